@@ -0,0 +1,28 @@
+// Package auth defines how the server authenticates logins independently of the connectors of its users.
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+)
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Authenticator decides which user a login is for. When the server is given one, it is consulted instead of the
+// connectors of the loaded users.
+type Authenticator interface {
+	// Authenticate returns the ID of the user the given credentials log in to, or ErrInvalidCredentials if they don't
+	// log in to any. Logins failing with other errors, for instance because the credentials couldn't be checked, are
+	// not counted as failed attempts.
+	Authenticate(ctx context.Context, username string, password []byte) (string, error)
+}
+
+// CertificateAuthenticator decides which user a TLS client certificate logs in to, for clients authenticating with
+// SASL EXTERNAL.
+type CertificateAuthenticator interface {
+	// AuthenticateCertificate returns the ID of the user the given verified certificate logs in to, or
+	// ErrInvalidCredentials if it doesn't log in to any. The authorization identity is what the client asked to log
+	// in as, or empty if the certificate should decide.
+	AuthenticateCertificate(ctx context.Context, cert *x509.Certificate, authzID string) (string, error)
+}
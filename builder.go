@@ -4,10 +4,12 @@ import (
 	"crypto/tls"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"time"
 
 	"github.com/ProtonMail/gluon/async"
+	"github.com/ProtonMail/gluon/auth"
 	"github.com/ProtonMail/gluon/db"
 	"github.com/ProtonMail/gluon/imap"
 	"github.com/ProtonMail/gluon/internal/backend"
@@ -18,29 +20,41 @@ import (
 	"github.com/ProtonMail/gluon/profiling"
 	"github.com/ProtonMail/gluon/reporter"
 	"github.com/ProtonMail/gluon/store"
+	"github.com/ProtonMail/gluon/trace"
 	"github.com/ProtonMail/gluon/version"
 	"github.com/sirupsen/logrus"
+	oteltrace "go.opentelemetry.io/otel/trace"
 )
 
 type serverBuilder struct {
 	dataDir              string
 	databaseDir          string
 	delim                string
-	loginJailTime        time.Duration
+	loginThrottle        limits.LoginThrottle
+	authenticator        auth.Authenticator
 	tlsConfig            *tls.Config
 	idleBulkTime         time.Duration
+	sessionTimeouts      limits.SessionTimeouts
+	connLimits           limits.Connections
 	inLogger             io.Writer
 	outLogger            io.Writer
+	traceSink            trace.Sink
+	traceRedaction       trace.Redaction
 	versionInfo          version.Info
 	cmdExecProfBuilder   profiling.CmdProfilerBuilder
 	storeBuilder         store.Builder
 	reporter             reporter.Reporter
 	disableParallelism   bool
+	rejectUnavailable    bool
+	flagConflictPolicy   imap.FlagConflictPolicy
+	searchIndex          bool
+	storeBudget          int64
 	imapLimits           limits.IMAP
 	uidValidityGenerator imap.UIDValidityGenerator
 	panicHandler         async.PanicHandler
 	dbCI                 db.ClientInterface
 	observabilitySender  observability.Sender
+	tracerProvider       oteltrace.TracerProvider
 }
 
 func newBuilder() (*serverBuilder, error) {
@@ -51,6 +65,8 @@ func newBuilder() (*serverBuilder, error) {
 		reporter:             &reporter.NullReporter{},
 		idleBulkTime:         500 * time.Millisecond,
 		imapLimits:           limits.DefaultLimits(),
+		loginThrottle:        limits.DefaultLoginThrottle(),
+		sessionTimeouts:      limits.DefaultSessionTimeouts(),
 		uidValidityGenerator: imap.DefaultEpochUIDValidityGenerator(),
 		panicHandler:         async.NoopPanicHandler{},
 		dbCI:                 sqlite3.NewBuilder(),
@@ -90,8 +106,14 @@ func (builder *serverBuilder) build() (*Server, error) {
 		builder.databaseDir,
 		builder.storeBuilder,
 		builder.delim,
-		builder.loginJailTime,
+		builder.loginThrottle,
+		builder.authenticator,
 		builder.imapLimits,
+		builder.rejectUnavailable,
+		builder.flagConflictPolicy,
+		builder.searchIndex,
+		builder.storeBudget,
+		builder.connLimits.MaxPerUser,
 		builder.panicHandler,
 		builder.dbCI,
 	)
@@ -112,11 +134,18 @@ func (builder *serverBuilder) build() (*Server, error) {
 		sessions:             make(map[int]*session.Session),
 		serveErrCh:           async.NewQueuedChannel[error](1, 1, builder.panicHandler, "server-err-ch"),
 		serveDoneCh:          make(chan struct{}),
+		drainCh:              make(chan struct{}),
+		listeners:            make(map[net.Listener]struct{}),
 		serveWG:              async.MakeWaitGroup(builder.panicHandler),
+		backendEventsDoneCh:  make(chan struct{}),
 		inLogger:             builder.inLogger,
 		outLogger:            builder.outLogger,
+		traceSink:            builder.traceSink,
+		traceRedaction:       builder.traceRedaction,
 		tlsConfig:            builder.tlsConfig,
 		idleBulkTime:         builder.idleBulkTime,
+		sessionTimeouts:      builder.sessionTimeouts,
+		connCounter:          newConnCounter(builder.connLimits),
 		storeBuilder:         builder.storeBuilder,
 		cmdExecProfBuilder:   builder.cmdExecProfBuilder,
 		versionInfo:          builder.versionInfo,
@@ -125,7 +154,10 @@ func (builder *serverBuilder) build() (*Server, error) {
 		uidValidityGenerator: builder.uidValidityGenerator,
 		panicHandler:         builder.panicHandler,
 		observabilitySender:  builder.observabilitySender,
+		tracerProvider:       builder.tracerProvider,
 	}
 
+	s.forwardBackendEvents()
+
 	return s, nil
 }
@@ -0,0 +1,117 @@
+package gluon
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/gluon/internal/response"
+	"github.com/ProtonMail/gluon/limits"
+	"github.com/ProtonMail/gluon/listener"
+	"github.com/ProtonMail/gluon/observability/metrics"
+)
+
+// rejectWriteTimeout bounds how long a refused connection waits for the client to read the BYE.
+const rejectWriteTimeout = 10 * time.Second
+
+// connCounter counts connected sessions, in total and per remote IP, to enforce the connection limits.
+type connCounter struct {
+	limits limits.Connections
+
+	total int
+	perIP map[string]int
+	lock  sync.Mutex
+}
+
+func newConnCounter(limits limits.Connections) *connCounter {
+	return &connCounter{
+		limits: limits,
+		perIP:  make(map[string]int),
+	}
+}
+
+// acquire counts a connection from the given address. If a limit is reached, the connection isn't counted and the
+// metric of the limit is returned.
+func (c *connCounter) acquire(addr net.Addr) (map[string]interface{}, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.limits.MaxTotal > 0 && c.total >= c.limits.MaxTotal {
+		return metrics.GenerateTooManyConnectionsMetric(), false
+	}
+
+	ip := remoteIP(addr)
+
+	if c.limits.MaxPerIP > 0 && c.perIP[ip] >= c.limits.MaxPerIP {
+		return metrics.GenerateTooManyConnectionsFromIPMetric(), false
+	}
+
+	c.total++
+	c.perIP[ip]++
+
+	return nil, true
+}
+
+// release stops counting a connection from the given address.
+func (c *connCounter) release(addr net.Addr) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ip := remoteIP(addr)
+
+	c.total--
+
+	if c.perIP[ip]--; c.perIP[ip] <= 0 {
+		delete(c.perIP, ip)
+	}
+}
+
+// admitConn decides whether a connection accepted from a listener with the given policy is served. If it isn't, it
+// returns the BYE to refuse it with and the metric of the refusal, if any. Admitted connections are counted until
+// released.
+func (s *Server) admitConn(conn net.Conn, policy listener.Policy) (response.Response, map[string]interface{}, bool) {
+	if s.isDraining() {
+		return response.Bye().WithItems(response.ItemUnavailable()).WithMessage("Server restarting"), nil, false
+	}
+
+	if policy.Security == listener.PlaintextLoopback && !isLoopback(conn.RemoteAddr()) {
+		bye := response.Bye().WithItems(response.ItemPrivacyRequired()).WithMessage("Plaintext connections are only accepted from this host")
+
+		return bye, nil, false
+	}
+
+	if metric, ok := s.connCounter.acquire(conn.RemoteAddr()); !ok {
+		bye := response.Bye().WithItems(response.ItemLimit()).WithMessage("Too many connections, please try again later")
+
+		return bye, metric, false
+	}
+
+	return nil, nil, true
+}
+
+// rejectConn tells the client why its connection is refused with the given BYE.
+func rejectConn(conn net.Conn, bye response.Response) error {
+	if err := conn.SetWriteDeadline(time.Now().Add(rejectWriteTimeout)); err != nil {
+		return err
+	}
+
+	if _, err := conn.Write([]byte(bye.String() + "\r\n")); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// remoteIP returns the IP connections from the given address are counted by, or the whole address if it has no port.
+func remoteIP(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+
+	return host
+}
@@ -63,3 +63,12 @@ type Connector interface {
 	// Close the connector will no longer be used and all resources should be closed/released.
 	Close(ctx context.Context) error
 }
+
+// UsernameOwner is implemented by connectors which know the usernames they can be logged in with. Logins with one of
+// those usernames are authorized by the connector owning it alone, instead of by each connector in turn.
+// Connectors which don't implement it are asked to authorize every login no owner accepted.
+type UsernameOwner interface {
+	// Usernames returns the usernames the connector can be logged in with. When they change, the connector must send
+	// an imap.UsernamesChanged update.
+	Usernames() []string
+}
@@ -31,7 +31,8 @@ type Dummy struct {
 	state *dummyState
 
 	// usernames holds usernames that can be used for authorization.
-	usernames []string
+	usernames     []string
+	usernamesLock sync.RWMutex
 
 	// password holds the password that can be used for authorization.
 	password []byte
@@ -59,6 +60,9 @@ type Dummy struct {
 	allowMessageCreateWithUnknownMailboxID bool
 
 	updatesAllowedToFail int32
+
+	// updatesLost is set while updates should be dropped instead of being queued.
+	updatesLost int32
 }
 
 func NewDummy(usernames []string, password []byte, period time.Duration, flags, permFlags, attrs imap.FlagSet) *Dummy {
@@ -113,9 +117,19 @@ func (conn *Dummy) Authorize(_ context.Context, username string, password []byte
 		return false
 	}
 
+	conn.usernamesLock.RLock()
+	defer conn.usernamesLock.RUnlock()
+
 	return slices.Contains(conn.usernames, username)
 }
 
+func (conn *Dummy) Usernames() []string {
+	conn.usernamesLock.RLock()
+	defer conn.usernamesLock.RUnlock()
+
+	return slices.Clone(conn.usernames)
+}
+
 func (conn *Dummy) GetUpdates() <-chan imap.Update {
 	return conn.updateCh
 }
@@ -345,6 +359,10 @@ func (conn *Dummy) pushUpdate(update imap.Update) {
 	conn.queueLock.Lock()
 	defer conn.queueLock.Unlock()
 
+	if atomic.LoadInt32(&conn.updatesLost) != 0 {
+		return
+	}
+
 	// We mimic the behaviour of the Proton sever. if several update to a message or mailbox happen in between
 	// two event polls, we only get one refresh update with the latest state.
 	switch update := update.(type) {
@@ -1,6 +1,8 @@
 package connector
 
 import (
+	"sync/atomic"
+
 	"github.com/ProtonMail/gluon/imap"
 )
 
@@ -40,6 +42,7 @@ func (conn *Dummy) MailboxCreated(mbox imap.Mailbox) error {
 	conn.state.mailboxes[mbox.ID] = &dummyMailbox{
 		mboxName:  mbox.Name,
 		exclusive: exclusive,
+		perms:     mbox.Permissions,
 	}
 
 	conn.pushUpdate(imap.NewMailboxCreated(mbox))
@@ -63,6 +66,14 @@ func (conn *Dummy) RenameMailbox(id imap.MailboxID, newName []string) error {
 	return nil
 }
 
+func (conn *Dummy) SetMailboxPermissions(id imap.MailboxID, perms imap.MailboxPermissions) error {
+	name := conn.state.setMailboxPermissions(id, perms)
+
+	conn.pushUpdate(imap.NewMailboxUpdated(id, name).WithPermissions(perms))
+
+	return nil
+}
+
 func (conn *Dummy) MessageCreated(message imap.Message, literal []byte, mboxIDs []imap.MailboxID) error {
 	parsedMessage, err := imap.NewParsedMessage(literal)
 	if err != nil {
@@ -215,6 +226,8 @@ func (conn *Dummy) MessageFlagged(messageID imap.MessageID, flagged bool) error
 }
 
 func (conn *Dummy) MessageDeleted(messageID imap.MessageID) error {
+	conn.state.deleteMessage(messageID)
+
 	conn.pushUpdate(imap.NewMessagesDeleted(messageID))
 
 	return nil
@@ -224,6 +237,27 @@ func (conn *Dummy) UIDValidityBumped() {
 	conn.pushUpdate(imap.NewUIDValidityBumped())
 }
 
+func (conn *Dummy) HealthChanged(health imap.ConnectorHealth, message string) {
+	conn.pushUpdate(imap.NewConnectorHealthChanged(health, message))
+}
+
+// SetUsernames replaces the usernames the connector can be logged in with.
+func (conn *Dummy) SetUsernames(usernames []string) {
+	conn.usernamesLock.Lock()
+	conn.usernames = usernames
+	conn.usernamesLock.Unlock()
+
+	conn.pushUpdate(imap.NewUsernamesChanged())
+}
+
+// WithUpdatesLost runs fn and discards every update it generates, simulating a remote event stream that was lost.
+func (conn *Dummy) WithUpdatesLost(fn func()) {
+	atomic.StoreInt32(&conn.updatesLost, 1)
+	defer atomic.StoreInt32(&conn.updatesLost, 0)
+
+	fn()
+}
+
 func (conn *Dummy) Flush() {
 	conn.ticker.Poll()
 }
@@ -0,0 +1,38 @@
+package connector
+
+import (
+	"context"
+
+	"github.com/ProtonMail/gluon/imap"
+)
+
+type dummySnapshot struct {
+	mailboxes []imap.Mailbox
+	messages  []SnapshotMessage
+}
+
+// GetSnapshot returns a snapshot of the current state of the dummy remote.
+func (conn *Dummy) GetSnapshot() Snapshot {
+	return &dummySnapshot{
+		mailboxes: conn.state.getMailboxes(),
+		messages:  conn.state.getSnapshotMessages(),
+	}
+}
+
+func (snapshot *dummySnapshot) GetMailboxes(_ context.Context) ([]imap.Mailbox, error) {
+	return snapshot.mailboxes, nil
+}
+
+func (snapshot *dummySnapshot) ForEachMessage(ctx context.Context, fn func(SnapshotMessage) error) error {
+	for _, message := range snapshot.messages {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := fn(message); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -24,6 +24,7 @@ type dummyState struct {
 type dummyMailbox struct {
 	mboxName  []string
 	exclusive bool
+	perms     imap.MailboxPermissions
 }
 
 type dummyMessage struct {
@@ -117,6 +118,15 @@ func (state *dummyState) renameMailbox(mboxID imap.MailboxID, name []string) {
 	state.mailboxes[mboxID].mboxName = name
 }
 
+func (state *dummyState) setMailboxPermissions(mboxID imap.MailboxID, perms imap.MailboxPermissions) []string {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	state.mailboxes[mboxID].perms = perms
+
+	return state.mailboxes[mboxID].mboxName
+}
+
 func (state *dummyState) deleteMailbox(mboxID imap.MailboxID) {
 	state.lock.Lock()
 	defer state.lock.Unlock()
@@ -137,6 +147,18 @@ func (state *dummyState) getMessages() []imap.Message {
 	})
 }
 
+func (state *dummyState) getSnapshotMessages() []SnapshotMessage {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	return xslices.Map(maps.Keys(state.messages), func(messageID imap.MessageID) SnapshotMessage {
+		return SnapshotMessage{
+			Message:    state.toMessage(messageID),
+			MailboxIDs: maps.Keys(state.messages[messageID].mboxIDs),
+		}
+	})
+}
+
 func (state *dummyState) getMessageCreatedUpdate(id imap.MessageID) (*imap.MessageCreated, error) {
 	state.lock.Lock()
 	defer state.lock.Unlock()
@@ -225,6 +247,13 @@ func (state *dummyState) createMessage(
 	return state.toMessage(messageID)
 }
 
+func (state *dummyState) deleteMessage(messageID imap.MessageID) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	delete(state.messages, messageID)
+}
+
 func (state *dummyState) addMessageToMailbox(messageID imap.MessageID, mboxID imap.MailboxID) {
 	state.lock.Lock()
 	defer state.lock.Unlock()
@@ -317,6 +346,7 @@ func (state *dummyState) toMailbox(mboxID imap.MailboxID) imap.Mailbox {
 		Flags:          state.flags,
 		PermanentFlags: state.permFlags,
 		Attributes:     state.attrs,
+		Permissions:    state.mailboxes[mboxID].perms,
 	}
 }
 
@@ -0,0 +1,25 @@
+package connector
+
+import (
+	"context"
+
+	"github.com/ProtonMail/gluon/imap"
+)
+
+// Snapshot describes the complete state of a user on the remote. It is used to resynchronize gluon's database with the
+// remote when the stream of updates returned by Connector.GetUpdates can no longer be trusted.
+type Snapshot interface {
+	// GetMailboxes returns all the mailboxes that exist on the remote.
+	GetMailboxes(ctx context.Context) ([]imap.Mailbox, error)
+
+	// ForEachMessage calls fn for every message that exists on the remote. Iteration stops at the first error
+	// returned by fn, which is then returned to the caller.
+	ForEachMessage(ctx context.Context, fn func(SnapshotMessage) error) error
+}
+
+// SnapshotMessage is the remote state of a single message.
+// The literal is not part of the snapshot; it is retrieved with Connector.GetMessageLiteral when gluon needs it.
+type SnapshotMessage struct {
+	Message    imap.Message
+	MailboxIDs []imap.MailboxID
+}
@@ -16,11 +16,41 @@ type Client interface {
 	Close() error
 }
 
+// VersionedClient is implemented by clients whose schema is versioned and can be migrated back to an older version.
+// Neither method runs migrations, so they can be used on a database which hasn't been initialized.
+type VersionedClient interface {
+	Client
+
+	// SchemaVersion returns the schema version of the database and the oldest version able to use it.
+	SchemaVersion(ctx context.Context) (version, minCompatibleVersion int, err error)
+
+	// Downgrade reverts migrations until the database is at the given schema version. It returns
+	// ErrMigrationNotReversible, leaving the database untouched, if one of the migrations can't be reverted.
+	Downgrade(ctx context.Context, version int) error
+}
+
 type ClientInterface interface {
 	New(path string, userID string) (Client, bool, error)
 	Delete(path string, userID string) error
 }
 
+// PassphraseClientInterface is implemented by ClientInterfaces which protect the databases they create with the user's
+// passphrase. It is used instead of New whenever the passphrase is known.
+type PassphraseClientInterface interface {
+	ClientInterface
+
+	NewWithPassphrase(path string, userID string, passphrase []byte) (Client, bool, error)
+}
+
+// RekeyableClient is implemented by clients which may protect their database with the user's passphrase.
+type RekeyableClient interface {
+	Client
+
+	// Rekey protects the database with the given passphrase from now on. It has no effect if the database isn't
+	// protected with a passphrase.
+	Rekey(ctx context.Context, passphrase []byte) error
+}
+
 func GetDeferredDeleteDBPath(dir string) string {
 	return filepath.Join(dir, "deferred_delete")
 }
@@ -0,0 +1,1169 @@
+// Package dbtest implements a conformance test suite for db.ClientInterface implementations.
+//
+// Embedders plugging in their own database backend should run TestClientInterface against it:
+//
+//	func TestConformance(t *testing.T) {
+//		dbtest.TestClientInterface(t, mydb.NewBuilder())
+//	}
+package dbtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/gluon/db"
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// TestClientInterface checks that databases created by ci behave the way gluon expects.
+// Every subtest uses a fresh database in its own temporary directory.
+func TestClientInterface(t *testing.T, ci db.ClientInterface) {
+	tests := []struct {
+		name string
+		test func(*testing.T, db.ClientInterface)
+	}{
+		{"New", testNew},
+		{"Delete", testDelete},
+		{"ConnectorSettings", testConnectorSettings},
+		{"SieveScript", testSieveScript},
+		{"CreateMailbox", testCreateMailbox},
+		{"GetOrCreateMailbox", testGetOrCreateMailbox},
+		{"UpdateMailbox", testUpdateMailbox},
+		{"AddFlagsToAllMailboxes", testAddFlagsToAllMailboxes},
+		{"DeleteMailbox", testDeleteMailbox},
+		{"DeletedSubscriptions", testDeletedSubscriptions},
+		{"CreateMessages", testCreateMessages},
+		{"MessageFlags", testMessageFlags},
+		{"MarkMessagesAsDeleted", testMarkMessagesAsDeleted},
+		{"UpdateRemoteMessageID", testUpdateRemoteMessageID},
+		{"DeleteMessages", testDeleteMessages},
+		{"MailboxMessages", testMailboxMessages},
+		{"CreateMessageAndAddToMailbox", testCreateMessageAndAddToMailbox},
+		{"MailboxMessageFlags", testMailboxMessageFlags},
+		{"RemoveMessagesFromMailbox", testRemoveMessagesFromMailbox},
+		{"BumpMailboxUIDNext", testBumpMailboxUIDNext},
+		{"HeaderFields", testHeaderFields},
+		{"LiteralHashes", testLiteralHashes},
+		{"SearchMessageHeaders", testSearchMessageHeaders},
+		{"WriteRollback", testWriteRollback},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, ci)
+		})
+	}
+}
+
+func testNew(t *testing.T, ci db.ClientInterface) {
+	dir, userID := t.TempDir(), uuid.NewString()
+
+	client := openClient(t, ci, dir, userID, true)
+
+	write(t, client, func(ctx context.Context, tx db.Transaction) {
+		createMailbox(ctx, t, tx, "mbox-1", "Folder")
+	})
+
+	require.NoError(t, client.Close())
+
+	// Reopening the database keeps its contents.
+	client = openClient(t, ci, dir, userID, false)
+
+	read(t, client, func(ctx context.Context, rd db.ReadOnly) {
+		exists, err := rd.MailboxExistsWithRemoteID(ctx, "mbox-1")
+		require.NoError(t, err)
+		require.True(t, exists)
+	})
+
+	// Databases of other users are separate.
+	other := openClient(t, ci, dir, uuid.NewString(), true)
+
+	read(t, other, func(ctx context.Context, rd db.ReadOnly) {
+		count, err := rd.GetMailboxCount(ctx)
+		require.NoError(t, err)
+		require.Zero(t, count)
+	})
+}
+
+func testDelete(t *testing.T, ci db.ClientInterface) {
+	dir, userID := t.TempDir(), uuid.NewString()
+
+	client := openClient(t, ci, dir, userID, true)
+
+	write(t, client, func(ctx context.Context, tx db.Transaction) {
+		createMailbox(ctx, t, tx, "mbox-1", "Folder")
+	})
+
+	require.NoError(t, client.Close())
+	require.NoError(t, ci.Delete(dir, userID))
+
+	client = openClient(t, ci, dir, userID, true)
+
+	read(t, client, func(ctx context.Context, rd db.ReadOnly) {
+		count, err := rd.GetMailboxCount(ctx)
+		require.NoError(t, err)
+		require.Zero(t, count)
+	})
+}
+
+func testConnectorSettings(t *testing.T, ci db.ClientInterface) {
+	client := newClient(t, ci)
+
+	read(t, client, func(ctx context.Context, rd db.ReadOnly) {
+		_, ok, err := rd.GetConnectorSettings(ctx)
+		require.NoError(t, err)
+		require.False(t, ok)
+	})
+
+	write(t, client, func(ctx context.Context, tx db.Transaction) {
+		require.NoError(t, tx.StoreConnectorSettings(ctx, "settings"))
+	})
+
+	read(t, client, func(ctx context.Context, rd db.ReadOnly) {
+		settings, ok, err := rd.GetConnectorSettings(ctx)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, "settings", settings)
+	})
+}
+
+func testSieveScript(t *testing.T, ci db.ClientInterface) {
+	client := newClient(t, ci)
+
+	read(t, client, func(ctx context.Context, rd db.ReadOnly) {
+		script, err := rd.GetSieveScript(ctx)
+		require.NoError(t, err)
+		require.Empty(t, script)
+	})
+
+	write(t, client, func(ctx context.Context, tx db.Transaction) {
+		require.NoError(t, tx.StoreSieveScript(ctx, "keep;"))
+	})
+
+	read(t, client, func(ctx context.Context, rd db.ReadOnly) {
+		script, err := rd.GetSieveScript(ctx)
+		require.NoError(t, err)
+		require.Equal(t, "keep;", script)
+	})
+}
+
+func testCreateMailbox(t *testing.T, ci db.ClientInterface) {
+	client := newClient(t, ci)
+
+	var mbox *db.Mailbox
+
+	write(t, client, func(ctx context.Context, tx db.Transaction) {
+		var err error
+
+		mbox, err = tx.CreateMailbox(ctx,
+			"mbox-1",
+			"Folder",
+			imap.NewFlagSet(imap.FlagSeen, imap.FlagFlagged),
+			imap.NewFlagSet(imap.FlagSeen),
+			imap.NewFlagSet(imap.AttrNoInferiors),
+			imap.PermRead,
+			42,
+		)
+		require.NoError(t, err)
+		require.Equal(t, imap.MailboxID("mbox-1"), mbox.RemoteID)
+		require.Equal(t, "Folder", mbox.Name)
+		require.Equal(t, imap.UID(42), mbox.UIDValidity)
+		require.Equal(t, imap.PermRead, mbox.Permissions)
+		require.True(t, mbox.Subscribed)
+
+		// Names and remote IDs are unique.
+		_, err = tx.CreateMailbox(ctx, "mbox-2", "Folder", imap.NewFlagSet(), imap.NewFlagSet(), imap.NewFlagSet(), 0, 1)
+		require.Error(t, err)
+	})
+
+	write(t, client, func(ctx context.Context, tx db.Transaction) {
+		_, err := tx.CreateMailbox(ctx, "mbox-1", "Other", imap.NewFlagSet(), imap.NewFlagSet(), imap.NewFlagSet(), 0, 1)
+		require.Error(t, err)
+	}, errIgnored)
+
+	write(t, client, func(ctx context.Context, tx db.Transaction) {
+		createMailbox(ctx, t, tx, "mbox-2", "Other")
+	})
+
+	read(t, client, func(ctx context.Context, rd db.ReadOnly) {
+		requireMailbox := func(got *db.Mailbox, err error) {
+			require.NoError(t, err)
+			require.Equal(t, *mbox, *got)
+		}
+
+		requireMailbox(rd.GetMailboxByID(ctx, mbox.ID))
+		requireMailbox(rd.GetMailboxByName(ctx, "Folder"))
+		requireMailbox(rd.GetMailboxByRemoteID(ctx, "mbox-1"))
+
+		_, err := rd.GetMailboxByID(ctx, mbox.ID+1000)
+		require.ErrorIs(t, err, db.ErrNotFound)
+
+		_, err = rd.GetMailboxByName(ctx, "Missing")
+		require.ErrorIs(t, err, db.ErrNotFound)
+
+		_, err = rd.GetMailboxByRemoteID(ctx, "missing")
+		require.ErrorIs(t, err, db.ErrNotFound)
+
+		requireTrue(t)(rd.MailboxExistsWithID(ctx, mbox.ID))
+		requireTrue(t)(rd.MailboxExistsWithRemoteID(ctx, "mbox-1"))
+		requireTrue(t)(rd.MailboxExistsWithName(ctx, "Folder"))
+		requireFalse(t)(rd.MailboxExistsWithID(ctx, mbox.ID+1000))
+		requireFalse(t)(rd.MailboxExistsWithRemoteID(ctx, "missing"))
+		requireFalse(t)(rd.MailboxExistsWithName(ctx, "Missing"))
+
+		id, err := rd.GetMailboxIDFromRemoteID(ctx, "mbox-1")
+		require.NoError(t, err)
+		require.Equal(t, mbox.ID, id)
+
+		name, err := rd.GetMailboxName(ctx, mbox.ID)
+		require.NoError(t, err)
+		require.Equal(t, "Folder", name)
+
+		name, err = rd.GetMailboxNameWithRemoteID(ctx, "mbox-1")
+		require.NoError(t, err)
+		require.Equal(t, "Folder", name)
+
+		flags, err := rd.GetMailboxFlags(ctx, mbox.ID)
+		require.NoError(t, err)
+		require.True(t, flags.Equals(imap.NewFlagSet(imap.FlagSeen, imap.FlagFlagged)))
+
+		permFlags, err := rd.GetMailboxPermanentFlags(ctx, mbox.ID)
+		require.NoError(t, err)
+		require.True(t, permFlags.Equals(imap.NewFlagSet(imap.FlagSeen)))
+
+		attrs, err := rd.GetMailboxAttributes(ctx, mbox.ID)
+		require.NoError(t, err)
+		require.True(t, attrs.Equals(imap.NewFlagSet(imap.AttrNoInferiors)))
+
+		count, err := rd.GetMailboxCount(ctx)
+		require.NoError(t, err)
+		require.Equal(t, 2, count)
+
+		withAttrs, err := rd.GetAllMailboxesWithAttr(ctx)
+		require.NoError(t, err)
+		require.Len(t, withAttrs, 2)
+		require.Equal(t, *mbox, withAttrs[0].Mailbox)
+		require.True(t, withAttrs[0].Attributes.Equals(imap.NewFlagSet(imap.AttrNoInferiors)))
+
+		remoteIDs, err := rd.GetAllMailboxesAsRemoteIDs(ctx)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []imap.MailboxID{"mbox-1", "mbox-2"}, remoteIDs)
+
+		namesAndIDs, err := rd.GetAllMailboxesNameAndRemoteID(ctx)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []db.MailboxNameAndRemoteID{
+			{Name: "Folder", RemoteID: "mbox-1"},
+			{Name: "Other", RemoteID: "mbox-2"},
+		}, namesAndIDs)
+
+		translated, err := rd.MailboxTranslateRemoteIDs(ctx, []imap.MailboxID{"mbox-1", "missing"})
+		require.NoError(t, err)
+		require.Equal(t, []imap.InternalMailboxID{mbox.ID}, translated)
+
+		messageCount, uid, err := rd.GetMailboxMessageCountAndUID(ctx, mbox.ID)
+		require.NoError(t, err)
+		require.Zero(t, messageCount)
+		require.Equal(t, imap.UID(1), uid)
+	})
+}
+
+func testGetOrCreateMailbox(t *testing.T, ci db.ClientInterface) {
+	client := newClient(t, ci)
+
+	write(t, client, func(ctx context.Context, tx db.Transaction) {
+		created, err := tx.GetOrCreateMailboxAlt(ctx, imap.Mailbox{
+			ID:             "mbox-1",
+			Name:           []string{"Folder", "Child"},
+			Flags:          imap.NewFlagSet(imap.FlagSeen),
+			PermanentFlags: imap.NewFlagSet(imap.FlagSeen),
+			Attributes:     imap.NewFlagSet(),
+			Permissions:    imap.PermRead | imap.PermInsert,
+		}, "/", 1)
+		require.NoError(t, err)
+		require.Equal(t, "Folder/Child", created.Name)
+		require.Equal(t, imap.PermRead|imap.PermInsert, created.Permissions)
+
+		existing, err := tx.GetOrCreateMailbox(ctx, "mbox-1", "Ignored", imap.NewFlagSet(), imap.NewFlagSet(), imap.NewFlagSet(), 0, 2)
+		require.NoError(t, err)
+		require.Equal(t, *created, *existing)
+
+		require.NoError(t, tx.CreateMailboxIfNotExists(ctx, imap.Mailbox{ID: "mbox-1", Name: []string{"Ignored"}}, "/", 3))
+		require.NoError(t, tx.CreateMailboxIfNotExists(ctx, imap.Mailbox{
+			ID:             "mbox-2",
+			Name:           []string{"Other"},
+			Flags:          imap.NewFlagSet(),
+			PermanentFlags: imap.NewFlagSet(),
+			Attributes:     imap.NewFlagSet(),
+		}, "/", 3))
+
+		count, err := tx.GetMailboxCount(ctx)
+		require.NoError(t, err)
+		require.Equal(t, 2, count)
+	})
+}
+
+func testUpdateMailbox(t *testing.T, ci db.ClientInterface) {
+	client := newClient(t, ci)
+
+	write(t, client, func(ctx context.Context, tx db.Transaction) {
+		mbox := createMailbox(ctx, t, tx, "mbox-1", "Folder")
+		createMailbox(ctx, t, tx, "mbox-2", "Other")
+
+		require.NoError(t, tx.RenameMailboxWithRemoteID(ctx, "mbox-1", "Renamed"))
+		require.Error(t, tx.RenameMailboxWithRemoteID(ctx, "missing", "Renamed"))
+
+		require.NoError(t, tx.SetMailboxPermissionsWithRemoteID(ctx, "mbox-1", imap.PermRead))
+		require.Error(t, tx.SetMailboxPermissionsWithRemoteID(ctx, "missing", imap.PermRead))
+
+		require.NoError(t, tx.UpdateRemoteMailboxID(ctx, mbox.ID, "mbox-3"))
+		require.Error(t, tx.UpdateRemoteMailboxID(ctx, mbox.ID+1000, "mbox-4"))
+
+		require.NoError(t, tx.SetMailboxUIDValidity(ctx, mbox.ID, 100))
+		require.Error(t, tx.SetMailboxUIDValidity(ctx, mbox.ID+1000, 100))
+
+		require.NoError(t, tx.SetMailboxSubscribed(ctx, mbox.ID, false))
+
+		updated, err := tx.GetMailboxByID(ctx, mbox.ID)
+		require.NoError(t, err)
+		require.Equal(t, db.Mailbox{
+			ID:          mbox.ID,
+			RemoteID:    "mbox-3",
+			Name:        "Renamed",
+			UIDValidity: 100,
+			Subscribed:  false,
+			Permissions: imap.PermRead,
+		}, *updated)
+	})
+}
+
+func testAddFlagsToAllMailboxes(t *testing.T, ci db.ClientInterface) {
+	client := newClient(t, ci)
+
+	write(t, client, func(ctx context.Context, tx db.Transaction) {
+		mbox1 := createMailbox(ctx, t, tx, "mbox-1", "Folder")
+		mbox2 := createMailbox(ctx, t, tx, "mbox-2", "Other")
+
+		require.NoError(t, tx.AddFlagsToAllMailboxes(ctx, imap.FlagSeen, imap.XFlagDollarForwarded))
+		require.NoError(t, tx.AddPermFlagsToAllMailboxes(ctx, imap.FlagSeen, imap.XFlagDollarForwarded))
+
+		// Adding flags which are already present has no effect.
+		require.NoError(t, tx.AddFlagsToAllMailboxes(ctx, imap.FlagSeen))
+
+		for _, mbox := range []*db.Mailbox{mbox1, mbox2} {
+			flags, err := tx.GetMailboxFlags(ctx, mbox.ID)
+			require.NoError(t, err)
+			require.True(t, flags.Equals(imap.NewFlagSet(imap.FlagSeen, imap.XFlagDollarForwarded)))
+
+			permFlags, err := tx.GetMailboxPermanentFlags(ctx, mbox.ID)
+			require.NoError(t, err)
+			require.True(t, permFlags.Equals(imap.NewFlagSet(imap.FlagSeen, imap.XFlagDollarForwarded)))
+		}
+	})
+}
+
+func testDeleteMailbox(t *testing.T, ci db.ClientInterface) {
+	client := newClient(t, ci)
+
+	write(t, client, func(ctx context.Context, tx db.Transaction) {
+		mbox := createMailbox(ctx, t, tx, "mbox-1", "Folder")
+		msg := createMessage(ctx, t, tx, "msg-1")
+
+		_, err := tx.AddMessagesToMailbox(ctx, mbox.ID, []db.MessageIDPair{msg})
+		require.NoError(t, err)
+
+		require.NoError(t, tx.DeleteMailboxWithRemoteID(ctx, "mbox-1"))
+
+		// Deleting a mailbox which doesn't exist is not an error.
+		require.NoError(t, tx.DeleteMailboxWithRemoteID(ctx, "mbox-1"))
+
+		requireFalse(t)(tx.MailboxExistsWithRemoteID(ctx, "mbox-1"))
+
+		// The messages of the mailbox remain.
+		requireTrue(t)(tx.MessageExists(ctx, msg.InternalID))
+
+		mboxIDs, err := tx.GetMessageMailboxIDs(ctx, msg.InternalID)
+		require.NoError(t, err)
+		require.Empty(t, mboxIDs)
+	})
+}
+
+func testDeletedSubscriptions(t *testing.T, ci db.ClientInterface) {
+	client := newClient(t, ci)
+
+	write(t, client, func(ctx context.Context, tx db.Transaction) {
+		mbox1 := createMailbox(ctx, t, tx, "mbox-1", "Subscribed")
+		mbox2 := createMailbox(ctx, t, tx, "mbox-2", "Unsubscribed")
+
+		require.NoError(t, tx.SetMailboxSubscribed(ctx, mbox2.ID, false))
+
+		require.NoError(t, tx.DeleteMailboxWithRemoteID(ctx, mbox1.RemoteID))
+		require.NoError(t, tx.DeleteMailboxWithRemoteID(ctx, mbox2.RemoteID))
+
+		// Only subscribed mailboxes are remembered once deleted.
+		deleted, err := tx.GetDeletedSubscriptionSet(ctx)
+		require.NoError(t, err)
+		require.Equal(t, map[imap.MailboxID]*db.DeletedSubscription{
+			"mbox-1": {Name: "Subscribed", RemoteID: "mbox-1"},
+		}, deleted)
+
+		// Adding a subscription with an existing name replaces its remote ID.
+		require.NoError(t, tx.AddDeletedSubscription(ctx, "Subscribed", "mbox-3"))
+
+		deleted, err = tx.GetDeletedSubscriptionSet(ctx)
+		require.NoError(t, err)
+		require.Equal(t, map[imap.MailboxID]*db.DeletedSubscription{
+			"mbox-3": {Name: "Subscribed", RemoteID: "mbox-3"},
+		}, deleted)
+
+		count, err := tx.RemoveDeletedSubscriptionWithName(ctx, "Subscribed")
+		require.NoError(t, err)
+		require.Equal(t, 1, count)
+
+		count, err = tx.RemoveDeletedSubscriptionWithName(ctx, "Subscribed")
+		require.NoError(t, err)
+		require.Zero(t, count)
+	})
+}
+
+func testCreateMessages(t *testing.T, ci db.ClientInterface) {
+	client := newClient(t, ci)
+
+	date := time.Date(2023, 5, 17, 10, 30, 0, 0, time.UTC)
+	id1, id2 := imap.NewInternalMessageID(), imap.NewInternalMessageID()
+
+	write(t, client, func(ctx context.Context, tx db.Transaction) {
+		require.NoError(t, tx.CreateMessages(ctx,
+			&db.CreateMessageReq{
+				Message:     imap.Message{ID: "msg-1", Flags: imap.NewFlagSet(imap.FlagSeen, imap.FlagDraft), Date: date},
+				InternalID:  id1,
+				LiteralSize: 123,
+				Body:        "body",
+				Structure:   "structure",
+				Envelope:    "envelope",
+			},
+			&db.CreateMessageReq{
+				Message:    imap.Message{ID: "msg-2", Flags: imap.NewFlagSet(), Date: date},
+				InternalID: id2,
+			},
+		))
+	})
+
+	// Remote IDs are unique.
+	write(t, client, func(ctx context.Context, tx db.Transaction) {
+		require.Error(t, tx.CreateMessages(ctx, &db.CreateMessageReq{
+			Message:    imap.Message{ID: "msg-1", Flags: imap.NewFlagSet(), Date: date},
+			InternalID: imap.NewInternalMessageID(),
+		}))
+	}, errIgnored)
+
+	read(t, client, func(ctx context.Context, rd db.ReadOnly) {
+		requireTrue(t)(rd.MessageExists(ctx, id1))
+		requireTrue(t)(rd.MessageExistsWithRemoteID(ctx, "msg-1"))
+		requireFalse(t)(rd.MessageExists(ctx, imap.NewInternalMessageID()))
+		requireFalse(t)(rd.MessageExistsWithRemoteID(ctx, "missing"))
+
+		msg, err := rd.GetMessageNoEdges(ctx, id1)
+		require.NoError(t, err)
+		require.Equal(t, id1, msg.ID)
+		require.Equal(t, imap.MessageID("msg-1"), msg.RemoteID)
+		require.True(t, date.Equal(msg.Date))
+		require.Equal(t, 123, msg.Size)
+		require.Equal(t, "body", msg.Body)
+		require.Equal(t, "structure", msg.BodyStructure)
+		require.Equal(t, "envelope", msg.Envelope)
+		require.False(t, msg.Deleted)
+
+		_, err = rd.GetMessageNoEdges(ctx, imap.NewInternalMessageID())
+		require.ErrorIs(t, err, db.ErrNotFound)
+
+		imported, err := rd.GetImportedMessageData(ctx, id1)
+		require.NoError(t, err)
+		require.Equal(t, imap.MessageID("msg-1"), imported.RemoteID)
+		require.True(t, imported.Flags.Equals(imap.NewFlagSet(imap.FlagSeen, imap.FlagDraft)))
+
+		count, err := rd.GetTotalMessageCount(ctx)
+		require.NoError(t, err)
+		require.Equal(t, 2, count)
+
+		remoteID, err := rd.GetMessageRemoteID(ctx, id1)
+		require.NoError(t, err)
+		require.Equal(t, imap.MessageID("msg-1"), remoteID)
+
+		internalID, err := rd.GetMessageIDFromRemoteID(ctx, "msg-2")
+		require.NoError(t, err)
+		require.Equal(t, id2, internalID)
+
+		_, err = rd.GetMessageIDFromRemoteID(ctx, "missing")
+		require.ErrorIs(t, err, db.ErrNotFound)
+
+		msgDate, size, err := rd.GetMessageDateAndSize(ctx, id1)
+		require.NoError(t, err)
+		require.True(t, date.Equal(msgDate))
+		require.Equal(t, 123, size)
+
+		ids, err := rd.GetAllMessagesIDsAsMap(ctx)
+		require.NoError(t, err)
+		require.Equal(t, map[imap.InternalMessageID]struct{}{id1: {}, id2: {}}, ids)
+	})
+}
+
+func testMessageFlags(t *testing.T, ci db.ClientInterface) {
+	client := newClient(t, ci)
+
+	write(t, client, func(ctx context.Context, tx db.Transaction) {
+		msg1 := createMessage(ctx, t, tx, "msg-1")
+		msg2 := createMessage(ctx, t, tx, "msg-2")
+		ids := []imap.InternalMessageID{msg1.InternalID, msg2.InternalID}
+
+		requireFlags := func(want map[imap.InternalMessageID]imap.FlagSet) {
+			flags, err := tx.GetMessagesFlags(ctx, append(ids, imap.NewInternalMessageID()))
+			require.NoError(t, err)
+			require.Len(t, flags, len(want))
+
+			for _, f := range flags {
+				require.Contains(t, want, f.ID)
+				require.Equal(t, want[f.ID].Len(), f.FlagSet.Len())
+				require.True(t, f.FlagSet.ContainsAll(want[f.ID].ToSliceUnsorted()...))
+			}
+		}
+
+		require.NoError(t, tx.AddFlagToMessages(ctx, ids, imap.FlagSeen))
+		require.NoError(t, tx.AddFlagToMessages(ctx, ids, imap.FlagSeen))
+		require.NoError(t, tx.AddFlagToMessages(ctx, ids[:1], imap.FlagFlagged))
+
+		requireFlags(map[imap.InternalMessageID]imap.FlagSet{
+			msg1.InternalID: imap.NewFlagSet(imap.FlagSeen, imap.FlagFlagged),
+			msg2.InternalID: imap.NewFlagSet(imap.FlagSeen),
+		})
+
+		require.NoError(t, tx.RemoveFlagFromMessages(ctx, ids, imap.FlagSeen))
+
+		requireFlags(map[imap.InternalMessageID]imap.FlagSet{
+			msg1.InternalID: imap.NewFlagSet(imap.FlagFlagged),
+			msg2.InternalID: imap.NewFlagSet(),
+		})
+
+		require.NoError(t, tx.SetFlagsOnMessages(ctx, ids, imap.NewFlagSet(imap.FlagAnswered, imap.FlagDraft)))
+
+		requireFlags(map[imap.InternalMessageID]imap.FlagSet{
+			msg1.InternalID: imap.NewFlagSet(imap.FlagAnswered, imap.FlagDraft),
+			msg2.InternalID: imap.NewFlagSet(imap.FlagAnswered, imap.FlagDraft),
+		})
+
+		require.NoError(t, tx.SetFlagsOnMessages(ctx, ids, imap.NewFlagSet()))
+
+		requireFlags(map[imap.InternalMessageID]imap.FlagSet{
+			msg1.InternalID: imap.NewFlagSet(),
+			msg2.InternalID: imap.NewFlagSet(),
+		})
+	})
+}
+
+func testMarkMessagesAsDeleted(t *testing.T, ci db.ClientInterface) {
+	client := newClient(t, ci)
+
+	write(t, client, func(ctx context.Context, tx db.Transaction) {
+		msg1 := createMessage(ctx, t, tx, "msg-1")
+		msg2 := createMessage(ctx, t, tx, "msg-2")
+		msg3 := createMessage(ctx, t, tx, "msg-3")
+		createMessage(ctx, t, tx, "msg-4")
+
+		require.NoError(t, tx.MarkMessageAsDeleted(ctx, msg1.InternalID))
+		require.NoError(t, tx.MarkMessageAsDeletedWithRemoteID(ctx, msg2.RemoteID))
+		require.NoError(t, tx.MarkMessageAsDeletedAndAssignRandomRemoteID(ctx, msg3.InternalID))
+
+		for _, id := range []imap.InternalMessageID{msg1.InternalID, msg2.InternalID, msg3.InternalID} {
+			requireTrue(t)(tx.GetMessageDeletedFlag(ctx, id))
+		}
+
+		// The remote ID is freed for a new message.
+		requireFalse(t)(tx.MessageExistsWithRemoteID(ctx, msg3.RemoteID))
+
+		ids, err := tx.GetMessageIDsMarkedAsDelete(ctx)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []imap.InternalMessageID{msg1.InternalID, msg2.InternalID, msg3.InternalID}, ids)
+
+		_, err = tx.GetMessageDeletedFlag(ctx, imap.NewInternalMessageID())
+		require.ErrorIs(t, err, db.ErrNotFound)
+	})
+}
+
+func testUpdateRemoteMessageID(t *testing.T, ci db.ClientInterface) {
+	client := newClient(t, ci)
+
+	write(t, client, func(ctx context.Context, tx db.Transaction) {
+		msg := createMessage(ctx, t, tx, "msg-1")
+
+		require.NoError(t, tx.UpdateRemoteMessageID(ctx, msg.InternalID, "msg-2"))
+		require.Error(t, tx.UpdateRemoteMessageID(ctx, imap.NewInternalMessageID(), "msg-3"))
+
+		remoteID, err := tx.GetMessageRemoteID(ctx, msg.InternalID)
+		require.NoError(t, err)
+		require.Equal(t, imap.MessageID("msg-2"), remoteID)
+	})
+}
+
+func testDeleteMessages(t *testing.T, ci db.ClientInterface) {
+	client := newClient(t, ci)
+
+	write(t, client, func(ctx context.Context, tx db.Transaction) {
+		msg1 := createMessage(ctx, t, tx, "msg-1")
+		msg2 := createMessage(ctx, t, tx, "msg-2")
+
+		require.NoError(t, tx.AddFlagToMessages(ctx, []imap.InternalMessageID{msg1.InternalID}, imap.FlagSeen))
+		require.NoError(t, tx.DeleteMessages(ctx, []imap.InternalMessageID{msg1.InternalID}))
+
+		requireFalse(t)(tx.MessageExists(ctx, msg1.InternalID))
+		requireTrue(t)(tx.MessageExists(ctx, msg2.InternalID))
+
+		_, err := tx.GetMessageHeaderFields(ctx, msg1.InternalID)
+		require.ErrorIs(t, err, db.ErrNotFound)
+
+		// The flags of deleted messages go with them.
+		orphaned, err := tx.GetOrphanedFlagMessageIDs(ctx)
+		require.NoError(t, err)
+		require.Empty(t, orphaned)
+
+		// A new message may reuse the remote ID of a deleted one.
+		createMessage(ctx, t, tx, "msg-1")
+	})
+}
+
+func testMailboxMessages(t *testing.T, ci db.ClientInterface) {
+	client := newClient(t, ci)
+
+	write(t, client, func(ctx context.Context, tx db.Transaction) {
+		mbox := createMailbox(ctx, t, tx, "mbox-1", "Folder")
+		other := createMailbox(ctx, t, tx, "mbox-2", "Other")
+		msg1 := createMessage(ctx, t, tx, "msg-1")
+		msg2 := createMessage(ctx, t, tx, "msg-2")
+		msg3 := createMessage(ctx, t, tx, "msg-3")
+
+		require.NoError(t, tx.AddFlagToMessages(ctx, []imap.InternalMessageID{msg1.InternalID}, imap.FlagSeen))
+
+		added, err := tx.AddMessagesToMailbox(ctx, mbox.ID, []db.MessageIDPair{msg1, msg2})
+		require.NoError(t, err)
+		require.Len(t, added, 2)
+
+		for i, msg := range []db.MessageIDPair{msg1, msg2} {
+			require.Equal(t, msg.InternalID, added[i].InternalID)
+			require.Equal(t, msg.RemoteID, added[i].RemoteID)
+			require.Equal(t, imap.UID(i+1), added[i].UID)
+			require.True(t, added[i].Recent)
+			require.False(t, added[i].Deleted)
+		}
+
+		require.True(t, added[0].GetFlagSet().Equals(imap.NewFlagSet(imap.FlagSeen, imap.FlagRecent)))
+
+		// A message can only be added to a mailbox once.
+		_, err = tx.AddMessagesToMailbox(ctx, mbox.ID, []db.MessageIDPair{msg1})
+		require.Error(t, err)
+
+		_, err = tx.AddMessagesToMailbox(ctx, other.ID, []db.MessageIDPair{msg1, msg3})
+		require.NoError(t, err)
+
+		pairs, err := tx.GetMailboxMessageIDPairs(ctx, mbox.ID)
+		require.NoError(t, err)
+		require.Equal(t, []db.MessageIDPair{msg1, msg2}, pairs)
+
+		count, err := tx.GetMailboxMessageCount(ctx, mbox.ID)
+		require.NoError(t, err)
+		require.Equal(t, 2, count)
+
+		count, err = tx.GetMailboxMessageCountWithRemoteID(ctx, "mbox-2")
+		require.NoError(t, err)
+		require.Equal(t, 2, count)
+
+		count, uid, err := tx.GetMailboxMessageCountAndUID(ctx, mbox.ID)
+		require.NoError(t, err)
+		require.Equal(t, 2, count)
+		require.Equal(t, imap.UID(3), uid)
+
+		mboxIDs, err := tx.GetMessageMailboxIDs(ctx, msg1.InternalID)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []imap.InternalMailboxID{mbox.ID, other.ID}, mboxIDs)
+
+		contained, err := tx.MailboxFilterContains(ctx, mbox.ID, []db.MessageIDPair{msg1, msg3})
+		require.NoError(t, err)
+		require.Equal(t, []imap.InternalMessageID{msg1.InternalID}, contained)
+	})
+}
+
+func testCreateMessageAndAddToMailbox(t *testing.T, ci db.ClientInterface) {
+	client := newClient(t, ci)
+
+	write(t, client, func(ctx context.Context, tx db.Transaction) {
+		mbox := createMailbox(ctx, t, tx, "mbox-1", "Folder")
+		msg := createMessage(ctx, t, tx, "msg-1")
+
+		_, err := tx.AddMessagesToMailbox(ctx, mbox.ID, []db.MessageIDPair{msg})
+		require.NoError(t, err)
+
+		id := imap.NewInternalMessageID()
+
+		uid, flags, err := tx.CreateMessageAndAddToMailbox(ctx, mbox.ID, &db.CreateMessageReq{
+			Message:    imap.Message{ID: "msg-2", Flags: imap.NewFlagSet(imap.FlagSeen), Date: time.Now()},
+			InternalID: id,
+		})
+		require.NoError(t, err)
+		require.Equal(t, imap.UID(2), uid)
+		require.True(t, flags.Equals(imap.NewFlagSet(imap.FlagSeen, imap.FlagRecent)))
+
+		requireTrue(t)(tx.MessageExists(ctx, id))
+
+		mboxIDs, err := tx.GetMessageMailboxIDs(ctx, id)
+		require.NoError(t, err)
+		require.Equal(t, []imap.InternalMailboxID{mbox.ID}, mboxIDs)
+	})
+}
+
+func testMailboxMessageFlags(t *testing.T, ci db.ClientInterface) {
+	client := newClient(t, ci)
+
+	write(t, client, func(ctx context.Context, tx db.Transaction) {
+		mbox := createMailbox(ctx, t, tx, "mbox-1", "Folder")
+		msg1 := createMessage(ctx, t, tx, "msg-1")
+		msg2 := createMessage(ctx, t, tx, "msg-2")
+
+		require.NoError(t, tx.AddFlagToMessages(ctx, []imap.InternalMessageID{msg2.InternalID}, imap.FlagFlagged))
+
+		_, err := tx.AddMessagesToMailbox(ctx, mbox.ID, []db.MessageIDPair{msg1, msg2})
+		require.NoError(t, err)
+
+		recent, err := tx.GetMailboxRecentCount(ctx, mbox.ID)
+		require.NoError(t, err)
+		require.Equal(t, 2, recent)
+
+		require.NoError(t, tx.ClearRecentFlagInMailboxOnMessage(ctx, mbox.ID, msg1.InternalID))
+
+		recent, err = tx.GetMailboxRecentCount(ctx, mbox.ID)
+		require.NoError(t, err)
+		require.Equal(t, 1, recent)
+
+		require.NoError(t, tx.SetMailboxMessagesDeletedFlag(ctx, mbox.ID, []imap.InternalMessageID{msg2.InternalID}, true))
+
+		snapshot, err := tx.GetMailboxMessageForNewSnapshot(ctx, mbox.ID)
+		require.NoError(t, err)
+		require.Len(t, snapshot, 2)
+
+		require.Equal(t, msg1.InternalID, snapshot[0].InternalID)
+		require.Equal(t, msg1.RemoteID, snapshot[0].RemoteID)
+		require.Equal(t, imap.UID(1), snapshot[0].UID)
+		require.True(t, snapshot[0].GetFlagSet().Equals(imap.NewFlagSet()))
+
+		require.Equal(t, msg2.InternalID, snapshot[1].InternalID)
+		require.Equal(t, imap.UID(2), snapshot[1].UID)
+		require.True(t, snapshot[1].GetFlagSet().Equals(imap.NewFlagSet(imap.FlagFlagged, imap.FlagRecent, imap.FlagDeleted)))
+
+		require.NoError(t, tx.ClearRecentFlagsInMailbox(ctx, mbox.ID))
+
+		recent, err = tx.GetMailboxRecentCount(ctx, mbox.ID)
+		require.NoError(t, err)
+		require.Zero(t, recent)
+	})
+}
+
+func testRemoveMessagesFromMailbox(t *testing.T, ci db.ClientInterface) {
+	client := newClient(t, ci)
+
+	write(t, client, func(ctx context.Context, tx db.Transaction) {
+		mbox := createMailbox(ctx, t, tx, "mbox-1", "Folder")
+
+		// Use more messages than fit in a single query to cover implementations which split them in chunks.
+		msgs := make([]db.MessageIDPair, 0, db.ChunkLimit+10)
+
+		for len(msgs) < cap(msgs) {
+			msgs = append(msgs, createMessage(ctx, t, tx, imap.MessageID(uuid.NewString())))
+		}
+
+		_, err := tx.AddMessagesToMailbox(ctx, mbox.ID, msgs)
+		require.NoError(t, err)
+
+		ids, _ := db.SplitMessageIDPairSlice(msgs[1:])
+
+		require.NoError(t, tx.RemoveMessagesFromMailbox(ctx, mbox.ID, ids))
+
+		pairs, err := tx.GetMailboxMessageIDPairs(ctx, mbox.ID)
+		require.NoError(t, err)
+		require.Equal(t, msgs[:1], pairs)
+
+		mboxIDs, err := tx.GetMessageMailboxIDs(ctx, ids[len(ids)-1])
+		require.NoError(t, err)
+		require.Empty(t, mboxIDs)
+
+		// UIDs are never reused.
+		uid, err := tx.GetMailboxUID(ctx, mbox.ID)
+		require.NoError(t, err)
+		require.Equal(t, imap.UID(len(msgs)+1), uid)
+
+		added, err := tx.AddMessagesToMailbox(ctx, mbox.ID, msgs[1:2])
+		require.NoError(t, err)
+		require.Equal(t, imap.UID(len(msgs)+1), added[0].UID)
+	})
+}
+
+func testBumpMailboxUIDNext(t *testing.T, ci db.ClientInterface) {
+	client := newClient(t, ci)
+
+	write(t, client, func(ctx context.Context, tx db.Transaction) {
+		mbox := createMailbox(ctx, t, tx, "mbox-1", "Folder")
+		empty := createMailbox(ctx, t, tx, "mbox-2", "Empty")
+		msg1 := createMessage(ctx, t, tx, "msg-1")
+		msg2 := createMessage(ctx, t, tx, "msg-2")
+
+		_, err := tx.AddMessagesToMailbox(ctx, mbox.ID, []db.MessageIDPair{msg1})
+		require.NoError(t, err)
+
+		require.NoError(t, tx.BumpMailboxUIDNext(ctx, mbox.ID, 10))
+		require.NoError(t, tx.BumpMailboxUIDNext(ctx, empty.ID, 5))
+
+		// The counter never goes backwards.
+		require.NoError(t, tx.BumpMailboxUIDNext(ctx, mbox.ID, 3))
+
+		uid, err := tx.GetMailboxUID(ctx, mbox.ID)
+		require.NoError(t, err)
+		require.Equal(t, imap.UID(10), uid)
+
+		uid, err = tx.GetMailboxUID(ctx, empty.ID)
+		require.NoError(t, err)
+		require.Equal(t, imap.UID(5), uid)
+
+		added, err := tx.AddMessagesToMailbox(ctx, mbox.ID, []db.MessageIDPair{msg2})
+		require.NoError(t, err)
+		require.Equal(t, imap.UID(10), added[0].UID)
+
+		added, err = tx.AddMessagesToMailbox(ctx, empty.ID, []db.MessageIDPair{msg1})
+		require.NoError(t, err)
+		require.Equal(t, imap.UID(5), added[0].UID)
+	})
+}
+
+func testHeaderFields(t *testing.T, ci db.ClientInterface) {
+	client := newClient(t, ci)
+
+	fields := &db.MessageHeaderFields{
+		From:      "alice@example.com",
+		To:        "bob@example.com",
+		Cc:        "carol@example.com",
+		Bcc:       "dave@example.com",
+		Subject:   "Subject",
+		MessageID: "<id@example.com>",
+		SentDate:  time.Date(2023, 5, 17, 0, 0, 0, 0, time.UTC),
+	}
+
+	write(t, client, func(ctx context.Context, tx db.Transaction) {
+		withFields := imap.NewInternalMessageID()
+
+		require.NoError(t, tx.CreateMessages(ctx, &db.CreateMessageReq{
+			Message:      imap.Message{ID: "msg-1", Flags: imap.NewFlagSet(), Date: time.Now()},
+			InternalID:   withFields,
+			HeaderFields: fields,
+		}))
+
+		without := createMessage(ctx, t, tx, "msg-2")
+
+		stored, err := tx.GetMessageHeaderFields(ctx, withFields)
+		require.NoError(t, err)
+		requireHeaderFields(t, fields, stored)
+
+		_, err = tx.GetMessageHeaderFields(ctx, without.InternalID)
+		require.ErrorIs(t, err, db.ErrNotFound)
+
+		ids, err := tx.GetMessageIDsWithoutHeaderFields(ctx)
+		require.NoError(t, err)
+		require.Equal(t, []imap.InternalMessageID{without.InternalID}, ids)
+
+		// Storing the fields of a message replaces them; a missing sent date is preserved as the zero time.
+		noDate := *fields
+		noDate.SentDate = time.Time{}
+
+		require.NoError(t, tx.StoreMessageHeaderFields(ctx, without.InternalID, fields))
+		require.NoError(t, tx.StoreMessageHeaderFields(ctx, without.InternalID, &noDate))
+
+		stored, err = tx.GetMessageHeaderFields(ctx, without.InternalID)
+		require.NoError(t, err)
+		requireHeaderFields(t, &noDate, stored)
+
+		ids, err = tx.GetMessageIDsWithoutHeaderFields(ctx)
+		require.NoError(t, err)
+		require.Empty(t, ids)
+	})
+}
+
+func testLiteralHashes(t *testing.T, ci db.ClientInterface) {
+	client := newClient(t, ci)
+
+	hash := db.NewLiteralHash([]byte("literal"))
+
+	write(t, client, func(ctx context.Context, tx db.Transaction) {
+		withHash := imap.NewInternalMessageID()
+
+		require.NoError(t, tx.CreateMessages(ctx, &db.CreateMessageReq{
+			Message:     imap.Message{ID: "msg-1", Flags: imap.NewFlagSet(), Date: time.Now()},
+			InternalID:  withHash,
+			LiteralHash: hash,
+		}))
+
+		without := createMessage(ctx, t, tx, "msg-2")
+
+		hashes, err := tx.GetMessageLiteralHashes(ctx, []imap.InternalMessageID{withHash, without.InternalID})
+		require.NoError(t, err)
+		require.Equal(t, map[imap.InternalMessageID][]byte{withHash: hash}, hashes)
+
+		other := db.NewLiteralHash([]byte("other literal"))
+
+		require.NoError(t, tx.StoreMessageLiteralHash(ctx, without.InternalID, hash))
+		require.NoError(t, tx.StoreMessageLiteralHash(ctx, without.InternalID, other))
+
+		hashes, err = tx.GetMessageLiteralHashes(ctx, []imap.InternalMessageID{withHash, without.InternalID})
+		require.NoError(t, err)
+		require.Equal(t, map[imap.InternalMessageID][]byte{withHash: hash, without.InternalID: other}, hashes)
+
+		require.NoError(t, tx.DeleteMessages(ctx, []imap.InternalMessageID{withHash}))
+
+		hashes, err = tx.GetMessageLiteralHashes(ctx, []imap.InternalMessageID{withHash})
+		require.NoError(t, err)
+		require.Empty(t, hashes)
+	})
+}
+
+func testSearchMessageHeaders(t *testing.T, ci db.ClientInterface) {
+	client := newClient(t, ci)
+
+	write(t, client, func(ctx context.Context, tx db.Transaction) {
+		mbox := createMailbox(ctx, t, tx, "mbox-1", "Folder")
+
+		newMessage := func(remoteID imap.MessageID, literal string) db.MessageIDPair {
+			id := imap.NewInternalMessageID()
+
+			require.NoError(t, tx.CreateMessages(ctx, &db.CreateMessageReq{
+				Message:      imap.Message{ID: remoteID, Flags: imap.NewFlagSet(), Date: time.Now()},
+				InternalID:   id,
+				HeaderFields: db.NewMessageHeaderFields([]byte(literal)),
+			}))
+
+			return db.MessageIDPair{InternalID: id, RemoteID: remoteID}
+		}
+
+		msg1 := newMessage("msg-1", "From: Alice <alice@example.com>\r\nSubject: Café\r\nDate: Wed, 17 May 2023 10:00:00 +0200\r\n\r\n")
+		msg2 := newMessage("msg-2", "From: bob@example.com\r\nSubject: Lunch\r\nDate: Fri, 19 May 2023 10:00:00 +0200\r\n\r\n")
+		msg3 := newMessage("msg-3", "From: alice@example.com\r\n\r\n")
+		without := createMessage(ctx, t, tx, "msg-4")
+		other := newMessage("msg-5", "From: alice@example.com\r\n\r\n")
+
+		_, err := tx.AddMessagesToMailbox(ctx, mbox.ID, []db.MessageIDPair{msg1, msg2, msg3, without})
+		require.NoError(t, err)
+
+		day := time.Date(2023, 5, 17, 0, 0, 0, 0, time.UTC)
+
+		result, err := tx.SearchMessageHeaders(ctx, mbox.ID, []db.HeaderSearchKey{
+			{Op: db.HeaderSearchContains, Field: db.HeaderFieldFrom, Value: "ALICE"},
+			{Op: db.HeaderSearchContains, Field: db.HeaderFieldSubject, Value: "CAFÉ"},
+			{Op: db.HeaderSearchSentBefore, Date: day.AddDate(0, 0, 1)},
+			{Op: db.HeaderSearchSentOn, Date: day},
+			{Op: db.HeaderSearchSentSince, Date: day.AddDate(0, 0, 1)},
+		})
+		require.NoError(t, err)
+
+		ids := func(pairs ...db.MessageIDPair) map[imap.InternalMessageID]struct{} {
+			set := make(map[imap.InternalMessageID]struct{})
+
+			for _, pair := range pairs {
+				set[pair.InternalID] = struct{}{}
+			}
+
+			return set
+		}
+
+		// Messages outside the mailbox never match; messages without a sent date never match date keys.
+		require.Equal(t, []map[imap.InternalMessageID]struct{}{
+			ids(msg1, msg3),
+			ids(msg1),
+			ids(msg1),
+			ids(msg1),
+			ids(msg2),
+		}, result.Matches)
+		require.Equal(t, ids(without), result.Missing)
+		require.NotContains(t, result.Matches[0], other.InternalID)
+	})
+}
+
+func testWriteRollback(t *testing.T, ci db.ClientInterface) {
+	client := newClient(t, ci)
+
+	errFail := errors.New("fail")
+
+	err := client.Write(context.Background(), func(ctx context.Context, tx db.Transaction) error {
+		createMailbox(ctx, t, tx, "mbox-1", "Folder")
+		createMessage(ctx, t, tx, "msg-1")
+
+		require.NoError(t, tx.StoreSieveScript(ctx, "keep;"))
+
+		return errFail
+	})
+	require.ErrorIs(t, err, errFail)
+
+	require.Panics(t, func() {
+		_ = client.Write(context.Background(), func(ctx context.Context, tx db.Transaction) error {
+			createMailbox(ctx, t, tx, "mbox-1", "Folder")
+
+			panic("fail")
+		})
+	})
+
+	read(t, client, func(ctx context.Context, rd db.ReadOnly) {
+		count, err := rd.GetMailboxCount(ctx)
+		require.NoError(t, err)
+		require.Zero(t, count)
+
+		count, err = rd.GetTotalMessageCount(ctx)
+		require.NoError(t, err)
+		require.Zero(t, count)
+
+		script, err := rd.GetSieveScript(ctx)
+		require.NoError(t, err)
+		require.Empty(t, script)
+	})
+
+	// Changes to existing mailboxes and messages are rolled back too.
+	var (
+		mbox *db.Mailbox
+		msg  db.MessageIDPair
+	)
+
+	write(t, client, func(ctx context.Context, tx db.Transaction) {
+		mbox = createMailbox(ctx, t, tx, "mbox-1", "Folder")
+		msg = createMessage(ctx, t, tx, "msg-1")
+
+		_, err := tx.AddMessagesToMailbox(ctx, mbox.ID, []db.MessageIDPair{msg})
+		require.NoError(t, err)
+	})
+
+	err = client.Write(context.Background(), func(ctx context.Context, tx db.Transaction) error {
+		require.NoError(t, tx.RenameMailboxWithRemoteID(ctx, "mbox-1", "Renamed"))
+		require.NoError(t, tx.UpdateRemoteMessageID(ctx, msg.InternalID, "msg-2"))
+		require.NoError(t, tx.AddFlagToMessages(ctx, []imap.InternalMessageID{msg.InternalID}, imap.FlagSeen))
+		require.NoError(t, tx.ClearRecentFlagsInMailbox(ctx, mbox.ID))
+		require.NoError(t, tx.RemoveMessagesFromMailbox(ctx, mbox.ID, []imap.InternalMessageID{msg.InternalID}))
+		require.NoError(t, tx.DeleteMessages(ctx, []imap.InternalMessageID{msg.InternalID}))
+		require.NoError(t, tx.DeleteMailboxWithRemoteID(ctx, "mbox-1"))
+
+		return errFail
+	})
+	require.ErrorIs(t, err, errFail)
+
+	read(t, client, func(ctx context.Context, rd db.ReadOnly) {
+		named, err := rd.GetMailboxByName(ctx, "Folder")
+		require.NoError(t, err)
+		require.Equal(t, mbox.ID, named.ID)
+
+		requireFalse(t)(rd.MailboxExistsWithName(ctx, "Renamed"))
+
+		id, err := rd.GetMessageIDFromRemoteID(ctx, "msg-1")
+		require.NoError(t, err)
+		require.Equal(t, msg.InternalID, id)
+
+		requireFalse(t)(rd.MessageExistsWithRemoteID(ctx, "msg-2"))
+
+		flags, err := rd.GetMessagesFlags(ctx, []imap.InternalMessageID{msg.InternalID})
+		require.NoError(t, err)
+		require.True(t, flags[0].FlagSet.Equals(imap.NewFlagSet()))
+
+		recent, err := rd.GetMailboxRecentCount(ctx, mbox.ID)
+		require.NoError(t, err)
+		require.Equal(t, 1, recent)
+	})
+}
+
+// errIgnored marks writes which are expected to fail; their changes must be rolled back.
+var errIgnored = errors.New("ignored")
+
+func newClient(t *testing.T, ci db.ClientInterface) db.Client {
+	return openClient(t, ci, t.TempDir(), uuid.NewString(), true)
+}
+
+func openClient(t *testing.T, ci db.ClientInterface, dir, userID string, wantNew bool) db.Client {
+	client, isNew, err := ci.New(dir, userID)
+	require.NoError(t, err)
+	require.Equal(t, wantNew, isNew)
+
+	require.NoError(t, client.Init(context.Background(), imap.DefaultEpochUIDValidityGenerator()))
+
+	t.Cleanup(func() { require.NoError(t, client.Close()) })
+
+	return client
+}
+
+func read(t *testing.T, client db.Client, fn func(context.Context, db.ReadOnly)) {
+	require.NoError(t, client.Read(context.Background(), func(ctx context.Context, rd db.ReadOnly) error {
+		fn(ctx, rd)
+		return nil
+	}))
+}
+
+// write runs fn in a transaction. If wantErr is given, the transaction is failed with it after fn returns.
+func write(t *testing.T, client db.Client, fn func(context.Context, db.Transaction), wantErr ...error) {
+	err := client.Write(context.Background(), func(ctx context.Context, tx db.Transaction) error {
+		fn(ctx, tx)
+
+		if len(wantErr) > 0 {
+			return wantErr[0]
+		}
+
+		return nil
+	})
+
+	if len(wantErr) > 0 {
+		require.ErrorIs(t, err, wantErr[0])
+	} else {
+		require.NoError(t, err)
+	}
+}
+
+func createMailbox(ctx context.Context, t *testing.T, tx db.Transaction, mboxID imap.MailboxID, name string) *db.Mailbox {
+	mbox, err := tx.CreateMailbox(ctx, mboxID, name, imap.NewFlagSet(), imap.NewFlagSet(), imap.NewFlagSet(), 0, 1)
+	require.NoError(t, err)
+
+	return mbox
+}
+
+func createMessage(ctx context.Context, t *testing.T, tx db.Transaction, remoteID imap.MessageID) db.MessageIDPair {
+	id := imap.NewInternalMessageID()
+
+	require.NoError(t, tx.CreateMessages(ctx, &db.CreateMessageReq{
+		Message:    imap.Message{ID: remoteID, Flags: imap.NewFlagSet(), Date: time.Now()},
+		InternalID: id,
+	}))
+
+	return db.MessageIDPair{InternalID: id, RemoteID: remoteID}
+}
+
+func requireHeaderFields(t *testing.T, want, got *db.MessageHeaderFields) {
+	require.True(t, want.SentDate.Equal(got.SentDate))
+
+	wantCopy, gotCopy := *want, *got
+	wantCopy.SentDate, gotCopy.SentDate = time.Time{}, time.Time{}
+
+	require.Equal(t, wantCopy, gotCopy)
+}
+
+// requireTrue returns a function checking the result of an operation which returns a bool and an error.
+func requireTrue(t *testing.T) func(bool, error) {
+	return func(ok bool, err error) {
+		require.NoError(t, err)
+		require.True(t, ok)
+	}
+}
+
+func requireFalse(t *testing.T) func(bool, error) {
+	return func(ok bool, err error) {
+		require.NoError(t, err)
+		require.False(t, ok)
+	}
+}
@@ -1,11 +1,46 @@
 package db
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var ErrNotFound = errors.New("value not found")
 var ErrTransactionFailed = errors.New("transaction failed")
 var ErrMigrationFailed = errors.New("database migration failed")
 var ErrInvalidDatabaseVersion = errors.New("invalid database version")
+var ErrMigrationNotReversible = errors.New("database migration can't be reverted")
+
+// ErrSaveFailed is returned once a committed transaction couldn't be saved to disk. The client no longer matches what
+// is on disk, so it fails every further operation and must be reopened.
+var ErrSaveFailed = errors.New("database could not be saved")
+
+// FutureVersionError is returned when a database was written by a newer version whose schema this version can't use.
+// The database is left untouched so that it can still be used once the newer version is installed again, or be
+// downgraded by it first.
+type FutureVersionError struct {
+	// Version is the schema version of the database.
+	Version int
+
+	// MinCompatibleVersion is the oldest schema version able to use the database.
+	MinCompatibleVersion int
+
+	// SupportedVersion is the newest schema version this version knows.
+	SupportedVersion int
+}
+
+func (e *FutureVersionError) Error() string {
+	return fmt.Sprintf(
+		"database schema version %v needs at least version %v, but only up to %v is supported",
+		e.Version,
+		e.MinCompatibleVersion,
+		e.SupportedVersion,
+	)
+}
+
+func (e *FutureVersionError) Unwrap() error {
+	return ErrInvalidDatabaseVersion
+}
 
 func IsErrNotFound(err error) bool {
 	if err == nil {
@@ -0,0 +1,163 @@
+package db
+
+import (
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/rfc5322"
+	"github.com/ProtonMail/gluon/rfc822"
+)
+
+// MessageHeaderFields holds the header fields of a message which header searches are evaluated against,
+// so that they don't need to read the message from the store.
+// The text fields are lower-cased, as searches ignore case.
+type MessageHeaderFields struct {
+	From    string
+	To      string
+	Cc      string
+	Bcc     string
+	Subject string
+
+	// MessageID is the value of the Message-ID header field.
+	MessageID string
+
+	// SentDate is the day of the Date header field, ignoring its time zone.
+	// It is the zero time if the field is missing or can't be parsed.
+	SentDate time.Time
+}
+
+// NewMessageHeaderFields extracts the header fields of the given message literal.
+// It returns nil if the header can't be parsed, in which case searches read the message from the store instead.
+func NewMessageHeaderFields(literal []byte) *MessageHeaderFields {
+	headerBytes, _ := rfc822.Split(literal)
+
+	header, err := rfc822.NewHeader(headerBytes)
+	if err != nil {
+		return nil
+	}
+
+	fields := &MessageHeaderFields{
+		From:      strings.ToLower(header.Get("From")),
+		To:        strings.ToLower(header.Get("To")),
+		Cc:        strings.ToLower(header.Get("Cc")),
+		Bcc:       strings.ToLower(header.Get("Bcc")),
+		Subject:   strings.ToLower(header.Get("Subject")),
+		MessageID: strings.ToLower(header.Get("Message-Id")),
+	}
+
+	if date, err := rfc5322.ParseDateTime(header.Get("Date")); err == nil {
+		fields.SentDate = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	}
+
+	return fields
+}
+
+// HeaderField is a text field of MessageHeaderFields.
+type HeaderField int
+
+const (
+	HeaderFieldFrom HeaderField = iota
+	HeaderFieldTo
+	HeaderFieldCc
+	HeaderFieldBcc
+	HeaderFieldSubject
+	HeaderFieldMessageID
+)
+
+// HeaderFieldByName returns the stored field holding the header field with the given name, if there is one.
+func HeaderFieldByName(name string) (HeaderField, bool) {
+	switch strings.ToLower(name) {
+	case "from":
+		return HeaderFieldFrom, true
+
+	case "to":
+		return HeaderFieldTo, true
+
+	case "cc":
+		return HeaderFieldCc, true
+
+	case "bcc":
+		return HeaderFieldBcc, true
+
+	case "subject":
+		return HeaderFieldSubject, true
+
+	case "message-id":
+		return HeaderFieldMessageID, true
+
+	default:
+		return 0, false
+	}
+}
+
+// Value returns the value of the given field.
+func (fields *MessageHeaderFields) Value(field HeaderField) string {
+	switch field {
+	case HeaderFieldFrom:
+		return fields.From
+
+	case HeaderFieldTo:
+		return fields.To
+
+	case HeaderFieldCc:
+		return fields.Cc
+
+	case HeaderFieldBcc:
+		return fields.Bcc
+
+	case HeaderFieldSubject:
+		return fields.Subject
+
+	default:
+		return fields.MessageID
+	}
+}
+
+// HeaderSearchOp is the comparison made by a HeaderSearchKey.
+type HeaderSearchOp int
+
+const (
+	// HeaderSearchContains matches messages whose Field contains Value, ignoring case.
+	HeaderSearchContains HeaderSearchOp = iota
+
+	// HeaderSearchSentBefore, HeaderSearchSentOn and HeaderSearchSentSince match messages whose sent date is before,
+	// on or on or after the day of Date. Messages without a sent date never match.
+	HeaderSearchSentBefore
+	HeaderSearchSentOn
+	HeaderSearchSentSince
+)
+
+// HeaderSearchKey is a search key evaluated against the stored header fields of messages.
+type HeaderSearchKey struct {
+	Op    HeaderSearchOp
+	Field HeaderField
+	Value string
+	Date  time.Time
+}
+
+// Matches returns whether the given header fields match the key.
+func (key HeaderSearchKey) Matches(fields *MessageHeaderFields) bool {
+	switch key.Op {
+	case HeaderSearchContains:
+		return strings.Contains(fields.Value(key.Field), strings.ToLower(key.Value))
+
+	case HeaderSearchSentBefore:
+		return !fields.SentDate.IsZero() && fields.SentDate.Before(key.Date)
+
+	case HeaderSearchSentOn:
+		return !fields.SentDate.IsZero() && fields.SentDate.Equal(key.Date)
+
+	default:
+		return !fields.SentDate.IsZero() && !fields.SentDate.Before(key.Date)
+	}
+}
+
+// HeaderSearchResult holds the messages of a mailbox matching header search keys.
+type HeaderSearchResult struct {
+	// Matches holds, for each key, the messages with stored header fields which match it.
+	Matches []map[imap.InternalMessageID]struct{}
+
+	// Missing holds the messages of the mailbox whose header fields haven't been stored.
+	Missing map[imap.InternalMessageID]struct{}
+}
@@ -0,0 +1,37 @@
+package db
+
+import (
+	"crypto/sha256"
+	"hash"
+	"io"
+)
+
+// NewLiteralHash returns the hash of a message literal, as stored alongside the message to detect literals which
+// were damaged in the store.
+func NewLiteralHash(literal []byte) []byte {
+	sum := sha256.Sum256(literal)
+
+	return sum[:]
+}
+
+// LiteralHasher hashes a literal while it is read, e.g. while it is written to the store.
+type LiteralHasher struct {
+	reader io.Reader
+	hash   hash.Hash
+}
+
+// NewLiteralHasher returns a LiteralHasher hashing the literal read from r.
+func NewLiteralHasher(r io.Reader) *LiteralHasher {
+	h := sha256.New()
+
+	return &LiteralHasher{reader: io.TeeReader(r, h), hash: h}
+}
+
+func (h *LiteralHasher) Read(p []byte) (int, error) {
+	return h.reader.Read(p)
+}
+
+// Sum returns the hash of the literal read so far, which is the value NewLiteralHash returns once it was read fully.
+func (h *LiteralHasher) Sum() []byte {
+	return h.hash.Sum(nil)
+}
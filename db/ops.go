@@ -9,6 +9,9 @@ type ReadOnly interface {
 
 	// GetConnectorSettings returns true if no previous setting was ever stored before.
 	GetConnectorSettings(ctx context.Context) (string, bool, error)
+
+	// GetSieveScript returns the user's sieve script or an empty string if none was stored.
+	GetSieveScript(ctx context.Context) (string, error)
 }
 
 type Transaction interface {
@@ -18,4 +21,6 @@ type Transaction interface {
 	SubscriptionWriteOps
 
 	StoreConnectorSettings(ctx context.Context, settings string) error
+
+	StoreSieveScript(ctx context.Context, script string) error
 }
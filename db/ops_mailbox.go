@@ -71,12 +71,14 @@ type MailboxWriteOps interface {
 		mboxID imap.MailboxID,
 		name string,
 		flags, permFlags, attrs imap.FlagSet,
+		perms imap.MailboxPermissions,
 		uidValidity imap.UID) (*Mailbox, error)
 
 	GetOrCreateMailbox(ctx context.Context,
 		mboxID imap.MailboxID,
 		name string,
 		flags, permFlags, attrs imap.FlagSet,
+		perms imap.MailboxPermissions,
 		uidValidity imap.UID) (*Mailbox, error)
 
 	GetOrCreateMailboxAlt(ctx context.Context,
@@ -86,6 +88,8 @@ type MailboxWriteOps interface {
 
 	RenameMailboxWithRemoteID(ctx context.Context, mboxID imap.MailboxID, name string) error
 
+	SetMailboxPermissionsWithRemoteID(ctx context.Context, mboxID imap.MailboxID, permissions imap.MailboxPermissions) error
+
 	DeleteMailboxWithRemoteID(ctx context.Context, mboxID imap.MailboxID) error
 
 	AddMessagesToMailbox(ctx context.Context, mboxID imap.InternalMailboxID, messageIDs []MessageIDPair) ([]UIDWithFlags, error)
@@ -106,6 +110,9 @@ type MailboxWriteOps interface {
 
 	SetMailboxUIDValidity(ctx context.Context, mboxID imap.InternalMailboxID, uidValidity imap.UID) error
 
+	// BumpMailboxUIDNext makes sure the next UID assigned in the mailbox is at least uidNext.
+	BumpMailboxUIDNext(ctx context.Context, mboxID imap.InternalMailboxID, uidNext imap.UID) error
+
 	AddFlagsToAllMailboxes(ctx context.Context, flags ...string) error
 
 	AddPermFlagsToAllMailboxes(ctx context.Context, flags ...string) error
@@ -33,6 +33,20 @@ type MessageReadOps interface {
 	GetMessageDeletedFlag(ctx context.Context, id imap.InternalMessageID) (bool, error)
 
 	GetAllMessagesIDsAsMap(ctx context.Context) (map[imap.InternalMessageID]struct{}, error)
+
+	// GetMessageHeaderFields returns ErrNotFound if the header fields of the message haven't been stored.
+	GetMessageHeaderFields(ctx context.Context, id imap.InternalMessageID) (*MessageHeaderFields, error)
+
+	GetMessageIDsWithoutHeaderFields(ctx context.Context) ([]imap.InternalMessageID, error)
+
+	// SearchMessageHeaders evaluates the given keys against the stored header fields of the messages of the mailbox.
+	SearchMessageHeaders(ctx context.Context, mboxID imap.InternalMailboxID, keys []HeaderSearchKey) (HeaderSearchResult, error)
+
+	// GetOrphanedFlagMessageIDs returns the IDs of messages which don't exist but still have flags stored.
+	GetOrphanedFlagMessageIDs(ctx context.Context) ([]imap.InternalMessageID, error)
+
+	// GetMessageLiteralHashes returns the literal hashes stored for the given messages; messages without one are left out.
+	GetMessageLiteralHashes(ctx context.Context, ids []imap.InternalMessageID) (map[imap.InternalMessageID][]byte, error)
 }
 
 type MessageWriteOps interface {
@@ -57,6 +71,10 @@ type MessageWriteOps interface {
 	RemoveFlagFromMessages(ctx context.Context, ids []imap.InternalMessageID, flag string) error
 
 	SetFlagsOnMessages(ctx context.Context, ids []imap.InternalMessageID, flags imap.FlagSet) error
+
+	StoreMessageHeaderFields(ctx context.Context, id imap.InternalMessageID, fields *MessageHeaderFields) error
+
+	StoreMessageLiteralHash(ctx context.Context, id imap.InternalMessageID, hash []byte) error
 }
 
 type CreateMessageReq struct {
@@ -66,6 +84,12 @@ type CreateMessageReq struct {
 	Body        string
 	Structure   string
 	Envelope    string
+
+	// HeaderFields are stored alongside the message if set.
+	HeaderFields *MessageHeaderFields
+
+	// LiteralHash is the hash of the literal stored for the message, see NewLiteralHash. It is stored if set.
+	LiteralHash []byte
 }
 
 type MessageFlagSet struct {
@@ -90,6 +90,7 @@ type Mailbox struct {
 	Name        string
 	UIDValidity imap.UID
 	Subscribed  bool
+	Permissions imap.MailboxPermissions
 }
 
 type MailboxWithAttr struct {
@@ -7,6 +7,15 @@ import (
 	"github.com/ProtonMail/gluon/internal/state"
 )
 
+// ErrNoSuchSession is returned when a session is not connected to the server.
+var ErrNoSuchSession = errors.New("no such session")
+
+// ErrInvalidListenerPolicy is returned when a listener is served with a policy which can't be applied.
+var ErrInvalidListenerPolicy = errors.New("invalid listener policy")
+
+// ErrServerDraining is returned when a listener is served after the server started draining.
+var ErrServerDraining = errors.New("the server is draining")
+
 // IsNoSuchMessage returns true if the error is ErrNoSuchMessage.
 func IsNoSuchMessage(err error) bool {
 	return errors.Is(err, state.ErrNoSuchMessage)
@@ -0,0 +1,21 @@
+package events
+
+import "github.com/ProtonMail/gluon/imap"
+
+// MessageFlagsConflict is published when the connector reported flags for a message which disagree with a local
+// change of its flags that the connector hadn't acknowledged yet.
+type MessageFlagsConflict struct {
+	eventBase
+
+	UserID string
+
+	MessageID imap.MessageID
+
+	// LocalFlags and RemoteFlags are the flags of the message as set locally and as reported by the connector.
+	LocalFlags, RemoteFlags imap.FlagSet
+
+	// ResolvedFlags are the flags of the message after the conflict was resolved with Policy.
+	ResolvedFlags imap.FlagSet
+
+	Policy imap.FlagConflictPolicy
+}
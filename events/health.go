@@ -0,0 +1,14 @@
+package events
+
+import "github.com/ProtonMail/gluon/imap"
+
+// ConnectorHealthChanged is published when the connector of a user reports a new health state.
+type ConnectorHealthChanged struct {
+	eventBase
+
+	UserID string
+
+	Health imap.ConnectorHealth
+
+	Message string
+}
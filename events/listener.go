@@ -1,11 +1,16 @@
 package events
 
-import "net"
+import (
+	"net"
+
+	"github.com/ProtonMail/gluon/listener"
+)
 
 type ListenerAdded struct {
 	eventBase
 
-	Addr net.Addr
+	Addr   net.Addr
+	Policy listener.Policy
 }
 
 type ListenerRemoved struct {
@@ -1,8 +1,20 @@
 package events
 
+import (
+	"net"
+	"time"
+)
+
 type LoginFailed struct {
 	eventBase
 
-	SessionID int
-	Username  string
+	SessionID  int
+	Username   string
+	RemoteAddr net.Addr
+
+	// Blocked is set if the login failed once too often for its address or username, in which case further logins
+	// from the address or for the username are delayed by Delay, until Until.
+	Blocked bool
+	Delay   time.Duration
+	Until   time.Time
 }
@@ -14,4 +14,53 @@ type SessionRemoved struct {
 	eventBase
 
 	SessionID int
+	Reason    SessionRemovedReason
+}
+
+// SessionRemovedReason describes why a session ended.
+type SessionRemovedReason int
+
+const (
+	// SessionClosed means the client logged out or closed the connection, or the server was closed.
+	SessionClosed SessionRemovedReason = iota
+
+	// SessionPreAuthTimeout means the client didn't log in in time.
+	SessionPreAuthTimeout
+
+	// SessionAutoLogout means the client was logged out after being inactive for too long.
+	SessionAutoLogout
+
+	// SessionIdleTimeout means the client stayed in IDLE for too long.
+	SessionIdleTimeout
+
+	// SessionDisconnected means the server was asked to disconnect the session.
+	SessionDisconnected
+
+	// SessionDrained means the session was closed because the server was drained.
+	SessionDrained
+)
+
+func (r SessionRemovedReason) String() string {
+	switch r {
+	case SessionClosed:
+		return "closed"
+
+	case SessionPreAuthTimeout:
+		return "pre-auth-timeout"
+
+	case SessionAutoLogout:
+		return "auto-logout"
+
+	case SessionIdleTimeout:
+		return "idle-timeout"
+
+	case SessionDisconnected:
+		return "disconnected"
+
+	case SessionDrained:
+		return "drained"
+
+	default:
+		return "unknown"
+	}
 }
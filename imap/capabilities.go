@@ -10,11 +10,15 @@ const (
 	UIDPLUS   Capability = `UIDPLUS`
 	MOVE      Capability = `MOVE`
 	ID        Capability = `ID`
+
+	LoginDisabled Capability = `LOGINDISABLED`
+	AuthExternal  Capability = `AUTH=EXTERNAL`
+	SASLIR        Capability = `SASL-IR`
 )
 
 func IsCapabilityAvailableBeforeAuth(c Capability) bool {
 	switch c {
-	case IMAP4rev1, StartTLS, IDLE, ID:
+	case IMAP4rev1, StartTLS, IDLE, ID, LoginDisabled, AuthExternal, SASLIR:
 		return true
 	case UNSELECT, UIDPLUS, MOVE:
 		return false
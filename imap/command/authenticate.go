@@ -0,0 +1,95 @@
+package command
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/ProtonMail/gluon/rfcparser"
+)
+
+// ErrAuthenticateCancelled is returned by ParseAuthenticateResponse when the client cancelled the exchange.
+var ErrAuthenticateCancelled = errors.New("authentication cancelled")
+
+type Authenticate struct {
+	Mechanism string
+
+	// InitialResponse is the decoded initial client response sent with the command (RFC 4959), or nil if there was
+	// none. An empty response is sent as "=".
+	InitialResponse []byte
+}
+
+func (l Authenticate) String() string {
+	if l.InitialResponse == nil {
+		return fmt.Sprintf("AUTHENTICATE %v", l.Mechanism)
+	}
+
+	return fmt.Sprintf("AUTHENTICATE %v '%v'", l.Mechanism, string(l.InitialResponse))
+}
+
+func (l Authenticate) SanitizedString() string {
+	if l.InitialResponse == nil {
+		return fmt.Sprintf("AUTHENTICATE %v", l.Mechanism)
+	}
+
+	return fmt.Sprintf("AUTHENTICATE %v <RESPONSE>", l.Mechanism)
+}
+
+type AuthenticateCommandParser struct{}
+
+func (AuthenticateCommandParser) FromParser(p *rfcparser.Parser) (Payload, error) {
+	// authenticate    = "AUTHENTICATE" SP auth-type [SP (base64 / "=")]
+	// auth-type       = atom
+	if err := p.Consume(rfcparser.TokenTypeSP, "expected space after command"); err != nil {
+		return nil, err
+	}
+
+	mechanism, err := p.ParseAtom()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := &Authenticate{Mechanism: mechanism}
+
+	if ok, err := p.Matches(rfcparser.TokenTypeSP); err != nil {
+		return nil, err
+	} else if !ok {
+		return cmd, nil
+	}
+
+	encoded, err := p.ParseAtom()
+	if err != nil {
+		return nil, err
+	}
+
+	if encoded == "=" {
+		cmd.InitialResponse = []byte{}
+	} else if cmd.InitialResponse, err = base64.StdEncoding.DecodeString(encoded); err != nil {
+		return nil, p.MakeError("invalid base64 in initial response")
+	}
+
+	return cmd, nil
+}
+
+// ParseAuthenticateResponse decodes the line a client sent in response to an AUTHENTICATE continuation request
+// (RFC 3501 6.2.2), which is either a base64 encoded response or "*" to cancel the exchange.
+func ParseAuthenticateResponse(line []byte) ([]byte, error) {
+	line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))
+
+	if string(line) == "*" {
+		return nil, ErrAuthenticateCancelled
+	}
+
+	response, err := base64.StdEncoding.DecodeString(string(line))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 in response: %w", err)
+	}
+
+	// An empty response is still a response.
+	if response == nil {
+		response = []byte{}
+	}
+
+	return response, nil
+}
@@ -0,0 +1,68 @@
+package command
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ProtonMail/gluon/rfcparser"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParser_AuthenticateCommand(t *testing.T) {
+	input := toIMAPLine(`tag AUTHENTICATE EXTERNAL`)
+	s := rfcparser.NewScanner(bytes.NewReader(input))
+	p := NewParser(s)
+
+	expected := Command{Tag: "tag", Payload: &Authenticate{Mechanism: "EXTERNAL"}}
+
+	cmd, err := p.Parse()
+	require.NoError(t, err)
+	require.Equal(t, expected, cmd)
+	require.Equal(t, "authenticate", p.LastParsedCommand())
+	require.Equal(t, "tag", p.LastParsedTag())
+}
+
+func TestParser_AuthenticateCommandInitialResponse(t *testing.T) {
+	input := toIMAPLine(`tag AUTHENTICATE EXTERNAL dXNlckBleGFtcGxlLmNvbQ==`, `tag AUTHENTICATE EXTERNAL =`)
+	s := rfcparser.NewScanner(bytes.NewReader(input))
+	p := NewParser(s)
+
+	cmd, err := p.Parse()
+	require.NoError(t, err)
+	require.Equal(t, Command{Tag: "tag", Payload: &Authenticate{
+		Mechanism:       "EXTERNAL",
+		InitialResponse: []byte("user@example.com"),
+	}}, cmd)
+
+	cmd, err = p.Parse()
+	require.NoError(t, err)
+	require.Equal(t, Command{Tag: "tag", Payload: &Authenticate{
+		Mechanism:       "EXTERNAL",
+		InitialResponse: []byte{},
+	}}, cmd)
+}
+
+func TestParser_AuthenticateCommandInvalidInitialResponse(t *testing.T) {
+	input := toIMAPLine(`tag AUTHENTICATE EXTERNAL not*base64`)
+	s := rfcparser.NewScanner(bytes.NewReader(input))
+	p := NewParser(s)
+
+	_, err := p.Parse()
+	require.Error(t, err)
+}
+
+func TestParseAuthenticateResponse(t *testing.T) {
+	response, err := ParseAuthenticateResponse([]byte("dXNlckBleGFtcGxlLmNvbQ==\r\n"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("user@example.com"), response)
+
+	response, err = ParseAuthenticateResponse([]byte("\r\n"))
+	require.NoError(t, err)
+	require.Equal(t, []byte{}, response)
+
+	_, err = ParseAuthenticateResponse([]byte("*\r\n"))
+	require.ErrorIs(t, err, ErrAuthenticateCancelled)
+
+	_, err = ParseAuthenticateResponse([]byte("not*base64\r\n"))
+	require.Error(t, err)
+}
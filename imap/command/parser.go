@@ -29,34 +29,35 @@ func NewParserWithLiteralContinuationCb(s *rfcparser.Scanner, cb func() error) *
 		scanner: s,
 		parser:  rfcparser.NewParserWithLiteralContinuationCb(s, cb),
 		commands: map[string]Builder{
-			"list":        &ListCommandParser{},
-			"append":      &AppendCommandParser{},
-			"search":      &SearchCommandParser{},
-			"fetch":       &FetchCommandParser{},
-			"capability":  &CapabilityCommandParser{},
-			"idle":        &IdleCommandParser{},
-			"noop":        &NoopCommandParser{},
-			"logout":      &LogoutCommandParser{},
-			"check":       &CheckCommandParser{},
-			"close":       &CloseCommandParser{},
-			"expunge":     &ExpungeCommandParser{},
-			"unselect":    &UnselectCommandParser{},
-			"starttls":    &StartTLSCommandParser{},
-			"status":      &StatusCommandParser{},
-			"select":      &SelectCommandParser{},
-			"examine":     &ExamineCommandParser{},
-			"create":      &CreateCommandParser{},
-			"delete":      &DeleteCommandParser{},
-			"subscribe":   &SubscribeCommandParser{},
-			"unsubscribe": &UnsubscribeCommandParser{},
-			"rename":      &RenameCommandParser{},
-			"lsub":        &LSubCommandParser{},
-			"login":       &LoginCommandParser{},
-			"store":       &StoreCommandParser{},
-			"copy":        &CopyCommandParser{},
-			"move":        &MoveCommandParser{},
-			"uid":         NewUIDCommandParser(),
-			"id":          &IDCommandParser{},
+			"list":         &ListCommandParser{},
+			"append":       &AppendCommandParser{},
+			"search":       &SearchCommandParser{},
+			"fetch":        &FetchCommandParser{},
+			"capability":   &CapabilityCommandParser{},
+			"idle":         &IdleCommandParser{},
+			"noop":         &NoopCommandParser{},
+			"logout":       &LogoutCommandParser{},
+			"check":        &CheckCommandParser{},
+			"close":        &CloseCommandParser{},
+			"expunge":      &ExpungeCommandParser{},
+			"unselect":     &UnselectCommandParser{},
+			"starttls":     &StartTLSCommandParser{},
+			"status":       &StatusCommandParser{},
+			"select":       &SelectCommandParser{},
+			"examine":      &ExamineCommandParser{},
+			"create":       &CreateCommandParser{},
+			"delete":       &DeleteCommandParser{},
+			"subscribe":    &SubscribeCommandParser{},
+			"unsubscribe":  &UnsubscribeCommandParser{},
+			"rename":       &RenameCommandParser{},
+			"lsub":         &LSubCommandParser{},
+			"login":        &LoginCommandParser{},
+			"store":        &StoreCommandParser{},
+			"copy":         &CopyCommandParser{},
+			"move":         &MoveCommandParser{},
+			"uid":          NewUIDCommandParser(),
+			"id":           &IDCommandParser{},
+			"authenticate": &AuthenticateCommandParser{},
 		},
 	}
 }
@@ -0,0 +1,42 @@
+package imap
+
+// ConnectorHealth describes how well a connector is able to reach the remote it synchronizes with.
+type ConnectorHealth int
+
+const (
+	// HealthOnline means the connector is fully operational.
+	HealthOnline ConnectorHealth = iota
+
+	// HealthDegraded means the connector still works, but changes may be delayed or fail intermittently.
+	HealthDegraded
+
+	// HealthOffline means the connector can't reach the remote; the local data may be stale.
+	HealthOffline
+
+	// HealthAuthExpired means the connector's credentials are no longer accepted by the remote.
+	HealthAuthExpired
+)
+
+// IsAvailable returns whether the remote can currently be reached by the connector.
+func (h ConnectorHealth) IsAvailable() bool {
+	return h == HealthOnline || h == HealthDegraded
+}
+
+func (h ConnectorHealth) String() string {
+	switch h {
+	case HealthOnline:
+		return "online"
+
+	case HealthDegraded:
+		return "degraded"
+
+	case HealthOffline:
+		return "offline"
+
+	case HealthAuthExpired:
+		return "auth-expired"
+
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,32 @@
+package imap
+
+// FlagConflictPolicy decides how a message's flags are resolved when a client changed them locally while the
+// connector concurrently reported different flags for the same message.
+type FlagConflictPolicy int
+
+const (
+	// FlagConflictRemoteWins applies the flags reported by the connector, discarding the local change.
+	FlagConflictRemoteWins FlagConflictPolicy = iota
+
+	// FlagConflictLocalWins keeps the flags changed locally and sends them to the connector again.
+	FlagConflictLocalWins
+
+	// FlagConflictMergeUnion keeps every flag that is set either locally or remotely.
+	FlagConflictMergeUnion
+)
+
+func (p FlagConflictPolicy) String() string {
+	switch p {
+	case FlagConflictRemoteWins:
+		return "remote-wins"
+
+	case FlagConflictLocalWins:
+		return "local-wins"
+
+	case FlagConflictMergeUnion:
+		return "merge-union"
+
+	default:
+		return "unknown"
+	}
+}
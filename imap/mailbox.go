@@ -6,6 +6,9 @@ type Mailbox struct {
 	Name []string
 
 	Flags, PermanentFlags, Attributes FlagSet
+
+	// Permissions restricts what clients may do with the mailbox.
+	Permissions MailboxPermissions
 }
 
 type MailboxNoAttrib struct {
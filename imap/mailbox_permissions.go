@@ -0,0 +1,58 @@
+package imap
+
+import "strings"
+
+// MailboxPermissions describes what clients are allowed to do with a mailbox.
+// The zero value is treated as PermAll so that connectors which don't restrict their mailboxes needn't set it.
+type MailboxPermissions uint8
+
+const (
+	// PermRead allows the mailbox to be selected or examined.
+	PermRead MailboxPermissions = 1 << iota
+
+	// PermWriteFlags allows the flags of messages in the mailbox to be changed.
+	PermWriteFlags
+
+	// PermInsert allows messages to be appended, copied or moved into the mailbox.
+	PermInsert
+
+	// PermExpunge allows messages to be expunged or moved out of the mailbox.
+	PermExpunge
+
+	// PermCreateChildren allows mailboxes to be created below the mailbox.
+	PermCreateChildren
+
+	PermAll = PermRead | PermWriteFlags | PermInsert | PermExpunge | PermCreateChildren
+)
+
+var permissionNames = []string{"read", "write-flags", "insert", "expunge", "create-children"}
+
+// Has returns whether all the given permissions are granted.
+func (p MailboxPermissions) Has(perm MailboxPermissions) bool {
+	if p == 0 {
+		return true
+	}
+
+	return p&perm == perm
+}
+
+// IsReadOnly returns whether the mailbox contents can't be modified in any way once selected.
+func (p MailboxPermissions) IsReadOnly() bool {
+	return !p.Has(PermWriteFlags) && !p.Has(PermExpunge)
+}
+
+func (p MailboxPermissions) String() string {
+	if p == 0 {
+		p = PermAll
+	}
+
+	var perms []string
+
+	for i, name := range permissionNames {
+		if p&(1<<i) != 0 {
+			perms = append(perms, name)
+		}
+	}
+
+	return strings.Join(perms, ",")
+}
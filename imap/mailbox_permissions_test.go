@@ -0,0 +1,27 @@
+package imap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMailboxPermissionsZeroValueGrantsAll(t *testing.T) {
+	var perms MailboxPermissions
+
+	require.True(t, perms.Has(PermAll))
+	require.False(t, perms.IsReadOnly())
+	require.Equal(t, "read,write-flags,insert,expunge,create-children", perms.String())
+}
+
+func TestMailboxPermissionsHas(t *testing.T) {
+	perms := PermRead | PermInsert
+
+	require.True(t, perms.Has(PermRead))
+	require.True(t, perms.Has(PermRead|PermInsert))
+	require.False(t, perms.Has(PermRead|PermExpunge))
+	require.True(t, perms.IsReadOnly())
+	require.Equal(t, "read,insert", perms.String())
+
+	require.False(t, (PermRead | PermExpunge).IsReadOnly())
+}
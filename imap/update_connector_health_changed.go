@@ -0,0 +1,28 @@
+package imap
+
+import (
+	"fmt"
+)
+
+// ConnectorHealthChanged is sent by the connector when its health changes.
+// The message, if not empty, is shown to connected clients in place of the default one.
+type ConnectorHealthChanged struct {
+	updateBase
+
+	*updateWaiter
+
+	Health  ConnectorHealth
+	Message string
+}
+
+func NewConnectorHealthChanged(health ConnectorHealth, message string) *ConnectorHealthChanged {
+	return &ConnectorHealthChanged{
+		updateWaiter: newUpdateWaiter(),
+		Health:       health,
+		Message:      message,
+	}
+}
+
+func (u *ConnectorHealthChanged) String() string {
+	return fmt.Sprintf("ConnectorHealthChanged: Health = %v", u.Health)
+}
@@ -12,6 +12,9 @@ type MailboxUpdated struct {
 
 	MailboxID   MailboxID
 	MailboxName []string
+
+	// Permissions replaces the permissions of the mailbox, unless nil.
+	Permissions *MailboxPermissions
 }
 
 func NewMailboxUpdated(mailboxID MailboxID, mailboxName []string) *MailboxUpdated {
@@ -22,10 +25,22 @@ func NewMailboxUpdated(mailboxID MailboxID, mailboxName []string) *MailboxUpdate
 	}
 }
 
+// WithPermissions makes the update also replace the permissions of the mailbox.
+func (u *MailboxUpdated) WithPermissions(permissions MailboxPermissions) *MailboxUpdated {
+	u.Permissions = &permissions
+	return u
+}
+
 func (u *MailboxUpdated) String() string {
-	return fmt.Sprintf(
+	str := fmt.Sprintf(
 		"MailboxUpdated: MailboxID = %v, MailboxName = %v",
 		u.MailboxID.ShortID(),
 		ShortID(strings.Join(u.MailboxName, "/")),
 	)
+
+	if u.Permissions != nil {
+		str += fmt.Sprintf(", Permissions = %v", *u.Permissions)
+	}
+
+	return str
 }
@@ -0,0 +1,19 @@
+package imap
+
+// UsernamesChanged is sent by a connector implementing connector.UsernameOwner when the usernames it can be logged in
+// with change.
+type UsernamesChanged struct {
+	updateBase
+
+	*updateWaiter
+}
+
+func NewUsernamesChanged() *UsernamesChanged {
+	return &UsernamesChanged{
+		updateWaiter: newUpdateWaiter(),
+	}
+}
+
+func (u *UsernamesChanged) String() string {
+	return "UsernamesChanged"
+}
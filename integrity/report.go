@@ -0,0 +1,97 @@
+// Package integrity describes the outcome of checking a user's database and message store for inconsistencies.
+package integrity
+
+import (
+	"fmt"
+
+	"github.com/ProtonMail/gluon/imap"
+)
+
+// Kind identifies the invariant a Problem violates.
+type Kind string
+
+const (
+	// KindUIDCounter means a mailbox would assign a UID which one of its messages already has.
+	KindUIDCounter Kind = "uid-counter"
+
+	// KindMessageFlags means a message carries \Deleted or \Recent among its own flags,
+	// even though these are tracked per mailbox.
+	KindMessageFlags Kind = "message-flags"
+
+	// KindOrphanedFlags means flags are stored for a message which doesn't exist.
+	KindOrphanedFlags Kind = "orphaned-flags"
+
+	// KindNoMailbox means a message which isn't marked as deleted belongs to no mailbox.
+	KindNoMailbox Kind = "no-mailbox"
+
+	// KindDuplicateRemoteID means several messages or several mailboxes share the same remote ID.
+	KindDuplicateRemoteID Kind = "duplicate-remote-id"
+
+	// KindMissingLiteral means a message has no literal in the store.
+	KindMissingLiteral Kind = "missing-literal"
+
+	// KindStaleLiteral means the store holds a literal for a message which doesn't exist.
+	KindStaleLiteral Kind = "stale-literal"
+
+	// KindCorruptLiteral means a message's literal can't be read back from the store, or its size, internal ID
+	// header or hash don't match the message it's stored for.
+	KindCorruptLiteral Kind = "corrupt-literal"
+)
+
+// Problem is a single inconsistency found by a check.
+type Problem struct {
+	Kind Kind
+
+	// MailboxID is the remote ID of the mailbox concerned, if any.
+	MailboxID imap.MailboxID
+
+	// MessageID is the internal ID of the message concerned, if any.
+	MessageID imap.InternalMessageID
+
+	// Detail describes the problem in a human readable form.
+	Detail string
+
+	// Repaired is set if the check was asked to repair the problem and did so.
+	Repaired bool
+}
+
+func (p Problem) String() string {
+	var subject string
+
+	switch {
+	case p.MailboxID != "":
+		subject = fmt.Sprintf(" mailbox %v:", p.MailboxID)
+
+	case p.MessageID != imap.InternalMessageID{}:
+		subject = fmt.Sprintf(" message %v:", p.MessageID.ShortID())
+	}
+
+	var repaired string
+
+	if p.Repaired {
+		repaired = " (repaired)"
+	}
+
+	return fmt.Sprintf("%v:%v %v%v", p.Kind, subject, p.Detail, repaired)
+}
+
+// Report is the outcome of checking a user.
+type Report struct {
+	UserID string
+
+	// Mailboxes and Messages are the number of mailboxes and messages which were checked.
+	Mailboxes, Messages int
+
+	Problems []Problem
+}
+
+// OK returns whether every problem found was repaired.
+func (r *Report) OK() bool {
+	for _, p := range r.Problems {
+		if !p.Repaired {
+			return false
+		}
+	}
+
+	return true
+}
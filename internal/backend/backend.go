@@ -2,16 +2,19 @@ package backend
 
 import (
 	"context"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"net"
 	"sync"
-	"sync/atomic"
-	"time"
 
 	"github.com/ProtonMail/gluon/async"
+	"github.com/ProtonMail/gluon/auth"
 	"github.com/ProtonMail/gluon/connector"
 	"github.com/ProtonMail/gluon/db"
+	"github.com/ProtonMail/gluon/events"
 	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/internal/search"
 	"github.com/ProtonMail/gluon/internal/state"
 	"github.com/ProtonMail/gluon/limits"
 	"github.com/ProtonMail/gluon/observability"
@@ -20,11 +23,9 @@ import (
 	"github.com/ProtonMail/gluon/store"
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/maps"
 )
 
-// maxLoginAttempts is the maximum number of permitted login attempts before the user is jailed.
-const maxLoginAttempts = 3
-
 type Backend struct {
 	// dataDir is the directory in which backend files should be stored.
 	dataDir string
@@ -39,19 +40,38 @@ type Backend struct {
 	users     map[string]*user
 	usersLock sync.Mutex
 
+	// usernames indexes the users by the usernames their connectors own. It is guarded by usersLock.
+	usernames map[string][]string
+
+	// authenticator decides which user a login is for, or is nil if the connectors of the users do.
+	authenticator auth.Authenticator
+
 	// storeBuilder builds stores for the backend users.
 	storeBuilder store.Builder
 
-	// loginJailTime is the time a user is jailed after too many failed login attempts.
-	loginJailTime time.Duration
-
-	// loginErrorCount holds the number of failed login attempts for each user.
-	loginErrorCount int32
-	loginLock       sync.Mutex
-	loginWG         sync.WaitGroup
+	// loginThrottle delays logins from addresses and for usernames which failed to log in too often.
+	loginThrottle *loginThrottle
 
 	imapLimits limits.IMAP
 
+	// rejectUnavailableLogins indicates whether logins of users whose connector is unavailable should be rejected.
+	rejectUnavailableLogins bool
+
+	// searchIndex is true if a full-text search index is maintained for each user.
+	searchIndex bool
+
+	// storeBudget is the space each user's store may take before literals are evicted, or zero for no limit.
+	storeBudget int64
+
+	// maxUserConnections is how many sessions may be logged in to the same user, or zero for no limit.
+	maxUserConnections int
+
+	// flagConflictPolicy decides how concurrent local and remote flag changes are resolved.
+	flagConflictPolicy imap.FlagConflictPolicy
+
+	// eventCh is used to publish events originating from the backend users.
+	eventCh *async.QueuedChannel[events.Event]
+
 	database db.ClientInterface
 
 	panicHandler async.PanicHandler
@@ -62,25 +82,44 @@ type Backend struct {
 func New(dataDir, databaseDir string,
 	storeBuilder store.Builder,
 	delim string,
-	loginJailTime time.Duration,
+	loginThrottle limits.LoginThrottle,
+	authenticator auth.Authenticator,
 	imapLimits limits.IMAP,
+	rejectUnavailableLogins bool,
+	flagConflictPolicy imap.FlagConflictPolicy,
+	searchIndex bool,
+	storeBudget int64,
+	maxUserConnections int,
 	panicHandler async.PanicHandler,
 	database db.ClientInterface,
 ) (*Backend, error) {
 	return &Backend{
-		dataDir:       dataDir,
-		databaseDir:   databaseDir,
-		delim:         delim,
-		users:         make(map[string]*user),
-		storeBuilder:  storeBuilder,
-		loginJailTime: loginJailTime,
-		imapLimits:    imapLimits,
-		panicHandler:  panicHandler,
-		database:      database,
-		log:           logrus.WithField("pkg", "gluon/backend"),
+		dataDir:                 dataDir,
+		databaseDir:             databaseDir,
+		delim:                   delim,
+		users:                   make(map[string]*user),
+		storeBuilder:            storeBuilder,
+		loginThrottle:           newLoginThrottle(loginThrottle),
+		authenticator:           authenticator,
+		imapLimits:              imapLimits,
+		rejectUnavailableLogins: rejectUnavailableLogins,
+		flagConflictPolicy:      flagConflictPolicy,
+		searchIndex:             searchIndex,
+		storeBudget:             storeBudget,
+		maxUserConnections:      maxUserConnections,
+		eventCh:                 async.NewQueuedChannel[events.Event](0, 0, panicHandler, "gluon-backend-events"),
+		panicHandler:            panicHandler,
+		database:                database,
+		log:                     logrus.WithField("pkg", "gluon/backend"),
 	}, nil
 }
 
+// GetEvents returns a channel of events originating from the backend users.
+// The channel is closed when the backend is closed.
+func (b *Backend) GetEvents() <-chan events.Event {
+	return b.eventCh.GetChannel()
+}
+
 func (b *Backend) NewUserID() string {
 	return uuid.NewString()
 }
@@ -106,7 +145,29 @@ func (b *Backend) AddUser(ctx context.Context, userID string, conn connector.Con
 		}
 	}
 
-	database, isNew, err := b.database.New(b.getDBDir(), userID)
+	// A store which can't evict literals can't be kept within a budget.
+	if _, ok := storeBuilder.(store.Evictor); !ok && b.storeBudget > 0 {
+		onErrorExit()
+		return false, fmt.Errorf("the store can't be limited to a budget: %w", store.ErrEvictionUnsupported)
+	}
+
+	// A rotation may have been interrupted before the database was protected with the new passphrase.
+	oldPassphrase := rotationPassphrase(storeBuilder)
+
+	var searchIndex *search.Index
+
+	if b.searchIndex {
+		index, err := search.Open(b.getSearchIndexPath(userID), passphrase)
+		if err != nil {
+			onErrorExit()
+			return false, err
+		}
+
+		searchIndex = index
+		storeBuilder = &indexingStore{Store: storeBuilder, index: index}
+	}
+
+	database, isNew, err := b.openDatabase(ctx, userID, passphrase, oldPassphrase)
 	if err != nil {
 		onErrorExit()
 		return false, err
@@ -117,6 +178,12 @@ func (b *Backend) AddUser(ctx context.Context, userID string, conn connector.Con
 			b.log.WithError(err).Errorf("Failed to close db after migration failure")
 		}
 
+		// A database written by a newer version is kept for when that version is installed again.
+		if futureErr := new(db.FutureVersionError); errors.As(err, &futureErr) {
+			onErrorExit()
+			return false, err
+		}
+
 		if !errors.Is(err, db.ErrMigrationFailed) && !errors.Is(err, db.ErrInvalidDatabaseVersion) {
 			onErrorExit()
 			return false, err
@@ -134,7 +201,7 @@ func (b *Backend) AddUser(ctx context.Context, userID string, conn connector.Con
 			return false, fmt.Errorf("failed to remove database after migration: %w", err)
 		}
 
-		database, isNew, err = b.database.New(b.getDBDir(), userID)
+		database, isNew, err = b.newDatabase(userID, passphrase)
 		if err != nil {
 			b.log.WithError(err).Errorf("Failed to create new database")
 			onErrorExit()
@@ -160,12 +227,13 @@ func (b *Backend) AddUser(ctx context.Context, userID string, conn connector.Con
 		}
 	}
 
-	user, err := newUser(ctx, userID, database, conn, storeBuilder, b.delim, b.imapLimits, uidValidityGenerator, b.panicHandler)
+	user, err := newUser(ctx, userID, database, conn, storeBuilder, searchIndex, b.storeBudget, b.delim, b.imapLimits, uidValidityGenerator, b.flagConflictPolicy, b.eventCh, b.panicHandler)
 	if err != nil {
 		return false, err
 	}
 
 	b.users[userID] = user
+	b.indexUsernames()
 
 	return isNew, nil
 }
@@ -190,6 +258,7 @@ func (b *Backend) RemoveUser(ctx context.Context, userID string, removeFiles boo
 	}
 
 	delete(b.users, userID)
+	b.indexUsernames()
 
 	if removeFiles {
 		if err := b.storeBuilder.Delete(b.getStoreDir(), userID); err != nil {
@@ -199,11 +268,65 @@ func (b *Backend) RemoveUser(ctx context.Context, userID string, removeFiles boo
 		if err := b.database.Delete(b.getDBDir(), userID); err != nil {
 			return err
 		}
+
+		if err := search.Delete(b.getSearchIndexPath(userID)); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// DowngradeDatabase migrates the database of the given user back to an older schema version.
+// The user must not be loaded.
+func (b *Backend) DowngradeDatabase(ctx context.Context, userID string, passphrase []byte, version int) error {
+	b.usersLock.Lock()
+	defer b.usersLock.Unlock()
+
+	if _, ok := b.users[userID]; ok {
+		return ErrUserLoaded
+	}
+
+	database, isNew, err := b.newDatabase(userID, passphrase)
+	if err != nil {
+		return err
+	}
+
+	if isNew {
+		if err := database.Close(); err != nil {
+			return err
+		}
+
+		if err := b.database.Delete(b.getDBDir(), userID); err != nil {
+			return err
+		}
+
+		return ErrNoSuchUser
+	}
+
+	defer func() {
+		if err := database.Close(); err != nil {
+			b.log.WithError(err).Error("Failed to close database after downgrade")
+		}
+	}()
+
+	versioned, ok := database.(db.VersionedClient)
+	if !ok {
+		return ErrDowngradeUnsupported
+	}
+
+	return versioned.Downgrade(ctx, version)
+}
+
+// newDatabase opens the database of the given user, protected with its passphrase if the database client supports it.
+func (b *Backend) newDatabase(userID string, passphrase []byte) (db.Client, bool, error) {
+	if ci, ok := b.database.(db.PassphraseClientInterface); ok {
+		return ci.NewWithPassphrase(b.getDBDir(), userID, passphrase)
+	}
+
+	return b.database.New(b.getDBDir(), userID)
+}
+
 func (b *Backend) GetMailboxMessageCounts(ctx context.Context, userID string) (map[imap.MailboxID]int, error) {
 	b.usersLock.Lock()
 	defer b.usersLock.Unlock()
@@ -234,17 +357,63 @@ func (b *Backend) GetMailboxMessageCounts(ctx context.Context, userID string) (m
 	})
 }
 
-func (b *Backend) GetState(ctx context.Context, username string, password []byte, sessionID int) (*state.State, error) {
-	b.usersLock.Lock()
-	defer b.usersLock.Unlock()
+func (b *Backend) GetState(ctx context.Context, username string, password []byte, sessionID int, remoteAddr net.Addr) (*state.State, error) {
+	return b.login(ctx, username, remoteAddr, func(ctx context.Context) (string, error) {
+		return b.authenticate(ctx, username, password)
+	})
+}
 
-	userID, err := b.getUserID(ctx, username, password)
+// GetCertificateState returns a new state for a session logging in with the given verified TLS client certificate.
+// The username is the authorization identity, or the certificate's subject if the client didn't ask for one.
+// Certificates which don't log in to any user fail with ErrNoSuchUser and are throttled like wrong passwords.
+func (b *Backend) GetCertificateState(
+	ctx context.Context,
+	authenticator auth.CertificateAuthenticator,
+	cert *x509.Certificate,
+	authzID, username string,
+	remoteAddr net.Addr,
+) (*state.State, error) {
+	return b.login(ctx, username, remoteAddr, func(ctx context.Context) (string, error) {
+		userID, err := authenticator.AuthenticateCertificate(ctx, cert, authzID)
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			return "", ErrNoSuchUser
+		}
+
+		return userID, err
+	})
+}
+
+// login returns a new state for the user authenticate logs in to. Logins from addresses and for usernames which
+// failed too often, by authenticate returning ErrNoSuchUser, are delayed.
+func (b *Backend) login(
+	ctx context.Context,
+	username string,
+	remoteAddr net.Addr,
+	authenticate func(context.Context) (string, error),
+) (*state.State, error) {
+	keys := loginKeys(remoteAddr, username)
+
+	// Delayed logins wait before anything else so that they don't hold up other logins.
+	if err := b.loginThrottle.wait(ctx, keys); err != nil {
+		return nil, err
+	}
+
+	userID, err := authenticate(ctx)
 	if err != nil {
-		// todo filter on error and track ErrLoginBlocked to notify the connector
+		if !errors.Is(err, ErrNoSuchUser) {
+			return nil, err
+		}
+
+		if blocked, delay, until := b.loginThrottle.failed(keys); blocked {
+			return nil, &LoginBlockedError{Delay: delay, Until: until}
+		}
+
 		return nil, err
 	}
 
-	state, err := b.users[userID].newState()
+	b.loginThrottle.succeeded(username)
+
+	state, err := b.GetUserState(userID)
 	if err != nil {
 		return nil, err
 	}
@@ -258,6 +427,28 @@ func (b *Backend) GetState(ctx context.Context, username string, password []byte
 	return state, nil
 }
 
+// GetUserState returns a new state for a session logged in to the given user, whose credentials were already checked.
+func (b *Backend) GetUserState(userID string) (*state.State, error) {
+	b.usersLock.Lock()
+	defer b.usersLock.Unlock()
+
+	// The user may have been removed while the credentials were checked, or not be loaded at all.
+	user, ok := b.users[userID]
+	if !ok {
+		return nil, ErrNoSuchUser
+	}
+
+	if health := user.getHealth(); b.rejectUnavailableLogins && !health.IsAvailable() {
+		return nil, fmt.Errorf("%w: connector is %v", ErrUserUnavailable, health)
+	}
+
+	if b.maxUserConnections > 0 && user.countStates() >= b.maxUserConnections {
+		return nil, ErrTooManyConnections
+	}
+
+	return user.newState()
+}
+
 func (b *Backend) ReleaseState(ctx context.Context, st *state.State) error {
 	b.usersLock.Lock()
 	defer b.usersLock.Unlock()
@@ -272,10 +463,34 @@ func (b *Backend) ReleaseState(ctx context.Context, st *state.State) error {
 	return user.removeState(ctx, st)
 }
 
+// Flush waits until the users have applied the updates their connectors already delivered.
+func (b *Backend) Flush(ctx context.Context) error {
+	// The users are copied so that others can be added or removed while the updates are waited for.
+	b.usersLock.Lock()
+	users := maps.Clone(b.users)
+	b.usersLock.Unlock()
+
+	for userID, user := range users {
+		// Updates are applied in order, so the others are applied once this one is.
+		if err := user.injectUpdates(ctx, imap.NewNoop()); err != nil {
+			// A user removed meanwhile has nothing left to apply.
+			if errors.Is(err, ErrUserClosed) {
+				continue
+			}
+
+			return fmt.Errorf("failed to flush updates of user (%v): %w", userID, err)
+		}
+	}
+
+	return nil
+}
+
 func (b *Backend) Close(ctx context.Context) error {
 	b.usersLock.Lock()
 	defer b.usersLock.Unlock()
 
+	defer b.eventCh.Close()
+
 	for userID, user := range b.users {
 		if err := user.close(ctx); err != nil {
 			// there's no events like this in sentry so far.
@@ -295,33 +510,6 @@ func (b *Backend) Close(ctx context.Context) error {
 	return nil
 }
 
-func (b *Backend) getUserID(ctx context.Context, username string, password []byte) (string, error) {
-	b.loginLock.Lock()
-	defer b.loginLock.Unlock()
-
-	b.loginWG.Wait()
-
-	for _, user := range b.users {
-		if user.connector.Authorize(ctx, username, password) {
-			atomic.StoreInt32(&b.loginErrorCount, 0)
-			return user.userID, nil
-		}
-	}
-
-	if count := atomic.AddInt32(&b.loginErrorCount, 1); count == maxLoginAttempts {
-		b.loginWG.Add(1)
-
-		time.AfterFunc(b.loginJailTime, func() {
-			defer b.loginWG.Done()
-			atomic.StoreInt32(&b.loginErrorCount, 0)
-		})
-
-		return "", ErrLoginBlocked
-	}
-
-	return "", ErrNoSuchUser
-}
-
 func (b *Backend) getStoreDir() string {
 	return b.dataDir
 }
@@ -0,0 +1,454 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/ProtonMail/gluon/db"
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/integrity"
+	"github.com/ProtonMail/gluon/internal/ids"
+	"github.com/ProtonMail/gluon/rfc822"
+	"github.com/bradenaw/juniper/xslices"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// checkRepairBatchSize is the number of repairs applied per write transaction, so that repairing a large database
+// doesn't block every other write until it's done.
+const checkRepairBatchSize = 64
+
+// CheckUser checks the database and message store of the given user for inconsistencies.
+// If repair is set, the problems which can be fixed without data from the connector are fixed once they are found.
+func (b *Backend) CheckUser(ctx context.Context, userID string, repair bool) (*integrity.Report, error) {
+	b.usersLock.Lock()
+	user, ok := b.users[userID]
+	b.usersLock.Unlock()
+
+	if !ok {
+		return nil, ErrNoSuchUser
+	}
+
+	return user.check(ctx, repair)
+}
+
+func (user *user) check(ctx context.Context, repair bool) (*integrity.Report, error) {
+	check := &databaseCheck{report: &integrity.Report{UserID: user.userID}}
+
+	// The database is scanned in a single read transaction so the invariants are checked against a consistent state.
+	if err := user.db.Read(ctx, check.run); err != nil {
+		return nil, err
+	}
+
+	if repair {
+		if err := user.applyRepairs(ctx, check.report, check.repairs); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := user.checkStore(ctx, check, repair); err != nil {
+		return nil, err
+	}
+
+	return check.report, nil
+}
+
+// dbRepair fixes a problem found while scanning the database.
+// As it is applied in a later transaction, it must check that the problem still exists.
+type dbRepair struct {
+	// problem is the index of the problem in the report, or -1 if the repair fixes no reported problem.
+	problem int
+
+	apply func(ctx context.Context, tx db.Transaction) error
+}
+
+// applyRepairs applies the given repairs in batches of checkRepairBatchSize, each in its own write transaction.
+func (user *user) applyRepairs(ctx context.Context, report *integrity.Report, repairs []dbRepair) error {
+	for _, batch := range xslices.Chunk(repairs, checkRepairBatchSize) {
+		if err := user.db.Write(ctx, func(ctx context.Context, tx db.Transaction) error {
+			for _, r := range batch {
+				if err := r.apply(ctx, tx); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for _, r := range batch {
+			if r.problem >= 0 {
+				report.Problems[r.problem].Repaired = true
+			}
+		}
+	}
+
+	return nil
+}
+
+// databaseCheck collects the problems found in the database, along with the data the store is checked against.
+type databaseCheck struct {
+	report  *integrity.Report
+	repairs []dbRepair
+
+	messages      map[imap.InternalMessageID]*db.Message
+	literalHashes map[imap.InternalMessageID][]byte
+}
+
+// addProblem reports p; fix, if not nil, repairs it.
+func (check *databaseCheck) addProblem(p integrity.Problem, fix func(ctx context.Context, tx db.Transaction) error) {
+	if fix != nil {
+		check.repairs = append(check.repairs, dbRepair{problem: len(check.report.Problems), apply: fix})
+	}
+
+	check.report.Problems = append(check.report.Problems, p)
+}
+
+// run checks the invariants which only involve the database.
+func (check *databaseCheck) run(ctx context.Context, rd db.ReadOnly) error {
+	mailboxes, err := rd.GetAllMailboxesWithAttr(ctx)
+	if err != nil {
+		return err
+	}
+
+	check.report.Mailboxes = len(mailboxes)
+
+	mailboxRemoteIDs := make(map[imap.MailboxID][]string)
+	inMailbox := make(map[imap.InternalMessageID]struct{})
+
+	for _, mbox := range mailboxes {
+		mailboxRemoteIDs[mbox.RemoteID] = append(mailboxRemoteIDs[mbox.RemoteID], mbox.Name)
+
+		snapshot, err := rd.GetMailboxMessageForNewSnapshot(ctx, mbox.ID)
+		if err != nil {
+			return err
+		}
+
+		for _, msg := range snapshot {
+			inMailbox[msg.InternalID] = struct{}{}
+		}
+
+		if err := check.checkMailboxUIDs(ctx, rd, &mbox.Mailbox, snapshot); err != nil {
+			return err
+		}
+	}
+
+	for _, remoteID := range sortedKeys(mailboxRemoteIDs) {
+		if names := mailboxRemoteIDs[remoteID]; len(names) > 1 {
+			check.addProblem(integrity.Problem{
+				Kind:      integrity.KindDuplicateRemoteID,
+				MailboxID: remoteID,
+				Detail:    fmt.Sprintf("shared by mailboxes %q", names),
+			}, nil)
+		}
+	}
+
+	messageIDs, err := rd.GetAllMessagesIDsAsMap(ctx)
+	if err != nil {
+		return err
+	}
+
+	check.report.Messages = len(messageIDs)
+	check.messages = make(map[imap.InternalMessageID]*db.Message, len(messageIDs))
+
+	messageRemoteIDs := make(map[imap.MessageID][]imap.InternalMessageID)
+
+	for id := range messageIDs {
+		msg, err := rd.GetMessageNoEdges(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		check.messages[id] = msg
+		messageRemoteIDs[msg.RemoteID] = append(messageRemoteIDs[msg.RemoteID], id)
+	}
+
+	for _, remoteID := range sortedKeys(messageRemoteIDs) {
+		if msgIDs := messageRemoteIDs[remoteID]; len(msgIDs) > 1 {
+			check.addProblem(integrity.Problem{
+				Kind:   integrity.KindDuplicateRemoteID,
+				Detail: fmt.Sprintf("remote message ID %v shared by %v messages", remoteID, len(msgIDs)),
+			}, nil)
+		}
+	}
+
+	sortedMessageIDs := sortMessageIDs(maps.Keys(messageIDs))
+
+	// Whether a message still belongs to a mailbox is only known to the connector, so these aren't repaired.
+	for _, id := range sortedMessageIDs {
+		if _, ok := inMailbox[id]; ok || check.messages[id].Deleted {
+			continue
+		}
+
+		check.addProblem(integrity.Problem{
+			Kind:      integrity.KindNoMailbox,
+			MessageID: id,
+			Detail:    fmt.Sprintf("remote message %v belongs to no mailbox", check.messages[id].RemoteID),
+		}, nil)
+	}
+
+	if err := check.checkMessageFlags(ctx, rd, sortedMessageIDs); err != nil {
+		return err
+	}
+
+	orphaned, err := rd.GetOrphanedFlagMessageIDs(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range sortMessageIDs(orphaned) {
+		id := id
+
+		check.addProblem(integrity.Problem{
+			Kind:      integrity.KindOrphanedFlags,
+			MessageID: id,
+			Detail:    "flags stored for a message which doesn't exist",
+		}, func(ctx context.Context, tx db.Transaction) error {
+			if exists, err := tx.MessageExists(ctx, id); err != nil || exists {
+				return err
+			}
+
+			return tx.SetFlagsOnMessages(ctx, []imap.InternalMessageID{id}, imap.NewFlagSet())
+		})
+	}
+
+	literalHashes, err := rd.GetMessageLiteralHashes(ctx, sortedMessageIDs)
+	if err != nil {
+		return err
+	}
+
+	check.literalHashes = literalHashes
+
+	return nil
+}
+
+// checkMailboxUIDs checks that the next UID the mailbox assigns is above the UIDs of its messages.
+func (check *databaseCheck) checkMailboxUIDs(
+	ctx context.Context,
+	rd db.ReadOnly,
+	mbox *db.Mailbox,
+	snapshot []db.SnapshotMessageResult,
+) error {
+	if len(snapshot) == 0 {
+		return nil
+	}
+
+	uidNext, err := rd.GetMailboxUID(ctx, mbox.ID)
+	if err != nil {
+		return err
+	}
+
+	var maxUID imap.UID
+
+	for _, msg := range snapshot {
+		if msg.UID > maxUID {
+			maxUID = msg.UID
+		}
+	}
+
+	if maxUID < uidNext {
+		return nil
+	}
+
+	check.addProblem(integrity.Problem{
+		Kind:      integrity.KindUIDCounter,
+		MailboxID: mbox.RemoteID,
+		Detail:    fmt.Sprintf("next UID is %v but UID %v is already assigned", uidNext, maxUID),
+	}, func(ctx context.Context, tx db.Transaction) error {
+		if exists, err := tx.MailboxExistsWithID(ctx, mbox.ID); err != nil || !exists {
+			return err
+		}
+
+		// The next UID is only ever raised, so this is a no-op if it was raised since.
+		return tx.BumpMailboxUIDNext(ctx, mbox.ID, maxUID.Add(1))
+	})
+
+	return nil
+}
+
+// checkMessageFlags checks that no message carries flags which are tracked per mailbox.
+func (check *databaseCheck) checkMessageFlags(ctx context.Context, rd db.ReadOnly, messageIDs []imap.InternalMessageID) error {
+	for _, chunk := range xslices.Chunk(messageIDs, db.ChunkLimit) {
+		flagSets, err := rd.GetMessagesFlags(ctx, chunk)
+		if err != nil {
+			return err
+		}
+
+		for _, flagSet := range flagSets {
+			for _, flag := range []string{imap.FlagDeleted, imap.FlagRecent} {
+				if !flagSet.FlagSet.Contains(flag) {
+					continue
+				}
+
+				id, flag := flagSet.ID, flag
+
+				check.addProblem(integrity.Problem{
+					Kind:      integrity.KindMessageFlags,
+					MessageID: id,
+					Detail:    fmt.Sprintf("message flags contain %v", flag),
+				}, func(ctx context.Context, tx db.Transaction) error {
+					if exists, err := tx.MessageExists(ctx, id); err != nil || !exists {
+						return err
+					}
+
+					return tx.RemoveFlagFromMessages(ctx, []imap.InternalMessageID{id}, flag)
+				})
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkStore checks that the store holds exactly one intact literal for each message in the database, unless it
+// was evicted.
+// Only literals of messages which don't exist are repaired, by deleting them. The hashes of intact literals of
+// messages created before hashes were stored are recorded.
+func (user *user) checkStore(ctx context.Context, check *databaseCheck, repair bool) error {
+	storeIDs, err := user.store.List()
+	if err != nil {
+		return err
+	}
+
+	stored := make(map[imap.InternalMessageID]struct{}, len(storeIDs))
+
+	for _, id := range storeIDs {
+		stored[id] = struct{}{}
+	}
+
+	var hashRepairs []dbRepair
+
+	for _, id := range sortMessageIDs(maps.Keys(check.messages)) {
+		id, msg := id, check.messages[id]
+
+		// Messages marked as deleted are removed along with their literal once no session needs them anymore.
+		if msg.Deleted {
+			continue
+		}
+
+		if _, ok := stored[id]; !ok {
+			// With a store budget, literals are evicted and fetched from the connector again when needed.
+			if user.storeBudget > 0 && !ids.IsRecoveredRemoteMessageID(msg.RemoteID) {
+				continue
+			}
+
+			check.addProblem(integrity.Problem{
+				Kind:      integrity.KindMissingLiteral,
+				MessageID: id,
+				Detail:    fmt.Sprintf("no literal stored for remote message %v", msg.RemoteID),
+			}, nil)
+
+			continue
+		}
+
+		hash, hasHash := check.literalHashes[id]
+
+		literalHash, detail := user.checkLiteral(msg, hash)
+		if detail != "" {
+			check.addProblem(integrity.Problem{
+				Kind:      integrity.KindCorruptLiteral,
+				MessageID: id,
+				Detail:    detail,
+			}, nil)
+
+			continue
+		}
+
+		if !hasHash {
+			hashRepairs = append(hashRepairs, dbRepair{problem: -1, apply: func(ctx context.Context, tx db.Transaction) error {
+				if exists, err := tx.MessageExists(ctx, id); err != nil || !exists {
+					return err
+				}
+
+				return tx.StoreMessageLiteralHash(ctx, id, literalHash)
+			}})
+		}
+	}
+
+	if repair {
+		if err := user.applyRepairs(ctx, check.report, hashRepairs); err != nil {
+			return err
+		}
+	}
+
+	stale := xslices.Filter(storeIDs, func(id imap.InternalMessageID) bool {
+		_, ok := check.messages[id]
+		return !ok
+	})
+
+	if len(stale) > 0 && repair {
+		// A message may have been created since the database was checked; its literal is stored first.
+		existing, err := db.ClientReadType(ctx, user.db, func(ctx context.Context, client db.ReadOnly) (map[imap.InternalMessageID]struct{}, error) {
+			return client.GetAllMessagesIDsAsMap(ctx)
+		})
+		if err != nil {
+			return err
+		}
+
+		stale = xslices.Filter(stale, func(id imap.InternalMessageID) bool {
+			_, ok := existing[id]
+			return !ok
+		})
+
+		if err := user.store.Delete(stale...); err != nil {
+			return err
+		}
+	}
+
+	for _, id := range sortMessageIDs(stale) {
+		check.report.Problems = append(check.report.Problems, integrity.Problem{
+			Kind:      integrity.KindStaleLiteral,
+			MessageID: id,
+			Detail:    "literal stored for a message which doesn't exist",
+			Repaired:  repair,
+		})
+	}
+
+	return nil
+}
+
+// checkLiteral returns the hash of the stored literal of msg, and why it doesn't match msg and its stored hash, if it
+// has one, or an empty string if it does.
+func (user *user) checkLiteral(msg *db.Message, hash []byte) ([]byte, string) {
+	literal, err := user.store.Get(msg.ID)
+	if err != nil {
+		return nil, fmt.Sprintf("failed to read literal: %v", err)
+	}
+
+	if len(literal) != msg.Size {
+		return nil, fmt.Sprintf("literal is %v bytes but the message is %v bytes", len(literal), msg.Size)
+	}
+
+	if id, err := rfc822.GetHeaderValue(literal, ids.InternalIDKey); err != nil {
+		return nil, fmt.Sprintf("failed to parse literal header: %v", err)
+	} else if id != "" && id != msg.ID.String() {
+		return nil, fmt.Sprintf("literal belongs to message %v", id)
+	}
+
+	literalHash := db.NewLiteralHash(literal)
+
+	if hash != nil && !bytes.Equal(hash, literalHash) {
+		return nil, "literal doesn't match its hash"
+	}
+
+	return literalHash, ""
+}
+
+// sortMessageIDs sorts ids in place so reports list problems in a stable order.
+func sortMessageIDs(ids []imap.InternalMessageID) []imap.InternalMessageID {
+	slices.SortFunc(ids, func(a, b imap.InternalMessageID) bool {
+		return a.String() < b.String()
+	})
+
+	return ids
+}
+
+func sortedKeys[K interface{ ~string }, V any](m map[K]V) []K {
+	keys := maps.Keys(m)
+
+	slices.Sort(keys)
+
+	return keys
+}
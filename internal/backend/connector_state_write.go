@@ -51,6 +51,7 @@ func (d *DBIMAPStateWrite) CreateMailbox(ctx context.Context, mailbox imap.Mailb
 		mailbox.Flags,
 		mailbox.PermanentFlags,
 		mailbox.Attributes,
+		mailbox.Permissions,
 		uidValidity,
 	); err != nil {
 		return err
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"io"
 	"os"
 	"runtime"
 	"strings"
@@ -58,6 +57,13 @@ func (user *user) apply(ctx context.Context, update imap.Update) error {
 		case *imap.UIDValidityBumped:
 			return user.applyUIDValidityBumped(ctx, update)
 
+		case *imap.ConnectorHealthChanged:
+			return user.applyConnectorHealthChanged(ctx, update)
+
+		case *imap.UsernamesChanged:
+			user.usernamesChanged.Store(true)
+			return nil
+
 		case *imap.Noop:
 			return nil
 
@@ -82,7 +88,10 @@ func (user *user) applyMailboxCreated(ctx context.Context, update *imap.MailboxC
 	}); err != nil {
 		return err
 	} else if exists {
-		return nil
+		// The connector may have changed what clients are allowed to do with the mailbox.
+		return user.db.Write(ctx, func(ctx context.Context, tx db.Transaction) error {
+			return tx.SetMailboxPermissionsWithRemoteID(ctx, update.Mailbox.ID, update.Mailbox.Permissions)
+		})
 	}
 
 	uidValidity, err := user.uidValidityGenerator.Generate()
@@ -108,6 +117,7 @@ func (user *user) applyMailboxCreated(ctx context.Context, update *imap.MailboxC
 			update.Mailbox.Flags,
 			update.Mailbox.PermanentFlags,
 			update.Mailbox.Attributes,
+			update.Mailbox.Permissions,
 			uidValidity,
 		); err != nil {
 			return err
@@ -158,6 +168,12 @@ func (user *user) applyMailboxUpdated(ctx context.Context, update *imap.MailboxU
 			return nil
 		}
 
+		if update.Permissions != nil {
+			if err := tx.SetMailboxPermissionsWithRemoteID(ctx, update.MailboxID, *update.Permissions); err != nil {
+				return err
+			}
+		}
+
 		currentName, err := tx.GetMailboxNameWithRemoteID(ctx, update.MailboxID)
 		if err != nil {
 			return err
@@ -193,9 +209,14 @@ func (user *user) applyMailboxIDChanged(ctx context.Context, update *imap.Mailbo
 
 // applyMessagesCreated applies a MessagesCreated update.
 func (user *user) applyMessagesCreated(ctx context.Context, update *imap.MessagesCreated) error {
+	sieveOutcomes, err := user.applySieve(ctx, update)
+	if err != nil {
+		return fmt.Errorf("failed to apply sieve script: %w", err)
+	}
+
 	type DBRequestWithLiteral struct {
 		db.CreateMessageReq
-		reader io.Reader
+		reader *db.LiteralHasher
 	}
 
 	// collect all unique messages to create
@@ -204,7 +225,7 @@ func (user *user) applyMessagesCreated(ctx context.Context, update *imap.Message
 	messageForMBox := make(map[imap.InternalMailboxID][]db.MessageIDPair)
 	mboxInternalIDMap := make(map[imap.MailboxID]imap.InternalMailboxID)
 
-	err := userDBWrite(ctx, user, func(ctx context.Context, tx db.Transaction) ([]state.Update, error) {
+	err = userDBWrite(ctx, user, func(ctx context.Context, tx db.Transaction) ([]state.Update, error) {
 		for _, message := range update.Messages {
 			if slices.Contains(message.MailboxIDs, ids.GluonInternalRecoveryMailboxRemoteID) {
 				user.log.Errorf("attempting to import messages into protected mailbox (recovery), skipping")
@@ -230,8 +251,10 @@ func (user *user) applyMessagesCreated(ctx context.Context, update *imap.Message
 							Structure:   message.ParsedMessage.Structure,
 							Envelope:    message.ParsedMessage.Envelope,
 							InternalID:  internalID,
+
+							HeaderFields: db.NewMessageHeaderFields(message.Literal),
 						},
-						reader: literalReader,
+						reader: db.NewLiteralHasher(literalReader),
 					}
 
 					messagesToCreate = append(messagesToCreate, request)
@@ -291,6 +314,8 @@ func (user *user) applyMessagesCreated(ctx context.Context, update *imap.Message
 					return fmt.Errorf("failed to store message literal: %w", err)
 				}
 
+				msg.LiteralHash = msg.reader.Sum()
+
 				return nil
 			}); err != nil {
 				return nil, err
@@ -339,9 +364,13 @@ func (user *user) applyMessagesCreated(ctx context.Context, update *imap.Message
 				}
 			}
 		}
+
+		return err
 	}
 
-	return err
+	user.propagateSieve(ctx, sieveOutcomes)
+
+	return nil
 }
 
 // applyMessageMailboxesUpdated applies a MessageMailboxesUpdated update.
@@ -413,7 +442,17 @@ func (user *user) applyMessageFlagsUpdated(ctx context.Context, update *imap.Mes
 			return nil, err
 		}
 
-		return user.setMessageFlags(ctx, tx, internalMsgID, update.Flags)
+		flags, updates, err := user.resolveFlagConflict(ctx, tx, db.MessageIDPair{InternalID: internalMsgID, RemoteID: update.MessageID}, update.Flags)
+		if err != nil {
+			return nil, err
+		}
+
+		flagUpdates, err := user.setMessageFlags(ctx, tx, internalMsgID, flags)
+		if err != nil {
+			return nil, err
+		}
+
+		return append(updates, flagUpdates...), nil
 	})
 }
 
@@ -689,13 +728,19 @@ func (user *user) applyMessageUpdated(ctx context.Context, update *imap.MessageU
 					Structure:   update.ParsedMessage.Structure,
 					Envelope:    update.ParsedMessage.Envelope,
 					InternalID:  newInternalID,
+
+					HeaderFields: db.NewMessageHeaderFields(update.Literal),
 				}
 
-				if err := tx.CreateMessages(ctx, request); err != nil {
+				hasher := db.NewLiteralHasher(literalReader)
+
+				if err := user.store.Set(newInternalID, hasher); err != nil {
 					return nil, err
 				}
 
-				if err := user.store.Set(newInternalID, literalReader); err != nil {
+				request.LiteralHash = hasher.Sum()
+
+				if err := tx.CreateMessages(ctx, request); err != nil {
 					return nil, err
 				}
 
@@ -1,8 +1,37 @@
 package backend
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 var (
 	ErrNoSuchUser   = errors.New("no such user")
 	ErrLoginBlocked = errors.New("too many login attempts")
+	ErrUserClosed   = errors.New("user was closed")
+	ErrUserLoaded   = errors.New("user is loaded")
+
+	ErrUserUnavailable    = errors.New("user is unavailable")
+	ErrTooManyConnections = errors.New("too many connections to user")
+
+	ErrSearchIndexDisabled = errors.New("search index is disabled")
+
+	ErrUnsupportedSieveFlag = errors.New("sieve script adds a flag the connector can't store")
+
+	ErrDowngradeUnsupported = errors.New("database doesn't support downgrades")
 )
+
+// LoginBlockedError is returned when a login failed once too often for its address or username.
+type LoginBlockedError struct {
+	// Delay is how long further logins from the address or for the username are delayed, which is until Until.
+	Delay time.Duration
+	Until time.Time
+}
+
+func (e *LoginBlockedError) Error() string {
+	return ErrLoginBlocked.Error()
+}
+
+func (e *LoginBlockedError) Unwrap() error {
+	return ErrLoginBlocked
+}
@@ -0,0 +1,145 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ProtonMail/gluon/db"
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/internal/ids"
+	"github.com/ProtonMail/gluon/store"
+	"golang.org/x/exp/slices"
+)
+
+// storeEvictionInterval is how often the store of each user is checked against its budget.
+const storeEvictionInterval = time.Minute
+
+// storeEvictionTarget is the share of the budget that eviction frees the store down to, so that it doesn't exceed the
+// budget again as soon as the next literal is written.
+const storeEvictionTarget = 0.9
+
+// EvictUserStore evicts the least recently used literals of the given user until its store is within its budget.
+// It does nothing if the store has no budget.
+func (b *Backend) EvictUserStore(ctx context.Context, userID string) error {
+	b.usersLock.Lock()
+	user, ok := b.users[userID]
+	b.usersLock.Unlock()
+
+	if !ok {
+		return ErrNoSuchUser
+	}
+
+	return user.evictStore(ctx)
+}
+
+// GetUserStoreSize returns the space taken by the literals in the store of the given user.
+func (b *Backend) GetUserStoreSize(_ context.Context, userID string) (int64, error) {
+	b.usersLock.Lock()
+	user, ok := b.users[userID]
+	b.usersLock.Unlock()
+
+	if !ok {
+		return 0, ErrNoSuchUser
+	}
+
+	usage, err := user.store.Usage()
+	if err != nil {
+		return 0, err
+	}
+
+	return store.TotalSize(usage), nil
+}
+
+// evictStore evicts the least recently used literals until the store is back below its budget.
+// Literals which can't be fetched from the connector again, those of recovered messages and of messages waiting to
+// be removed, are kept.
+func (user *user) evictStore(ctx context.Context) error {
+	if user.storeBudget <= 0 {
+		return nil
+	}
+
+	user.evictLock.Lock()
+	defer user.evictLock.Unlock()
+
+	usage, err := user.store.Usage()
+	if err != nil {
+		return err
+	}
+
+	size := store.TotalSize(usage)
+	if size <= user.storeBudget {
+		return nil
+	}
+
+	slices.SortFunc(usage, func(a, b store.Usage) bool {
+		return a.LastAccess.Before(b.LastAccess)
+	})
+
+	target := int64(float64(user.storeBudget) * storeEvictionTarget)
+
+	evict, err := db.ClientReadType(ctx, user.db, func(ctx context.Context, client db.ReadOnly) ([]imap.InternalMessageID, error) {
+		var evict []imap.InternalMessageID
+
+		for _, u := range usage {
+			if size <= target {
+				break
+			}
+
+			msg, err := client.GetMessageNoEdges(ctx, u.MessageID)
+			if db.IsErrNotFound(err) {
+				// The message may still be being created; its literal is stored first.
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+
+			if msg.Deleted || ids.IsRecoveredRemoteMessageID(msg.RemoteID) {
+				continue
+			}
+
+			evict = append(evict, u.MessageID)
+			size -= u.Size
+		}
+
+		return evict, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := user.store.Evict(evict...); err != nil {
+		return err
+	}
+
+	user.log.WithField("count", len(evict)).Debug("Evicted literals from store")
+
+	return nil
+}
+
+// evictStorePeriodically keeps the store within its budget until the user is closed.
+func (user *user) evictStorePeriodically(ctx context.Context) {
+	ticker := time.NewTicker(storeEvictionInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := user.evictStore(ctx); err != nil {
+			if errors.Is(err, store.ErrEvictionUnsupported) {
+				user.log.Warn("Store budget is set but the store doesn't support eviction")
+				return
+			}
+
+			user.log.WithError(err).Error("Failed to evict literals from store")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-user.updateQuitCh:
+			return
+
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/gluon/db"
+	"github.com/ProtonMail/gluon/events"
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/internal/state"
+)
+
+// flagConflictWindow is how long a local flag change waits to be acknowledged by the connector.
+// A remote flag update which disagrees with a younger local change is treated as a conflict rather than as a newer
+// change made on the remote.
+const flagConflictWindow = time.Minute
+
+// remoteFlag is a flag which is sent to the connector when changed locally and can therefore conflict.
+type remoteFlag int
+
+const (
+	remoteFlagSeen remoteFlag = iota
+	remoteFlagFlagged
+	remoteFlagForwarded
+)
+
+func (f remoteFlag) isSet(flags imap.FlagSet) bool {
+	switch f {
+	case remoteFlagSeen:
+		return flags.ContainsUnchecked(imap.FlagSeenLowerCase)
+
+	case remoteFlagFlagged:
+		return flags.ContainsUnchecked(imap.FlagFlaggedLowerCase)
+
+	default:
+		return flags.ContainsAnyUnchecked(imap.ForwardFlagListLowerCase...)
+	}
+}
+
+func (f remoteFlag) set(flags imap.FlagSet, on bool) imap.FlagSet {
+	switch f {
+	case remoteFlagSeen:
+		return flags.Set(imap.FlagSeen, on)
+
+	case remoteFlagFlagged:
+		return flags.Set(imap.FlagFlagged, on)
+
+	default:
+		if on {
+			return flags.Add(imap.ForwardFlagList...)
+		}
+
+		return flags.Remove(imap.ForwardFlagList...)
+	}
+}
+
+func (f remoteFlag) push(ctx context.Context, user *user, cache *DBIMAPStateWrite, messageIDs []imap.MessageID, on bool) error {
+	switch f {
+	case remoteFlagSeen:
+		return user.connector.MarkMessagesSeen(ctx, cache, messageIDs, on)
+
+	case remoteFlagFlagged:
+		return user.connector.MarkMessagesFlagged(ctx, cache, messageIDs, on)
+
+	default:
+		return user.connector.MarkMessagesForwarded(ctx, cache, messageIDs, on)
+	}
+}
+
+// flagVersion holds the local flag changes of a message which the connector hasn't acknowledged yet.
+type flagVersion struct {
+	// version is incremented on every local change of the message's flags.
+	version uint64
+
+	// pending maps each flag changed locally to its new value.
+	pending map[remoteFlag]bool
+
+	// changedAt is the time of the last local change.
+	changedAt time.Time
+}
+
+// flagVersions tracks the versions of the flags of a user's messages, so that remote flag updates racing with local
+// changes can be detected.
+type flagVersions struct {
+	versions map[imap.MessageID]*flagVersion
+	lock     sync.Mutex
+
+	// lastSweep is the last time versions older than flagConflictWindow were evicted.
+	lastSweep time.Time
+}
+
+func newFlagVersions() *flagVersions {
+	return &flagVersions{
+		versions: make(map[imap.MessageID]*flagVersion),
+	}
+}
+
+// recordLocal records that the given flag was changed locally on the given messages.
+// It must be called before the change is sent to the connector, as the connector may acknowledge it immediately.
+// It returns the new versions of the messages' flags.
+func (fv *flagVersions) recordLocal(messageIDs []imap.MessageID, flag remoteFlag, on bool) map[imap.MessageID]uint64 {
+	fv.lock.Lock()
+	defer fv.lock.Unlock()
+
+	now := time.Now()
+
+	// Changes the connector never acknowledged would otherwise be kept forever.
+	if now.Sub(fv.lastSweep) > flagConflictWindow {
+		fv.evictExpired(now)
+	}
+
+	versions := make(map[imap.MessageID]uint64, len(messageIDs))
+
+	for _, messageID := range messageIDs {
+		v, ok := fv.versions[messageID]
+		if !ok {
+			v = &flagVersion{pending: make(map[remoteFlag]bool)}
+			fv.versions[messageID] = v
+		}
+
+		v.version++
+		v.pending[flag] = on
+		v.changedAt = now
+
+		versions[messageID] = v.version
+	}
+
+	return versions
+}
+
+// revertLocal forgets local changes recorded with recordLocal which couldn't be sent to the connector.
+// Messages whose flags were changed again in the meantime are left alone.
+func (fv *flagVersions) revertLocal(versions map[imap.MessageID]uint64, flag remoteFlag) {
+	fv.lock.Lock()
+	defer fv.lock.Unlock()
+
+	for messageID, version := range versions {
+		if v, ok := fv.versions[messageID]; ok && v.version == version {
+			fv.forget(messageID, v, flag)
+		}
+	}
+}
+
+// checkRemote compares the flags reported by the connector for a message with its unacknowledged local changes.
+// Local changes which the remote agrees with are acknowledged; the ones it disagrees with are returned.
+func (fv *flagVersions) checkRemote(messageID imap.MessageID, remote imap.FlagSet) map[remoteFlag]bool {
+	fv.lock.Lock()
+	defer fv.lock.Unlock()
+
+	v, ok := fv.versions[messageID]
+	if !ok {
+		return nil
+	}
+
+	if time.Since(v.changedAt) > flagConflictWindow {
+		delete(fv.versions, messageID)
+		return nil
+	}
+
+	conflicts := make(map[remoteFlag]bool)
+
+	for flag, on := range v.pending {
+		if flag.isSet(remote) == on {
+			fv.forget(messageID, v, flag)
+		} else {
+			conflicts[flag] = on
+		}
+	}
+
+	return conflicts
+}
+
+// resolved updates the unacknowledged local change of a flag after a conflict was resolved.
+// If the local value was kept, the connector is expected to acknowledge it again; otherwise it is forgotten.
+func (fv *flagVersions) resolved(messageID imap.MessageID, flag remoteFlag, kept bool) {
+	fv.lock.Lock()
+	defer fv.lock.Unlock()
+
+	v, ok := fv.versions[messageID]
+	if !ok {
+		return
+	}
+
+	if kept {
+		v.changedAt = time.Now()
+	} else {
+		fv.forget(messageID, v, flag)
+	}
+}
+
+// evictExpired forgets the local changes older than flagConflictWindow; they can no longer conflict.
+func (fv *flagVersions) evictExpired(now time.Time) {
+	for messageID, v := range fv.versions {
+		if now.Sub(v.changedAt) > flagConflictWindow {
+			delete(fv.versions, messageID)
+		}
+	}
+
+	fv.lastSweep = now
+}
+
+func (fv *flagVersions) forget(messageID imap.MessageID, v *flagVersion, flag remoteFlag) {
+	delete(v.pending, flag)
+
+	if len(v.pending) == 0 {
+		delete(fv.versions, messageID)
+	}
+}
+
+// resolveFlagConflict returns the flags a message should have after the connector reported the given flags for it.
+// If the remote flags conflict with unacknowledged local changes, the conflict is resolved with the user's policy,
+// any local values which are kept are sent to the connector again, and a MessageFlagsConflict event is published.
+func (user *user) resolveFlagConflict(
+	ctx context.Context,
+	tx db.Transaction,
+	messageID db.MessageIDPair,
+	remote imap.FlagSet,
+) (imap.FlagSet, []state.Update, error) {
+	conflicts := user.flagVersions.checkRemote(messageID.RemoteID, remote)
+	if len(conflicts) == 0 {
+		return remote, nil, nil
+	}
+
+	curFlags, err := tx.GetMessagesFlags(ctx, []imap.InternalMessageID{messageID.InternalID})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	local := curFlags[0].FlagSet
+
+	var resolved imap.FlagSet
+
+	switch user.flagConflictPolicy {
+	case imap.FlagConflictLocalWins:
+		resolved = remote.Clone()
+
+		for flag, on := range conflicts {
+			resolved = flag.set(resolved, on)
+		}
+
+	case imap.FlagConflictMergeUnion:
+		resolved = remote.AddFlagSet(local)
+
+	default:
+		resolved = remote
+	}
+
+	cache := &DBIMAPStateWrite{DBIMAPStateRead: DBIMAPStateRead{rd: tx}, tx: tx, user: user}
+
+	for flag, on := range conflicts {
+		kept := flag.isSet(resolved) == on
+
+		if kept {
+			if err := flag.push(ctx, user, cache, []imap.MessageID{messageID.RemoteID}, on); err != nil {
+				return nil, nil, fmt.Errorf("failed to send resolved flags to connector: %w", err)
+			}
+		}
+
+		user.flagVersions.resolved(messageID.RemoteID, flag, kept)
+	}
+
+	user.log.WithField("messageID", messageID.RemoteID.ShortID()).
+		WithField("policy", user.flagConflictPolicy).
+		Info("Resolved conflicting flag changes")
+
+	if !user.eventCh.Enqueue(events.MessageFlagsConflict{
+		UserID:        user.userID,
+		MessageID:     messageID.RemoteID,
+		LocalFlags:    local,
+		RemoteFlags:   remote,
+		ResolvedFlags: resolved,
+		Policy:        user.flagConflictPolicy,
+	}) {
+		user.log.Warn("Failed to publish flag conflict event")
+	}
+
+	return resolved, cache.stateUpdates, nil
+}
@@ -0,0 +1,72 @@
+package backend
+
+import (
+	"context"
+
+	"github.com/ProtonMail/gluon/events"
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/internal/state"
+)
+
+// applyConnectorHealthChanged records the new health of the connector and notifies the states and watchers about it.
+func (user *user) applyConnectorHealthChanged(_ context.Context, update *imap.ConnectorHealthChanged) error {
+	user.healthLock.Lock()
+	prev := user.health
+	user.health, user.healthMsg = update.Health, update.Message
+	user.healthLock.Unlock()
+
+	if prev == update.Health {
+		return nil
+	}
+
+	user.log.WithField("health", update.Health).Info("Connector health changed")
+
+	user.queueStateUpdate(state.NewAlertStateUpdate(getHealthAlert(update.Health, update.Message)))
+
+	if !user.eventCh.Enqueue(events.ConnectorHealthChanged{
+		UserID:  user.userID,
+		Health:  update.Health,
+		Message: update.Message,
+	}) {
+		user.log.Warn("Failed to publish connector health event")
+	}
+
+	return nil
+}
+
+func (user *user) getHealth() imap.ConnectorHealth {
+	health, _ := user.getHealthAndMessage()
+
+	return health
+}
+
+func (user *user) getHealthAndMessage() (imap.ConnectorHealth, string) {
+	user.healthLock.RLock()
+	defer user.healthLock.RUnlock()
+
+	return user.health, user.healthMsg
+}
+
+// getHealthAlert returns the text of the alert shown to clients when the connector's health changes.
+func getHealthAlert(health imap.ConnectorHealth, msg string) string {
+	if msg != "" {
+		return msg
+	}
+
+	switch health {
+	case imap.HealthOnline:
+		return "Connection to the mail server was restored"
+
+	case imap.HealthDegraded:
+		return "Connection to the mail server is degraded, changes may be delayed"
+
+	case imap.HealthOffline:
+		return "Connection to the mail server was lost, mailbox contents may be out of date"
+
+	case imap.HealthAuthExpired:
+		return "Authentication with the mail server has expired, please sign in again"
+
+	default:
+		return "Connection to the mail server changed state"
+	}
+}
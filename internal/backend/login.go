@@ -0,0 +1,99 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/ProtonMail/gluon/auth"
+	"github.com/ProtonMail/gluon/connector"
+	"golang.org/x/exp/slices"
+)
+
+// authenticate returns the ID of the user the given credentials log in to, or ErrNoSuchUser if they don't log in to
+// any. It doesn't hold the users lock while credentials are checked, so that slow checks don't hold up other logins.
+func (b *Backend) authenticate(ctx context.Context, username string, password []byte) (string, error) {
+	if b.authenticator != nil {
+		userID, err := b.authenticator.Authenticate(ctx, username, password)
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			return "", ErrNoSuchUser
+		} else if err != nil {
+			return "", err
+		}
+
+		return userID, nil
+	}
+
+	for _, user := range b.getLoginCandidates(username) {
+		if user.connector.Authorize(ctx, username, password) {
+			return user.userID, nil
+		}
+	}
+
+	return "", ErrNoSuchUser
+}
+
+// getLoginCandidates returns the users whose connectors may authorize a login with the given username: the owners of
+// the username, followed by the users whose connectors don't declare the usernames they own.
+func (b *Backend) getLoginCandidates(username string) []*user {
+	b.usersLock.Lock()
+	defer b.usersLock.Unlock()
+
+	// The index is only rebuilt once a connector reports that its usernames changed.
+	var changed bool
+
+	for _, user := range b.users {
+		if user.usernamesChanged.Swap(false) {
+			changed = true
+		}
+	}
+
+	if changed {
+		b.indexUsernames()
+	}
+
+	key := usernameKey(username)
+
+	var candidates []*user
+
+	for _, userID := range b.usernames[key] {
+		if user, ok := b.users[userID]; ok {
+			candidates = append(candidates, user)
+		}
+	}
+
+	for _, user := range b.users {
+		if _, ok := user.connector.(connector.UsernameOwner); !ok {
+			candidates = append(candidates, user)
+		}
+	}
+
+	return candidates
+}
+
+// indexUsernames rebuilds the index of the users owning each username, when users are added or removed and when a
+// connector reports that its usernames changed. It must be called with the users lock held.
+func (b *Backend) indexUsernames() {
+	b.usernames = make(map[string][]string)
+
+	for userID, user := range b.users {
+		owner, ok := user.connector.(connector.UsernameOwner)
+		if !ok {
+			continue
+		}
+
+		for _, username := range owner.Usernames() {
+			key := usernameKey(username)
+
+			if !slices.Contains(b.usernames[key], userID) {
+				b.usernames[key] = append(b.usernames[key], userID)
+			}
+		}
+	}
+}
+
+// usernameKey returns the key a username is indexed by. Usernames are usually addresses, which clients may capitalize
+// differently; the connector still decides whether the username it is given is valid.
+func usernameKey(username string) string {
+	return strings.ToLower(username)
+}
@@ -0,0 +1,165 @@
+package backend
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/gluon/limits"
+)
+
+// loginThrottle counts failed logins by remote address and by username, and delays further logins for those which
+// failed too often.
+type loginThrottle struct {
+	policy limits.LoginThrottle
+
+	failures  map[string]*loginFailures
+	lastSweep time.Time
+
+	lock sync.Mutex
+}
+
+type loginFailures struct {
+	count int
+	last  time.Time
+
+	// until is when logins stop being delayed.
+	until time.Time
+}
+
+func newLoginThrottle(policy limits.LoginThrottle) *loginThrottle {
+	return &loginThrottle{
+		policy:   policy,
+		failures: make(map[string]*loginFailures),
+	}
+}
+
+// loginKeys returns the keys the failures of a login are counted by: its username and, if known, its remote address.
+// The username is matched regardless of case, like it is when logging in, and the port is left out of the address
+// since each connection of a client uses another one.
+func loginKeys(remoteAddr net.Addr, username string) []string {
+	keys := []string{userThrottleKey(username)}
+
+	if remoteAddr != nil {
+		host := remoteAddr.String()
+
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+
+		keys = append(keys, "addr:"+host)
+	}
+
+	return keys
+}
+
+// wait blocks until logins for the given keys are no longer delayed.
+func (t *loginThrottle) wait(ctx context.Context, keys []string) error {
+	for {
+		t.lock.Lock()
+
+		var until time.Time
+
+		for _, key := range keys {
+			if f, ok := t.failures[key]; ok && f.until.After(until) {
+				until = f.until
+			}
+		}
+
+		t.lock.Unlock()
+
+		delay := time.Until(until)
+		if delay <= 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+
+		case <-timer.C:
+		}
+	}
+}
+
+// failed records a failed login for the given keys. It returns whether one of them failed too often and, if so, how
+// long further logins for it are delayed, and until when.
+func (t *loginThrottle) failed(keys []string) (bool, time.Duration, time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := time.Now()
+
+	t.sweep(now)
+
+	var (
+		blocked bool
+		delay   time.Duration
+		until   time.Time
+	)
+
+	for _, key := range keys {
+		f, ok := t.failures[key]
+		if !ok || t.expired(f, now) {
+			f = &loginFailures{}
+			t.failures[key] = f
+		}
+
+		f.count++
+		f.last = now
+
+		if t.policy.MaxAttempts <= 0 || f.count%t.policy.MaxAttempts != 0 {
+			continue
+		}
+
+		blocked = true
+
+		if d := t.policy.DelayAfter(f.count); d > 0 {
+			f.until = now.Add(d)
+
+			if d > delay {
+				delay, until = d, f.until
+			}
+		}
+	}
+
+	return blocked, delay, until
+}
+
+// succeeded clears the failures of the given username. Those of the address are kept so that logging in to one account
+// doesn't allow guessing the passwords of others from the same address.
+func (t *loginThrottle) succeeded(username string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.failures, userThrottleKey(username))
+}
+
+func userThrottleKey(username string) string {
+	return "user:" + usernameKey(username)
+}
+
+// sweep forgets the failures which are old enough to be reset, at most once per reset period.
+// It must be called with the lock held.
+func (t *loginThrottle) sweep(now time.Time) {
+	if t.policy.ResetAfter <= 0 || now.Sub(t.lastSweep) < t.policy.ResetAfter {
+		return
+	}
+
+	for key, f := range t.failures {
+		if t.expired(f, now) && now.After(f.until) {
+			delete(t.failures, key)
+		}
+	}
+
+	t.lastSweep = now
+}
+
+// expired returns whether the given failures are old enough to be reset.
+func (t *loginThrottle) expired(f *loginFailures, now time.Time) bool {
+	return t.policy.ResetAfter > 0 && now.Sub(f.last) > t.policy.ResetAfter
+}
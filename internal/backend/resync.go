@@ -0,0 +1,263 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ProtonMail/gluon/connector"
+	"github.com/ProtonMail/gluon/db"
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/internal/ids"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// resyncCreateBatchSize is the maximum number of new messages which are created with a single update during a resync.
+const resyncCreateBatchSize = 100
+
+// resyncMessage is the local state of a message that is compared against the snapshot during a resync.
+type resyncMessage struct {
+	mailboxIDs []imap.MailboxID
+	flags      imap.FlagSet
+}
+
+// ResyncUser brings the database of the given user in line with the given snapshot of the remote.
+func (b *Backend) ResyncUser(ctx context.Context, userID string, snapshot connector.Snapshot) error {
+	b.usersLock.Lock()
+	user, ok := b.users[userID]
+	b.usersLock.Unlock()
+
+	if !ok {
+		return ErrNoSuchUser
+	}
+
+	return user.resync(ctx, snapshot)
+}
+
+// resync computes the differences between the snapshot and the database and applies them as regular imap updates.
+// Mailboxes and messages that exist in both are left untouched, which preserves their UIDVALIDITY and UIDs.
+func (user *user) resync(ctx context.Context, snapshot connector.Snapshot) error {
+	mailboxes, err := snapshot.GetMailboxes(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get snapshot mailboxes: %w", err)
+	}
+
+	if err := user.resyncMailboxes(ctx, mailboxes); err != nil {
+		return fmt.Errorf("failed to resync mailboxes: %w", err)
+	}
+
+	if err := user.resyncMessages(ctx, snapshot); err != nil {
+		return fmt.Errorf("failed to resync messages: %w", err)
+	}
+
+	return nil
+}
+
+func (user *user) resyncMailboxes(ctx context.Context, remote []imap.Mailbox) error {
+	local, err := db.ClientReadType(ctx, user.db, func(ctx context.Context, client db.ReadOnly) ([]db.MailboxNameAndRemoteID, error) {
+		return client.GetAllMailboxesNameAndRemoteID(ctx)
+	})
+	if err != nil {
+		return err
+	}
+
+	localIDs := make(map[imap.MailboxID]struct{}, len(local))
+
+	for _, mbox := range local {
+		if mbox.RemoteID != ids.GluonInternalRecoveryMailboxRemoteID {
+			localIDs[mbox.RemoteID] = struct{}{}
+		}
+	}
+
+	var updates []imap.Update
+
+	for _, mbox := range remote {
+		if mbox.ID == ids.GluonInternalRecoveryMailboxRemoteID {
+			continue
+		}
+
+		// Existing mailboxes are updated in any case so that their permissions match the remote's.
+		if _, ok := localIDs[mbox.ID]; !ok {
+			updates = append(updates, imap.NewMailboxCreated(mbox))
+		} else {
+			updates = append(updates, imap.NewMailboxUpdated(mbox.ID, mbox.Name).WithPermissions(mbox.Permissions))
+		}
+
+		delete(localIDs, mbox.ID)
+	}
+
+	for mboxID := range localIDs {
+		updates = append(updates, imap.NewMailboxDeleted(mboxID))
+	}
+
+	return user.injectUpdates(ctx, updates...)
+}
+
+func (user *user) resyncMessages(ctx context.Context, snapshot connector.Snapshot) error {
+	local, err := user.getResyncMessages(ctx)
+	if err != nil {
+		return err
+	}
+
+	var created []*imap.MessageCreated
+
+	if err := snapshot.ForEachMessage(ctx, func(message connector.SnapshotMessage) error {
+		if slices.Contains(message.MailboxIDs, ids.GluonInternalRecoveryMailboxRemoteID) {
+			return nil
+		}
+
+		if msg, ok := local[message.Message.ID]; ok {
+			delete(local, message.Message.ID)
+
+			return user.injectUpdates(ctx, resyncMessageUpdates(message, msg)...)
+		}
+
+		if exists, err := db.ClientReadType(ctx, user.db, func(ctx context.Context, client db.ReadOnly) (bool, error) {
+			return client.MessageExistsWithRemoteID(ctx, message.Message.ID)
+		}); err != nil {
+			return err
+		} else if exists {
+			return user.injectUpdates(ctx, imap.NewMessageMailboxesUpdated(message.Message.ID, message.MailboxIDs, message.Message.Flags))
+		}
+
+		if len(message.MailboxIDs) == 0 {
+			return nil
+		}
+
+		literal, err := user.connector.GetMessageLiteral(ctx, message.Message.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get literal for message %v: %w", message.Message.ID.ShortID(), err)
+		}
+
+		parsed, err := imap.NewParsedMessage(literal)
+		if err != nil {
+			return fmt.Errorf("failed to parse literal for message %v: %w", message.Message.ID.ShortID(), err)
+		}
+
+		created = append(created, &imap.MessageCreated{
+			Message:       message.Message,
+			Literal:       literal,
+			MailboxIDs:    message.MailboxIDs,
+			ParsedMessage: parsed,
+		})
+
+		if len(created) < resyncCreateBatchSize {
+			return nil
+		}
+
+		batch := created
+		created = nil
+
+		return user.injectUpdates(ctx, imap.NewMessagesCreated(true, batch...))
+	}); err != nil {
+		return err
+	}
+
+	if len(created) > 0 {
+		if err := user.injectUpdates(ctx, imap.NewMessagesCreated(true, created...)); err != nil {
+			return err
+		}
+	}
+
+	var updates []imap.Update
+
+	for messageID := range local {
+		updates = append(updates, imap.NewMessagesDeleted(messageID))
+	}
+
+	return user.injectUpdates(ctx, updates...)
+}
+
+// getResyncMessages returns the mailboxes and flags of every message that is currently visible in a mailbox.
+func (user *user) getResyncMessages(ctx context.Context) (map[imap.MessageID]*resyncMessage, error) {
+	return db.ClientReadType(ctx, user.db, func(ctx context.Context, client db.ReadOnly) (map[imap.MessageID]*resyncMessage, error) {
+		mailboxes, err := client.GetAllMailboxesWithAttr(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		messages := make(map[imap.MessageID]*resyncMessage)
+		internalIDs := make(map[imap.InternalMessageID]imap.MessageID)
+
+		for _, mbox := range mailboxes {
+			if mbox.ID == user.recoveryMailboxID {
+				continue
+			}
+
+			pairs, err := client.GetMailboxMessageIDPairs(ctx, mbox.ID)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, pair := range pairs {
+				msg, ok := messages[pair.RemoteID]
+				if !ok {
+					msg = &resyncMessage{}
+					messages[pair.RemoteID] = msg
+					internalIDs[pair.InternalID] = pair.RemoteID
+				}
+
+				msg.mailboxIDs = append(msg.mailboxIDs, mbox.RemoteID)
+			}
+		}
+
+		flags, err := client.GetMessagesFlags(ctx, maps.Keys(internalIDs))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, flag := range flags {
+			messages[internalIDs[flag.ID]].flags = flag.FlagSet
+		}
+
+		return messages, nil
+	})
+}
+
+// resyncMessageUpdates returns the updates required to bring the local message in line with the remote message.
+func resyncMessageUpdates(remote connector.SnapshotMessage, local *resyncMessage) []imap.Update {
+	if !sameMailboxIDs(remote.MailboxIDs, local.mailboxIDs) {
+		return []imap.Update{imap.NewMessageMailboxesUpdated(remote.Message.ID, remote.MailboxIDs, remote.Message.Flags)}
+	}
+
+	if !remote.Message.Flags.Equals(local.flags) {
+		return []imap.Update{imap.NewMessageFlagsUpdated(remote.Message.ID, remote.Message.Flags)}
+	}
+
+	return nil
+}
+
+// injectUpdates publishes the given updates alongside the connector's updates and waits until all have been applied.
+func (user *user) injectUpdates(ctx context.Context, updates ...imap.Update) error {
+	for _, update := range updates {
+		if !user.updateInjector.Inject(ctx, update) {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			return ErrUserClosed
+		}
+	}
+
+	for _, update := range updates {
+		if err, ok := update.WaitContext(ctx); ok && err != nil {
+			return fmt.Errorf("failed to apply update %v: %w", update.String(), err)
+		}
+	}
+
+	return ctx.Err()
+}
+
+func sameMailboxIDs(a, b []imap.MailboxID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for _, mboxID := range a {
+		if !slices.Contains(b, mboxID) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,116 @@
+package backend
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ProtonMail/gluon/db"
+	"github.com/ProtonMail/gluon/store"
+)
+
+// RotateUserPassphrase protects the data of the given user with newPassphrase instead of oldPassphrase.
+// The literals in the store are re-encrypted one by one while the user stays in use. If the rotation is interrupted,
+// it resumes when the user is next loaded, which must then be done with newPassphrase.
+func (b *Backend) RotateUserPassphrase(ctx context.Context, userID string, oldPassphrase, newPassphrase []byte) error {
+	b.usersLock.Lock()
+	user, ok := b.users[userID]
+	b.usersLock.Unlock()
+
+	if !ok {
+		return ErrNoSuchUser
+	}
+
+	return user.rotatePassphrase(ctx, oldPassphrase, newPassphrase)
+}
+
+func (user *user) rotatePassphrase(ctx context.Context, oldPassphrase, newPassphrase []byte) error {
+	user.rotationLock.Lock()
+	defer user.rotationLock.Unlock()
+
+	// The store records the rotation first, so that the old passphrase can be recovered if it is interrupted.
+	if err := user.store.StartRotation(oldPassphrase, newPassphrase); err != nil {
+		return err
+	}
+
+	if database, ok := user.db.(db.RekeyableClient); ok {
+		if err := database.Rekey(ctx, newPassphrase); err != nil {
+			return err
+		}
+	}
+
+	if user.searchIndex != nil {
+		if err := user.searchIndex.SetPassphrase(newPassphrase); err != nil {
+			return err
+		}
+	}
+
+	return user.rotateLiterals(ctx)
+}
+
+// resumeRotation finishes a rotation which was interrupted before all literals were rotated.
+func (user *user) resumeRotation(ctx context.Context) error {
+	user.rotationLock.Lock()
+	defer user.rotationLock.Unlock()
+
+	if user.store.RotationPassphrase() == nil {
+		return nil
+	}
+
+	return user.rotateLiterals(ctx)
+}
+
+func (user *user) rotateLiterals(ctx context.Context) error {
+	ids, err := user.store.List()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case <-user.updateQuitCh:
+			return ErrUserClosed
+
+		default:
+		}
+
+		if err := user.store.RotateLiteral(id); err != nil {
+			return err
+		}
+	}
+
+	return user.store.FinishRotation()
+}
+
+// openDatabase opens the database of the given user. If a rotation from oldPassphrase was interrupted before the
+// database was protected with passphrase, it is opened with oldPassphrase and protected with passphrase instead.
+func (b *Backend) openDatabase(ctx context.Context, userID string, passphrase, oldPassphrase []byte) (db.Client, bool, error) {
+	database, isNew, err := b.newDatabase(userID, passphrase)
+	if err == nil || oldPassphrase == nil {
+		return database, isNew, err
+	}
+
+	database, isNew, oldErr := b.newDatabase(userID, oldPassphrase)
+	if oldErr != nil {
+		return nil, false, err
+	}
+
+	if database, ok := database.(db.RekeyableClient); ok {
+		if err := database.Rekey(ctx, passphrase); err != nil {
+			return nil, false, errors.Join(err, database.Close())
+		}
+	}
+
+	return database, isNew, nil
+}
+
+// rotationPassphrase returns the passphrase the given store is being rotated from, or nil if it isn't.
+func rotationPassphrase(st store.Store) []byte {
+	if rotator, ok := st.(store.Rotator); ok {
+		return rotator.RotationPassphrase()
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+
+	"github.com/ProtonMail/gluon/db"
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/internal/search"
+	"github.com/ProtonMail/gluon/store"
+	"github.com/bradenaw/juniper/xslices"
+)
+
+// indexingStore keeps a user's search index in line with the messages written to and deleted from its store.
+type indexingStore struct {
+	store.Store
+
+	index *search.Index
+}
+
+func (s *indexingStore) Set(messageID imap.InternalMessageID, reader io.Reader) error {
+	literal, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	if err := s.Store.Set(messageID, bytes.NewReader(literal)); err != nil {
+		return err
+	}
+
+	s.index.Add(messageID, literal)
+
+	return nil
+}
+
+func (s *indexingStore) Delete(messageIDs ...imap.InternalMessageID) error {
+	if err := s.Store.Delete(messageIDs...); err != nil {
+		return err
+	}
+
+	s.index.Remove(messageIDs...)
+
+	return nil
+}
+
+func (s *indexingStore) StartRotation(oldPassphrase, newPassphrase []byte) error {
+	rotator, ok := s.Store.(store.Rotator)
+	if !ok {
+		return store.ErrRotationUnsupported
+	}
+
+	return rotator.StartRotation(oldPassphrase, newPassphrase)
+}
+
+func (s *indexingStore) RotationPassphrase() []byte {
+	return rotationPassphrase(s.Store)
+}
+
+func (s *indexingStore) RotateLiteral(messageID imap.InternalMessageID) error {
+	rotator, ok := s.Store.(store.Rotator)
+	if !ok {
+		return store.ErrRotationUnsupported
+	}
+
+	return rotator.RotateLiteral(messageID)
+}
+
+func (s *indexingStore) FinishRotation() error {
+	rotator, ok := s.Store.(store.Rotator)
+	if !ok {
+		return store.ErrRotationUnsupported
+	}
+
+	return rotator.FinishRotation()
+}
+
+func (s *indexingStore) Usage() ([]store.Usage, error) {
+	evictor, ok := s.Store.(store.Evictor)
+	if !ok {
+		return nil, store.ErrEvictionUnsupported
+	}
+
+	return evictor.Usage()
+}
+
+// Evict leaves the evicted messages in the index, since they still exist and can be fetched again.
+func (s *indexingStore) Evict(messageIDs ...imap.InternalMessageID) error {
+	evictor, ok := s.Store.(store.Evictor)
+	if !ok {
+		return store.ErrEvictionUnsupported
+	}
+
+	return evictor.Evict(messageIDs...)
+}
+
+// RebuildSearchIndex discards the search index of the given user and indexes all its messages again.
+// Searches fall back to scanning the messages which haven't been indexed again yet.
+func (b *Backend) RebuildSearchIndex(ctx context.Context, userID string) error {
+	b.usersLock.Lock()
+	user, ok := b.users[userID]
+	b.usersLock.Unlock()
+
+	if !ok {
+		return ErrNoSuchUser
+	}
+
+	if user.searchIndex == nil {
+		return ErrSearchIndexDisabled
+	}
+
+	user.searchIndex.Reset()
+
+	return user.syncSearchIndex(ctx)
+}
+
+func (b *Backend) getSearchIndexPath(userID string) string {
+	return filepath.Join(b.dataDir, "search", userID)
+}
+
+// syncSearchIndex brings the search index in line with the store: messages missing from the index are indexed and
+// messages which no longer exist are removed. This recovers from changes made since the index was last saved.
+// Messages whose literal was evicted from the store stay indexed.
+func (user *user) syncSearchIndex(ctx context.Context) error {
+	storeIDs, err := user.store.List()
+	if err != nil {
+		return err
+	}
+
+	dbIDMap, err := db.ClientReadType(ctx, user.db, func(ctx context.Context, client db.ReadOnly) (map[imap.InternalMessageID]struct{}, error) {
+		return client.GetAllMessagesIDsAsMap(ctx)
+	})
+	if err != nil {
+		return err
+	}
+
+	user.searchIndex.Remove(xslices.Filter(user.searchIndex.IDs(), func(id imap.InternalMessageID) bool {
+		_, ok := dbIDMap[id]
+		return !ok
+	})...)
+
+	for _, id := range storeIDs {
+		if user.searchIndex.Has(id) {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case <-user.updateQuitCh:
+			return nil
+
+		default:
+		}
+
+		literal, err := user.store.Get(id)
+		if err != nil {
+			user.log.WithError(err).WithField("messageID", id.ShortID()).Warn("Failed to load message for search index")
+			continue
+		}
+
+		user.searchIndex.Add(id, literal)
+	}
+
+	return user.searchIndex.Save()
+}
@@ -0,0 +1,314 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ProtonMail/gluon/db"
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/internal/state"
+	"github.com/ProtonMail/gluon/rfc822"
+	"github.com/ProtonMail/gluon/sieve"
+	"github.com/bradenaw/juniper/xslices"
+	"golang.org/x/exp/slices"
+)
+
+// sieveOutcome records how the sieve script changed a newly created message, so that the remote can be told about it.
+type sieveOutcome struct {
+	messageID imap.MessageID
+	inboxID   imap.MailboxID
+
+	// fileInto holds the mailboxes the message was filed into.
+	fileInto []imap.MailboxID
+
+	// removedFromInbox is true if the message no longer lives in the inbox.
+	removedFromInbox bool
+
+	seen, flagged, forwarded bool
+}
+
+// SetSieveScript stores the sieve script of the given user. An empty script disables filtering.
+func (b *Backend) SetSieveScript(ctx context.Context, userID, script string) error {
+	b.usersLock.Lock()
+	user, ok := b.users[userID]
+	b.usersLock.Unlock()
+
+	if !ok {
+		return ErrNoSuchUser
+	}
+
+	return user.setSieveScript(ctx, script)
+}
+
+// GetSieveScript returns the sieve script of the given user.
+func (b *Backend) GetSieveScript(ctx context.Context, userID string) (string, error) {
+	b.usersLock.Lock()
+	user, ok := b.users[userID]
+	b.usersLock.Unlock()
+
+	if !ok {
+		return "", ErrNoSuchUser
+	}
+
+	return db.ClientReadType(ctx, user.db, func(ctx context.Context, client db.ReadOnly) (string, error) {
+		return client.GetSieveScript(ctx)
+	})
+}
+
+// loadSieveScript parses the sieve script stored in the database.
+// A script which fails to parse is ignored rather than preventing the user from being loaded.
+func (user *user) loadSieveScript(ctx context.Context) error {
+	src, err := db.ClientReadType(ctx, user.db, func(ctx context.Context, client db.ReadOnly) (string, error) {
+		return client.GetSieveScript(ctx)
+	})
+	if err != nil {
+		return err
+	}
+
+	if src == "" {
+		return nil
+	}
+
+	script, err := sieve.Parse(src)
+	if err != nil {
+		user.log.WithError(err).Error("Failed to parse stored sieve script, filtering is disabled")
+		return nil
+	}
+
+	if err := checkSieveFlags(script); err != nil {
+		user.log.WithError(err).Error("Stored sieve script can't be applied, filtering is disabled")
+		return nil
+	}
+
+	user.sieveLock.Lock()
+	defer user.sieveLock.Unlock()
+
+	user.sieve = script
+
+	return nil
+}
+
+func (user *user) setSieveScript(ctx context.Context, src string) error {
+	var script *sieve.Script
+
+	if src != "" {
+		parsed, err := sieve.Parse(src)
+		if err != nil {
+			return err
+		}
+
+		if err := checkSieveFlags(parsed); err != nil {
+			return err
+		}
+
+		script = parsed
+	}
+
+	if err := user.db.Write(ctx, func(ctx context.Context, tx db.Transaction) error {
+		return tx.StoreSieveScript(ctx, src)
+	}); err != nil {
+		return err
+	}
+
+	user.sieveLock.Lock()
+	defer user.sieveLock.Unlock()
+
+	user.sieve = script
+
+	return nil
+}
+
+func (user *user) getSieveScript() *sieve.Script {
+	user.sieveLock.RLock()
+	defer user.sieveLock.RUnlock()
+
+	return user.sieve
+}
+
+// applySieve runs the user's sieve script on the messages of the update which are delivered to the inbox,
+// changing their mailboxes and flags in place before they are written to the database.
+func (user *user) applySieve(ctx context.Context, update *imap.MessagesCreated) ([]sieveOutcome, error) {
+	script := user.getSieveScript()
+	if script == nil {
+		return nil, nil
+	}
+
+	mailboxes, err := db.ClientReadType(ctx, user.db, func(ctx context.Context, client db.ReadOnly) ([]db.MailboxNameAndRemoteID, error) {
+		return client.GetAllMailboxesNameAndRemoteID(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	idx := xslices.IndexFunc(mailboxes, func(mbox db.MailboxNameAndRemoteID) bool {
+		return strings.EqualFold(mbox.Name, imap.Inbox)
+	})
+	if idx < 0 {
+		return nil, nil
+	}
+
+	inboxID := mailboxes[idx].RemoteID
+
+	var outcomes []sieveOutcome
+
+	for _, message := range update.Messages {
+		if !slices.Contains(message.MailboxIDs, inboxID) {
+			continue
+		}
+
+		// Only newly delivered messages are filtered.
+		if exists, err := db.ClientReadType(ctx, user.db, func(ctx context.Context, client db.ReadOnly) (bool, error) {
+			return client.MessageExistsWithRemoteID(ctx, message.Message.ID)
+		}); err != nil {
+			return nil, err
+		} else if exists {
+			continue
+		}
+
+		header, err := rfc822.Parse(message.Literal).ParseHeader()
+		if err != nil {
+			user.log.WithError(err).WithField("messageID", message.Message.ID.ShortID()).Warn("Failed to parse header for sieve")
+			continue
+		}
+
+		res := script.Execute(sieve.Message{Header: header, Size: len(message.Literal)})
+
+		outcome := sieveOutcome{messageID: message.Message.ID, inboxID: inboxID}
+
+		for _, name := range res.FileInto {
+			idx := xslices.IndexFunc(mailboxes, func(mbox db.MailboxNameAndRemoteID) bool {
+				return mbox.Name == name
+			})
+
+			// As required by RFC 5228, a failed fileinto falls back to keeping the message.
+			if idx < 0 {
+				user.log.WithField("mailbox", name).Warn("Sieve script refers to unknown mailbox, keeping message")
+				res.Keep = true
+
+				continue
+			}
+
+			if mboxID := mailboxes[idx].RemoteID; mboxID == inboxID {
+				res.Keep = true
+			} else if !slices.Contains(message.MailboxIDs, mboxID) {
+				message.MailboxIDs = append(message.MailboxIDs, mboxID)
+				outcome.fileInto = append(outcome.fileInto, mboxID)
+			}
+		}
+
+		if !res.Keep {
+			message.MailboxIDs = xslices.Filter(message.MailboxIDs, func(mboxID imap.MailboxID) bool {
+				return mboxID != inboxID
+			})
+
+			outcome.removedFromInbox = true
+		}
+
+		for _, flag := range res.Flags {
+			if message.Message.Flags.ContainsUnchecked(strings.ToLower(flag)) {
+				continue
+			}
+
+			message.Message.Flags = message.Message.Flags.Add(flag)
+
+			switch strings.ToLower(flag) {
+			case imap.FlagSeenLowerCase:
+				outcome.seen = true
+
+			case imap.FlagFlaggedLowerCase:
+				outcome.flagged = true
+
+			case imap.XFlagDollarForwardedLowerCase, imap.XFlagForwardedLowerCase:
+				outcome.forwarded = true
+			}
+		}
+
+		if len(outcome.fileInto) > 0 || outcome.removedFromInbox || outcome.seen || outcome.flagged || outcome.forwarded {
+			outcomes = append(outcomes, outcome)
+		}
+	}
+
+	return outcomes, nil
+}
+
+// propagateSieve tells the connector about the changes the sieve script made, as if a client had made them.
+func (user *user) propagateSieve(ctx context.Context, outcomes []sieveOutcome) {
+	for _, outcome := range outcomes {
+		if err := userDBWrite(ctx, user, func(ctx context.Context, tx db.Transaction) ([]state.Update, error) {
+			cache := &DBIMAPStateWrite{DBIMAPStateRead: DBIMAPStateRead{rd: tx}, tx: tx, user: user}
+
+			if err := user.propagateSieveOutcome(ctx, cache, outcome); err != nil {
+				return nil, err
+			}
+
+			return cache.stateUpdates, nil
+		}); err != nil {
+			user.log.WithError(err).WithField("messageID", outcome.messageID.ShortID()).Error("Failed to propagate sieve actions")
+		}
+	}
+}
+
+func (user *user) propagateSieveOutcome(ctx context.Context, cache *DBIMAPStateWrite, outcome sieveOutcome) error {
+	inboxID := outcome.inboxID
+	messageIDs := []imap.MessageID{outcome.messageID}
+	fileInto := outcome.fileInto
+
+	// Prefer a move so the remote doesn't briefly see the message in both mailboxes.
+	if outcome.removedFromInbox && len(fileInto) > 0 {
+		removed, err := user.connector.MoveMessages(ctx, cache, messageIDs, inboxID, fileInto[0])
+		if err != nil {
+			return fmt.Errorf("failed to move message: %w", err)
+		}
+
+		outcome.removedFromInbox = !removed
+		fileInto = fileInto[1:]
+	}
+
+	for _, mboxID := range fileInto {
+		if err := user.connector.AddMessagesToMailbox(ctx, cache, messageIDs, mboxID); err != nil {
+			return fmt.Errorf("failed to add message to mailbox: %w", err)
+		}
+	}
+
+	if outcome.removedFromInbox {
+		if err := user.connector.RemoveMessagesFromMailbox(ctx, cache, messageIDs, inboxID); err != nil {
+			return fmt.Errorf("failed to remove message from inbox: %w", err)
+		}
+	}
+
+	if outcome.seen {
+		if err := user.connector.MarkMessagesSeen(ctx, cache, messageIDs, true); err != nil {
+			return fmt.Errorf("failed to mark message as seen: %w", err)
+		}
+	}
+
+	if outcome.flagged {
+		if err := user.connector.MarkMessagesFlagged(ctx, cache, messageIDs, true); err != nil {
+			return fmt.Errorf("failed to mark message as flagged: %w", err)
+		}
+	}
+
+	if outcome.forwarded {
+		if err := user.connector.MarkMessagesForwarded(ctx, cache, messageIDs, true); err != nil {
+			return fmt.Errorf("failed to mark message as forwarded: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// checkSieveFlags checks that the script only adds flags the connector can store. Others would only be set locally
+// and be lost on the next resync.
+func checkSieveFlags(script *sieve.Script) error {
+	for _, flag := range script.Flags() {
+		switch strings.ToLower(flag) {
+		case imap.FlagSeenLowerCase, imap.FlagFlaggedLowerCase, imap.XFlagDollarForwardedLowerCase, imap.XFlagForwardedLowerCase:
+
+		default:
+			return fmt.Errorf("%w: %v", ErrUnsupportedSieveFlag, flag)
+		}
+	}
+
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/ProtonMail/gluon/db"
 	"github.com/ProtonMail/gluon/imap"
 	"github.com/ProtonMail/gluon/internal/state"
+	"github.com/ProtonMail/gluon/telemetry"
 )
 
 type stateConnectorImpl struct {
@@ -49,7 +50,10 @@ func (sc *stateConnectorImpl) CreateMailbox(ctx context.Context, tx db.Transacti
 
 	cache := sc.newDBIMAPWrite(tx)
 
+	ctx, span := telemetry.Start(ctx, "connector.CreateMailbox")
 	mbox, err := sc.connector.CreateMailbox(ctx, &cache, name)
+	telemetry.End(span, err)
+
 	if err != nil {
 		return nil, imap.Mailbox{}, err
 	}
@@ -62,7 +66,11 @@ func (sc *stateConnectorImpl) UpdateMailbox(ctx context.Context, tx db.Transacti
 
 	cache := sc.newDBIMAPWrite(tx)
 
-	if err := sc.connector.UpdateMailboxName(ctx, &cache, mboxID, newName); err != nil {
+	ctx, span := telemetry.Start(ctx, "connector.UpdateMailboxName")
+	err := sc.connector.UpdateMailboxName(ctx, &cache, mboxID, newName)
+	telemetry.End(span, err)
+
+	if err != nil {
 		return nil, err
 	}
 
@@ -74,7 +82,11 @@ func (sc *stateConnectorImpl) DeleteMailbox(ctx context.Context, tx db.Transacti
 
 	cache := sc.newDBIMAPWrite(tx)
 
-	if err := sc.connector.DeleteMailbox(ctx, &cache, mboxID); err != nil {
+	ctx, span := telemetry.Start(ctx, "connector.DeleteMailbox")
+	err := sc.connector.DeleteMailbox(ctx, &cache, mboxID)
+	telemetry.End(span, err)
+
+	if err != nil {
 		return nil, err
 	}
 
@@ -93,7 +105,10 @@ func (sc *stateConnectorImpl) CreateMessage(
 
 	cache := sc.newDBIMAPWrite(tx)
 
+	ctx, span := telemetry.Start(ctx, "connector.CreateMessage", telemetry.MessageSizeKey.Int(len(literal)))
 	msg, newLiteral, err := sc.connector.CreateMessage(ctx, &cache, mboxID, literal, flags, date)
+	telemetry.End(span, err)
+
 	if err != nil {
 		return nil, imap.InternalMessageID{}, imap.Message{}, nil, err
 	}
@@ -104,7 +119,12 @@ func (sc *stateConnectorImpl) CreateMessage(
 func (sc *stateConnectorImpl) GetMessageLiteral(ctx context.Context, id imap.MessageID) ([]byte, error) {
 	ctx = sc.newContextWithMetadata(ctx)
 
-	return sc.connector.GetMessageLiteral(ctx, id)
+	ctx, span := telemetry.Start(ctx, "connector.GetMessageLiteral")
+	literal, err := sc.connector.GetMessageLiteral(ctx, id)
+	span.SetAttributes(telemetry.MessageSizeKey.Int(len(literal)))
+	telemetry.End(span, err)
+
+	return literal, err
 }
 
 func (sc *stateConnectorImpl) AddMessagesToMailbox(
@@ -117,7 +137,11 @@ func (sc *stateConnectorImpl) AddMessagesToMailbox(
 
 	cache := sc.newDBIMAPWrite(tx)
 
-	if err := sc.connector.AddMessagesToMailbox(ctx, &cache, messageIDs, mboxID); err != nil {
+	ctx, span := telemetry.Start(ctx, "connector.AddMessagesToMailbox", telemetry.MessageCountKey.Int(len(messageIDs)))
+	err := sc.connector.AddMessagesToMailbox(ctx, &cache, messageIDs, mboxID)
+	telemetry.End(span, err)
+
+	if err != nil {
 		return nil, err
 	}
 
@@ -134,7 +158,11 @@ func (sc *stateConnectorImpl) RemoveMessagesFromMailbox(
 
 	cache := sc.newDBIMAPWrite(tx)
 
-	if err := sc.connector.RemoveMessagesFromMailbox(ctx, &cache, messageIDs, mboxID); err != nil {
+	ctx, span := telemetry.Start(ctx, "connector.RemoveMessagesFromMailbox", telemetry.MessageCountKey.Int(len(messageIDs)))
+	err := sc.connector.RemoveMessagesFromMailbox(ctx, &cache, messageIDs, mboxID)
+	telemetry.End(span, err)
+
+	if err != nil {
 		return nil, err
 	}
 
@@ -152,7 +180,10 @@ func (sc *stateConnectorImpl) MoveMessagesFromMailbox(
 
 	cache := sc.newDBIMAPWrite(tx)
 
+	ctx, span := telemetry.Start(ctx, "connector.MoveMessages", telemetry.MessageCountKey.Int(len(messageIDs)))
 	shouldMove, err := sc.connector.MoveMessages(ctx, &cache, messageIDs, mboxFromID, mboxToID)
+	telemetry.End(span, err)
+
 	if err != nil {
 		return nil, false, err
 	}
@@ -165,7 +196,14 @@ func (sc *stateConnectorImpl) SetMessagesSeen(ctx context.Context, tx db.Transac
 
 	cache := sc.newDBIMAPWrite(tx)
 
-	if err := sc.connector.MarkMessagesSeen(ctx, &cache, messageIDs, seen); err != nil {
+	versions := sc.user.flagVersions.recordLocal(messageIDs, remoteFlagSeen, seen)
+
+	ctx, span := telemetry.Start(ctx, "connector.MarkMessagesSeen", telemetry.MessageCountKey.Int(len(messageIDs)))
+	err := sc.connector.MarkMessagesSeen(ctx, &cache, messageIDs, seen)
+	telemetry.End(span, err)
+
+	if err != nil {
+		sc.user.flagVersions.revertLocal(versions, remoteFlagSeen)
 		return nil, err
 	}
 
@@ -179,7 +217,14 @@ func (sc *stateConnectorImpl) SetMessagesFlagged(ctx context.Context,
 
 	cache := sc.newDBIMAPWrite(tx)
 
-	if err := sc.connector.MarkMessagesFlagged(ctx, &cache, messageIDs, flagged); err != nil {
+	versions := sc.user.flagVersions.recordLocal(messageIDs, remoteFlagFlagged, flagged)
+
+	ctx, span := telemetry.Start(ctx, "connector.MarkMessagesFlagged", telemetry.MessageCountKey.Int(len(messageIDs)))
+	err := sc.connector.MarkMessagesFlagged(ctx, &cache, messageIDs, flagged)
+	telemetry.End(span, err)
+
+	if err != nil {
+		sc.user.flagVersions.revertLocal(versions, remoteFlagFlagged)
 		return nil, err
 	}
 
@@ -188,6 +233,9 @@ func (sc *stateConnectorImpl) SetMessagesFlagged(ctx context.Context,
 
 func (sc *stateConnectorImpl) GetMailboxVisibility(ctx context.Context,
 	id imap.MailboxID) imap.MailboxVisibility {
+	ctx, span := telemetry.Start(ctx, "connector.GetMailboxVisibility")
+	defer span.End()
+
 	return sc.connector.GetMailboxVisibility(ctx, id)
 }
 
@@ -201,7 +249,14 @@ func (sc *stateConnectorImpl) SetMessagesForwarded(
 
 	cache := sc.newDBIMAPWrite(tx)
 
-	if err := sc.connector.MarkMessagesForwarded(ctx, &cache, messageIDs, forwarded); err != nil {
+	versions := sc.user.flagVersions.recordLocal(messageIDs, remoteFlagForwarded, forwarded)
+
+	ctx, span := telemetry.Start(ctx, "connector.MarkMessagesForwarded", telemetry.MessageCountKey.Int(len(messageIDs)))
+	err := sc.connector.MarkMessagesForwarded(ctx, &cache, messageIDs, forwarded)
+	telemetry.End(span, err)
+
+	if err != nil {
+		sc.user.flagVersions.revertLocal(versions, remoteFlagForwarded)
 		return nil, err
 	}
 
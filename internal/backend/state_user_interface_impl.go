@@ -6,6 +6,7 @@ import (
 	"github.com/ProtonMail/gluon/db"
 	"github.com/ProtonMail/gluon/imap"
 	"github.com/ProtonMail/gluon/internal/ids"
+	"github.com/ProtonMail/gluon/internal/search"
 	"github.com/ProtonMail/gluon/internal/state"
 	"github.com/ProtonMail/gluon/internal/utils"
 	"github.com/ProtonMail/gluon/store"
@@ -93,3 +94,7 @@ func (s *StateUserInterfaceImpl) GetRecoveryMailboxID() db.MailboxIDPair {
 func (s *StateUserInterfaceImpl) GetRecoveredMessageHashesMap() *utils.MessageHashesMap {
 	return s.u.recoveredMessageHashes
 }
+
+func (s *StateUserInterfaceImpl) GetSearchIndex() *search.Index {
+	return s.u.searchIndex
+}
@@ -16,6 +16,9 @@ type updateInjector struct {
 	// updatesCh is the channel that delivers API updates to the mailserver.
 	updatesCh chan imap.Update
 
+	// injectCh carries updates published through Inject, which are forwarded alongside the connector's updates.
+	injectCh chan imap.Update
+
 	// forwardWG is used to ensure we wait until the forward() goroutine has finished executing.
 	forwardWG     sync.WaitGroup
 	forwardQuitCh chan struct{}
@@ -27,6 +30,7 @@ type updateInjector struct {
 func newUpdateInjector(connector connector.Connector, userID string, panicHandler async.PanicHandler) *updateInjector {
 	injector := &updateInjector{
 		updatesCh:     make(chan imap.Update),
+		injectCh:      make(chan imap.Update),
 		forwardQuitCh: make(chan struct{}),
 	}
 
@@ -47,6 +51,21 @@ func (u *updateInjector) GetUpdates() <-chan imap.Update {
 	return u.updatesCh
 }
 
+// Inject publishes the given update alongside the updates generated by the connector.
+// It returns false if the update could not be published because the injector was closed or the context was cancelled.
+func (u *updateInjector) Inject(ctx context.Context, update imap.Update) bool {
+	select {
+	case u.injectCh <- update:
+		return true
+
+	case <-u.forwardQuitCh:
+		return false
+
+	case <-ctx.Done():
+		return false
+	}
+}
+
 func (u *updateInjector) Close(ctx context.Context) error {
 	close(u.forwardQuitCh)
 	u.forwardWG.Wait()
@@ -72,6 +91,9 @@ func (u *updateInjector) forward(ctx context.Context, updateCh <-chan imap.Updat
 
 			u.send(ctx, update)
 
+		case update := <-u.injectCh:
+			u.send(ctx, update)
+
 		case <-u.forwardQuitCh:
 			return
 		}
@@ -2,14 +2,18 @@ package backend
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 
 	"github.com/ProtonMail/gluon/async"
 	"github.com/ProtonMail/gluon/connector"
 	"github.com/ProtonMail/gluon/db"
+	"github.com/ProtonMail/gluon/events"
 	"github.com/ProtonMail/gluon/imap"
 	"github.com/ProtonMail/gluon/internal/ids"
+	"github.com/ProtonMail/gluon/internal/search"
 	"github.com/ProtonMail/gluon/internal/state"
 	"github.com/ProtonMail/gluon/internal/utils"
 	"github.com/ProtonMail/gluon/limits"
@@ -17,6 +21,7 @@ import (
 	"github.com/ProtonMail/gluon/observability"
 	"github.com/ProtonMail/gluon/observability/metrics"
 	"github.com/ProtonMail/gluon/reporter"
+	"github.com/ProtonMail/gluon/sieve"
 	"github.com/ProtonMail/gluon/store"
 	"github.com/bradenaw/juniper/xslices"
 	"github.com/sirupsen/logrus"
@@ -31,6 +36,9 @@ type user struct {
 	store          *store.WriteControlledStore
 	delimiter      string
 
+	// searchIndex is the user's full-text search index, or nil if indexing is disabled.
+	searchIndex *search.Index
+
 	db db.Client
 
 	states     map[state.StateID]*state.State
@@ -42,10 +50,36 @@ type user struct {
 
 	recoveryMailboxID imap.InternalMailboxID
 
+	// health is the last health state reported by the connector.
+	health     imap.ConnectorHealth
+	healthMsg  string
+	healthLock sync.RWMutex
+
+	// usernamesChanged is set when the connector reports that its usernames changed, until they are indexed again.
+	usernamesChanged atomic.Bool
+
+	// flagVersions tracks local flag changes not yet acknowledged by the connector.
+	flagVersions       *flagVersions
+	flagConflictPolicy imap.FlagConflictPolicy
+
+	// rotationLock serializes passphrase rotations.
+	rotationLock sync.Mutex
+
+	// storeBudget is the space the literals in the store may take before the least recently used are evicted,
+	// or zero if the store is unbounded.
+	storeBudget int64
+	evictLock   sync.Mutex
+
+	// sieve is the user's parsed sieve script, or nil if filtering is disabled.
+	sieve     *sieve.Script
+	sieveLock sync.RWMutex
+
 	imapLimits limits.IMAP
 
 	uidValidityGenerator imap.UIDValidityGenerator
 
+	eventCh *async.QueuedChannel[events.Event]
+
 	panicHandler async.PanicHandler
 
 	recoveredMessageHashes *utils.MessageHashesMap
@@ -59,9 +93,13 @@ func newUser(
 	database db.Client,
 	conn connector.Connector,
 	st store.Store,
+	searchIndex *search.Index,
+	storeBudget int64,
 	delimiter string,
 	imapLimits limits.IMAP,
 	uidValidityGenerator imap.UIDValidityGenerator,
+	flagConflictPolicy imap.FlagConflictPolicy,
+	eventCh *async.QueuedChannel[events.Event],
 	panicHandler async.PanicHandler,
 ) (*user, error) {
 	recoveredMessageHashes := utils.NewMessageHashesMap()
@@ -123,6 +161,8 @@ func newUser(
 		updateInjector: newUpdateInjector(conn, userID, panicHandler),
 		store:          store.NewWriteControlledStore(st),
 		delimiter:      delimiter,
+		searchIndex:    searchIndex,
+		storeBudget:    storeBudget,
 
 		db: database,
 
@@ -135,6 +175,11 @@ func newUser(
 
 		uidValidityGenerator: uidValidityGenerator,
 
+		flagVersions:       newFlagVersions(),
+		flagConflictPolicy: flagConflictPolicy,
+
+		eventCh: eventCh,
+
 		panicHandler: panicHandler,
 
 		recoveredMessageHashes: recoveredMessageHashes,
@@ -149,6 +194,11 @@ func newUser(
 		return nil, err
 	}
 
+	if err := user.loadSieveScript(ctx); err != nil {
+		log.WithError(err).Error("Failed to load sieve script")
+		return nil, err
+	}
+
 	if err := user.deleteAllMessagesMarkedDeleted(ctx); err != nil {
 		log.WithError(err).Error("Failed to remove deleted messages")
 		observability.AddMessageRelatedMetric(ctx, metrics.GenerateFailedToRemoveDeletedMessagesMetric())
@@ -158,6 +208,66 @@ func newUser(
 		log.WithError(err).Error("Failed to cleanup stale store data")
 	}
 
+	if searchIndex != nil {
+		user.updateWG.Add(1)
+
+		// nolint:contextcheck
+		async.GoAnnotated(context.Background(), panicHandler, func(ctx context.Context) {
+			defer user.updateWG.Done()
+
+			if err := user.syncSearchIndex(ctx); err != nil {
+				log.WithError(err).Error("Failed to sync search index")
+			}
+		}, logging.Labels{
+			"Action": "Syncing search index",
+			"UserID": userID,
+		})
+	}
+
+	user.updateWG.Add(1)
+
+	// nolint:contextcheck
+	async.GoAnnotated(context.Background(), panicHandler, func(ctx context.Context) {
+		defer user.updateWG.Done()
+
+		if err := user.fillMissingHeaderFields(ctx); err != nil {
+			log.WithError(err).Error("Failed to fill in message header fields")
+		}
+	}, logging.Labels{
+		"Action": "Filling message header fields",
+		"UserID": userID,
+	})
+
+	if user.store.RotationPassphrase() != nil {
+		user.updateWG.Add(1)
+
+		// nolint:contextcheck
+		async.GoAnnotated(context.Background(), panicHandler, func(ctx context.Context) {
+			defer user.updateWG.Done()
+
+			if err := user.resumeRotation(ctx); err != nil && !errors.Is(err, ErrUserClosed) {
+				log.WithError(err).Error("Failed to resume passphrase rotation")
+			}
+		}, logging.Labels{
+			"Action": "Rotating passphrase",
+			"UserID": userID,
+		})
+	}
+
+	if storeBudget > 0 {
+		user.updateWG.Add(1)
+
+		// nolint:contextcheck
+		async.GoAnnotated(context.Background(), panicHandler, func(ctx context.Context) {
+			defer user.updateWG.Done()
+
+			user.evictStorePeriodically(ctx)
+		}, logging.Labels{
+			"Action": "Evicting store",
+			"UserID": userID,
+		})
+	}
+
 	user.updateWG.Add(1)
 
 	// nolint:contextcheck
@@ -220,6 +330,12 @@ func (user *user) close(ctx context.Context) error {
 		return fmt.Errorf("failed to close user client storage: %w", err)
 	}
 
+	if user.searchIndex != nil {
+		if err := user.searchIndex.Save(); err != nil {
+			return fmt.Errorf("failed to save search index: %w", err)
+		}
+	}
+
 	if err := user.db.Close(); err != nil {
 		return fmt.Errorf("failed to close user db: %w", err)
 	}
@@ -275,9 +391,21 @@ func (user *user) newState() (*state.State, error) {
 
 	user.statesWG.Add(1)
 
+	// Let the client know right away if the connector isn't healthy.
+	if health, msg := user.getHealthAndMessage(); health != imap.HealthOnline {
+		newState.QueueUpdates(state.NewAlertStateUpdate(getHealthAlert(health, msg)))
+	}
+
 	return newState, nil
 }
 
+func (user *user) countStates() int {
+	user.statesLock.RLock()
+	defer user.statesLock.RUnlock()
+
+	return len(user.states)
+}
+
 func (user *user) removeState(ctx context.Context, st *state.State) error {
 	messageIDs, err := db.ClientReadType(ctx, user.db, func(ctx context.Context, client db.ReadOnly) ([]imap.InternalMessageID, error) {
 		return client.GetMessageIDsMarkedAsDelete(ctx)
@@ -380,3 +508,59 @@ func (user *user) cleanupStaleStoreData(ctx context.Context) error {
 
 	return user.store.Delete(idsToDelete...)
 }
+
+// fillMissingHeaderFields stores the header fields of messages created before they were stored in the database,
+// so that header searches don't need to read them from the store.
+func (user *user) fillMissingHeaderFields(ctx context.Context) error {
+	messageIDs, err := db.ClientReadType(ctx, user.db, func(ctx context.Context, client db.ReadOnly) ([]imap.InternalMessageID, error) {
+		return client.GetMessageIDsWithoutHeaderFields(ctx)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Only the header fields of a batch are kept in memory, not the literals.
+	for _, chunk := range xslices.Chunk(messageIDs, 100) {
+		select {
+		case <-user.updateQuitCh:
+			return nil
+
+		default:
+		}
+
+		fields := make(map[imap.InternalMessageID]*db.MessageHeaderFields, len(chunk))
+
+		for _, id := range chunk {
+			literal, err := user.store.Get(id)
+			if err != nil {
+				user.log.WithError(err).WithField("messageID", id.ShortID()).Warn("Failed to load message for header fields")
+				continue
+			}
+
+			if f := db.NewMessageHeaderFields(literal); f != nil {
+				fields[id] = f
+			}
+		}
+
+		if err := user.db.Write(ctx, func(ctx context.Context, tx db.Transaction) error {
+			for id, f := range fields {
+				// The message may have been deleted in the meantime.
+				if exists, err := tx.MessageExists(ctx, id); err != nil {
+					return err
+				} else if !exists {
+					continue
+				}
+
+				if err := tx.StoreMessageHeaderFields(ctx, id, f); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/ProtonMail/gluon/db"
+	"github.com/ProtonMail/gluon/internal/db_impl/memory"
 	"github.com/ProtonMail/gluon/internal/db_impl/sqlite3"
 )
 
@@ -14,3 +15,11 @@ func NewSQLiteDB(options ...sqlite3.Option) db.ClientInterface {
 func TestUpdateDBVersion(ctx context.Context, dbPath, userID string, version int) error {
 	return sqlite3.TestUpdateDBVersion(ctx, dbPath, userID, version)
 }
+
+func TestUpdateDBMinCompatibleVersion(ctx context.Context, dbPath, userID string, version int) error {
+	return sqlite3.TestUpdateDBMinCompatibleVersion(ctx, dbPath, userID, version)
+}
+
+func NewMemoryDB() db.ClientInterface {
+	return memory.NewBuilder()
+}
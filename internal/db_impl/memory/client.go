@@ -0,0 +1,98 @@
+package memory
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+
+	"github.com/ProtonMail/gluon/db"
+	"github.com/ProtonMail/gluon/imap"
+)
+
+// Builder creates databases which are kept in memory for as long as the builder exists.
+// Closing a client keeps its data so that the same user can be loaded again; only Delete drops it.
+type Builder struct {
+	lock      sync.Mutex
+	databases map[string]*Client
+}
+
+func NewBuilder() db.ClientInterface {
+	return &Builder{
+		databases: make(map[string]*Client),
+	}
+}
+
+func (b *Builder) New(dir string, userID string) (db.Client, bool, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	path := getDatabasePath(dir, userID)
+
+	if client, ok := b.databases[path]; ok {
+		return client, false, nil
+	}
+
+	client := &Client{data: newDatabase()}
+
+	b.databases[path] = client
+
+	return client, true, nil
+}
+
+func (b *Builder) Delete(dir string, userID string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	delete(b.databases, getDatabasePath(dir, userID))
+
+	return nil
+}
+
+type Client struct {
+	lock sync.RWMutex
+	data *database
+}
+
+func (c *Client) Init(context.Context, imap.UIDValidityGenerator) error {
+	return nil
+}
+
+func (c *Client) Read(ctx context.Context, op func(context.Context, db.ReadOnly) error) error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return op(ctx, readOps{data: c.data})
+}
+
+// Write runs the operation against the database, recording how to revert each of its changes.
+// The changes of a failed or panicking operation are reverted, as a rolled back transaction would be.
+func (c *Client) Write(ctx context.Context, op func(context.Context, db.Transaction) error) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	committed := false
+
+	defer func() {
+		if !committed {
+			c.data.rollback()
+		}
+	}()
+
+	if err := op(ctx, writeOps{readOps: readOps{data: c.data}}); err != nil {
+		return err
+	}
+
+	c.data.commit()
+
+	committed = true
+
+	return nil
+}
+
+func (c *Client) Close() error {
+	return nil
+}
+
+func getDatabasePath(dir, userID string) string {
+	return filepath.Join(dir, userID)
+}
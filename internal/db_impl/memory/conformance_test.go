@@ -0,0 +1,11 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/gluon/db/dbtest"
+)
+
+func TestConformance(t *testing.T) {
+	dbtest.TestClientInterface(t, NewBuilder())
+}
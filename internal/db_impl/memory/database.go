@@ -0,0 +1,222 @@
+package memory
+
+import (
+	"github.com/ProtonMail/gluon/db"
+	"github.com/ProtonMail/gluon/imap"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+type database struct {
+	mailboxes     map[imap.InternalMailboxID]*mailbox
+	lastMailboxID imap.InternalMailboxID
+
+	messages map[imap.InternalMessageID]*message
+
+	// mailboxesByRemoteID, mailboxesByName and messagesByRemoteID index the mailboxes and messages.
+	mailboxesByRemoteID map[imap.MailboxID]imap.InternalMailboxID
+	mailboxesByName     map[string]imap.InternalMailboxID
+	messagesByRemoteID  map[imap.MessageID]imap.InternalMessageID
+
+	// deletedSubscriptions maps the names of deleted mailboxes to their remote IDs.
+	deletedSubscriptions map[string]imap.MailboxID
+
+	connectorSettings *string
+	sieveScript       string
+
+	// undo holds the functions reverting the changes made by the current write, in the order they were made.
+	undo []func()
+}
+
+type mailbox struct {
+	db.Mailbox
+
+	flags, permFlags, attrs imap.FlagSet
+
+	messages map[imap.InternalMessageID]*mailboxMessage
+
+	// messagesByRemoteID indexes the messages of the mailbox.
+	messagesByRemoteID map[imap.MessageID]imap.InternalMessageID
+
+	// lastUID is the highest UID ever assigned in the mailbox; UIDs are never reused.
+	lastUID imap.UID
+}
+
+type mailboxMessage struct {
+	uid      imap.UID
+	remoteID imap.MessageID
+	recent   bool
+	deleted  bool
+}
+
+type message struct {
+	db.Message
+
+	flags        imap.FlagSet
+	headerFields *db.MessageHeaderFields
+	literalHash  []byte
+}
+
+func newDatabase() *database {
+	return &database{
+		mailboxes:            make(map[imap.InternalMailboxID]*mailbox),
+		messages:             make(map[imap.InternalMessageID]*message),
+		mailboxesByRemoteID:  make(map[imap.MailboxID]imap.InternalMailboxID),
+		mailboxesByName:      make(map[string]imap.InternalMailboxID),
+		messagesByRemoteID:   make(map[imap.MessageID]imap.InternalMessageID),
+		deletedSubscriptions: make(map[string]imap.MailboxID),
+	}
+}
+
+// commit forgets the changes made by the current write, which can no longer be reverted.
+func (d *database) commit() {
+	d.undo = nil
+}
+
+// rollback reverts the changes made by the current write.
+func (d *database) rollback() {
+	for i := len(d.undo) - 1; i >= 0; i-- {
+		d.undo[i]()
+	}
+
+	d.undo = nil
+}
+
+// set assigns the value to the field, recording the change so that it can be rolled back.
+func set[T any](d *database, field *T, value T) {
+	old := *field
+
+	d.undo = append(d.undo, func() { *field = old })
+
+	*field = value
+}
+
+// setEntry sets the entry of the map, recording the change so that it can be rolled back.
+func setEntry[K comparable, V any](d *database, m map[K]V, key K, value V) {
+	recordEntry(d, m, key)
+
+	m[key] = value
+}
+
+// deleteEntry deletes the entry of the map, recording the change so that it can be rolled back.
+func deleteEntry[K comparable, V any](d *database, m map[K]V, key K) {
+	if _, ok := m[key]; !ok {
+		return
+	}
+
+	recordEntry(d, m, key)
+
+	delete(m, key)
+}
+
+func recordEntry[K comparable, V any](d *database, m map[K]V, key K) {
+	if old, ok := m[key]; ok {
+		d.undo = append(d.undo, func() { m[key] = old })
+	} else {
+		d.undo = append(d.undo, func() { delete(m, key) })
+	}
+}
+
+func (d *database) addMailbox(mbox *mailbox) {
+	setEntry(d, d.mailboxes, mbox.ID, mbox)
+	setEntry(d, d.mailboxesByRemoteID, mbox.RemoteID, mbox.ID)
+	setEntry(d, d.mailboxesByName, mbox.Name, mbox.ID)
+}
+
+func (d *database) deleteMailbox(mbox *mailbox) {
+	deleteEntry(d, d.mailboxes, mbox.ID)
+	deleteEntry(d, d.mailboxesByRemoteID, mbox.RemoteID)
+	deleteEntry(d, d.mailboxesByName, mbox.Name)
+}
+
+func (d *database) renameMailbox(mbox *mailbox, name string) {
+	deleteEntry(d, d.mailboxesByName, mbox.Name)
+	setEntry(d, d.mailboxesByName, name, mbox.ID)
+	set(d, &mbox.Name, name)
+}
+
+func (d *database) setMailboxRemoteID(mbox *mailbox, remoteID imap.MailboxID) {
+	deleteEntry(d, d.mailboxesByRemoteID, mbox.RemoteID)
+	setEntry(d, d.mailboxesByRemoteID, remoteID, mbox.ID)
+	set(d, &mbox.RemoteID, remoteID)
+}
+
+func (d *database) addMessage(msg *message) {
+	setEntry(d, d.messages, msg.ID, msg)
+	setEntry(d, d.messagesByRemoteID, msg.RemoteID, msg.ID)
+}
+
+func (d *database) deleteMessage(msg *message) {
+	deleteEntry(d, d.messages, msg.ID)
+	deleteEntry(d, d.messagesByRemoteID, msg.RemoteID)
+}
+
+func (d *database) setMessageRemoteID(msg *message, remoteID imap.MessageID) {
+	deleteEntry(d, d.messagesByRemoteID, msg.RemoteID)
+	setEntry(d, d.messagesByRemoteID, remoteID, msg.ID)
+	set(d, &msg.RemoteID, remoteID)
+}
+
+func (d *database) addMailboxMessage(mbox *mailbox, id imap.InternalMessageID, msg *mailboxMessage) {
+	setEntry(d, mbox.messages, id, msg)
+	setEntry(d, mbox.messagesByRemoteID, msg.remoteID, id)
+}
+
+func (d *database) removeMailboxMessage(mbox *mailbox, id imap.InternalMessageID) {
+	msg, ok := mbox.messages[id]
+	if !ok {
+		return
+	}
+
+	deleteEntry(d, mbox.messages, id)
+	deleteEntry(d, mbox.messagesByRemoteID, msg.remoteID)
+}
+
+// sortedMailboxes returns the mailboxes in the order they were created.
+func (d *database) sortedMailboxes() []*mailbox {
+	mailboxes := maps.Values(d.mailboxes)
+
+	slices.SortFunc(mailboxes, func(a, b *mailbox) bool {
+		return a.ID < b.ID
+	})
+
+	return mailboxes
+}
+
+func (d *database) mailboxByRemoteID(mboxID imap.MailboxID) (*mailbox, bool) {
+	id, ok := d.mailboxesByRemoteID[mboxID]
+	if !ok {
+		return nil, false
+	}
+
+	return d.mailboxes[id], true
+}
+
+func (d *database) mailboxByName(name string) (*mailbox, bool) {
+	id, ok := d.mailboxesByName[name]
+	if !ok {
+		return nil, false
+	}
+
+	return d.mailboxes[id], true
+}
+
+func (d *database) messageByRemoteID(id imap.MessageID) (*message, bool) {
+	internalID, ok := d.messagesByRemoteID[id]
+	if !ok {
+		return nil, false
+	}
+
+	return d.messages[internalID], true
+}
+
+// sortedMessages returns the messages of the mailbox ordered by UID.
+func (m *mailbox) sortedMessages() []imap.InternalMessageID {
+	ids := maps.Keys(m.messages)
+
+	slices.SortFunc(ids, func(a, b imap.InternalMessageID) bool {
+		return m.messages[a].uid < m.messages[b].uid
+	})
+
+	return ids
+}
@@ -0,0 +1,544 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/gluon/db"
+	"github.com/ProtonMail/gluon/imap"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+type readOps struct {
+	data *database
+}
+
+func (r readOps) getMailbox(mboxID imap.InternalMailboxID) (*mailbox, error) {
+	mbox, ok := r.data.mailboxes[mboxID]
+	if !ok {
+		return nil, fmt.Errorf("mailbox %v: %w", mboxID, db.ErrNotFound)
+	}
+
+	return mbox, nil
+}
+
+func (r readOps) getMessage(id imap.InternalMessageID) (*message, error) {
+	msg, ok := r.data.messages[id]
+	if !ok {
+		return nil, fmt.Errorf("message %v: %w", id, db.ErrNotFound)
+	}
+
+	return msg, nil
+}
+
+func (r readOps) MailboxExistsWithID(_ context.Context, mboxID imap.InternalMailboxID) (bool, error) {
+	_, ok := r.data.mailboxes[mboxID]
+
+	return ok, nil
+}
+
+func (r readOps) MailboxExistsWithRemoteID(_ context.Context, mboxID imap.MailboxID) (bool, error) {
+	_, ok := r.data.mailboxByRemoteID(mboxID)
+
+	return ok, nil
+}
+
+func (r readOps) MailboxExistsWithName(_ context.Context, name string) (bool, error) {
+	_, ok := r.data.mailboxByName(name)
+
+	return ok, nil
+}
+
+func (r readOps) GetMailboxIDFromRemoteID(ctx context.Context, mboxID imap.MailboxID) (imap.InternalMailboxID, error) {
+	mbox, err := r.GetMailboxByRemoteID(ctx, mboxID)
+	if err != nil {
+		return 0, err
+	}
+
+	return mbox.ID, nil
+}
+
+func (r readOps) GetMailboxName(_ context.Context, mboxID imap.InternalMailboxID) (string, error) {
+	mbox, err := r.getMailbox(mboxID)
+	if err != nil {
+		return "", err
+	}
+
+	return mbox.Name, nil
+}
+
+func (r readOps) GetMailboxNameWithRemoteID(ctx context.Context, mboxID imap.MailboxID) (string, error) {
+	mbox, err := r.GetMailboxByRemoteID(ctx, mboxID)
+	if err != nil {
+		return "", err
+	}
+
+	return mbox.Name, nil
+}
+
+func (r readOps) GetMailboxMessageIDPairs(_ context.Context, mboxID imap.InternalMailboxID) ([]db.MessageIDPair, error) {
+	mbox, err := r.getMailbox(mboxID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := mbox.sortedMessages()
+	result := make([]db.MessageIDPair, 0, len(ids))
+
+	for _, id := range ids {
+		result = append(result, db.MessageIDPair{InternalID: id, RemoteID: mbox.messages[id].remoteID})
+	}
+
+	return result, nil
+}
+
+func (r readOps) GetAllMailboxesWithAttr(_ context.Context) ([]*db.MailboxWithAttr, error) {
+	mailboxes := r.data.sortedMailboxes()
+	result := make([]*db.MailboxWithAttr, 0, len(mailboxes))
+
+	for _, mbox := range mailboxes {
+		result = append(result, &db.MailboxWithAttr{Mailbox: mbox.Mailbox, Attributes: mbox.attrs.Clone()})
+	}
+
+	return result, nil
+}
+
+func (r readOps) GetAllMailboxesAsRemoteIDs(_ context.Context) ([]imap.MailboxID, error) {
+	mailboxes := r.data.sortedMailboxes()
+	result := make([]imap.MailboxID, 0, len(mailboxes))
+
+	for _, mbox := range mailboxes {
+		result = append(result, mbox.RemoteID)
+	}
+
+	return result, nil
+}
+
+func (r readOps) GetMailboxByName(_ context.Context, name string) (*db.Mailbox, error) {
+	mbox, ok := r.data.mailboxByName(name)
+	if !ok {
+		return nil, fmt.Errorf("mailbox %v: %w", name, db.ErrNotFound)
+	}
+
+	result := mbox.Mailbox
+
+	return &result, nil
+}
+
+func (r readOps) GetMailboxByID(_ context.Context, mboxID imap.InternalMailboxID) (*db.Mailbox, error) {
+	mbox, err := r.getMailbox(mboxID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := mbox.Mailbox
+
+	return &result, nil
+}
+
+func (r readOps) GetMailboxByRemoteID(_ context.Context, mboxID imap.MailboxID) (*db.Mailbox, error) {
+	mbox, ok := r.data.mailboxByRemoteID(mboxID)
+	if !ok {
+		return nil, fmt.Errorf("mailbox %v: %w", mboxID, db.ErrNotFound)
+	}
+
+	result := mbox.Mailbox
+
+	return &result, nil
+}
+
+func (r readOps) GetMailboxRecentCount(_ context.Context, mboxID imap.InternalMailboxID) (int, error) {
+	mbox, err := r.getMailbox(mboxID)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+
+	for _, msg := range mbox.messages {
+		if msg.recent {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (r readOps) GetMailboxMessageCount(_ context.Context, mboxID imap.InternalMailboxID) (int, error) {
+	mbox, err := r.getMailbox(mboxID)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(mbox.messages), nil
+}
+
+func (r readOps) GetMailboxMessageCountWithRemoteID(ctx context.Context, mboxID imap.MailboxID) (int, error) {
+	internalID, err := r.GetMailboxIDFromRemoteID(ctx, mboxID)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.GetMailboxMessageCount(ctx, internalID)
+}
+
+func (r readOps) GetMailboxFlags(_ context.Context, mboxID imap.InternalMailboxID) (imap.FlagSet, error) {
+	mbox, err := r.getMailbox(mboxID)
+	if err != nil {
+		return imap.FlagSet{}, err
+	}
+
+	return mbox.flags.Clone(), nil
+}
+
+func (r readOps) GetMailboxPermanentFlags(_ context.Context, mboxID imap.InternalMailboxID) (imap.FlagSet, error) {
+	mbox, err := r.getMailbox(mboxID)
+	if err != nil {
+		return imap.FlagSet{}, err
+	}
+
+	return mbox.permFlags.Clone(), nil
+}
+
+func (r readOps) GetMailboxAttributes(_ context.Context, mboxID imap.InternalMailboxID) (imap.FlagSet, error) {
+	mbox, err := r.getMailbox(mboxID)
+	if err != nil {
+		return imap.FlagSet{}, err
+	}
+
+	return mbox.attrs.Clone(), nil
+}
+
+func (r readOps) GetMailboxUID(_ context.Context, mboxID imap.InternalMailboxID) (imap.UID, error) {
+	mbox, err := r.getMailbox(mboxID)
+	if err != nil {
+		return 0, err
+	}
+
+	return mbox.lastUID.Add(1), nil
+}
+
+func (r readOps) GetMailboxMessageCountAndUID(ctx context.Context, mboxID imap.InternalMailboxID) (int, imap.UID, error) {
+	count, err := r.GetMailboxMessageCount(ctx, mboxID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	uid, err := r.GetMailboxUID(ctx, mboxID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return count, uid, nil
+}
+
+func (r readOps) GetMailboxMessageForNewSnapshot(_ context.Context, mboxID imap.InternalMailboxID) ([]db.SnapshotMessageResult, error) {
+	mbox, err := r.getMailbox(mboxID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := mbox.sortedMessages()
+	result := make([]db.SnapshotMessageResult, 0, len(ids))
+
+	for _, id := range ids {
+		msg := mbox.messages[id]
+
+		result = append(result, db.SnapshotMessageResult{
+			InternalID: id,
+			RemoteID:   msg.remoteID,
+			UID:        msg.uid,
+			Recent:     msg.recent,
+			Deleted:    msg.deleted,
+			Flags:      r.joinedMessageFlags(id),
+		})
+	}
+
+	return result, nil
+}
+
+func (r readOps) MailboxTranslateRemoteIDs(_ context.Context, mboxIDs []imap.MailboxID) ([]imap.InternalMailboxID, error) {
+	result := make([]imap.InternalMailboxID, 0, len(mboxIDs))
+
+	for _, mboxID := range mboxIDs {
+		if mbox, ok := r.data.mailboxByRemoteID(mboxID); ok {
+			result = append(result, mbox.ID)
+		}
+	}
+
+	return result, nil
+}
+
+func (r readOps) MailboxFilterContains(_ context.Context, mboxID imap.InternalMailboxID, messageIDs []db.MessageIDPair) ([]imap.InternalMessageID, error) {
+	mbox, err := r.getMailbox(mboxID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]imap.InternalMessageID, 0, len(messageIDs))
+
+	for _, id := range messageIDs {
+		if _, ok := mbox.messages[id.InternalID]; ok {
+			result = append(result, id.InternalID)
+		}
+	}
+
+	return result, nil
+}
+
+func (r readOps) GetMailboxCount(_ context.Context) (int, error) {
+	return len(r.data.mailboxes), nil
+}
+
+func (r readOps) GetAllMailboxesNameAndRemoteID(_ context.Context) ([]db.MailboxNameAndRemoteID, error) {
+	mailboxes := r.data.sortedMailboxes()
+	result := make([]db.MailboxNameAndRemoteID, 0, len(mailboxes))
+
+	for _, mbox := range mailboxes {
+		result = append(result, db.MailboxNameAndRemoteID{Name: mbox.Name, RemoteID: mbox.RemoteID})
+	}
+
+	return result, nil
+}
+
+func (r readOps) MessageExists(_ context.Context, id imap.InternalMessageID) (bool, error) {
+	_, ok := r.data.messages[id]
+
+	return ok, nil
+}
+
+func (r readOps) MessageExistsWithRemoteID(_ context.Context, id imap.MessageID) (bool, error) {
+	_, ok := r.data.messageByRemoteID(id)
+
+	return ok, nil
+}
+
+func (r readOps) GetMessageNoEdges(_ context.Context, id imap.InternalMessageID) (*db.Message, error) {
+	msg, err := r.getMessage(id)
+	if err != nil {
+		return nil, err
+	}
+
+	result := msg.Message
+
+	return &result, nil
+}
+
+func (r readOps) GetTotalMessageCount(_ context.Context) (int, error) {
+	return len(r.data.messages), nil
+}
+
+func (r readOps) GetMessageRemoteID(_ context.Context, id imap.InternalMessageID) (imap.MessageID, error) {
+	msg, err := r.getMessage(id)
+	if err != nil {
+		return "", err
+	}
+
+	return msg.RemoteID, nil
+}
+
+func (r readOps) GetImportedMessageData(_ context.Context, id imap.InternalMessageID) (*db.MessageWithFlags, error) {
+	msg, err := r.getMessage(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &db.MessageWithFlags{Message: msg.Message, Flags: msg.flags.Clone()}, nil
+}
+
+func (r readOps) GetMessageDateAndSize(_ context.Context, id imap.InternalMessageID) (time.Time, int, error) {
+	msg, err := r.getMessage(id)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	return msg.Date, msg.Size, nil
+}
+
+func (r readOps) GetMessageMailboxIDs(_ context.Context, id imap.InternalMessageID) ([]imap.InternalMailboxID, error) {
+	var result []imap.InternalMailboxID
+
+	for _, mbox := range r.data.sortedMailboxes() {
+		if _, ok := mbox.messages[id]; ok {
+			result = append(result, mbox.ID)
+		}
+	}
+
+	return result, nil
+}
+
+func (r readOps) GetMessagesFlags(_ context.Context, ids []imap.InternalMessageID) ([]db.MessageFlagSet, error) {
+	result := make([]db.MessageFlagSet, 0, len(ids))
+
+	for _, id := range ids {
+		msg, ok := r.data.messages[id]
+		if !ok {
+			continue
+		}
+
+		result = append(result, db.MessageFlagSet{ID: id, RemoteID: msg.RemoteID, FlagSet: msg.flags.Clone()})
+	}
+
+	return result, nil
+}
+
+func (r readOps) GetMessageIDsMarkedAsDelete(_ context.Context) ([]imap.InternalMessageID, error) {
+	var result []imap.InternalMessageID
+
+	for id, msg := range r.data.messages {
+		if msg.Deleted {
+			result = append(result, id)
+		}
+	}
+
+	return result, nil
+}
+
+func (r readOps) GetMessageIDFromRemoteID(_ context.Context, id imap.MessageID) (imap.InternalMessageID, error) {
+	msg, ok := r.data.messageByRemoteID(id)
+	if !ok {
+		return imap.InternalMessageID{}, fmt.Errorf("message %v: %w", id, db.ErrNotFound)
+	}
+
+	return msg.ID, nil
+}
+
+func (r readOps) GetMessageDeletedFlag(_ context.Context, id imap.InternalMessageID) (bool, error) {
+	msg, err := r.getMessage(id)
+	if err != nil {
+		return false, err
+	}
+
+	return msg.Deleted, nil
+}
+
+func (r readOps) GetAllMessagesIDsAsMap(_ context.Context) (map[imap.InternalMessageID]struct{}, error) {
+	result := make(map[imap.InternalMessageID]struct{}, len(r.data.messages))
+
+	for id := range r.data.messages {
+		result[id] = struct{}{}
+	}
+
+	return result, nil
+}
+
+func (r readOps) GetMessageHeaderFields(_ context.Context, id imap.InternalMessageID) (*db.MessageHeaderFields, error) {
+	msg, err := r.getMessage(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if msg.headerFields == nil {
+		return nil, fmt.Errorf("header fields of message %v: %w", id, db.ErrNotFound)
+	}
+
+	fields := *msg.headerFields
+
+	return &fields, nil
+}
+
+func (r readOps) GetMessageLiteralHashes(_ context.Context, ids []imap.InternalMessageID) (map[imap.InternalMessageID][]byte, error) {
+	result := make(map[imap.InternalMessageID][]byte, len(ids))
+
+	for _, id := range ids {
+		if msg, ok := r.data.messages[id]; ok && msg.literalHash != nil {
+			result[id] = slices.Clone(msg.literalHash)
+		}
+	}
+
+	return result, nil
+}
+
+func (r readOps) GetMessageIDsWithoutHeaderFields(_ context.Context) ([]imap.InternalMessageID, error) {
+	var result []imap.InternalMessageID
+
+	for id, msg := range r.data.messages {
+		if msg.headerFields == nil {
+			result = append(result, id)
+		}
+	}
+
+	return result, nil
+}
+
+func (r readOps) SearchMessageHeaders(_ context.Context, mboxID imap.InternalMailboxID, keys []db.HeaderSearchKey) (db.HeaderSearchResult, error) {
+	mbox, err := r.getMailbox(mboxID)
+	if err != nil {
+		return db.HeaderSearchResult{}, err
+	}
+
+	result := db.HeaderSearchResult{
+		Matches: make([]map[imap.InternalMessageID]struct{}, len(keys)),
+		Missing: make(map[imap.InternalMessageID]struct{}),
+	}
+
+	for i := range keys {
+		result.Matches[i] = make(map[imap.InternalMessageID]struct{})
+	}
+
+	for id := range mbox.messages {
+		msg, ok := r.data.messages[id]
+		if !ok {
+			continue
+		}
+
+		fields := msg.headerFields
+		if fields == nil {
+			result.Missing[id] = struct{}{}
+			continue
+		}
+
+		for i, key := range keys {
+			if key.Matches(fields) {
+				result.Matches[i][id] = struct{}{}
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// GetOrphanedFlagMessageIDs returns nothing: flags are stored with their message and deleted along with it.
+func (r readOps) GetOrphanedFlagMessageIDs(_ context.Context) ([]imap.InternalMessageID, error) {
+	return nil, nil
+}
+
+func (r readOps) GetDeletedSubscriptionSet(_ context.Context) (map[imap.MailboxID]*db.DeletedSubscription, error) {
+	result := make(map[imap.MailboxID]*db.DeletedSubscription, len(r.data.deletedSubscriptions))
+
+	for name, remoteID := range r.data.deletedSubscriptions {
+		result[remoteID] = &db.DeletedSubscription{Name: name, RemoteID: remoteID}
+	}
+
+	return result, nil
+}
+
+func (r readOps) GetConnectorSettings(_ context.Context) (string, bool, error) {
+	if r.data.connectorSettings == nil {
+		return "", false, nil
+	}
+
+	return *r.data.connectorSettings, true, nil
+}
+
+func (r readOps) GetSieveScript(_ context.Context) (string, error) {
+	return r.data.sieveScript, nil
+}
+
+// joinedMessageFlags returns the flags of the message joined by commas, as expected by db.SnapshotMessageResult
+// and db.UIDWithFlags.
+func (r readOps) joinedMessageFlags(id imap.InternalMessageID) string {
+	msg, ok := r.data.messages[id]
+	if !ok {
+		return ""
+	}
+
+	flags := maps.Values(msg.flags)
+
+	slices.Sort(flags)
+
+	return strings.Join(flags, ",")
+}
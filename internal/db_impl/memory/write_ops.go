@@ -0,0 +1,527 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ProtonMail/gluon/db"
+	"github.com/ProtonMail/gluon/imap"
+	"golang.org/x/exp/slices"
+)
+
+var (
+	errMailboxExists  = errors.New("mailbox already exists")
+	errMessageExists  = errors.New("message already exists")
+	errNoValueChanged = errors.New("no values changed")
+)
+
+type writeOps struct {
+	readOps
+}
+
+func (w writeOps) CreateMailbox(
+	_ context.Context,
+	mboxID imap.MailboxID,
+	name string,
+	flags, permFlags, attrs imap.FlagSet,
+	perms imap.MailboxPermissions,
+	uidValidity imap.UID,
+) (*db.Mailbox, error) {
+	if _, ok := w.data.mailboxByRemoteID(mboxID); ok {
+		return nil, fmt.Errorf("%w: remote ID %v", errMailboxExists, mboxID)
+	}
+
+	if _, ok := w.data.mailboxByName(name); ok {
+		return nil, fmt.Errorf("%w: name %v", errMailboxExists, name)
+	}
+
+	set(w.data, &w.data.lastMailboxID, w.data.lastMailboxID+1)
+
+	mbox := &mailbox{
+		Mailbox: db.Mailbox{
+			ID:          w.data.lastMailboxID,
+			RemoteID:    mboxID,
+			Name:        name,
+			UIDValidity: uidValidity,
+			Subscribed:  true,
+			Permissions: perms,
+		},
+		flags:     flags.Clone(),
+		permFlags: permFlags.Clone(),
+		attrs:     attrs.Clone(),
+		messages:  make(map[imap.InternalMessageID]*mailboxMessage),
+
+		messagesByRemoteID: make(map[imap.MessageID]imap.InternalMessageID),
+	}
+
+	w.data.addMailbox(mbox)
+
+	result := mbox.Mailbox
+
+	return &result, nil
+}
+
+func (w writeOps) GetOrCreateMailbox(
+	ctx context.Context,
+	mboxID imap.MailboxID,
+	name string,
+	flags, permFlags, attrs imap.FlagSet,
+	perms imap.MailboxPermissions,
+	uidValidity imap.UID,
+) (*db.Mailbox, error) {
+	if mbox, err := w.GetMailboxByRemoteID(ctx, mboxID); err == nil {
+		return mbox, nil
+	}
+
+	return w.CreateMailbox(ctx, mboxID, name, flags, permFlags, attrs, perms, uidValidity)
+}
+
+func (w writeOps) GetOrCreateMailboxAlt(ctx context.Context, mbox imap.Mailbox, delimiter string, uidValidity imap.UID) (*db.Mailbox, error) {
+	return w.GetOrCreateMailbox(
+		ctx,
+		mbox.ID,
+		strings.Join(mbox.Name, delimiter),
+		mbox.Flags,
+		mbox.PermanentFlags,
+		mbox.Attributes,
+		mbox.Permissions,
+		uidValidity,
+	)
+}
+
+func (w writeOps) RenameMailboxWithRemoteID(_ context.Context, mboxID imap.MailboxID, name string) error {
+	mbox, ok := w.data.mailboxByRemoteID(mboxID)
+	if !ok {
+		return errNoValueChanged
+	}
+
+	if other, ok := w.data.mailboxByName(name); ok && other != mbox {
+		return fmt.Errorf("%w: name %v", errMailboxExists, name)
+	}
+
+	w.data.renameMailbox(mbox, name)
+
+	return nil
+}
+
+func (w writeOps) SetMailboxPermissionsWithRemoteID(_ context.Context, mboxID imap.MailboxID, permissions imap.MailboxPermissions) error {
+	mbox, ok := w.data.mailboxByRemoteID(mboxID)
+	if !ok {
+		return errNoValueChanged
+	}
+
+	set(w.data, &mbox.Permissions, permissions)
+
+	return nil
+}
+
+func (w writeOps) DeleteMailboxWithRemoteID(ctx context.Context, mboxID imap.MailboxID) error {
+	mbox, ok := w.data.mailboxByRemoteID(mboxID)
+	if !ok {
+		return nil
+	}
+
+	if mbox.Subscribed {
+		if err := w.AddDeletedSubscription(ctx, mbox.Name, mboxID); err != nil {
+			return err
+		}
+	}
+
+	w.data.deleteMailbox(mbox)
+
+	return nil
+}
+
+func (w writeOps) AddMessagesToMailbox(
+	_ context.Context,
+	mboxID imap.InternalMailboxID,
+	messageIDs []db.MessageIDPair,
+) ([]db.UIDWithFlags, error) {
+	if len(messageIDs) == 0 {
+		return nil, nil
+	}
+
+	mbox, err := w.getMailbox(mboxID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]db.UIDWithFlags, 0, len(messageIDs))
+
+	for _, id := range messageIDs {
+		if err := w.addMessageToMailbox(mbox, id); err != nil {
+			return nil, err
+		}
+
+		msg := mbox.messages[id.InternalID]
+
+		result = append(result, db.UIDWithFlags{
+			InternalID: id.InternalID,
+			RemoteID:   msg.remoteID,
+			UID:        msg.uid,
+			Recent:     msg.recent,
+			Deleted:    msg.deleted,
+			Flags:      w.joinedMessageFlags(id.InternalID),
+		})
+	}
+
+	return result, nil
+}
+
+func (w writeOps) addMessageToMailbox(mbox *mailbox, id db.MessageIDPair) error {
+	if _, err := w.getMessage(id.InternalID); err != nil {
+		return err
+	}
+
+	if _, ok := mbox.messages[id.InternalID]; ok {
+		return fmt.Errorf("%w: %v in mailbox %v", errMessageExists, id.InternalID, mbox.ID)
+	}
+
+	if _, ok := mbox.messagesByRemoteID[id.RemoteID]; ok {
+		return fmt.Errorf("%w: %v in mailbox %v", errMessageExists, id.RemoteID, mbox.ID)
+	}
+
+	set(w.data, &mbox.lastUID, mbox.lastUID.Add(1))
+
+	w.data.addMailboxMessage(mbox, id.InternalID, &mailboxMessage{
+		uid:      mbox.lastUID,
+		remoteID: id.RemoteID,
+		recent:   true,
+	})
+
+	return nil
+}
+
+func (w writeOps) RemoveMessagesFromMailbox(_ context.Context, mboxID imap.InternalMailboxID, messageIDs []imap.InternalMessageID) error {
+	mbox, err := w.getMailbox(mboxID)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range messageIDs {
+		w.data.removeMailboxMessage(mbox, id)
+	}
+
+	return nil
+}
+
+func (w writeOps) ClearRecentFlagInMailboxOnMessage(_ context.Context, mboxID imap.InternalMailboxID, messageID imap.InternalMessageID) error {
+	mbox, err := w.getMailbox(mboxID)
+	if err != nil {
+		return err
+	}
+
+	if msg, ok := mbox.messages[messageID]; ok {
+		set(w.data, &msg.recent, false)
+	}
+
+	return nil
+}
+
+func (w writeOps) ClearRecentFlagsInMailbox(_ context.Context, mboxID imap.InternalMailboxID) error {
+	mbox, err := w.getMailbox(mboxID)
+	if err != nil {
+		return err
+	}
+
+	for _, msg := range mbox.messages {
+		if msg.recent {
+			set(w.data, &msg.recent, false)
+		}
+	}
+
+	return nil
+}
+
+func (w writeOps) CreateMailboxIfNotExists(ctx context.Context, mbox imap.Mailbox, delimiter string, uidValidity imap.UID) error {
+	_, err := w.GetOrCreateMailboxAlt(ctx, mbox, delimiter, uidValidity)
+
+	return err
+}
+
+func (w writeOps) SetMailboxMessagesDeletedFlag(_ context.Context, mboxID imap.InternalMailboxID, messageIDs []imap.InternalMessageID, deleted bool) error {
+	mbox, err := w.getMailbox(mboxID)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range messageIDs {
+		if msg, ok := mbox.messages[id]; ok {
+			set(w.data, &msg.deleted, deleted)
+		}
+	}
+
+	return nil
+}
+
+func (w writeOps) SetMailboxSubscribed(_ context.Context, mboxID imap.InternalMailboxID, subscribed bool) error {
+	if mbox, ok := w.data.mailboxes[mboxID]; ok {
+		set(w.data, &mbox.Subscribed, subscribed)
+	}
+
+	return nil
+}
+
+func (w writeOps) UpdateRemoteMailboxID(_ context.Context, mboxID imap.InternalMailboxID, remoteID imap.MailboxID) error {
+	mbox, ok := w.data.mailboxes[mboxID]
+	if !ok {
+		return errNoValueChanged
+	}
+
+	if other, ok := w.data.mailboxByRemoteID(remoteID); ok && other != mbox {
+		return fmt.Errorf("%w: remote ID %v", errMailboxExists, remoteID)
+	}
+
+	w.data.setMailboxRemoteID(mbox, remoteID)
+
+	return nil
+}
+
+func (w writeOps) SetMailboxUIDValidity(_ context.Context, mboxID imap.InternalMailboxID, uidValidity imap.UID) error {
+	mbox, ok := w.data.mailboxes[mboxID]
+	if !ok {
+		return errNoValueChanged
+	}
+
+	set(w.data, &mbox.UIDValidity, uidValidity)
+
+	return nil
+}
+
+func (w writeOps) BumpMailboxUIDNext(_ context.Context, mboxID imap.InternalMailboxID, uidNext imap.UID) error {
+	mbox, err := w.getMailbox(mboxID)
+	if err != nil {
+		return err
+	}
+
+	if mbox.lastUID < uidNext-1 {
+		set(w.data, &mbox.lastUID, uidNext-1)
+	}
+
+	return nil
+}
+
+func (w writeOps) AddFlagsToAllMailboxes(_ context.Context, flags ...string) error {
+	for _, mbox := range w.data.mailboxes {
+		set(w.data, &mbox.flags, mbox.flags.Add(flags...))
+	}
+
+	return nil
+}
+
+func (w writeOps) AddPermFlagsToAllMailboxes(_ context.Context, flags ...string) error {
+	for _, mbox := range w.data.mailboxes {
+		set(w.data, &mbox.permFlags, mbox.permFlags.Add(flags...))
+	}
+
+	return nil
+}
+
+func (w writeOps) CreateMessages(_ context.Context, reqs ...*db.CreateMessageReq) error {
+	for _, req := range reqs {
+		if err := w.createMessage(req); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w writeOps) createMessage(req *db.CreateMessageReq) error {
+	if _, ok := w.data.messages[req.InternalID]; ok {
+		return fmt.Errorf("%w: %v", errMessageExists, req.InternalID)
+	}
+
+	if _, ok := w.data.messageByRemoteID(req.Message.ID); ok {
+		return fmt.Errorf("%w: %v", errMessageExists, req.Message.ID)
+	}
+
+	msg := &message{
+		Message: db.Message{
+			ID:            req.InternalID,
+			RemoteID:      req.Message.ID,
+			Date:          req.Message.Date,
+			Size:          req.LiteralSize,
+			Body:          req.Body,
+			BodyStructure: req.Structure,
+			Envelope:      req.Envelope,
+		},
+		flags: imap.NewFlagSet(req.Message.Flags.ToSliceUnsorted()...),
+	}
+
+	if req.HeaderFields != nil {
+		fields := *req.HeaderFields
+		msg.headerFields = &fields
+	}
+
+	if req.LiteralHash != nil {
+		msg.literalHash = slices.Clone(req.LiteralHash)
+	}
+
+	w.data.addMessage(msg)
+
+	return nil
+}
+
+func (w writeOps) CreateMessageAndAddToMailbox(_ context.Context, mboxID imap.InternalMailboxID, req *db.CreateMessageReq) (imap.UID, imap.FlagSet, error) {
+	mbox, err := w.getMailbox(mboxID)
+	if err != nil {
+		return 0, imap.FlagSet{}, err
+	}
+
+	if err := w.createMessage(req); err != nil {
+		return 0, imap.FlagSet{}, err
+	}
+
+	if err := w.addMessageToMailbox(mbox, db.MessageIDPair{InternalID: req.InternalID, RemoteID: req.Message.ID}); err != nil {
+		return 0, imap.FlagSet{}, err
+	}
+
+	return mbox.lastUID, req.Message.Flags.Add(imap.FlagRecent), nil
+}
+
+func (w writeOps) MarkMessageAsDeleted(_ context.Context, id imap.InternalMessageID) error {
+	if msg, ok := w.data.messages[id]; ok {
+		set(w.data, &msg.Deleted, true)
+	}
+
+	return nil
+}
+
+func (w writeOps) MarkMessageAsDeletedAndAssignRandomRemoteID(_ context.Context, id imap.InternalMessageID) error {
+	if msg, ok := w.data.messages[id]; ok {
+		set(w.data, &msg.Deleted, true)
+		w.data.setMessageRemoteID(msg, imap.MessageID(fmt.Sprintf("DELETED-%v", imap.NewInternalMessageID())))
+	}
+
+	return nil
+}
+
+func (w writeOps) MarkMessageAsDeletedWithRemoteID(_ context.Context, id imap.MessageID) error {
+	if msg, ok := w.data.messageByRemoteID(id); ok {
+		set(w.data, &msg.Deleted, true)
+	}
+
+	return nil
+}
+
+func (w writeOps) DeleteMessages(_ context.Context, ids []imap.InternalMessageID) error {
+	for _, id := range ids {
+		msg, ok := w.data.messages[id]
+		if !ok {
+			continue
+		}
+
+		w.data.deleteMessage(msg)
+
+		for _, mbox := range w.data.mailboxes {
+			w.data.removeMailboxMessage(mbox, id)
+		}
+	}
+
+	return nil
+}
+
+func (w writeOps) UpdateRemoteMessageID(_ context.Context, internalID imap.InternalMessageID, remoteID imap.MessageID) error {
+	msg, ok := w.data.messages[internalID]
+	if !ok {
+		return errNoValueChanged
+	}
+
+	if other, ok := w.data.messageByRemoteID(remoteID); ok && other != msg {
+		return fmt.Errorf("%w: %v", errMessageExists, remoteID)
+	}
+
+	w.data.setMessageRemoteID(msg, remoteID)
+
+	return nil
+}
+
+func (w writeOps) AddFlagToMessages(_ context.Context, ids []imap.InternalMessageID, flag string) error {
+	for _, id := range ids {
+		if msg, ok := w.data.messages[id]; ok {
+			set(w.data, &msg.flags, msg.flags.Add(flag))
+		}
+	}
+
+	return nil
+}
+
+func (w writeOps) RemoveFlagFromMessages(_ context.Context, ids []imap.InternalMessageID, flag string) error {
+	for _, id := range ids {
+		if msg, ok := w.data.messages[id]; ok {
+			set(w.data, &msg.flags, msg.flags.Remove(flag))
+		}
+	}
+
+	return nil
+}
+
+func (w writeOps) SetFlagsOnMessages(_ context.Context, ids []imap.InternalMessageID, flags imap.FlagSet) error {
+	for _, id := range ids {
+		if msg, ok := w.data.messages[id]; ok {
+			set(w.data, &msg.flags, flags.Clone())
+		}
+	}
+
+	return nil
+}
+
+func (w writeOps) StoreMessageHeaderFields(_ context.Context, id imap.InternalMessageID, fields *db.MessageHeaderFields) error {
+	msg, err := w.getMessage(id)
+	if err != nil {
+		return err
+	}
+
+	stored := *fields
+	set(w.data, &msg.headerFields, &stored)
+
+	return nil
+}
+
+func (w writeOps) StoreMessageLiteralHash(_ context.Context, id imap.InternalMessageID, hash []byte) error {
+	msg, err := w.getMessage(id)
+	if err != nil {
+		return err
+	}
+
+	set(w.data, &msg.literalHash, slices.Clone(hash))
+
+	return nil
+}
+
+func (w writeOps) AddDeletedSubscription(_ context.Context, mboxName string, mboxID imap.MailboxID) error {
+	for name, remoteID := range w.data.deletedSubscriptions {
+		if remoteID == mboxID && name != mboxName {
+			deleteEntry(w.data, w.data.deletedSubscriptions, name)
+		}
+	}
+
+	setEntry(w.data, w.data.deletedSubscriptions, mboxName, mboxID)
+
+	return nil
+}
+
+func (w writeOps) RemoveDeletedSubscriptionWithName(_ context.Context, mboxName string) (int, error) {
+	if _, ok := w.data.deletedSubscriptions[mboxName]; !ok {
+		return 0, nil
+	}
+
+	deleteEntry(w.data, w.data.deletedSubscriptions, mboxName)
+
+	return 1, nil
+}
+
+func (w writeOps) StoreConnectorSettings(_ context.Context, settings string) error {
+	set(w.data, &w.data.connectorSettings, &settings)
+
+	return nil
+}
+
+func (w writeOps) StoreSieveScript(_ context.Context, script string) error {
+	set(w.data, &w.data.sieveScript, script)
+
+	return nil
+}
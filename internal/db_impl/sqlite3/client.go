@@ -26,6 +26,13 @@ type Client struct {
 	lock  sync.RWMutex
 	debug bool
 	trace bool
+
+	// file is the encrypted copy of the database on disk, or nil if the database is used from disk directly.
+	file *encryptedFile
+
+	// saveErr is set once a committed transaction couldn't be written to file. The in-memory database no longer
+	// matches the file then, so every further operation fails with it until the client is reopened.
+	saveErr error
 }
 
 func NewClient(dir string, userID string, debug, trace bool) (*Client, bool, error) {
@@ -83,6 +90,10 @@ func (c *Client) Read(ctx context.Context, op func(context.Context, db.ReadOnly)
 	c.lock.RLock()
 	defer c.lock.RUnlock()
 
+	if c.saveErr != nil {
+		return c.saveErr
+	}
+
 	rdID := uuid.NewString()
 
 	if c.debug {
@@ -149,6 +160,10 @@ func (c *Client) wrapTx(ctx context.Context, op func(context.Context, *sql.Tx, *
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
+	if c.saveErr != nil {
+		return c.saveErr
+	}
+
 	var entry *logrus.Entry
 
 	if c.debug {
@@ -208,19 +223,51 @@ func (c *Client) wrapTx(ctx context.Context, op func(context.Context, *sql.Tx, *
 		entry.Debugf("Transaction Committed")
 	}
 
+	if c.file != nil {
+		if err := c.save(ctx); err != nil {
+			c.saveErr = fmt.Errorf("%w: %v", db.ErrSaveFailed, err)
+
+			return c.saveErr
+		}
+	}
+
 	return nil
 }
 
+func (c *Client) SchemaVersion(ctx context.Context) (int, int, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	if c.saveErr != nil {
+		return 0, 0, c.saveErr
+	}
+
+	return getDatabaseVersion(ctx, &utils.DBWrapper{DB: c.db})
+}
+
+func (c *Client) Downgrade(ctx context.Context, version int) error {
+	return c.wrapTx(ctx, func(ctx context.Context, tx *sql.Tx, entry *logrus.Entry) error {
+		entry.Debugf("Downgrading database to version %v", version)
+
+		return RevertMigrations(ctx, &utils.TXWrapper{TX: tx}, version)
+	})
+}
+
 func (c *Client) Close() error {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
+	if c.file != nil {
+		return errors.Join(c.db.Close(), c.file.close())
+	}
+
 	return c.db.Close()
 }
 
 type Builder struct {
-	debug bool
-	trace bool
+	debug   bool
+	trace   bool
+	encrypt bool
 }
 
 type Option interface {
@@ -239,6 +286,12 @@ func (dbTraceOption) apply(builder *Builder) {
 	builder.trace = true
 }
 
+type dbEncryptOption struct{}
+
+func (dbEncryptOption) apply(builder *Builder) {
+	builder.encrypt = true
+}
+
 // Trace enables db interface call tracing. Name of the called functions will be written to trace log.
 func Trace() Option {
 	return &dbTraceOption{}
@@ -249,6 +302,14 @@ func Debug() Option {
 	return &dbDebugOption{}
 }
 
+// Encrypt encrypts databases with a key derived from the user's passphrase. Existing plaintext databases are encrypted
+// when they are next opened. Encrypted databases are kept in memory while open and written back after each write
+// transaction, which makes writes to large databases noticeably slower. If writing back fails, the client fails every
+// further operation with db.ErrSaveFailed and must be reopened.
+func Encrypt() Option {
+	return &dbEncryptOption{}
+}
+
 func NewBuilder(options ...Option) db.ClientInterface {
 	builder := &Builder{
 		debug: false,
@@ -263,9 +324,21 @@ func NewBuilder(options ...Option) db.ClientInterface {
 }
 
 func (b Builder) New(dir string, userID string) (db.Client, bool, error) {
+	if b.encrypt {
+		return nil, false, errPassphraseRequired
+	}
+
 	return NewClient(dir, userID, b.debug, b.trace)
 }
 
+func (b Builder) NewWithPassphrase(dir string, userID string, passphrase []byte) (db.Client, bool, error) {
+	if !b.encrypt {
+		return NewClient(dir, userID, b.debug, b.trace)
+	}
+
+	return NewEncryptedClient(dir, userID, passphrase, b.debug, b.trace)
+}
+
 func (Builder) Delete(dir string, userID string) error {
 	return db.DeleteDB(dir, userID)
 }
@@ -308,3 +381,22 @@ func TestUpdateDBVersion(ctx context.Context, dbPath, userID string, version int
 		return updateDBVersion(ctx, qw, version)
 	})
 }
+
+func TestUpdateDBMinCompatibleVersion(ctx context.Context, dbPath, userID string, version int) error {
+	client, _, err := NewClient(dbPath, userID, false, false)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := client.Close(); err != nil {
+			logrus.Panic("failed to close db")
+		}
+	}()
+
+	return client.wrapTx(ctx, func(ctx context.Context, tx *sql.Tx, entry *logrus.Entry) error {
+		qw := utils.TXWrapper{TX: tx}
+
+		return updateDBMinCompatibleVersion(ctx, qw, version)
+	})
+}
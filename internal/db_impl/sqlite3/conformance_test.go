@@ -0,0 +1,30 @@
+package sqlite3
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/gluon/db"
+	"github.com/ProtonMail/gluon/db/dbtest"
+)
+
+func TestConformance(t *testing.T) {
+	dbtest.TestClientInterface(t, NewBuilder())
+}
+
+func TestConformance_Encrypted(t *testing.T) {
+	dbtest.TestClientInterface(t, &passphraseBuilder{
+		PassphraseClientInterface: NewBuilder(Encrypt()).(db.PassphraseClientInterface),
+		passphrase:                []byte("passphrase"),
+	})
+}
+
+// passphraseBuilder opens every database with the same passphrase.
+type passphraseBuilder struct {
+	db.PassphraseClientInterface
+
+	passphrase []byte
+}
+
+func (b *passphraseBuilder) New(dir, userID string) (db.Client, bool, error) {
+	return b.NewWithPassphrase(dir, userID, b.passphrase)
+}
@@ -0,0 +1,506 @@
+package sqlite3
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/ProtonMail/gluon/internal/fsutil"
+	gosqlite3 "github.com/mattn/go-sqlite3"
+)
+
+var errPassphraseRequired = errors.New("encrypted databases can only be opened with the user's passphrase")
+
+// sqliteHeader starts every plaintext sqlite database file.
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// encryptedHeader starts every encrypted database file. It is followed by the nonce and the sealed database.
+var encryptedHeader = []byte("GLUON-DB-AES-GCM\x02")
+
+// journalHeader starts every journal file. It is followed by the nonce of the database file the journal applies to.
+var journalHeader = []byte("GLUON-DB-JOURNAL\x02")
+
+// databaseKeyLabel is the HKDF info the database key is derived with, so that it differs from the keys derived from
+// the same passphrase for the user's other files.
+const databaseKeyLabel = "gluon-db"
+
+// encryptedFile is the on-disk copy of a database which is only ever decrypted in memory.
+//
+// It is made of a snapshot of the whole database, sealed in one piece, and a journal of the pages changed since.
+// Each write transaction appends a record with the pages it changed to the journal, so that only those are encrypted
+// and synced. Once the journal grows larger than the database, a new snapshot is written and the journal restarted.
+// To find the changed pages, the contents last written are kept in memory, doubling the memory the database takes.
+type encryptedFile struct {
+	path string
+	gcm  cipher.AEAD
+
+	// snapshotID is the nonce the snapshot was sealed with, which records of the journal are bound to.
+	snapshotID []byte
+
+	// saved holds the database contents as they are on disk, snapshot and journal together.
+	saved []byte
+
+	// journal is the journal file, opened for appending, and records the number of records in it.
+	journal     *os.File
+	journalSize int
+	records     uint64
+}
+
+// NewEncryptedClient opens the database of the given user, encrypted with a key derived from passphrase.
+// The database is decrypted into memory and the pages changed by each write transaction are written back to disk.
+// A plaintext database found at the same path is encrypted in place.
+func NewEncryptedClient(dir string, userID string, passphrase []byte, debug, trace bool) (*Client, bool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, false, err
+	}
+
+	gcm, err := newDatabaseCipher(passphrase)
+	if err != nil {
+		return nil, false, err
+	}
+
+	file := &encryptedFile{path: getDatabasePath(dir, userID), gcm: gcm}
+
+	contents, plaintext, err := file.load(dir, userID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	client, err := sql.Open("sqlite3", "file::memory:?_fk=1")
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Every connection to an in-memory database has its own copy, so there must only ever be the one we fill.
+	client.SetMaxOpenConns(1)
+	client.SetMaxIdleConns(1)
+	client.SetConnMaxLifetime(0)
+	client.SetConnMaxIdleTime(0)
+
+	c := &Client{db: client, debug: debug, trace: trace, file: file}
+
+	if contents != nil {
+		if err := c.withConn(context.Background(), func(conn *gosqlite3.SQLiteConn) error {
+			return conn.Deserialize(contents, "main")
+		}); err != nil {
+			return nil, false, errors.Join(fmt.Errorf("failed to load database: %w", err), client.Close())
+		}
+
+		// Start from a fresh snapshot, folding in the journal and dropping any record torn by a crash.
+		if err := c.compact(context.Background()); err != nil {
+			return nil, false, errors.Join(fmt.Errorf("failed to save database: %w", err), client.Close())
+		}
+	}
+
+	if plaintext {
+		// The write-ahead log of the plaintext database was folded into the copy which was just encrypted.
+		for _, suffix := range []string{"-wal", "-shm"} {
+			if err := os.Remove(file.path + suffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return nil, false, errors.Join(err, c.Close())
+			}
+		}
+	}
+
+	return c, contents == nil, nil
+}
+
+// newDatabaseCipher returns the cipher databases are encrypted with, keyed with HKDF-SHA256 from the passphrase.
+func newDatabaseCipher(passphrase []byte) (cipher.AEAD, error) {
+	// The key is a single block of output, so the expansion is a single HMAC of the label.
+	prk := hmacSum(make([]byte, sha256.Size), passphrase)
+	key := hmacSum(prk, append([]byte(databaseKeyLabel), 1))
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func hmacSum(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+
+	return mac.Sum(nil)
+}
+
+func (f *encryptedFile) journalPath() string {
+	return f.path + ".journal"
+}
+
+// load returns the decrypted contents of the database with its journal applied, or nil if there is none yet.
+// It also reports whether the database was found in plaintext.
+func (f *encryptedFile) load(dir, userID string) ([]byte, bool, error) {
+	b, err := os.ReadFile(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	switch {
+	case bytes.HasPrefix(b, encryptedHeader):
+		b = b[len(encryptedHeader):]
+
+		nonceSize := f.gcm.NonceSize()
+		if len(b) < nonceSize {
+			return nil, false, fmt.Errorf("encrypted database is truncated")
+		}
+
+		contents, err := f.gcm.Open(nil, b[:nonceSize], b[nonceSize:], encryptedHeader)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to decrypt database: %w", err)
+		}
+
+		f.snapshotID = b[:nonceSize]
+
+		contents, err = f.replay(contents)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read database journal: %w", err)
+		}
+
+		return contents, false, nil
+
+	case bytes.HasPrefix(b, sqliteHeader):
+		contents, err := readPlaintextDatabase(dir, userID)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read plaintext database: %w", err)
+		}
+
+		return contents, true, nil
+
+	default:
+		return nil, false, fmt.Errorf("unrecognized database file %v", f.path)
+	}
+}
+
+// replay applies the records of the journal to the given snapshot contents.
+// A journal written for another snapshot is ignored: it was left behind by a crash while the snapshot was replaced,
+// and the snapshot already holds its pages. Reading stops at the first record which is truncated or doesn't
+// authenticate, which a crash can leave behind while a record is appended; its transaction was never reported saved.
+func (f *encryptedFile) replay(contents []byte) ([]byte, error) {
+	b, err := os.ReadFile(f.journalPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return contents, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(b, journalHeader) || !bytes.Equal(b[len(journalHeader):min(len(b), len(journalHeader)+len(f.snapshotID))], f.snapshotID) {
+		return contents, nil
+	}
+
+	b = b[len(journalHeader)+len(f.snapshotID):]
+
+	for index := uint64(0); len(b) >= 4; index++ {
+		size := int(binary.BigEndian.Uint32(b))
+		if len(b) < 4+size || size < f.gcm.NonceSize() {
+			break
+		}
+
+		record := b[4 : 4+size]
+
+		page, err := f.gcm.Open(nil, record[:f.gcm.NonceSize()], record[f.gcm.NonceSize():], f.recordData(index))
+		if err != nil {
+			break
+		}
+
+		if contents, err = applyRecord(contents, page); err != nil {
+			return nil, err
+		}
+
+		b = b[4+size:]
+	}
+
+	return contents, nil
+}
+
+// recordData returns the additional data the index-th record of the journal is sealed with,
+// binding it to its place in the journal of the current snapshot.
+func (f *encryptedFile) recordData(index uint64) []byte {
+	data := append(bytes.Clone(journalHeader), f.snapshotID...)
+
+	return binary.BigEndian.AppendUint64(data, index)
+}
+
+// save writes the given database contents to disk: the pages which changed since the last save are appended to the
+// journal, or a new snapshot is written if there is no usable journal or it grew larger than the database.
+func (f *encryptedFile) save(contents []byte) error {
+	pageSize := getPageSize(contents)
+
+	if f.journal == nil || pageSize == 0 || pageSize != getPageSize(f.saved) || f.journalSize > len(contents) {
+		return f.compact(contents)
+	}
+
+	record := binary.BigEndian.AppendUint64(nil, uint64(len(contents)))
+	record = binary.BigEndian.AppendUint32(record, uint32(pageSize))
+
+	changed := false
+
+	for offset := 0; offset < len(contents); offset += pageSize {
+		page := contents[offset:min(offset+pageSize, len(contents))]
+
+		if offset+len(page) <= len(f.saved) && bytes.Equal(page, f.saved[offset:offset+len(page)]) {
+			continue
+		}
+
+		record = binary.BigEndian.AppendUint32(record, uint32(offset/pageSize))
+		record = append(record, page...)
+		changed = true
+	}
+
+	if !changed && len(contents) == len(f.saved) {
+		return nil
+	}
+
+	nonce := make([]byte, f.gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	sealed := f.gcm.Seal(nonce, nonce, record, f.recordData(f.records))
+
+	if _, err := f.journal.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(sealed))), sealed...)); err != nil {
+		return err
+	}
+
+	if err := f.journal.Sync(); err != nil {
+		return err
+	}
+
+	f.saved = contents
+	f.journalSize += 4 + len(sealed)
+	f.records++
+
+	return nil
+}
+
+// compact writes the given database contents as a new snapshot and starts a new, empty journal for it.
+func (f *encryptedFile) compact(contents []byte) error {
+	nonce := make([]byte, f.gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	sealed := f.gcm.Seal(append(bytes.Clone(encryptedHeader), nonce...), nonce, contents, encryptedHeader)
+
+	// The snapshot is replaced atomically and synced, so a crash never leaves a truncated or stale database behind.
+	// The old journal is ignored from then on, as it is bound to the old snapshot.
+	if err := fsutil.WriteFile(f.path, sealed, 0o600); err != nil {
+		return err
+	}
+
+	header := append(bytes.Clone(journalHeader), nonce...)
+
+	if err := fsutil.WriteFile(f.journalPath(), header, 0o600); err != nil {
+		return err
+	}
+
+	journal, err := os.OpenFile(f.journalPath(), os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if err := f.close(); err != nil {
+		return errors.Join(err, journal.Close())
+	}
+
+	f.snapshotID = nonce
+	f.saved = contents
+	f.journal = journal
+	f.journalSize = len(header)
+	f.records = 0
+
+	return nil
+}
+
+func (f *encryptedFile) close() error {
+	if f.journal == nil {
+		return nil
+	}
+
+	err := f.journal.Close()
+	f.journal = nil
+
+	return err
+}
+
+// applyRecord writes the pages of a journal record to the given database contents.
+func applyRecord(contents, record []byte) ([]byte, error) {
+	if len(record) < 12 {
+		return nil, fmt.Errorf("journal record is truncated")
+	}
+
+	size := int(binary.BigEndian.Uint64(record))
+	pageSize := int(binary.BigEndian.Uint32(record[8:]))
+	record = record[12:]
+
+	if pageSize == 0 {
+		return nil, fmt.Errorf("journal record has no page size")
+	}
+
+	if size <= len(contents) {
+		contents = contents[:size]
+	} else {
+		contents = append(contents, make([]byte, size-len(contents))...)
+	}
+
+	for len(record) > 0 {
+		if len(record) < 4 {
+			return nil, fmt.Errorf("journal record is truncated")
+		}
+
+		offset := int(binary.BigEndian.Uint32(record)) * pageSize
+		record = record[4:]
+
+		if offset >= size {
+			return nil, fmt.Errorf("journal record has a page past the end of the database")
+		}
+
+		n := min(pageSize, size-offset)
+		if len(record) < n {
+			return nil, fmt.Errorf("journal record is truncated")
+		}
+
+		copy(contents[offset:], record[:n])
+		record = record[n:]
+	}
+
+	return contents, nil
+}
+
+// getPageSize returns the page size of the given database contents, or 0 if they hold no database.
+func getPageSize(contents []byte) int {
+	if len(contents) < 100 {
+		return 0
+	}
+
+	// The value 1 stands for the largest page size, which doesn't fit in the two bytes.
+	if size := int(binary.BigEndian.Uint16(contents[16:])); size != 1 {
+		return size
+	}
+
+	return 65536
+}
+
+// readPlaintextDatabase returns the contents of a plaintext database, including what is still in its write-ahead log.
+func readPlaintextDatabase(dir, userID string) ([]byte, error) {
+	client, err := sql.Open("sqlite3", getDatabaseConn(dir, userID, getDatabasePath(dir, userID)))
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{db: client}
+
+	var contents []byte
+
+	if err := c.withConn(context.Background(), func(conn *gosqlite3.SQLiteConn) error {
+		b, err := conn.Serialize("main")
+		contents = b
+
+		return err
+	}); err != nil {
+		return nil, errors.Join(err, client.Close())
+	}
+
+	// The header still marks the database as using a write-ahead log, which an in-memory database can't have.
+	if len(contents) > 19 {
+		contents[18], contents[19] = 1, 1
+	}
+
+	return contents, client.Close()
+}
+
+// Rekey encrypts the database with a key derived from passphrase from now on.
+func (c *Client) Rekey(ctx context.Context, passphrase []byte) error {
+	if c.file == nil {
+		return nil
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.saveErr != nil {
+		return c.saveErr
+	}
+
+	gcm, err := newDatabaseCipher(passphrase)
+	if err != nil {
+		return err
+	}
+
+	oldGCM := c.file.gcm
+	c.file.gcm = gcm
+
+	// The journal is sealed with the old key, so the database is written as a new snapshot.
+	if err := c.compact(ctx); err != nil {
+		c.file.gcm = oldGCM
+		return err
+	}
+
+	return nil
+}
+
+// save writes the changes to the in-memory database of an encrypted client back to disk.
+func (c *Client) save(ctx context.Context) error {
+	contents, err := c.serialize(ctx)
+	if err != nil {
+		return err
+	}
+
+	return c.file.save(contents)
+}
+
+// compact writes the in-memory database of an encrypted client back to disk as a new snapshot.
+func (c *Client) compact(ctx context.Context) error {
+	contents, err := c.serialize(ctx)
+	if err != nil {
+		return err
+	}
+
+	return c.file.compact(contents)
+}
+
+func (c *Client) serialize(ctx context.Context) ([]byte, error) {
+	var contents []byte
+
+	if err := c.withConn(ctx, func(conn *gosqlite3.SQLiteConn) error {
+		b, err := conn.Serialize("main")
+		contents = b
+
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	return contents, nil
+}
+
+func (c *Client) withConn(ctx context.Context, fn func(*gosqlite3.SQLiteConn) error) error {
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		sqliteConn, ok := driverConn.(*gosqlite3.SQLiteConn)
+		if !ok {
+			return fmt.Errorf("unexpected sqlite connection type %T", driverConn)
+		}
+
+		return fn(sqliteConn)
+	})
+}
@@ -0,0 +1,203 @@
+package sqlite3
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/ProtonMail/gluon/db"
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptedClient(t *testing.T) {
+	dir, ctx := t.TempDir(), context.Background()
+
+	client, isNew, err := NewEncryptedClient(dir, "foo", []byte("pass"), false, false)
+	require.NoError(t, err)
+	require.True(t, isNew)
+	require.NoError(t, client.Init(ctx, imap.DefaultEpochUIDValidityGenerator()))
+	createSecretMailbox(ctx, t, client)
+	require.NoError(t, client.Close())
+
+	b, err := os.ReadFile(getDatabasePath(dir, "foo"))
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(b, encryptedHeader))
+	require.False(t, bytes.Contains(b, []byte("Secret")))
+
+	b, err = os.ReadFile(getDatabasePath(dir, "foo") + ".journal")
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(b, journalHeader))
+	require.False(t, bytes.Contains(b, []byte("Secret")))
+
+	_, _, err = NewEncryptedClient(dir, "foo", []byte("wrong"), false, false)
+	require.Error(t, err)
+
+	client, isNew, err = NewEncryptedClient(dir, "foo", []byte("pass"), false, false)
+	require.NoError(t, err)
+	require.False(t, isNew)
+	require.NoError(t, client.Init(ctx, imap.DefaultEpochUIDValidityGenerator()))
+	requireSecretMailbox(ctx, t, client)
+	require.NoError(t, client.Close())
+}
+
+func TestEncryptedClient_EncryptsPlaintextDatabase(t *testing.T) {
+	dir, ctx := t.TempDir(), context.Background()
+
+	client, _, err := NewClient(dir, "foo", false, false)
+	require.NoError(t, err)
+	require.NoError(t, client.Init(ctx, imap.DefaultEpochUIDValidityGenerator()))
+	createSecretMailbox(ctx, t, client)
+	require.NoError(t, client.Close())
+
+	client, isNew, err := NewEncryptedClient(dir, "foo", []byte("pass"), false, false)
+	require.NoError(t, err)
+	require.False(t, isNew)
+	require.NoError(t, client.Init(ctx, imap.DefaultEpochUIDValidityGenerator()))
+	requireSecretMailbox(ctx, t, client)
+	require.NoError(t, client.Close())
+
+	b, err := os.ReadFile(getDatabasePath(dir, "foo"))
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(b, encryptedHeader))
+	require.NoFileExists(t, getDatabasePath(dir, "foo")+"-wal")
+	require.NoFileExists(t, getDatabasePath(dir, "foo")+"-shm")
+}
+
+func TestEncryptedClient_Rekey(t *testing.T) {
+	dir, ctx := t.TempDir(), context.Background()
+
+	client, _, err := NewEncryptedClient(dir, "foo", []byte("old"), false, false)
+	require.NoError(t, err)
+	require.NoError(t, client.Init(ctx, imap.DefaultEpochUIDValidityGenerator()))
+	createSecretMailbox(ctx, t, client)
+	require.NoError(t, client.Rekey(ctx, []byte("new")))
+	require.NoError(t, client.Close())
+
+	_, _, err = NewEncryptedClient(dir, "foo", []byte("old"), false, false)
+	require.Error(t, err)
+
+	client, _, err = NewEncryptedClient(dir, "foo", []byte("new"), false, false)
+	require.NoError(t, err)
+	require.NoError(t, client.Init(ctx, imap.DefaultEpochUIDValidityGenerator()))
+	requireSecretMailbox(ctx, t, client)
+	require.NoError(t, client.Close())
+}
+
+func TestEncryptedClient_SaveFailure(t *testing.T) {
+	dir, ctx := t.TempDir(), context.Background()
+
+	client, _, err := NewEncryptedClient(dir, "foo", []byte("pass"), false, false)
+	require.NoError(t, err)
+	require.NoError(t, client.Init(ctx, imap.DefaultEpochUIDValidityGenerator()))
+
+	// The journal can't be appended to through a file opened for reading.
+	require.NoError(t, client.file.journal.Close())
+	journal, err := os.Open(client.file.journalPath())
+	require.NoError(t, err)
+	client.file.journal = journal
+
+	require.ErrorIs(t, client.Write(ctx, func(ctx context.Context, tx db.Transaction) error {
+		_, err := tx.CreateMailbox(ctx, "secret-id", "Secret", imap.NewFlagSet(), imap.NewFlagSet(), imap.NewFlagSet(), 0, 1)
+		return err
+	}), db.ErrSaveFailed)
+
+	// The committed mailbox only exists in memory, so the client must not be used anymore.
+	require.ErrorIs(t, client.Read(ctx, func(ctx context.Context, rd db.ReadOnly) error {
+		return nil
+	}), db.ErrSaveFailed)
+
+	require.ErrorIs(t, client.Write(ctx, func(ctx context.Context, tx db.Transaction) error {
+		return nil
+	}), db.ErrSaveFailed)
+
+	require.NoError(t, client.Close())
+}
+
+func TestEncryptedClient_Journal(t *testing.T) {
+	dir, ctx := t.TempDir(), context.Background()
+
+	client, _, err := NewEncryptedClient(dir, "foo", []byte("pass"), false, false)
+	require.NoError(t, err)
+	require.NoError(t, client.Init(ctx, imap.DefaultEpochUIDValidityGenerator()))
+
+	snapshot, err := os.ReadFile(getDatabasePath(dir, "foo"))
+	require.NoError(t, err)
+
+	createSecretMailbox(ctx, t, client)
+
+	// The transaction only appended its pages to the journal.
+	b, err := os.ReadFile(getDatabasePath(dir, "foo"))
+	require.NoError(t, err)
+	require.Equal(t, snapshot, b)
+	require.Equal(t, uint64(1), client.file.records)
+
+	require.NoError(t, client.Close())
+
+	// A record torn by a crash is dropped.
+	journal, err := os.OpenFile(getDatabasePath(dir, "foo")+".journal", os.O_WRONLY|os.O_APPEND, 0o600)
+	require.NoError(t, err)
+	_, err = journal.Write([]byte{0, 0, 1, 0, 42})
+	require.NoError(t, err)
+	require.NoError(t, journal.Close())
+
+	client, _, err = NewEncryptedClient(dir, "foo", []byte("pass"), false, false)
+	require.NoError(t, err)
+	require.NoError(t, client.Init(ctx, imap.DefaultEpochUIDValidityGenerator()))
+	requireSecretMailbox(ctx, t, client)
+	require.NoError(t, client.Close())
+}
+
+func TestEncryptedClient_StaleJournal(t *testing.T) {
+	dir, ctx := t.TempDir(), context.Background()
+
+	client, _, err := NewEncryptedClient(dir, "foo", []byte("pass"), false, false)
+	require.NoError(t, err)
+	require.NoError(t, client.Init(ctx, imap.DefaultEpochUIDValidityGenerator()))
+	require.NoError(t, client.Close())
+
+	stale, err := os.ReadFile(getDatabasePath(dir, "foo") + ".journal")
+	require.NoError(t, err)
+
+	client, _, err = NewEncryptedClient(dir, "foo", []byte("pass"), false, false)
+	require.NoError(t, err)
+	require.NoError(t, client.Init(ctx, imap.DefaultEpochUIDValidityGenerator()))
+	createSecretMailbox(ctx, t, client)
+	require.NoError(t, client.Rekey(ctx, []byte("pass")))
+	require.NoError(t, client.Close())
+
+	// A crash after a new snapshot was written leaves the journal of the previous one behind, which is ignored.
+	require.NoError(t, os.WriteFile(getDatabasePath(dir, "foo")+".journal", stale, 0o600))
+
+	client, _, err = NewEncryptedClient(dir, "foo", []byte("pass"), false, false)
+	require.NoError(t, err)
+	require.NoError(t, client.Init(ctx, imap.DefaultEpochUIDValidityGenerator()))
+	requireSecretMailbox(ctx, t, client)
+	require.NoError(t, client.Close())
+}
+
+func TestBuilder_EncryptRequiresPassphrase(t *testing.T) {
+	_, _, err := NewBuilder(Encrypt()).New(t.TempDir(), "foo")
+	require.ErrorIs(t, err, errPassphraseRequired)
+}
+
+func createSecretMailbox(ctx context.Context, t *testing.T, client *Client) {
+	require.NoError(t, client.Write(ctx, func(ctx context.Context, tx db.Transaction) error {
+		_, err := tx.CreateMailbox(ctx, "secret-id", "Secret", imap.NewFlagSet(), imap.NewFlagSet(), imap.NewFlagSet(), 0, 1)
+		return err
+	}))
+}
+
+func requireSecretMailbox(ctx context.Context, t *testing.T, client *Client) {
+	require.NoError(t, client.Read(ctx, func(ctx context.Context, rd db.ReadOnly) error {
+		mbox, err := rd.GetMailboxByName(ctx, "Secret")
+		if err != nil {
+			return err
+		}
+
+		require.Equal(t, imap.MailboxID("secret-id"), mbox.RemoteID)
+
+		return nil
+	}))
+}
@@ -13,6 +13,8 @@ import (
 	"github.com/ProtonMail/gluon/imap"
 	"github.com/ProtonMail/gluon/internal/db_impl/sqlite3/utils"
 	v0 "github.com/ProtonMail/gluon/internal/db_impl/sqlite3/v0"
+	v2 "github.com/ProtonMail/gluon/internal/db_impl/sqlite3/v2"
+	v4 "github.com/ProtonMail/gluon/internal/db_impl/sqlite3/v4"
 	"github.com/bradenaw/juniper/xslices"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
@@ -36,7 +38,12 @@ func TestMigration_VersionTooHigh(t *testing.T) {
 		// For version to very high value
 		require.NoError(t, client.wrapTx(ctx, func(ctx context.Context, tx *sql.Tx, entry *logrus.Entry) error {
 			qw := utils.TXWrapper{TX: tx}
-			return updateDBVersion(ctx, qw, 999999)
+
+			if err := updateDBVersion(ctx, qw, 999999); err != nil {
+				return err
+			}
+
+			return updateDBMinCompatibleVersion(ctx, qw, 999998)
 		}))
 	}
 
@@ -52,6 +59,127 @@ func TestMigration_VersionTooHigh(t *testing.T) {
 	err = client.Init(context.Background(), imap.DefaultEpochUIDValidityGenerator())
 	require.Error(t, err)
 	require.True(t, errors.Is(err, db.ErrInvalidDatabaseVersion))
+
+	var futureErr *db.FutureVersionError
+
+	require.ErrorAs(t, err, &futureErr)
+	require.Equal(t, db.FutureVersionError{Version: 999999, MinCompatibleVersion: 999998, SupportedVersion: latestVersion}, *futureErr)
+}
+
+func TestMigration_MinCompatibleVersion(t *testing.T) {
+	// Versions before the mailbox permissions column scan mailboxes by position and can't read the table anymore.
+	require.Equal(t, 5, getMinCompatibleVersion(5))
+	require.Equal(t, 5, getMinCompatibleVersion(7))
+
+	// The header column of the message headers table is gone.
+	require.Equal(t, 8, getMinCompatibleVersion(8))
+
+	// The literal hashes table is ignored by versions which don't know about it.
+	require.Equal(t, 8, getMinCompatibleVersion(9))
+}
+
+func TestMigration_CompatibleFutureVersion(t *testing.T) {
+	testDir := t.TempDir()
+	ctx := context.Background()
+
+	client, _, err := NewClient(testDir, "foo", false, false)
+	require.NoError(t, err)
+	require.NoError(t, client.Init(ctx, &imap.IncrementalUIDValidityGenerator{}))
+
+	version, minCompatibleVersion, err := client.SchemaVersion(ctx)
+	require.NoError(t, err)
+	require.Equal(t, latestVersion, version)
+	require.Equal(t, getMinCompatibleVersion(latestVersion), minCompatibleVersion)
+	require.LessOrEqual(t, minCompatibleVersion, latestVersion)
+
+	// A newer version which only added, e.g., a table records a min compatible version we support.
+	require.NoError(t, client.wrapTx(ctx, func(ctx context.Context, tx *sql.Tx, entry *logrus.Entry) error {
+		return utils.ExecQueryAndCheckUpdatedNotZero(ctx, utils.TXWrapper{TX: tx}, "UPDATE gluon_version SET `version` = ? WHERE `id` = 0", latestVersion+1)
+	}))
+	require.NoError(t, client.Close())
+
+	client, _, err = NewClient(testDir, "foo", false, false)
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, client.Close())
+	}()
+
+	require.NoError(t, client.Init(ctx, &imap.IncrementalUIDValidityGenerator{}))
+
+	version, _, err = client.SchemaVersion(ctx)
+	require.NoError(t, err)
+	require.Equal(t, latestVersion+1, version)
+
+	require.NoError(t, client.Write(ctx, func(ctx context.Context, tx db.Transaction) error {
+		return tx.StoreSieveScript(ctx, "keep;")
+	}))
+}
+
+func TestMigration_Downgrade(t *testing.T) {
+	testDir := t.TempDir()
+	ctx := context.Background()
+
+	client, _, err := NewClient(testDir, "foo", false, false)
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, client.Close())
+	}()
+
+	require.NoError(t, client.Init(ctx, &imap.IncrementalUIDValidityGenerator{}))
+
+	require.NoError(t, client.Write(ctx, func(ctx context.Context, tx db.Transaction) error {
+		_, err := tx.CreateMailbox(ctx, "mbox-1", "Folder", imap.NewFlagSet(), imap.NewFlagSet(), imap.NewFlagSet(), imap.PermAll, 1)
+		return err
+	}))
+
+	// Reverting v3 isn't possible, so nothing is reverted.
+	require.ErrorIs(t, client.Downgrade(ctx, 2), db.ErrMigrationNotReversible)
+
+	version, _, err := client.SchemaVersion(ctx)
+	require.NoError(t, err)
+	require.Equal(t, latestVersion, version)
+
+	require.NoError(t, client.Downgrade(ctx, 3))
+
+	version, minCompatibleVersion, err := client.SchemaVersion(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 3, version)
+	require.Zero(t, minCompatibleVersion)
+
+	require.False(t, tableExists(ctx, t, client, v4.SieveScriptTableName))
+	require.True(t, tableExists(ctx, t, client, v2.ConnectorSettingsTableName))
+
+	// Upgrading again keeps the data which survived the downgrade.
+	require.NoError(t, client.Init(ctx, &imap.IncrementalUIDValidityGenerator{}))
+
+	version, _, err = client.SchemaVersion(ctx)
+	require.NoError(t, err)
+	require.Equal(t, latestVersion, version)
+
+	require.NoError(t, client.Read(ctx, func(ctx context.Context, rd db.ReadOnly) error {
+		mbox, err := rd.GetMailboxByRemoteID(ctx, "mbox-1")
+		require.NoError(t, err)
+		require.Equal(t, "Folder", mbox.Name)
+
+		return nil
+	}))
+}
+
+func tableExists(ctx context.Context, t *testing.T, client *Client, name string) bool {
+	var count int
+
+	require.NoError(t, client.wrapTx(ctx, func(ctx context.Context, tx *sql.Tx, entry *logrus.Entry) error {
+		query := "SELECT COUNT(*) FROM sqlite_master WHERE `type` = 'table' AND `name` = ?"
+
+		c, err := utils.MapQueryRow[int](ctx, utils.TXWrapper{TX: tx}, query, name)
+		count = c
+
+		return err
+	}))
+
+	return count > 0
 }
 
 func TestRunMigrations(t *testing.T) {
@@ -119,6 +247,95 @@ func TestMigration_ConnectorSettingsEmtpyOnFirstUse(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestMigration_SieveScriptEmptyOnFirstUse(t *testing.T) {
+	testDir := t.TempDir()
+
+	client, _, err := NewClient(testDir, "foo", false, false)
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, client.Close())
+	}()
+
+	err = client.Init(context.Background(), imap.DefaultEpochUIDValidityGenerator())
+	require.NoError(t, err)
+
+	err = client.Write(context.Background(), func(ctx context.Context, tx db.Transaction) error {
+		{
+			script, err := tx.GetSieveScript(ctx)
+			require.NoError(t, err)
+			require.Empty(t, script)
+		}
+
+		newScript := `require "fileinto"; fileinto "Archive";`
+		require.NoError(t, tx.StoreSieveScript(ctx, newScript))
+
+		{
+			script, err := tx.GetSieveScript(ctx)
+			require.NoError(t, err)
+			require.Equal(t, newScript, script)
+		}
+
+		return nil
+	})
+
+	require.NoError(t, err)
+}
+
+func TestMigration_MessageHeaderFields(t *testing.T) {
+	testDir := t.TempDir()
+
+	client, _, err := NewClient(testDir, "foo", false, false)
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, client.Close())
+	}()
+
+	require.NoError(t, client.Init(context.Background(), imap.DefaultEpochUIDValidityGenerator()))
+
+	withFields, withoutFields := imap.NewInternalMessageID(), imap.NewInternalMessageID()
+
+	literal := []byte("From: a@pm.me\r\nSubject: Hello\r\nDate: Tue, 18 Feb 2003 00:29:37 +0200\r\n\r\nbody")
+
+	err = client.Write(context.Background(), func(ctx context.Context, tx db.Transaction) error {
+		require.NoError(t, tx.CreateMessages(ctx,
+			&db.CreateMessageReq{
+				Message:      imap.Message{ID: "with"},
+				InternalID:   withFields,
+				HeaderFields: db.NewMessageHeaderFields(literal),
+			},
+			&db.CreateMessageReq{
+				Message:    imap.Message{ID: "without"},
+				InternalID: withoutFields,
+			},
+		))
+
+		fields, err := tx.GetMessageHeaderFields(ctx, withFields)
+		require.NoError(t, err)
+		require.Equal(t, "a@pm.me", fields.From)
+		require.Equal(t, "hello", fields.Subject)
+		require.Equal(t, time.Date(2003, 2, 18, 0, 0, 0, 0, time.UTC), fields.SentDate)
+
+		_, err = tx.GetMessageHeaderFields(ctx, withoutFields)
+		require.True(t, db.IsErrNotFound(err))
+
+		missing, err := tx.GetMessageIDsWithoutHeaderFields(ctx)
+		require.NoError(t, err)
+		require.Equal(t, []imap.InternalMessageID{withoutFields}, missing)
+
+		// The header fields are deleted with their message.
+		require.NoError(t, tx.DeleteMessages(ctx, []imap.InternalMessageID{withFields}))
+
+		_, err = tx.GetMessageHeaderFields(ctx, withFields)
+		require.True(t, db.IsErrNotFound(err))
+
+		return nil
+	})
+
+	require.NoError(t, err)
+}
+
 func runAndValidateDB(t *testing.T, testDir, user string, testData *testData, uidGenerator imap.UIDValidityGenerator) {
 	// create client and run all migrations.
 	client, _, err := NewClient(testDir, "foo", false, false)
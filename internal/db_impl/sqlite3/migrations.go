@@ -12,6 +12,12 @@ import (
 	v1 "github.com/ProtonMail/gluon/internal/db_impl/sqlite3/v1"
 	v2 "github.com/ProtonMail/gluon/internal/db_impl/sqlite3/v2"
 	v3 "github.com/ProtonMail/gluon/internal/db_impl/sqlite3/v3"
+	v4 "github.com/ProtonMail/gluon/internal/db_impl/sqlite3/v4"
+	v5 "github.com/ProtonMail/gluon/internal/db_impl/sqlite3/v5"
+	v6 "github.com/ProtonMail/gluon/internal/db_impl/sqlite3/v6"
+	v7 "github.com/ProtonMail/gluon/internal/db_impl/sqlite3/v7"
+	v8 "github.com/ProtonMail/gluon/internal/db_impl/sqlite3/v8"
+	v9 "github.com/ProtonMail/gluon/internal/db_impl/sqlite3/v9"
 	"github.com/sirupsen/logrus"
 )
 
@@ -19,15 +25,39 @@ type Migration interface {
 	Run(ctx context.Context, tx utils.QueryWrapper, generator imap.UIDValidityGenerator) error
 }
 
+// ReversibleMigration is a Migration which can be undone, so that the database can be handed back to an older version.
+type ReversibleMigration interface {
+	Migration
+
+	Down(ctx context.Context, tx utils.QueryWrapper) error
+}
+
+// CompatibleMigration is a Migration after which versions that don't know about it can still use the database,
+// e.g. because it only adds tables or columns with defaults.
+type CompatibleMigration interface {
+	Migration
+
+	BackwardCompatible() bool
+}
+
 var migrationList = []Migration{
 	&v0.Migration{},
 	&v1.Migration{},
 	&v2.Migration{},
 	&v3.Migration{},
+	&v4.Migration{},
+	&v5.Migration{},
+	&v6.Migration{},
+	&v7.Migration{},
+	&v8.Migration{},
+	&v9.Migration{},
 }
 
+// latestVersion is the schema version of a database on which all migrations have run.
+var latestVersion = len(migrationList) - 1
+
 func RunMigrations(ctx context.Context, tx utils.QueryWrapper, generator imap.UIDValidityGenerator) error {
-	dbVersion, err := getDatabaseVersion(ctx, tx)
+	dbVersion, minCompatibleVersion, err := getDatabaseVersion(ctx, tx)
 	if err != nil {
 		return fmt.Errorf("failed to get db version: %w", err)
 	}
@@ -43,7 +73,7 @@ func RunMigrations(ctx context.Context, tx utils.QueryWrapper, generator imap.UI
 			}
 		}
 
-		if err := updateDBVersion(ctx, tx, len(migrationList)-1); err != nil {
+		if err := updateDBVersion(ctx, tx, latestVersion); err != nil {
 			return fmt.Errorf("%w: failed to update db version: %v", db.ErrMigrationFailed, err)
 		}
 
@@ -54,23 +84,27 @@ func RunMigrations(ctx context.Context, tx utils.QueryWrapper, generator imap.UI
 
 	logrus.Debugf("DB Version is %v", dbVersion)
 
-	dbVersion = dbVersion + 1
+	if dbVersion > latestVersion {
+		if minCompatibleVersion > latestVersion {
+			return &db.FutureVersionError{
+				Version:              dbVersion,
+				MinCompatibleVersion: minCompatibleVersion,
+				SupportedVersion:     latestVersion,
+			}
+		}
+
+		// The version is left as is so that the newer version doesn't run its migrations again.
+		logrus.Debugf("DB Version is newer than %v but compatible with it", latestVersion)
 
-	if dbVersion == len(migrationList) {
-		logrus.Debugf("No migrations to run")
 		return nil
 	}
 
-	if dbVersion > len(migrationList) {
-		return fmt.Errorf(
-			"%w: database version is %v, but we only support up to %v",
-			db.ErrInvalidDatabaseVersion,
-			dbVersion,
-			len(migrationList),
-		)
+	if dbVersion == latestVersion {
+		logrus.Debugf("No migrations to run")
+		return nil
 	}
 
-	for i := dbVersion; i < len(migrationList); i++ {
+	for i := dbVersion + 1; i <= latestVersion; i++ {
 		logrus.Debugf("Running migration for version %v", i)
 
 		if err := migrationList[i].Run(ctx, tx, generator); err != nil {
@@ -78,7 +112,7 @@ func RunMigrations(ctx context.Context, tx utils.QueryWrapper, generator imap.UI
 		}
 	}
 
-	if err := updateDBVersion(ctx, tx, len(migrationList)-1); err != nil {
+	if err := updateDBVersion(ctx, tx, latestVersion); err != nil {
 		return fmt.Errorf("%w: failed to update db version: %v", db.ErrMigrationFailed, err)
 	}
 
@@ -87,26 +121,145 @@ func RunMigrations(ctx context.Context, tx utils.QueryWrapper, generator imap.UI
 	return nil
 }
 
-// getDatabaseVersion returns -1 if the version table does not exist or the  version information contained within.
-func getDatabaseVersion(ctx context.Context, tx utils.QueryWrapper) (int, error) {
+// RevertMigrations runs the Down step of every migration newer than version, newest first.
+// Nothing is reverted unless all of them are reversible.
+func RevertMigrations(ctx context.Context, tx utils.QueryWrapper, version int) error {
+	dbVersion, minCompatibleVersion, err := getDatabaseVersion(ctx, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get db version: %w", err)
+	}
+
+	if dbVersion < 0 {
+		return fmt.Errorf("%w: database has no version", db.ErrInvalidDatabaseVersion)
+	}
+
+	if dbVersion > latestVersion {
+		return &db.FutureVersionError{
+			Version:              dbVersion,
+			MinCompatibleVersion: minCompatibleVersion,
+			SupportedVersion:     latestVersion,
+		}
+	}
+
+	if version < 0 || version > dbVersion {
+		return fmt.Errorf("%w: can't downgrade from version %v to %v", db.ErrInvalidDatabaseVersion, dbVersion, version)
+	}
+
+	reversible := make([]ReversibleMigration, 0, dbVersion-version)
+
+	for i := dbVersion; i > version; i-- {
+		m, ok := migrationList[i].(ReversibleMigration)
+		if !ok {
+			return fmt.Errorf("%w: version %v", db.ErrMigrationNotReversible, i)
+		}
+
+		reversible = append(reversible, m)
+	}
+
+	for idx, m := range reversible {
+		logrus.Debugf("Reverting migration for version %v", dbVersion-idx)
+
+		if err := m.Down(ctx, tx); err != nil {
+			return fmt.Errorf("%w %v: failed to revert: %v", db.ErrMigrationFailed, dbVersion-idx, err)
+		}
+	}
+
+	if err := updateDBVersion(ctx, tx, version); err != nil {
+		return fmt.Errorf("%w: failed to update db version: %v", db.ErrMigrationFailed, err)
+	}
+
+	return nil
+}
+
+// getMinCompatibleVersion returns the oldest version able to use a database at the given version: the most recent
+// migration up to it which older versions can't cope with.
+func getMinCompatibleVersion(version int) int {
+	if version > latestVersion {
+		version = latestVersion
+	}
+
+	for i := version; i > 0; i-- {
+		if m, ok := migrationList[i].(CompatibleMigration); !ok || !m.BackwardCompatible() {
+			return i
+		}
+	}
+
+	return 0
+}
+
+// getDatabaseVersion returns -1 if the version table does not exist or the version information contained within.
+// The min compatible version is 0 for databases which predate it being recorded.
+func getDatabaseVersion(ctx context.Context, tx utils.QueryWrapper) (int, int, error) {
 	query := "SELECT `name` FROM sqlite_master WHERE `type` = 'table' AND `name` NOT LIKE 'sqlite_%' AND `name` = 'gluon_version'"
 
 	_, err := utils.MapQueryRow[string](ctx, tx, query)
 	if err != nil {
 		if errors.Is(err, db.ErrNotFound) {
-			return -1, nil
+			return -1, 0, nil
 		}
 
-		return 0, err
+		return 0, 0, err
 	}
 
 	versionQuery := "SELECT `version` FROM gluon_version WHERE `id` = 0"
 
-	return utils.MapQueryRow[int](ctx, tx, versionQuery)
+	version, err := utils.MapQueryRow[int](ctx, tx, versionQuery)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	hasMinCompatibleVersion, err := hasMinCompatibleVersionField(ctx, tx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if !hasMinCompatibleVersion {
+		return version, 0, nil
+	}
+
+	minCompatibleQuery := fmt.Sprintf("SELECT `%v` FROM gluon_version WHERE `id` = 0", v7.GluonVersionFieldMinCompatibleVersion)
+
+	minCompatibleVersion, err := utils.MapQueryRow[int](ctx, tx, minCompatibleQuery)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return version, minCompatibleVersion, nil
 }
 
+// updateDBVersion records the version along with the min compatible version, if the database has a field for it.
 func updateDBVersion(ctx context.Context, tx utils.QueryWrapper, version int) error {
 	query := "UPDATE gluon_version SET `version` = ? WHERE `id` = 0"
 
+	if err := utils.ExecQueryAndCheckUpdatedNotZero(ctx, tx, query, version); err != nil {
+		return err
+	}
+
+	hasMinCompatibleVersion, err := hasMinCompatibleVersionField(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	if !hasMinCompatibleVersion {
+		return nil
+	}
+
+	return updateDBMinCompatibleVersion(ctx, tx, getMinCompatibleVersion(version))
+}
+
+func updateDBMinCompatibleVersion(ctx context.Context, tx utils.QueryWrapper, version int) error {
+	query := fmt.Sprintf("UPDATE gluon_version SET `%v` = ? WHERE `id` = 0", v7.GluonVersionFieldMinCompatibleVersion)
+
 	return utils.ExecQueryAndCheckUpdatedNotZero(ctx, tx, query, version)
 }
+
+func hasMinCompatibleVersionField(ctx context.Context, tx utils.QueryWrapper) (bool, error) {
+	query := "SELECT COUNT(*) FROM pragma_table_info('gluon_version') WHERE `name` = ?"
+
+	count, err := utils.MapQueryRow[int](ctx, tx, query, v7.GluonVersionFieldMinCompatibleVersion)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
@@ -13,6 +13,9 @@ import (
 	"github.com/ProtonMail/gluon/internal/db_impl/sqlite3/utils"
 	v1 "github.com/ProtonMail/gluon/internal/db_impl/sqlite3/v1"
 	v2 "github.com/ProtonMail/gluon/internal/db_impl/sqlite3/v2"
+	v4 "github.com/ProtonMail/gluon/internal/db_impl/sqlite3/v4"
+	v6 "github.com/ProtonMail/gluon/internal/db_impl/sqlite3/v6"
+	v9 "github.com/ProtonMail/gluon/internal/db_impl/sqlite3/v9"
 	"github.com/bradenaw/juniper/xmaps"
 	"github.com/bradenaw/juniper/xslices"
 )
@@ -22,7 +25,7 @@ type readOps struct {
 }
 
 func (r readOps) MailboxExistsWithID(ctx context.Context, mboxID imap.InternalMailboxID) (bool, error) {
-	query := fmt.Sprintf("SELEC 1 FROM %[1]v WHERE `%[2]v` = ? LIMIT 1",
+	query := fmt.Sprintf("SELECT 1 FROM %[1]v WHERE `%[2]v` = ? LIMIT 1",
 		v1.MailboxesTableName,
 		v1.MailboxesFieldID,
 	)
@@ -98,7 +101,7 @@ func (r readOps) GetMailboxMessageIDPairs(ctx context.Context, mboxID imap.Inter
 }
 
 func (r readOps) GetAllMailboxesWithAttr(ctx context.Context) ([]*db.MailboxWithAttr, error) {
-	query := fmt.Sprintf("SELECT * FROM %v", v1.MailboxesTableName)
+	query := fmt.Sprintf("SELECT %v FROM %v", mailboxColumns, v1.MailboxesTableName)
 
 	mailboxes, err := utils.MapQueryRowsFn(ctx, r.qw, query, ScanMailboxWithAttr)
 	if err != nil {
@@ -137,19 +140,19 @@ func (r readOps) GetAllMailboxesAsRemoteIDs(ctx context.Context) ([]imap.Mailbox
 }
 
 func (r readOps) GetMailboxByName(ctx context.Context, name string) (*db.Mailbox, error) {
-	query := fmt.Sprintf("SELECT * FROM %v WHERE `%v` = ?", v1.MailboxesTableName, v1.MailboxesFieldName)
+	query := fmt.Sprintf("SELECT %v FROM %v WHERE `%v` = ?", mailboxColumns, v1.MailboxesTableName, v1.MailboxesFieldName)
 
 	return utils.MapQueryRowFn(ctx, r.qw, query, ScanMailbox, name)
 }
 
 func (r readOps) GetMailboxByID(ctx context.Context, mboxID imap.InternalMailboxID) (*db.Mailbox, error) {
-	query := fmt.Sprintf("SELECT * FROM %v WHERE `%v` = ?", v1.MailboxesTableName, v1.MailboxesFieldID)
+	query := fmt.Sprintf("SELECT %v FROM %v WHERE `%v` = ?", mailboxColumns, v1.MailboxesTableName, v1.MailboxesFieldID)
 
 	return utils.MapQueryRowFn(ctx, r.qw, query, ScanMailbox, mboxID)
 }
 
 func (r readOps) GetMailboxByRemoteID(ctx context.Context, mboxID imap.MailboxID) (*db.Mailbox, error) {
-	query := fmt.Sprintf("SELECT * FROM %v WHERE `%v` = ?", v1.MailboxesTableName, v1.MailboxesFieldRemoteID)
+	query := fmt.Sprintf("SELECT %v FROM %v WHERE `%v` = ?", mailboxColumns, v1.MailboxesTableName, v1.MailboxesFieldRemoteID)
 
 	return utils.MapQueryRowFn(ctx, r.qw, query, ScanMailbox, mboxID)
 }
@@ -403,7 +406,7 @@ func (r readOps) MessageExistsWithRemoteID(ctx context.Context, id imap.MessageI
 }
 
 func (r readOps) GetMessageNoEdges(ctx context.Context, id imap.InternalMessageID) (*db.Message, error) {
-	query := fmt.Sprintf("SELECT * FROM %v WHERE `%v` = ?", v1.MessagesTableName, v1.MessagesFieldID)
+	query := fmt.Sprintf("SELECT %v FROM %v WHERE `%v` = ?", messageColumns, v1.MessagesTableName, v1.MessagesFieldID)
 
 	return utils.MapQueryRowFn(ctx, r.qw, query, ScanMessage, id)
 }
@@ -427,7 +430,8 @@ func (r readOps) GetImportedMessageData(ctx context.Context, id imap.InternalMes
 		v1.MessageFlagsFieldMessageID,
 	)
 
-	messageQuery := fmt.Sprintf("SELECT * FROM %v WHERE `%v` = ?",
+	messageQuery := fmt.Sprintf("SELECT %v FROM %v WHERE `%v` = ?",
+		messageColumns,
 		v1.MessagesTableName,
 		v1.MessagesFieldID,
 	)
@@ -635,6 +639,16 @@ func (r readOps) GetConnectorSettings(ctx context.Context) (string, bool, error)
 	return value, hasValue, err
 }
 
+func (r readOps) GetSieveScript(ctx context.Context) (string, error) {
+	query := fmt.Sprintf("SELECT `%v` FROM %v WHERE `%v` = ?",
+		v4.SieveScriptFieldValue,
+		v4.SieveScriptTableName,
+		v4.SieveScriptFieldID,
+	)
+
+	return utils.MapQueryRow[string](ctx, r.qw, query, v4.SieveScriptDefaultID)
+}
+
 func (r readOps) GetAllMailboxesNameAndRemoteID(ctx context.Context) ([]db.MailboxNameAndRemoteID, error) {
 	query := fmt.Sprintf(
 		"SELECT `%v`,`%v` FROM `%v`",
@@ -653,3 +667,200 @@ func (r readOps) GetAllMailboxesNameAndRemoteID(ctx context.Context) ([]db.Mailb
 		return r, nil
 	})
 }
+
+func (r readOps) GetMessageHeaderFields(ctx context.Context, id imap.InternalMessageID) (*db.MessageHeaderFields, error) {
+	query := fmt.Sprintf("SELECT `%v`, `%v`, `%v`, `%v`, `%v`, `%v`, `%v` FROM %v WHERE `%v` = ?",
+		v6.MessageHeadersFieldFrom,
+		v6.MessageHeadersFieldTo,
+		v6.MessageHeadersFieldCc,
+		v6.MessageHeadersFieldBcc,
+		v6.MessageHeadersFieldSubject,
+		v6.MessageHeadersFieldSentDate,
+		v6.MessageHeadersFieldMessageIDHeader,
+		v6.MessageHeadersTableName,
+		v6.MessageHeadersFieldMessageID,
+	)
+
+	return utils.MapQueryRowFn(ctx, r.qw, query, func(scanner utils.RowScanner) (*db.MessageHeaderFields, error) {
+		var (
+			fields   db.MessageHeaderFields
+			sentDate sql.NullTime
+		)
+
+		if err := scanner.Scan(
+			&fields.From,
+			&fields.To,
+			&fields.Cc,
+			&fields.Bcc,
+			&fields.Subject,
+			&sentDate,
+			&fields.MessageID,
+		); err != nil {
+			return nil, err
+		}
+
+		if sentDate.Valid {
+			fields.SentDate = sentDate.Time.UTC()
+		}
+
+		return &fields, nil
+	}, id)
+}
+
+func (r readOps) GetMessageIDsWithoutHeaderFields(ctx context.Context) ([]imap.InternalMessageID, error) {
+	query := fmt.Sprintf("SELECT `%[1]v` FROM %[2]v WHERE `%[1]v` NOT IN (SELECT `%[3]v` FROM %[4]v)",
+		v1.MessagesFieldID,
+		v1.MessagesTableName,
+		v6.MessageHeadersFieldMessageID,
+		v6.MessageHeadersTableName,
+	)
+
+	return utils.MapQueryRows[imap.InternalMessageID](ctx, r.qw, query)
+}
+
+func (r readOps) SearchMessageHeaders(ctx context.Context, mboxID imap.InternalMailboxID, keys []db.HeaderSearchKey) (db.HeaderSearchResult, error) {
+	mboxTableName := v1.MailboxMessageTableName(mboxID)
+
+	// Each key is evaluated by its own SELECT, so that the indexes of the table can be used, and the results are
+	// returned together by a single query, tagged with the index of their key; -1 tags messages without header fields.
+	selects := []string{fmt.Sprintf("SELECT -1, `%[1]v` FROM %[2]v WHERE `%[1]v` NOT IN (SELECT `%[3]v` FROM %[4]v)",
+		v1.MailboxMessagesFieldMessageID,
+		mboxTableName,
+		v6.MessageHeadersFieldMessageID,
+		v6.MessageHeadersTableName,
+	)}
+
+	args := make([]any, 0, len(keys))
+
+	for i, key := range keys {
+		predicate, arg := headerSearchPredicate(key)
+
+		selects = append(selects, fmt.Sprintf("SELECT %[1]v, `%[2]v` FROM %[3]v WHERE %[4]v AND `%[2]v` IN (SELECT `%[5]v` FROM %[6]v)",
+			i,
+			v6.MessageHeadersFieldMessageID,
+			v6.MessageHeadersTableName,
+			predicate,
+			v1.MailboxMessagesFieldMessageID,
+			mboxTableName,
+		))
+
+		args = append(args, arg)
+	}
+
+	result := db.HeaderSearchResult{
+		Matches: make([]map[imap.InternalMessageID]struct{}, len(keys)),
+		Missing: make(map[imap.InternalMessageID]struct{}),
+	}
+
+	for i := range keys {
+		result.Matches[i] = make(map[imap.InternalMessageID]struct{})
+	}
+
+	if err := utils.QueryForEachRow(ctx, r.qw, strings.Join(selects, " UNION ALL "), func(scanner utils.RowScanner) error {
+		var (
+			keyIdx int
+			id     imap.InternalMessageID
+		)
+
+		if err := scanner.Scan(&keyIdx, &id); err != nil {
+			return err
+		}
+
+		if keyIdx < 0 {
+			result.Missing[id] = struct{}{}
+		} else {
+			result.Matches[keyIdx][id] = struct{}{}
+		}
+
+		return nil
+	}, args...); err != nil {
+		return db.HeaderSearchResult{}, err
+	}
+
+	return result, nil
+}
+
+// headerSearchPredicate returns the SQL predicate evaluating the given key against the message headers table,
+// along with its argument.
+func headerSearchPredicate(key db.HeaderSearchKey) (string, any) {
+	switch key.Op {
+	case db.HeaderSearchContains:
+		// The fields are stored lower-cased.
+		return fmt.Sprintf("instr(`%v`, ?) > 0", headerFieldColumn(key.Field)), strings.ToLower(key.Value)
+
+	case db.HeaderSearchSentBefore:
+		return fmt.Sprintf("`%v` < ?", v6.MessageHeadersFieldSentDate), key.Date
+
+	case db.HeaderSearchSentOn:
+		return fmt.Sprintf("`%v` = ?", v6.MessageHeadersFieldSentDate), key.Date
+
+	default:
+		return fmt.Sprintf("`%v` >= ?", v6.MessageHeadersFieldSentDate), key.Date
+	}
+}
+
+func headerFieldColumn(field db.HeaderField) string {
+	switch field {
+	case db.HeaderFieldFrom:
+		return v6.MessageHeadersFieldFrom
+
+	case db.HeaderFieldTo:
+		return v6.MessageHeadersFieldTo
+
+	case db.HeaderFieldCc:
+		return v6.MessageHeadersFieldCc
+
+	case db.HeaderFieldBcc:
+		return v6.MessageHeadersFieldBcc
+
+	case db.HeaderFieldSubject:
+		return v6.MessageHeadersFieldSubject
+
+	default:
+		return v6.MessageHeadersFieldMessageIDHeader
+	}
+}
+
+func (r readOps) GetOrphanedFlagMessageIDs(ctx context.Context) ([]imap.InternalMessageID, error) {
+	query := fmt.Sprintf("SELECT DISTINCT `%[1]v` FROM %[2]v WHERE `%[1]v` NOT IN (SELECT `%[3]v` FROM %[4]v)",
+		v1.MessageFlagsFieldMessageID,
+		v1.MessageFlagsTableName,
+		v1.MessagesFieldID,
+		v1.MessagesTableName,
+	)
+
+	return utils.MapQueryRows[imap.InternalMessageID](ctx, r.qw, query)
+}
+
+func (r readOps) GetMessageLiteralHashes(ctx context.Context, ids []imap.InternalMessageID) (map[imap.InternalMessageID][]byte, error) {
+	result := make(map[imap.InternalMessageID][]byte, len(ids))
+
+	for _, chunk := range xslices.Chunk(ids, db.ChunkLimit) {
+		query := fmt.Sprintf("SELECT `%v`, `%v` FROM %v WHERE `%v` IN (%v)",
+			v9.MessageLiteralHashesFieldMessageID,
+			v9.MessageLiteralHashesFieldHash,
+			v9.MessageLiteralHashesTableName,
+			v9.MessageLiteralHashesFieldMessageID,
+			utils.GenSQLIn(len(chunk)),
+		)
+
+		if err := utils.QueryForEachRow(ctx, r.qw, query, func(scanner utils.RowScanner) error {
+			var (
+				id   imap.InternalMessageID
+				hash []byte
+			)
+
+			if err := scanner.Scan(&id, &hash); err != nil {
+				return err
+			}
+
+			result[id] = hash
+
+			return nil
+		}, utils.MapSliceToAny(chunk)...); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
@@ -1,14 +1,45 @@
 package sqlite3
 
 import (
+	"strings"
+
 	"github.com/ProtonMail/gluon/db"
 	"github.com/ProtonMail/gluon/internal/db_impl/sqlite3/utils"
+	v1 "github.com/ProtonMail/gluon/internal/db_impl/sqlite3/v1"
+	v5 "github.com/ProtonMail/gluon/internal/db_impl/sqlite3/v5"
+)
+
+// mailboxColumns are the columns ScanMailbox and ScanMailboxWithAttr expect, in order. Queries list them explicitly
+// rather than selecting *, so columns added by later versions don't shift the scanned values.
+var mailboxColumns = joinColumns(
+	v1.MailboxesFieldID,
+	v1.MailboxesFieldRemoteID,
+	v1.MailboxesFieldName,
+	v1.MailboxesFieldUIDValidity,
+	v1.MailboxesFieldSubscribed,
+	v5.MailboxesFieldPermissions,
 )
 
+// messageColumns are the columns ScanMessage and ScanMessageWithFlags expect, in order.
+var messageColumns = joinColumns(
+	v1.MessagesFieldID,
+	v1.MessagesFieldRemoteID,
+	v1.MessagesFieldDate,
+	v1.MessagesFieldSize,
+	v1.MessagesFieldBody,
+	v1.MessagesFieldBodyStructure,
+	v1.MessagesFieldEnvelope,
+	v1.MessagesFieldDeleted,
+)
+
+func joinColumns(columns ...string) string {
+	return "`" + strings.Join(columns, "`, `") + "`"
+}
+
 func ScanMailbox(scanner utils.RowScanner) (*db.Mailbox, error) {
 	mbox := new(db.Mailbox)
 
-	if err := scanner.Scan(&mbox.ID, &mbox.RemoteID, &mbox.Name, &mbox.UIDValidity, &mbox.Subscribed); err != nil {
+	if err := scanner.Scan(&mbox.ID, &mbox.RemoteID, &mbox.Name, &mbox.UIDValidity, &mbox.Subscribed, &mbox.Permissions); err != nil {
 		return nil, err
 	}
 
@@ -18,7 +49,7 @@ func ScanMailbox(scanner utils.RowScanner) (*db.Mailbox, error) {
 func ScanMailboxWithAttr(scanner utils.RowScanner) (*db.MailboxWithAttr, error) {
 	mbox := new(db.MailboxWithAttr)
 
-	if err := scanner.Scan(&mbox.ID, &mbox.RemoteID, &mbox.Name, &mbox.UIDValidity, &mbox.Subscribed); err != nil {
+	if err := scanner.Scan(&mbox.ID, &mbox.RemoteID, &mbox.Name, &mbox.UIDValidity, &mbox.Subscribed, &mbox.Permissions); err != nil {
 		return nil, err
 	}
 
@@ -237,6 +237,36 @@ func (r ReadTracer) GetAllMessagesIDsAsMap(ctx context.Context) (map[imap.Intern
 	return r.RD.GetAllMessagesIDsAsMap(ctx)
 }
 
+func (r ReadTracer) GetMessageHeaderFields(ctx context.Context, id imap.InternalMessageID) (*db.MessageHeaderFields, error) {
+	r.Entry.Tracef("GetMessageHeaderFields")
+
+	return r.RD.GetMessageHeaderFields(ctx, id)
+}
+
+func (r ReadTracer) GetMessageLiteralHashes(ctx context.Context, ids []imap.InternalMessageID) (map[imap.InternalMessageID][]byte, error) {
+	r.Entry.Tracef("GetMessageLiteralHashes")
+
+	return r.RD.GetMessageLiteralHashes(ctx, ids)
+}
+
+func (r ReadTracer) GetMessageIDsWithoutHeaderFields(ctx context.Context) ([]imap.InternalMessageID, error) {
+	r.Entry.Tracef("GetMessageIDsWithoutHeaderFields")
+
+	return r.RD.GetMessageIDsWithoutHeaderFields(ctx)
+}
+
+func (r ReadTracer) SearchMessageHeaders(ctx context.Context, mboxID imap.InternalMailboxID, keys []db.HeaderSearchKey) (db.HeaderSearchResult, error) {
+	r.Entry.Tracef("SearchMessageHeaders")
+
+	return r.RD.SearchMessageHeaders(ctx, mboxID, keys)
+}
+
+func (r ReadTracer) GetOrphanedFlagMessageIDs(ctx context.Context) ([]imap.InternalMessageID, error) {
+	r.Entry.Tracef("GetOrphanedFlagMessageIDs")
+
+	return r.RD.GetOrphanedFlagMessageIDs(ctx)
+}
+
 func (r ReadTracer) GetDeletedSubscriptionSet(ctx context.Context) (map[imap.MailboxID]*db.DeletedSubscription, error) {
 	r.Entry.Tracef("GetDeletedSubscriptionSet")
 
@@ -249,6 +279,12 @@ func (r ReadTracer) GetConnectorSettings(ctx context.Context) (string, bool, err
 	return r.RD.GetConnectorSettings(ctx)
 }
 
+func (r ReadTracer) GetSieveScript(ctx context.Context) (string, error) {
+	r.Entry.Tracef("GetSieveScript")
+
+	return r.RD.GetSieveScript(ctx)
+}
+
 func (r ReadTracer) GetAllMailboxesNameAndRemoteID(ctx context.Context) ([]db.MailboxNameAndRemoteID, error) {
 	r.Entry.Tracef("GetAllMailboxesNameAndRemoteID")
 
@@ -266,11 +302,12 @@ func (w WriteTracer) CreateMailbox(
 	mboxID imap.MailboxID,
 	name string,
 	flags, permFlags, attrs imap.FlagSet,
+	perms imap.MailboxPermissions,
 	uidValidity imap.UID,
 ) (*db.Mailbox, error) {
 	w.Entry.Tracef("CreateMailbox")
 
-	return w.TX.CreateMailbox(ctx, mboxID, name, flags, permFlags, attrs, uidValidity)
+	return w.TX.CreateMailbox(ctx, mboxID, name, flags, permFlags, attrs, perms, uidValidity)
 }
 
 func (w WriteTracer) GetOrCreateMailbox(
@@ -278,11 +315,12 @@ func (w WriteTracer) GetOrCreateMailbox(
 	mboxID imap.MailboxID,
 	name string,
 	flags, permFlags, attrs imap.FlagSet,
+	perms imap.MailboxPermissions,
 	uidValidity imap.UID,
 ) (*db.Mailbox, error) {
 	w.Entry.Tracef("GetOrCreateMailbox")
 
-	return w.TX.GetOrCreateMailbox(ctx, mboxID, name, flags, permFlags, attrs, uidValidity)
+	return w.TX.GetOrCreateMailbox(ctx, mboxID, name, flags, permFlags, attrs, perms, uidValidity)
 }
 
 func (w WriteTracer) GetOrCreateMailboxAlt(
@@ -302,6 +340,12 @@ func (w WriteTracer) RenameMailboxWithRemoteID(ctx context.Context, mboxID imap.
 	return w.TX.RenameMailboxWithRemoteID(ctx, mboxID, name)
 }
 
+func (w WriteTracer) SetMailboxPermissionsWithRemoteID(ctx context.Context, mboxID imap.MailboxID, permissions imap.MailboxPermissions) error {
+	w.Entry.Tracef("SetMailboxPermissionsWithRemoteID")
+
+	return w.TX.SetMailboxPermissionsWithRemoteID(ctx, mboxID, permissions)
+}
+
 func (w WriteTracer) DeleteMailboxWithRemoteID(ctx context.Context, mboxID imap.MailboxID) error {
 	w.Entry.Tracef("DeleteMailboxWithRemoteID")
 
@@ -443,6 +487,24 @@ func (w WriteTracer) SetFlagsOnMessages(ctx context.Context, ids []imap.Internal
 	return w.TX.SetFlagsOnMessages(ctx, ids, flags)
 }
 
+func (w WriteTracer) BumpMailboxUIDNext(ctx context.Context, mboxID imap.InternalMailboxID, uidNext imap.UID) error {
+	w.Entry.Tracef("BumpMailboxUIDNext")
+
+	return w.TX.BumpMailboxUIDNext(ctx, mboxID, uidNext)
+}
+
+func (w WriteTracer) StoreMessageHeaderFields(ctx context.Context, id imap.InternalMessageID, fields *db.MessageHeaderFields) error {
+	w.Entry.Tracef("StoreMessageHeaderFields")
+
+	return w.TX.StoreMessageHeaderFields(ctx, id, fields)
+}
+
+func (w WriteTracer) StoreMessageLiteralHash(ctx context.Context, id imap.InternalMessageID, hash []byte) error {
+	w.Entry.Tracef("StoreMessageLiteralHash")
+
+	return w.TX.StoreMessageLiteralHash(ctx, id, hash)
+}
+
 func (w WriteTracer) AddDeletedSubscription(ctx context.Context, mboxName string, mboxID imap.MailboxID) error {
 	w.Entry.Tracef("AddDeletedSubscription")
 
@@ -461,6 +523,12 @@ func (w WriteTracer) StoreConnectorSettings(ctx context.Context, settings string
 	return w.TX.StoreConnectorSettings(ctx, settings)
 }
 
+func (w WriteTracer) StoreSieveScript(ctx context.Context, script string) error {
+	w.Entry.Tracef("StoreSieveScript")
+
+	return w.TX.StoreSieveScript(ctx, script)
+}
+
 func (w WriteTracer) AddFlagsToAllMailboxes(ctx context.Context, flags ...string) error {
 	w.Entry.Tracef("AddFlagsToAllMailboxes")
 
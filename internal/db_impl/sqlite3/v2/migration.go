@@ -34,3 +34,18 @@ func (m Migration) Run(ctx context.Context, tx utils.QueryWrapper, _ imap.UIDVal
 
 	return nil
 }
+
+func (m Migration) Down(ctx context.Context, tx utils.QueryWrapper) error {
+	query := fmt.Sprintf("DROP TABLE %v", ConnectorSettingsTableName)
+
+	if _, err := utils.ExecQuery(ctx, tx, query); err != nil {
+		return fmt.Errorf("failed to drop connector settings table: %w", err)
+	}
+
+	return nil
+}
+
+// BackwardCompatible is true as older versions don't know about the table.
+func (m Migration) BackwardCompatible() bool {
+	return true
+}
@@ -0,0 +1,6 @@
+package v4
+
+const SieveScriptTableName = "sieve_script"
+const SieveScriptFieldID = "id"
+const SieveScriptFieldValue = "value"
+const SieveScriptDefaultID = 0
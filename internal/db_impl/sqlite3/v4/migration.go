@@ -0,0 +1,51 @@
+package v4
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/internal/db_impl/sqlite3/utils"
+)
+
+type Migration struct{}
+
+func (m Migration) Run(ctx context.Context, tx utils.QueryWrapper, _ imap.UIDValidityGenerator) error {
+	query := fmt.Sprintf("CREATE TABLE `%v` (`%v` INTEGER NOT NULL PRIMARY KEY , `%v` TEXT NOT NULL)",
+		SieveScriptTableName,
+		SieveScriptFieldID,
+		SieveScriptFieldValue,
+	)
+
+	if _, err := utils.ExecQuery(ctx, tx, query); err != nil {
+		return fmt.Errorf("failed to create sieve script table: %w", err)
+	}
+
+	query = fmt.Sprintf(
+		"INSERT INTO %v (`%v`, `%v`) VALUES (?,'')",
+		SieveScriptTableName,
+		SieveScriptFieldID,
+		SieveScriptFieldValue,
+	)
+
+	if _, err := utils.ExecQuery(ctx, tx, query, SieveScriptDefaultID); err != nil {
+		return fmt.Errorf("failed to create default sieve script entry: %w", err)
+	}
+
+	return nil
+}
+
+func (m Migration) Down(ctx context.Context, tx utils.QueryWrapper) error {
+	query := fmt.Sprintf("DROP TABLE %v", SieveScriptTableName)
+
+	if _, err := utils.ExecQuery(ctx, tx, query); err != nil {
+		return fmt.Errorf("failed to drop sieve script table: %w", err)
+	}
+
+	return nil
+}
+
+// BackwardCompatible is true as older versions don't know about the table.
+func (m Migration) BackwardCompatible() bool {
+	return true
+}
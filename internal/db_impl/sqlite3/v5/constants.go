@@ -0,0 +1,3 @@
+package v5
+
+const MailboxesFieldPermissions = "permissions"
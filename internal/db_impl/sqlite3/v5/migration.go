@@ -0,0 +1,45 @@
+package v5
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/internal/db_impl/sqlite3/utils"
+	v1 "github.com/ProtonMail/gluon/internal/db_impl/sqlite3/v1"
+)
+
+type Migration struct{}
+
+func (m Migration) Run(ctx context.Context, tx utils.QueryWrapper, _ imap.UIDValidityGenerator) error {
+	// Existing mailboxes default to 0, which grants all permissions.
+	query := fmt.Sprintf("ALTER TABLE %v ADD COLUMN `%v` INTEGER NOT NULL DEFAULT 0",
+		v1.MailboxesTableName,
+		MailboxesFieldPermissions,
+	)
+
+	if _, err := utils.ExecQuery(ctx, tx, query); err != nil {
+		return fmt.Errorf("failed to add mailbox permissions column: %w", err)
+	}
+
+	return nil
+}
+
+func (m Migration) Down(ctx context.Context, tx utils.QueryWrapper) error {
+	query := fmt.Sprintf("ALTER TABLE %v DROP COLUMN `%v`",
+		v1.MailboxesTableName,
+		MailboxesFieldPermissions,
+	)
+
+	if _, err := utils.ExecQuery(ctx, tx, query); err != nil {
+		return fmt.Errorf("failed to drop mailbox permissions column: %w", err)
+	}
+
+	return nil
+}
+
+// BackwardCompatible is false as older versions select every column of the mailboxes table and scan them by
+// position, which fails once the table has a column they don't know about.
+func (m Migration) BackwardCompatible() bool {
+	return false
+}
@@ -0,0 +1,12 @@
+package v6
+
+const MessageHeadersTableName = "message_headers"
+const MessageHeadersFieldMessageID = "message_id"
+const MessageHeadersFieldFrom = "from_addr"
+const MessageHeadersFieldTo = "to_addr"
+const MessageHeadersFieldCc = "cc_addr"
+const MessageHeadersFieldBcc = "bcc_addr"
+const MessageHeadersFieldSubject = "subject"
+const MessageHeadersFieldSentDate = "sent_date"
+const MessageHeadersFieldMessageIDHeader = "message_id_header"
+const MessageHeadersFieldHeader = "header"
@@ -0,0 +1,63 @@
+package v6
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/internal/db_impl/sqlite3/utils"
+	v1 "github.com/ProtonMail/gluon/internal/db_impl/sqlite3/v1"
+)
+
+type Migration struct{}
+
+func (m Migration) Run(ctx context.Context, tx utils.QueryWrapper, _ imap.UIDValidityGenerator) error {
+	// Messages created before this migration have no row; their header fields are filled in lazily.
+	query := fmt.Sprintf("CREATE TABLE `%[1]v` (`%[2]v` uuid NOT NULL PRIMARY KEY, "+
+		"`%[3]v` TEXT NOT NULL, `%[4]v` TEXT NOT NULL, `%[5]v` TEXT NOT NULL, `%[6]v` TEXT NOT NULL, "+
+		"`%[7]v` TEXT NOT NULL, `%[8]v` DATETIME NULL, `%[9]v` TEXT NOT NULL, `%[10]v` TEXT NOT NULL, "+
+		"CONSTRAINT `message_headers_message_id` FOREIGN KEY (`%[2]v`) REFERENCES `%[11]v` (`%[12]v`) ON DELETE CASCADE"+
+		")",
+		MessageHeadersTableName,
+		MessageHeadersFieldMessageID,
+		MessageHeadersFieldFrom,
+		MessageHeadersFieldTo,
+		MessageHeadersFieldCc,
+		MessageHeadersFieldBcc,
+		MessageHeadersFieldSubject,
+		MessageHeadersFieldSentDate,
+		MessageHeadersFieldMessageIDHeader,
+		MessageHeadersFieldHeader,
+		v1.MessagesTableName,
+		v1.MessagesFieldID,
+	)
+
+	if _, err := utils.ExecQuery(ctx, tx, query); err != nil {
+		return fmt.Errorf("failed to create message headers table: %w", err)
+	}
+
+	for _, field := range []string{MessageHeadersFieldSentDate, MessageHeadersFieldMessageIDHeader} {
+		query := fmt.Sprintf("CREATE INDEX `%[1]v_%[2]v` ON `%[1]v` (`%[2]v`)", MessageHeadersTableName, field)
+
+		if _, err := utils.ExecQuery(ctx, tx, query); err != nil {
+			return fmt.Errorf("failed to create message headers index: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (m Migration) Down(ctx context.Context, tx utils.QueryWrapper) error {
+	query := fmt.Sprintf("DROP TABLE %v", MessageHeadersTableName)
+
+	if _, err := utils.ExecQuery(ctx, tx, query); err != nil {
+		return fmt.Errorf("failed to drop message headers table: %w", err)
+	}
+
+	return nil
+}
+
+// BackwardCompatible is true as the header fields of messages created by older versions are filled in lazily.
+func (m Migration) BackwardCompatible() bool {
+	return true
+}
@@ -0,0 +1,4 @@
+package v7
+
+const GluonVersionTableName = "gluon_version"
+const GluonVersionFieldMinCompatibleVersion = "min_compatible_version"
@@ -0,0 +1,43 @@
+package v7
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/internal/db_impl/sqlite3/utils"
+)
+
+type Migration struct{}
+
+func (m Migration) Run(ctx context.Context, tx utils.QueryWrapper, _ imap.UIDValidityGenerator) error {
+	// The value is filled in along with the version once all migrations have run.
+	query := fmt.Sprintf("ALTER TABLE %v ADD COLUMN `%v` INTEGER NOT NULL DEFAULT 0",
+		GluonVersionTableName,
+		GluonVersionFieldMinCompatibleVersion,
+	)
+
+	if _, err := utils.ExecQuery(ctx, tx, query); err != nil {
+		return fmt.Errorf("failed to add min compatible version column: %w", err)
+	}
+
+	return nil
+}
+
+func (m Migration) Down(ctx context.Context, tx utils.QueryWrapper) error {
+	query := fmt.Sprintf("ALTER TABLE %v DROP COLUMN `%v`",
+		GluonVersionTableName,
+		GluonVersionFieldMinCompatibleVersion,
+	)
+
+	if _, err := utils.ExecQuery(ctx, tx, query); err != nil {
+		return fmt.Errorf("failed to drop min compatible version column: %w", err)
+	}
+
+	return nil
+}
+
+// BackwardCompatible is true as older versions never read the new column.
+func (m Migration) BackwardCompatible() bool {
+	return true
+}
@@ -0,0 +1,67 @@
+package v8
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/internal/db_impl/sqlite3/utils"
+	v1 "github.com/ProtonMail/gluon/internal/db_impl/sqlite3/v1"
+	v6 "github.com/ProtonMail/gluon/internal/db_impl/sqlite3/v6"
+)
+
+type Migration struct{}
+
+func (m Migration) Run(ctx context.Context, tx utils.QueryWrapper, _ imap.UIDValidityGenerator) error {
+	// The table is recreated without the full header of messages, which was stored in plaintext.
+	// Its rows are dropped too: the fields are now stored lower-cased, and are filled in again lazily.
+	if _, err := utils.ExecQuery(ctx, tx, fmt.Sprintf("DROP TABLE %v", v6.MessageHeadersTableName)); err != nil {
+		return fmt.Errorf("failed to drop message headers table: %w", err)
+	}
+
+	query := fmt.Sprintf("CREATE TABLE `%[1]v` (`%[2]v` uuid NOT NULL PRIMARY KEY, "+
+		"`%[3]v` TEXT NOT NULL, `%[4]v` TEXT NOT NULL, `%[5]v` TEXT NOT NULL, `%[6]v` TEXT NOT NULL, "+
+		"`%[7]v` TEXT NOT NULL, `%[8]v` DATETIME NULL, `%[9]v` TEXT NOT NULL, "+
+		"CONSTRAINT `message_headers_message_id` FOREIGN KEY (`%[2]v`) REFERENCES `%[10]v` (`%[11]v`) ON DELETE CASCADE"+
+		")",
+		v6.MessageHeadersTableName,
+		v6.MessageHeadersFieldMessageID,
+		v6.MessageHeadersFieldFrom,
+		v6.MessageHeadersFieldTo,
+		v6.MessageHeadersFieldCc,
+		v6.MessageHeadersFieldBcc,
+		v6.MessageHeadersFieldSubject,
+		v6.MessageHeadersFieldSentDate,
+		v6.MessageHeadersFieldMessageIDHeader,
+		v1.MessagesTableName,
+		v1.MessagesFieldID,
+	)
+
+	if _, err := utils.ExecQuery(ctx, tx, query); err != nil {
+		return fmt.Errorf("failed to create message headers table: %w", err)
+	}
+
+	for _, field := range []string{v6.MessageHeadersFieldSentDate, v6.MessageHeadersFieldMessageIDHeader} {
+		query := fmt.Sprintf("CREATE INDEX `%[1]v_%[2]v` ON `%[1]v` (`%[2]v`)", v6.MessageHeadersTableName, field)
+
+		if _, err := utils.ExecQuery(ctx, tx, query); err != nil {
+			return fmt.Errorf("failed to create message headers index: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (m Migration) Down(ctx context.Context, tx utils.QueryWrapper) error {
+	if _, err := utils.ExecQuery(ctx, tx, fmt.Sprintf("DROP TABLE %v", v6.MessageHeadersTableName)); err != nil {
+		return fmt.Errorf("failed to drop message headers table: %w", err)
+	}
+
+	// Older versions fill in the header fields lazily.
+	return v6.Migration{}.Run(ctx, tx, nil)
+}
+
+// BackwardCompatible is false as older versions store the full header of messages in the dropped column.
+func (m Migration) BackwardCompatible() bool {
+	return false
+}
@@ -0,0 +1,5 @@
+package v9
+
+const MessageLiteralHashesTableName = "message_literal_hashes"
+const MessageLiteralHashesFieldMessageID = "message_id"
+const MessageLiteralHashesFieldHash = "hash"
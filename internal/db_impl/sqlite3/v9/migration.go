@@ -0,0 +1,46 @@
+package v9
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/internal/db_impl/sqlite3/utils"
+	v1 "github.com/ProtonMail/gluon/internal/db_impl/sqlite3/v1"
+)
+
+type Migration struct{}
+
+func (m Migration) Run(ctx context.Context, tx utils.QueryWrapper, _ imap.UIDValidityGenerator) error {
+	// Messages created before this migration have no row; their hash is recorded when the user is checked.
+	query := fmt.Sprintf("CREATE TABLE `%[1]v` (`%[2]v` uuid NOT NULL PRIMARY KEY, `%[3]v` BLOB NOT NULL, "+
+		"CONSTRAINT `message_literal_hashes_message_id` FOREIGN KEY (`%[2]v`) REFERENCES `%[4]v` (`%[5]v`) ON DELETE CASCADE"+
+		")",
+		MessageLiteralHashesTableName,
+		MessageLiteralHashesFieldMessageID,
+		MessageLiteralHashesFieldHash,
+		v1.MessagesTableName,
+		v1.MessagesFieldID,
+	)
+
+	if _, err := utils.ExecQuery(ctx, tx, query); err != nil {
+		return fmt.Errorf("failed to create message literal hashes table: %w", err)
+	}
+
+	return nil
+}
+
+func (m Migration) Down(ctx context.Context, tx utils.QueryWrapper) error {
+	query := fmt.Sprintf("DROP TABLE %v", MessageLiteralHashesTableName)
+
+	if _, err := utils.ExecQuery(ctx, tx, query); err != nil {
+		return fmt.Errorf("failed to drop message literal hashes table: %w", err)
+	}
+
+	return nil
+}
+
+// BackwardCompatible is true as older versions never read the new table, and messages they create have no hash.
+func (m Migration) BackwardCompatible() bool {
+	return true
+}
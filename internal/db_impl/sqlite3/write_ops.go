@@ -2,6 +2,7 @@ package sqlite3
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"strings"
@@ -11,6 +12,10 @@ import (
 	"github.com/ProtonMail/gluon/internal/db_impl/sqlite3/utils"
 	v1 "github.com/ProtonMail/gluon/internal/db_impl/sqlite3/v1"
 	v2 "github.com/ProtonMail/gluon/internal/db_impl/sqlite3/v2"
+	v4 "github.com/ProtonMail/gluon/internal/db_impl/sqlite3/v4"
+	v5 "github.com/ProtonMail/gluon/internal/db_impl/sqlite3/v5"
+	v6 "github.com/ProtonMail/gluon/internal/db_impl/sqlite3/v6"
+	v9 "github.com/ProtonMail/gluon/internal/db_impl/sqlite3/v9"
 	"github.com/bradenaw/juniper/xslices"
 )
 
@@ -24,14 +29,16 @@ func (w writeOps) CreateMailbox(
 	mboxID imap.MailboxID,
 	name string,
 	flags, permFlags, attrs imap.FlagSet,
+	perms imap.MailboxPermissions,
 	uidValidity imap.UID,
 ) (*db.Mailbox, error) {
-	createMBoxQuery := fmt.Sprintf("INSERT INTO %v (`%v`, `%v`, `%v`, `%v`) VALUES (?,?,?,?) RETURNING `%v`",
+	createMBoxQuery := fmt.Sprintf("INSERT INTO %v (`%v`, `%v`, `%v`, `%v`, `%v`) VALUES (?,?,?,?,?) RETURNING `%v`",
 		v1.MailboxesTableName,
 		v1.MailboxesFieldRemoteID,
 		v1.MailboxesFieldName,
 		v1.MailboxesFieldUIDValidity,
 		v1.MailboxesFieldSubscribed,
+		v5.MailboxesFieldPermissions,
 		v1.MailboxesFieldID,
 	)
 
@@ -40,6 +47,7 @@ func (w writeOps) CreateMailbox(
 		name,
 		uidValidity,
 		true,
+		perms,
 	)
 	if err != nil {
 		return nil, err
@@ -94,6 +102,7 @@ func (w writeOps) CreateMailbox(
 		Name:        name,
 		UIDValidity: uidValidity,
 		Subscribed:  true,
+		Permissions: perms,
 	}, nil
 }
 
@@ -102,6 +111,7 @@ func (w writeOps) GetOrCreateMailbox(
 	mboxID imap.MailboxID,
 	name string,
 	flags, permFlags, attrs imap.FlagSet,
+	perms imap.MailboxPermissions,
 	uidValidity imap.UID,
 ) (*db.Mailbox, error) {
 	mbox, err := w.GetMailboxByRemoteID(ctx, mboxID)
@@ -113,7 +123,7 @@ func (w writeOps) GetOrCreateMailbox(
 		return mbox, nil
 	}
 
-	return w.CreateMailbox(ctx, mboxID, name, flags, permFlags, attrs, uidValidity)
+	return w.CreateMailbox(ctx, mboxID, name, flags, permFlags, attrs, perms, uidValidity)
 }
 
 func (w writeOps) GetOrCreateMailboxAlt(ctx context.Context, mbox imap.Mailbox, delimiter string, uidValidity imap.UID) (*db.Mailbox, error) {
@@ -124,6 +134,7 @@ func (w writeOps) GetOrCreateMailboxAlt(ctx context.Context, mbox imap.Mailbox,
 		mbox.Flags,
 		mbox.PermanentFlags,
 		mbox.Attributes,
+		mbox.Permissions,
 		uidValidity,
 	)
 }
@@ -138,6 +149,16 @@ func (w writeOps) RenameMailboxWithRemoteID(ctx context.Context, mboxID imap.Mai
 	return utils.ExecQueryAndCheckUpdatedNotZero(ctx, w.qw, query, name, mboxID)
 }
 
+func (w writeOps) SetMailboxPermissionsWithRemoteID(ctx context.Context, mboxID imap.MailboxID, permissions imap.MailboxPermissions) error {
+	query := fmt.Sprintf("UPDATE %v SET `%v` = ? WHERE `%v` = ?",
+		v1.MailboxesTableName,
+		v5.MailboxesFieldPermissions,
+		v1.MailboxesFieldRemoteID,
+	)
+
+	return utils.ExecQueryAndCheckUpdatedNotZero(ctx, w.qw, query, permissions, mboxID)
+}
+
 func (w writeOps) DeleteMailboxWithRemoteID(ctx context.Context, mboxID imap.MailboxID) error {
 	mbox, err := w.GetMailboxByRemoteID(ctx, mboxID)
 	if err != nil {
@@ -240,7 +261,7 @@ func (w writeOps) RemoveMessagesFromMailbox(ctx context.Context, mboxID imap.Int
 				utils.GenSQLIn(len(chunk)),
 			)
 
-			if _, err := utils.ExecQuery(ctx, w.qw, query, utils.MapSliceToAny(messageIDs)...); err != nil {
+			if _, err := utils.ExecQuery(ctx, w.qw, query, utils.MapSliceToAny(chunk)...); err != nil {
 				return err
 			}
 		}
@@ -254,7 +275,7 @@ func (w writeOps) RemoveMessagesFromMailbox(ctx context.Context, mboxID imap.Int
 				v1.MessageToMailboxFieldMailboxID,
 			)
 
-			if _, err := utils.ExecQuery(ctx, w.qw, query, append(utils.MapSliceToAny(messageIDs), mboxID)...); err != nil {
+			if _, err := utils.ExecQuery(ctx, w.qw, query, append(utils.MapSliceToAny(chunk), mboxID)...); err != nil {
 				return err
 			}
 		}
@@ -346,6 +367,35 @@ func (w writeOps) SetMailboxUIDValidity(ctx context.Context, mboxID imap.Interna
 	return utils.ExecQueryAndCheckUpdatedNotZero(ctx, w.qw, query, uidValidity, mboxID)
 }
 
+func (w writeOps) BumpMailboxUIDNext(ctx context.Context, mboxID imap.InternalMailboxID, uidNext imap.UID) error {
+	current, err := w.GetMailboxUID(ctx, mboxID)
+	if err != nil {
+		return err
+	}
+
+	if current >= uidNext {
+		return nil
+	}
+
+	// The next UID is one past the mailbox table's autoincrement sequence, see GetMailboxUID.
+	updateQuery := "UPDATE sqlite_sequence SET `seq` = ? WHERE `name` = ?"
+
+	count, err := utils.ExecQuery(ctx, w.qw, updateQuery, uidNext-1, v1.MailboxMessageTableName(mboxID))
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		insertQuery := "INSERT INTO sqlite_sequence (`name`, `seq`) VALUES (?, ?)"
+
+		if _, err := utils.ExecQuery(ctx, w.qw, insertQuery, v1.MailboxMessageTableName(mboxID), uidNext-1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (w writeOps) CreateMessages(ctx context.Context, reqs ...*db.CreateMessageReq) error {
 	for _, chunk := range xslices.Chunk(reqs, db.ChunkLimit) {
 		createMessageQuery := fmt.Sprintf("INSERT INTO %v (`%v`, `%v`, `%v`, `%v`, `%v`, `%v`, `%v`) VALUES %v",
@@ -382,6 +432,20 @@ func (w writeOps) CreateMessages(ctx context.Context, reqs ...*db.CreateMessageR
 			return err
 		}
 
+		for _, req := range chunk {
+			if req.HeaderFields != nil {
+				if err := w.StoreMessageHeaderFields(ctx, req.InternalID, req.HeaderFields); err != nil {
+					return err
+				}
+			}
+
+			if req.LiteralHash != nil {
+				if err := w.StoreMessageLiteralHash(ctx, req.InternalID, req.LiteralHash); err != nil {
+					return err
+				}
+			}
+		}
+
 		for _, chunk := range xslices.Chunk(flagArgs, db.ChunkLimit) {
 			createFlagsQuery := fmt.Sprintf("INSERT INTO %v (`%v`, `%v`) VALUES %v",
 				v1.MessageFlagsTableName,
@@ -424,6 +488,18 @@ func (w writeOps) CreateMessageAndAddToMailbox(ctx context.Context, mbox imap.In
 		return 0, imap.FlagSet{}, err
 	}
 
+	if req.HeaderFields != nil {
+		if err := w.StoreMessageHeaderFields(ctx, req.InternalID, req.HeaderFields); err != nil {
+			return 0, imap.FlagSet{}, err
+		}
+	}
+
+	if req.LiteralHash != nil {
+		if err := w.StoreMessageLiteralHash(ctx, req.InternalID, req.LiteralHash); err != nil {
+			return 0, imap.FlagSet{}, err
+		}
+	}
+
 	if req.Message.Flags.Len() != 0 {
 		createFlagsQuery := fmt.Sprintf("INSERT INTO %v (`%v`, `%v`) VALUES %v",
 			v1.MessageFlagsTableName,
@@ -528,7 +604,7 @@ func (w writeOps) DeleteMessages(ctx context.Context, ids []imap.InternalMessage
 
 func (w writeOps) UpdateRemoteMessageID(ctx context.Context, internalID imap.InternalMessageID, remoteID imap.MessageID) error {
 	query := fmt.Sprintf("UPDATE %v SET `%v` = ? WHERE `%v` = ?",
-		v1.MessagesFieldID,
+		v1.MessagesTableName,
 		v1.MessagesFieldRemoteID,
 		v1.MessagesFieldID,
 	)
@@ -580,25 +656,18 @@ func (w writeOps) SetFlagsOnMessages(ctx context.Context, ids []imap.InternalMes
 	// GODT-2522: can silently ignore duplicates with INSERT OR IGNORE INTO ... if constraint exists.
 	flagSlice := flags.ToSliceUnsorted()
 
-	flagsSQLIn := utils.GenSQLIn(len(flagSlice))
-
 	for _, chunk := range xslices.Chunk(ids, db.ChunkLimit/2) {
-		deleteQuery := fmt.Sprintf("DELETE FROM %v WHERE `%v` IN (%v) AND `%v` NOT IN(%v)",
+		deleteQuery := fmt.Sprintf("DELETE FROM %v WHERE `%v` IN (%v)",
 			v1.MessageFlagsTableName,
 			v1.MessageFlagsFieldMessageID,
 			utils.GenSQLIn(len(chunk)),
-			v1.MessageFlagsFieldValue,
-			flagsSQLIn,
 		)
 
-		insertQuery := fmt.Sprintf("INSERT OR IGNORE INTO %v (`%v`, `%v`) VALUES %v",
-			v1.MessageFlagsTableName,
-			v1.MessageFlagsFieldMessageID,
-			v1.MessageFlagsFieldValue,
-			strings.Join(xslices.Repeat("(?,?)", len(flagSlice)), ","),
-		)
+		if len(flagSlice) != 0 {
+			deleteQuery += fmt.Sprintf(" AND `%v` NOT IN(%v)", v1.MessageFlagsFieldValue, utils.GenSQLIn(len(flagSlice)))
+		}
 
-		deleteArgs := make([]any, 0, len(ids)+len(flagSlice))
+		deleteArgs := make([]any, 0, len(chunk)+len(flagSlice))
 		deleteArgs = append(deleteArgs, utils.MapSliceToAny(chunk)...)
 		deleteArgs = append(deleteArgs, utils.MapSliceToAny(flagSlice)...)
 
@@ -606,6 +675,17 @@ func (w writeOps) SetFlagsOnMessages(ctx context.Context, ids []imap.InternalMes
 			return err
 		}
 
+		if len(flagSlice) == 0 {
+			continue
+		}
+
+		insertQuery := fmt.Sprintf("INSERT OR IGNORE INTO %v (`%v`, `%v`) VALUES %v",
+			v1.MessageFlagsTableName,
+			v1.MessageFlagsFieldMessageID,
+			v1.MessageFlagsFieldValue,
+			strings.Join(xslices.Repeat("(?,?)", len(flagSlice)*len(chunk)), ","),
+		)
+
 		insertArgs := make([]any, 0, len(flagSlice)*2*len(chunk))
 
 		for _, id := range chunk {
@@ -670,6 +750,18 @@ func (w writeOps) StoreConnectorSettings(ctx context.Context, settings string) e
 	return err
 }
 
+func (w writeOps) StoreSieveScript(ctx context.Context, script string) error {
+	query := fmt.Sprintf("UPDATE `%v` SET `%v`=? WHERE `%v`=?",
+		v4.SieveScriptTableName,
+		v4.SieveScriptFieldValue,
+		v4.SieveScriptFieldID,
+	)
+
+	_, err := utils.ExecQuery(ctx, w.qw, query, script, v4.SieveScriptDefaultID)
+
+	return err
+}
+
 func (w writeOps) AddFlagsToAllMailboxes(ctx context.Context, flags ...string) error {
 	flagsJoined := strings.Join(xslices.Map(flags, func(s string) string {
 		return "('" + s + "')"
@@ -709,3 +801,48 @@ func (w writeOps) AddPermFlagsToAllMailboxes(ctx context.Context, flags ...strin
 
 	return err
 }
+
+func (w writeOps) StoreMessageHeaderFields(ctx context.Context, id imap.InternalMessageID, fields *db.MessageHeaderFields) error {
+	query := fmt.Sprintf("INSERT OR REPLACE INTO %v (`%v`, `%v`, `%v`, `%v`, `%v`, `%v`, `%v`, `%v`) VALUES (?,?,?,?,?,?,?,?)",
+		v6.MessageHeadersTableName,
+		v6.MessageHeadersFieldMessageID,
+		v6.MessageHeadersFieldFrom,
+		v6.MessageHeadersFieldTo,
+		v6.MessageHeadersFieldCc,
+		v6.MessageHeadersFieldBcc,
+		v6.MessageHeadersFieldSubject,
+		v6.MessageHeadersFieldSentDate,
+		v6.MessageHeadersFieldMessageIDHeader,
+	)
+
+	var sentDate sql.NullTime
+
+	if !fields.SentDate.IsZero() {
+		sentDate = sql.NullTime{Time: fields.SentDate, Valid: true}
+	}
+
+	_, err := utils.ExecQuery(ctx, w.qw, query,
+		id,
+		fields.From,
+		fields.To,
+		fields.Cc,
+		fields.Bcc,
+		fields.Subject,
+		sentDate,
+		fields.MessageID,
+	)
+
+	return err
+}
+
+func (w writeOps) StoreMessageLiteralHash(ctx context.Context, id imap.InternalMessageID, hash []byte) error {
+	query := fmt.Sprintf("INSERT OR REPLACE INTO %v (`%v`, `%v`) VALUES (?,?)",
+		v9.MessageLiteralHashesTableName,
+		v9.MessageLiteralHashesFieldMessageID,
+		v9.MessageLiteralHashesFieldHash,
+	)
+
+	_, err := utils.ExecQuery(ctx, w.qw, query, id, hash)
+
+	return err
+}
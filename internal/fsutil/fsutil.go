@@ -0,0 +1,51 @@
+// Package fsutil writes files so that they survive a crash or power loss once the write returns.
+package fsutil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// WriteFile replaces the file at path with data. The data is written to a temporary file next to it first, which is
+// synced and then renamed over path, so a crash leaves either the old or the new contents behind.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	tmpPath := path + ".tmp"
+
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		return errors.Join(err, f.Close())
+	}
+
+	if err := f.Sync(); err != nil {
+		return errors.Join(err, f.Close())
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	return SyncDir(filepath.Dir(path))
+}
+
+// SyncFile flushes the contents of the file at path to disk.
+func SyncFile(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		return errors.Join(err, f.Close())
+	}
+
+	return f.Close()
+}
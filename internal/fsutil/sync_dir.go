@@ -0,0 +1,23 @@
+//go:build !windows
+
+package fsutil
+
+import (
+	"errors"
+	"os"
+)
+
+// SyncDir flushes the entries of the directory at path to disk, so that files created, renamed or removed in it
+// stay that way after a crash.
+func SyncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	if err := dir.Sync(); err != nil {
+		return errors.Join(err, dir.Close())
+	}
+
+	return dir.Close()
+}
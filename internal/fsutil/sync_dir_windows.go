@@ -0,0 +1,8 @@
+//go:build windows
+
+package fsutil
+
+// SyncDir does nothing on Windows, where directories can't be opened to be synced.
+func SyncDir(string) error {
+	return nil
+}
@@ -1,7 +1,12 @@
 package response
 
+import (
+	"fmt"
+)
+
 type bye struct {
-	msg string
+	msg   string
+	items []Item
 }
 
 func Bye() *bye {
@@ -13,6 +18,11 @@ func (r *bye) WithMessage(msg string) *bye {
 	return r
 }
 
+func (r *bye) WithItems(items ...Item) *bye {
+	r.items = append(r.items, items...)
+	return r
+}
+
 func (r *bye) Send(s Session) error {
 	return s.WriteResponse(r.String())
 }
@@ -20,6 +30,16 @@ func (r *bye) Send(s Session) error {
 func (r *bye) String() string {
 	parts := []string{"*", "BYE"}
 
+	if len(r.items) > 0 {
+		var items []string
+
+		for _, item := range r.items {
+			items = append(items, item.String())
+		}
+
+		parts = append(parts, fmt.Sprintf("[%v]", join(items)))
+	}
+
 	if r.msg != "" {
 		parts = append(parts, r.msg)
 	}
@@ -38,3 +58,9 @@ func (r *bye) WithInconsistentState() *bye {
 
 	return r
 }
+
+func (r *bye) WithAutoLogout() *bye {
+	r.msg = "Autologout; idle for too long."
+
+	return r
+}
@@ -13,3 +13,7 @@ func TestBye(t *testing.T) {
 func TestByeMessage(t *testing.T) {
 	assert.Equal(t, "* BYE message", Bye().WithMessage("message").String())
 }
+
+func TestByeUnavailable(t *testing.T) {
+	assert.Equal(t, "* BYE [UNAVAILABLE] message", Bye().WithItems(ItemUnavailable()).WithMessage("message").String())
+}
@@ -1,14 +1,27 @@
 package response
 
-import "strings"
+import (
+	"encoding/base64"
+	"strings"
+)
 
 type continuation struct {
-	tag string
+	tag  string
+	text string
 }
 
 func Continuation() *continuation {
 	return &continuation{
-		tag: "+",
+		tag:  "+",
+		text: "Ready",
+	}
+}
+
+// Challenge returns a continuation request carrying the given SASL challenge, which may be empty.
+func Challenge(challenge []byte) *continuation {
+	return &continuation{
+		tag:  "+",
+		text: base64.StdEncoding.EncodeToString(challenge),
 	}
 }
 
@@ -17,5 +30,5 @@ func (r *continuation) Send(s Session) error {
 }
 
 func (r *continuation) String() string {
-	return strings.Join([]string{r.tag, "Ready"}, " ")
+	return strings.Join([]string{r.tag, r.text}, " ")
 }
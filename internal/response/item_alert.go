@@ -0,0 +1,11 @@
+package response
+
+type itemAlert struct{}
+
+func ItemAlert() *itemAlert {
+	return &itemAlert{}
+}
+
+func (c *itemAlert) String() string {
+	return "ALERT"
+}
@@ -0,0 +1,11 @@
+package response
+
+type itemLimit struct{}
+
+func ItemLimit() *itemLimit {
+	return &itemLimit{}
+}
+
+func (c *itemLimit) String() string {
+	return "LIMIT"
+}
@@ -0,0 +1,11 @@
+package response
+
+type itemPrivacyRequired struct{}
+
+func ItemPrivacyRequired() *itemPrivacyRequired {
+	return &itemPrivacyRequired{}
+}
+
+func (c *itemPrivacyRequired) String() string {
+	return "PRIVACYREQUIRED"
+}
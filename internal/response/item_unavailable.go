@@ -0,0 +1,11 @@
+package response
+
+type itemUnavailable struct{}
+
+func ItemUnavailable() *itemUnavailable {
+	return &itemUnavailable{}
+}
+
+func (c *itemUnavailable) String() string {
+	return "UNAVAILABLE"
+}
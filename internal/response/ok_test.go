@@ -34,3 +34,7 @@ func TestOkUIDValidity(t *testing.T) {
 func TestOkReadOnly(t *testing.T) {
 	assert.Equal(t, `* OK [READ-ONLY]`, Ok().WithItems(ItemReadOnly()).String())
 }
+
+func TestOkAlert(t *testing.T) {
+	assert.Equal(t, `* OK [ALERT] message`, Ok().WithItems(ItemAlert()).WithMessage("message").String())
+}
@@ -0,0 +1,442 @@
+// Package search implements a persistent full-text index of the messages of a user, used to answer BODY and TEXT
+// searches without reading every message from the store.
+package search
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/internal/fsutil"
+	"github.com/ProtonMail/gluon/store"
+	"github.com/sirupsen/logrus"
+)
+
+// indexVersion is incremented whenever the tokenization changes, so that indexes written with an older one are
+// discarded and rebuilt.
+const indexVersion = 2
+
+// Index is an inverted index mapping the tokens of messages to the messages containing them.
+// It is kept in memory and persisted, encrypted, to a single file.
+type Index struct {
+	path string
+	gcm  cipher.AEAD
+
+	// postings maps each token to the messages containing it and the fields it was found in.
+	postings map[string]map[imap.InternalMessageID]Field
+
+	// messages maps each indexed message to its tokens, so that it can be removed from the postings.
+	messages map[imap.InternalMessageID]map[string]Field
+
+	// partial maps the indexed messages which had tokens too long to be indexed to the fields they were found in.
+	partial map[imap.InternalMessageID]Field
+
+	// vocab holds the indexed tokens sorted for lookups; it is built on demand and reset when the tokens change.
+	vocab     *vocabulary
+	vocabLock sync.Mutex
+
+	dirty bool
+	lock  sync.RWMutex
+}
+
+// indexFile is the persisted form of an index; the postings are rebuilt from the messages when it is loaded.
+type indexFile struct {
+	Version  int
+	Messages map[imap.InternalMessageID]map[string]Field
+	Partial  map[imap.InternalMessageID]Field
+}
+
+// Open loads the index stored at the given path, encrypted with the given passphrase.
+// If there is no index yet, or it can't be read, an empty index is returned.
+func Open(path string, passphrase []byte) (*Index, error) {
+	gcm, err := store.NewCipher(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	index := &Index{
+		path:     path,
+		gcm:      gcm,
+		postings: make(map[string]map[imap.InternalMessageID]Field),
+		messages: make(map[imap.InternalMessageID]map[string]Field),
+		partial:  make(map[imap.InternalMessageID]Field),
+	}
+
+	file, err := index.load()
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			logrus.WithError(err).WithField("path", path).Warn("Failed to load search index, it will be rebuilt")
+		}
+
+		return index, nil
+	}
+
+	for messageID, tokens := range file.Messages {
+		index.insert(messageID, tokens, file.Partial[messageID])
+	}
+
+	return index, nil
+}
+
+// Add indexes the given message. A message which is already indexed is indexed again.
+func (index *Index) Add(messageID imap.InternalMessageID, literal []byte) {
+	header, body := extract(literal)
+
+	tokens := make(map[string]Field)
+
+	var partial Field
+
+	for _, token := range header {
+		if len(token) <= maxTokenLength {
+			tokens[token] |= FieldHeader
+		} else {
+			partial |= FieldHeader
+		}
+	}
+
+	for _, token := range body {
+		if len(token) <= maxTokenLength {
+			tokens[token] |= FieldBody
+		} else {
+			partial |= FieldBody
+		}
+	}
+
+	index.lock.Lock()
+	defer index.lock.Unlock()
+
+	index.remove(messageID)
+	index.insert(messageID, tokens, partial)
+
+	index.dirty = true
+}
+
+// Remove removes the given messages from the index.
+func (index *Index) Remove(messageIDs ...imap.InternalMessageID) {
+	index.lock.Lock()
+	defer index.lock.Unlock()
+
+	for _, messageID := range messageIDs {
+		if index.remove(messageID) {
+			index.dirty = true
+		}
+	}
+}
+
+// Reset removes all messages from the index.
+func (index *Index) Reset() {
+	index.lock.Lock()
+	defer index.lock.Unlock()
+
+	index.postings = make(map[string]map[imap.InternalMessageID]Field)
+	index.messages = make(map[imap.InternalMessageID]map[string]Field)
+	index.partial = make(map[imap.InternalMessageID]Field)
+	index.vocab = nil
+	index.dirty = true
+}
+
+// Has returns whether the given message is indexed.
+func (index *Index) Has(messageID imap.InternalMessageID) bool {
+	index.lock.RLock()
+	defer index.lock.RUnlock()
+
+	_, ok := index.messages[messageID]
+
+	return ok
+}
+
+// IDs returns the IDs of the indexed messages.
+func (index *Index) IDs() []imap.InternalMessageID {
+	index.lock.RLock()
+	defer index.lock.RUnlock()
+
+	ids := make([]imap.InternalMessageID, 0, len(index.messages))
+
+	for messageID := range index.messages {
+		ids = append(ids, messageID)
+	}
+
+	return ids
+}
+
+// Lookup finds the messages which may contain the given key in the given fields.
+// It returns false if the key can't be looked up in the index, e.g. because it contains no words,
+// in which case the messages must be searched without it.
+func (index *Index) Lookup(key string, fields Field) (*Result, bool) {
+	q, ok := newQuery(key)
+	if !ok {
+		return nil, false
+	}
+
+	index.lock.RLock()
+	defer index.lock.RUnlock()
+
+	vocab := index.vocabulary()
+
+	var candidates map[imap.InternalMessageID]struct{}
+
+	for i := range q.tokens {
+		found := make(map[imap.InternalMessageID]struct{})
+
+		vocab.each(q, i, func(word string) {
+			for messageID, field := range index.postings[word] {
+				if field&fields == 0 {
+					continue
+				}
+
+				if _, ok := candidates[messageID]; candidates == nil || ok {
+					found[messageID] = struct{}{}
+				}
+			}
+		})
+
+		candidates = found
+	}
+
+	indexed := make(map[imap.InternalMessageID]struct{}, len(index.messages))
+
+	for messageID := range index.messages {
+		indexed[messageID] = struct{}{}
+	}
+
+	partial := make(map[imap.InternalMessageID]struct{})
+
+	for messageID, field := range index.partial {
+		if field&fields != 0 {
+			partial[messageID] = struct{}{}
+		}
+	}
+
+	return &Result{
+		query:      q,
+		fields:     fields,
+		indexed:    indexed,
+		partial:    partial,
+		candidates: candidates,
+	}, true
+}
+
+// Save writes the index to disk if it changed since it was loaded or last saved.
+func (index *Index) Save() error {
+	index.lock.Lock()
+	defer index.lock.Unlock()
+
+	if !index.dirty {
+		return nil
+	}
+
+	var buf bytes.Buffer
+
+	file := indexFile{Version: indexVersion, Messages: index.messages, Partial: index.partial}
+
+	if err := gob.NewEncoder(&buf).Encode(file); err != nil {
+		return fmt.Errorf("failed to encode search index: %w", err)
+	}
+
+	nonce := make([]byte, index.gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(index.path), 0o700); err != nil {
+		return err
+	}
+
+	if err := fsutil.WriteFile(index.path, index.gcm.Seal(nonce, nonce, buf.Bytes(), nil), 0o600); err != nil {
+		return err
+	}
+
+	index.dirty = false
+
+	return nil
+}
+
+// SetPassphrase encrypts the index with the given passphrase from now on, and saves it with it.
+func (index *Index) SetPassphrase(passphrase []byte) error {
+	gcm, err := store.NewCipher(passphrase)
+	if err != nil {
+		return err
+	}
+
+	index.lock.Lock()
+	index.gcm = gcm
+	index.dirty = true
+	index.lock.Unlock()
+
+	return index.Save()
+}
+
+// Delete removes the index stored at the given path.
+func Delete(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func (index *Index) load() (indexFile, error) {
+	b, err := os.ReadFile(index.path)
+	if err != nil {
+		return indexFile{}, err
+	}
+
+	nonceSize := index.gcm.NonceSize()
+	if len(b) < nonceSize {
+		return indexFile{}, fmt.Errorf("search index is truncated")
+	}
+
+	plaintext, err := index.gcm.Open(nil, b[:nonceSize], b[nonceSize:], nil)
+	if err != nil {
+		return indexFile{}, fmt.Errorf("failed to decrypt search index: %w", err)
+	}
+
+	var file indexFile
+
+	if err := gob.NewDecoder(bytes.NewReader(plaintext)).Decode(&file); err != nil {
+		return indexFile{}, fmt.Errorf("failed to decode search index: %w", err)
+	}
+
+	if file.Version != indexVersion {
+		return indexFile{}, fmt.Errorf("search index has version %v, expected %v", file.Version, indexVersion)
+	}
+
+	return file, nil
+}
+
+func (index *Index) insert(messageID imap.InternalMessageID, tokens map[string]Field, partial Field) {
+	for token, field := range tokens {
+		postings, ok := index.postings[token]
+		if !ok {
+			postings = make(map[imap.InternalMessageID]Field)
+			index.postings[token] = postings
+			index.vocab = nil
+		}
+
+		postings[messageID] = field
+	}
+
+	index.messages[messageID] = tokens
+
+	if partial != 0 {
+		index.partial[messageID] = partial
+	}
+}
+
+func (index *Index) remove(messageID imap.InternalMessageID) bool {
+	tokens, ok := index.messages[messageID]
+	if !ok {
+		return false
+	}
+
+	for token := range tokens {
+		delete(index.postings[token], messageID)
+
+		if len(index.postings[token]) == 0 {
+			delete(index.postings, token)
+			index.vocab = nil
+		}
+	}
+
+	delete(index.messages, messageID)
+	delete(index.partial, messageID)
+
+	return true
+}
+
+// vocabulary returns the indexed tokens sorted for lookups, building them if they changed.
+// The caller must hold the index's read lock.
+func (index *Index) vocabulary() *vocabulary {
+	index.vocabLock.Lock()
+	defer index.vocabLock.Unlock()
+
+	if index.vocab == nil {
+		index.vocab = newVocabulary(index.postings)
+	}
+
+	return index.vocab
+}
+
+// Result holds the messages which may match a key looked up in the index.
+type Result struct {
+	query  query
+	fields Field
+
+	// indexed holds the messages which were indexed at the time of the lookup.
+	indexed map[imap.InternalMessageID]struct{}
+
+	// partial holds the indexed messages with tokens in the looked up fields which were too long to be indexed.
+	partial map[imap.InternalMessageID]struct{}
+
+	// candidates holds the indexed messages which contain every word of the key.
+	candidates map[imap.InternalMessageID]struct{}
+}
+
+// Indexed returns whether the given message was indexed when the lookup was made.
+// Messages which weren't must be searched without the index.
+func (res *Result) Indexed(messageID imap.InternalMessageID) bool {
+	_, ok := res.indexed[messageID]
+	return ok
+}
+
+// Complete returns whether every token of the looked up fields of the given indexed message was indexed.
+// Messages which weren't completely indexed may match the key without being candidates, and must be checked with
+// Match instead.
+func (res *Result) Complete(messageID imap.InternalMessageID) bool {
+	_, ok := res.partial[messageID]
+	return !ok
+}
+
+// Candidate returns whether the given completely indexed message may match the key.
+// Messages which aren't candidates don't match.
+func (res *Result) Candidate(messageID imap.InternalMessageID) bool {
+	_, ok := res.candidates[messageID]
+	return ok
+}
+
+// Exact returns whether every candidate matches the key, without checking the message itself with Match.
+// It doesn't apply to messages which weren't completely indexed.
+func (res *Result) Exact() bool {
+	return res.query.isWord()
+}
+
+// Match returns whether the given message literal matches the key, using the same normalization as the index.
+func (res *Result) Match(literal []byte) bool {
+	header, body := extract(literal)
+
+	if res.fields&FieldHeader != 0 && res.query.matches(header) {
+		return true
+	}
+
+	return res.fields&FieldBody != 0 && res.query.matches(body)
+}
+
+// Matches returns whether the given message matches the key. Completely indexed messages are answered from the index
+// where it can; every other message, indexed or not, is loaded and checked with Match, so that a message matches the
+// same keys whether or not it was indexed yet.
+func (res *Result) Matches(messageID imap.InternalMessageID, load func() ([]byte, error)) (bool, error) {
+	if res.Indexed(messageID) && res.Complete(messageID) {
+		if !res.Candidate(messageID) {
+			return false, nil
+		}
+
+		if res.Exact() {
+			return true, nil
+		}
+	}
+
+	literal, err := load()
+	if err != nil {
+		return false, err
+	}
+
+	return res.Match(literal), nil
+}
@@ -0,0 +1,212 @@
+package search
+
+import (
+	"encoding/base64"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/maps"
+)
+
+func TestTokenize(t *testing.T) {
+	require.Equal(t, []string{"hello", "world", "42"}, Tokenize("Hello, WORLD! 42"))
+	require.Equal(t, []string{"café"}, Tokenize("CAFÉ"))
+
+	// Compatibility forms are normalized.
+	require.Equal(t, []string{"fi", "1"}, Tokenize("ﬁ ①"))
+}
+
+func TestIndexLookup(t *testing.T) {
+	index, err := Open(filepath.Join(t.TempDir(), "index"), []byte("pass"))
+	require.NoError(t, err)
+
+	id1, id2 := imap.NewInternalMessageID(), imap.NewInternalMessageID()
+
+	index.Add(id1, []byte("Subject: greetings\r\n\r\nhello big world"))
+	index.Add(id2, []byte("Subject: farewell\r\n\r\nworld of hellos"))
+
+	lookup := func(key string, fields Field) []imap.InternalMessageID {
+		res, ok := index.Lookup(key, fields)
+		require.True(t, ok)
+
+		var ids []imap.InternalMessageID
+
+		for _, id := range []imap.InternalMessageID{id1, id2} {
+			if res.Candidate(id) {
+				ids = append(ids, id)
+			}
+		}
+
+		return ids
+	}
+
+	require.ElementsMatch(t, []imap.InternalMessageID{id1, id2}, lookup("ell", FieldBody))
+	require.ElementsMatch(t, []imap.InternalMessageID{id1}, lookup("big wor", FieldBody))
+	require.ElementsMatch(t, []imap.InternalMessageID{id2}, lookup("farewell", FieldHeader))
+	require.Empty(t, lookup("farewell", FieldBody))
+
+	index.Remove(id1)
+
+	require.ElementsMatch(t, []imap.InternalMessageID{id2}, lookup("ell", FieldBody))
+
+	_, ok := index.Lookup("!!", FieldAll)
+	require.False(t, ok)
+}
+
+func TestResultMatch(t *testing.T) {
+	index, err := Open(filepath.Join(t.TempDir(), "index"), []byte("pass"))
+	require.NoError(t, err)
+
+	literal := []byte("Subject: x\r\n\r\nhello big world")
+
+	for key, want := range map[string]bool{
+		"big world": true,
+		"o big w":   true,
+		"world big": false,
+		" ig world": false,
+		"hello big": true,
+	} {
+		res, ok := index.Lookup(key, FieldBody)
+		require.True(t, ok)
+		require.Equal(t, want, res.Match(literal), key)
+	}
+}
+
+func TestResultMatchesBeforeAndAfterIndexing(t *testing.T) {
+	index, err := Open(filepath.Join(t.TempDir(), "index"), []byte("pass"))
+	require.NoError(t, err)
+
+	body := base64.StdEncoding.EncodeToString([]byte("Hello, big world"))
+	literal := []byte("Subject: x\r\nContent-Type: text/plain\r\nContent-Transfer-Encoding: base64\r\n\r\n" + body)
+
+	id := imap.NewInternalMessageID()
+
+	load := func() ([]byte, error) { return literal, nil }
+
+	keys := map[string]bool{
+		"big world":  true,
+		"o, BIG w":   true,
+		"world big":  false,
+		body[:8]:     false,
+		"plain":      false,
+		"hello-big":  true,
+		"hello bigs": false,
+	}
+
+	search := func() map[string]bool {
+		got := make(map[string]bool)
+
+		for key := range keys {
+			res, ok := index.Lookup(key, FieldBody)
+			require.True(t, ok)
+
+			matches, err := res.Matches(id, load)
+			require.NoError(t, err)
+
+			got[key] = matches
+		}
+
+		return got
+	}
+
+	require.Equal(t, keys, search())
+
+	index.Add(id, literal)
+
+	require.Equal(t, keys, search())
+}
+
+func TestIndexPersisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index")
+
+	index, err := Open(path, []byte("pass"))
+	require.NoError(t, err)
+
+	id := imap.NewInternalMessageID()
+
+	index.Add(id, []byte("Subject: x\r\n\r\nhello"))
+	require.NoError(t, index.Save())
+
+	loaded, err := Open(path, []byte("pass"))
+	require.NoError(t, err)
+	require.True(t, loaded.Has(id))
+
+	res, ok := loaded.Lookup("hello", FieldBody)
+	require.True(t, ok)
+	require.True(t, res.Candidate(id))
+
+	// An index which can't be decrypted is discarded.
+	other, err := Open(path, []byte("other"))
+	require.NoError(t, err)
+	require.False(t, other.Has(id))
+}
+
+func TestIndexPartHeaders(t *testing.T) {
+	index, err := Open(filepath.Join(t.TempDir(), "index"), []byte("pass"))
+	require.NoError(t, err)
+
+	id := imap.NewInternalMessageID()
+
+	index.Add(id, []byte(
+		"Content-Type: multipart/mixed; boundary=b\r\n\r\n"+
+			"--b\r\nContent-Type: text/plain\r\n\r\nhello\r\n"+
+			"--b\r\nContent-Type: application/pdf\r\nContent-Disposition: attachment; filename*=utf-8''na%C3%AFve.pdf\r\n\r\nJVBERi0=\r\n"+
+			"--b--\r\n",
+	))
+
+	for _, key := range []string{"hello", "naïve", "attachment", "pdf"} {
+		res, ok := index.Lookup(key, FieldBody)
+		require.True(t, ok)
+		require.True(t, res.Complete(id), key)
+		require.True(t, res.Candidate(id), key)
+	}
+}
+
+func TestIndexLongTokens(t *testing.T) {
+	index, err := Open(filepath.Join(t.TempDir(), "index"), []byte("pass"))
+	require.NoError(t, err)
+
+	id := imap.NewInternalMessageID()
+	long := strings.Repeat("a", maxTokenLength+1)
+	literal := []byte("Subject: x\r\n\r\nhello " + long)
+
+	index.Add(id, literal)
+
+	res, ok := index.Lookup("aaa", FieldBody)
+	require.True(t, ok)
+	require.False(t, res.Complete(id))
+	require.False(t, res.Candidate(id))
+	require.True(t, res.Match(literal))
+
+	// The header had no long tokens.
+	res, ok = index.Lookup("subject", FieldHeader)
+	require.True(t, ok)
+	require.True(t, res.Complete(id))
+}
+
+func TestVocabulary(t *testing.T) {
+	postings := map[string]struct{}{"hello": {}, "hellos": {}, "shell": {}, "world": {}, "low": {}}
+	vocab := newVocabulary(postings)
+
+	each := func(key string, i int) []string {
+		q, ok := newQuery(key)
+		require.True(t, ok)
+
+		found := make(map[string]struct{})
+
+		vocab.each(q, i, func(word string) { found[word] = struct{}{} })
+
+		return maps.Keys(found)
+	}
+
+	require.ElementsMatch(t, []string{"hello", "hellos", "shell"}, each("ell", 0))
+	require.ElementsMatch(t, []string{"hello", "hellos", "low"}, each("lo", 0))
+	require.ElementsMatch(t, []string{"shell"}, each("ell world", 0))
+	require.ElementsMatch(t, []string{"world"}, each("ell world", 1))
+	require.ElementsMatch(t, []string{"hello", "hellos"}, each("x hello", 1))
+	require.ElementsMatch(t, []string{"low"}, each("x low y", 1))
+	require.Empty(t, each("x lo y", 1))
+}
@@ -0,0 +1,187 @@
+package search
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ProtonMail/gluon/rfc822"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/unicode/norm"
+)
+
+// maxTokenLength is the length in bytes above which tokens aren't indexed.
+// Longer tokens are almost always encoded data rather than words.
+const maxTokenLength = 64
+
+// Field identifies the parts of a message a token was found in.
+type Field uint8
+
+const (
+	FieldHeader Field = 1 << iota
+	FieldBody
+
+	FieldAll = FieldHeader | FieldBody
+)
+
+// Tokenize splits the given text into normalized tokens: runs of letters and digits, NFKC-normalized and lower-cased.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(norm.NFKC.String(text)), isSeparator)
+}
+
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+// extract returns the tokens of the header of the given literal and of its body, in the order in which they appear.
+// The body tokens are those of the headers of its MIME parts, including the names of attachments, and of its
+// decoded text parts.
+func extract(literal []byte) (header, body []string) {
+	root := rfc822.Parse(literal)
+
+	header = extractHeader(root)
+
+	_ = root.Walk(func(section *rfc822.Section) error {
+		if len(section.Identifier()) > 0 {
+			body = append(body, extractHeader(section)...)
+		}
+
+		mimeType, params, err := section.ContentType()
+		if err != nil || mimeType.Type() != "text" {
+			return nil
+		}
+
+		decoded, err := section.DecodedBody()
+		if err != nil {
+			decoded = section.Body()
+		}
+
+		body = append(body, Tokenize(toUTF8(decoded, params["charset"]))...)
+
+		return nil
+	})
+
+	return header, body
+}
+
+// extractHeader returns the tokens of the header of the given section, with encoded words and the parameters of
+// the content type and disposition (such as attachment names) decoded.
+// A header which can't be parsed is tokenized as is.
+func extractHeader(section *rfc822.Section) []string {
+	h, err := section.ParseHeader()
+	if err != nil {
+		return Tokenize(string(section.Header()))
+	}
+
+	var tokens []string
+
+	decoder := mime.WordDecoder{CharsetReader: charsetReader}
+
+	h.Entries(func(key, val string) {
+		if decoded, err := decoder.DecodeHeader(val); err == nil {
+			val = decoded
+		}
+
+		tokens = append(tokens, Tokenize(key)...)
+		tokens = append(tokens, Tokenize(val)...)
+
+		if !strings.EqualFold(key, "Content-Type") && !strings.EqualFold(key, "Content-Disposition") {
+			return
+		}
+
+		if _, params, err := mime.ParseMediaType(val); err == nil {
+			for _, name := range []string{"name", "filename"} {
+				if param, ok := params[name]; ok {
+					tokens = append(tokens, Tokenize(param)...)
+				}
+			}
+		}
+	})
+
+	return tokens
+}
+
+// toUTF8 converts text in the given charset to UTF-8. Unknown charsets are assumed to already be UTF-8.
+func toUTF8(b []byte, charset string) string {
+	if charset == "" {
+		return string(b)
+	}
+
+	enc, err := ianaindex.MIME.Encoding(charset)
+	if err != nil || enc == nil {
+		return string(b)
+	}
+
+	decoded, err := enc.NewDecoder().Bytes(b)
+	if err != nil {
+		return string(b)
+	}
+
+	return string(decoded)
+}
+
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	b, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader([]byte(toUTF8(b, charset))), nil
+}
+
+// query is a search key as matched against the index.
+type query struct {
+	tokens []string
+
+	// leading and trailing are true if the key starts or ends with a separator,
+	// in which case its first or last token must be a whole word.
+	leading, trailing bool
+}
+
+func newQuery(key string) (query, bool) {
+	normalized := strings.ToLower(norm.NFKC.String(key))
+
+	tokens := strings.FieldsFunc(normalized, isSeparator)
+	if len(tokens) == 0 {
+		return query{}, false
+	}
+
+	for _, token := range tokens {
+		if len(token) > maxTokenLength {
+			return query{}, false
+		}
+	}
+
+	first, _ := utf8.DecodeRuneInString(normalized)
+	last, _ := utf8.DecodeLastRuneInString(normalized)
+
+	return query{
+		tokens:   tokens,
+		leading:  isSeparator(first),
+		trailing: isSeparator(last),
+	}, true
+}
+
+// isWord returns true if the query is a single token without separators,
+// in which case any word containing it is a match.
+func (q query) isWord() bool {
+	return len(q.tokens) == 1 && !q.leading && !q.trailing
+}
+
+// matches returns whether the query appears in the given token sequence.
+func (q query) matches(tokens []string) bool {
+	pattern := strings.Join(q.tokens, " ")
+
+	if q.leading {
+		pattern = " " + pattern
+	}
+
+	if q.trailing {
+		pattern += " "
+	}
+
+	return strings.Contains(" "+strings.Join(tokens, " ")+" ", pattern)
+}
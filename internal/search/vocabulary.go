@@ -0,0 +1,127 @@
+package search
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// vocabulary holds the tokens of an index sorted, so that the tokens which can contain a query token are found
+// without walking every token of the index.
+//
+// Tokens are found by their suffixes with a suffix array: the tokens are concatenated into a single buffer, each
+// followed by a zero byte, and the offset of every character of every token is kept sorted by the rest of the token
+// from there. Besides the sorted tokens, which share their strings with the postings, it takes one byte per byte of
+// token plus a separator, and four bytes per character and per token, i.e. about six bytes per byte of indexed text.
+type vocabulary struct {
+	// words holds the indexed tokens, sorted.
+	words []string
+
+	// buf holds the sorted tokens, each followed by a zero byte.
+	buf []byte
+
+	// starts holds the offset in buf of each token of words.
+	starts []int32
+
+	// suffixes holds the offset in buf of every character of every token, sorted by the suffix of the token starting
+	// there.
+	suffixes []int32
+}
+
+func newVocabulary[T any](postings map[string]T) *vocabulary {
+	words := make([]string, 0, len(postings))
+
+	var size, chars int
+
+	for word := range postings {
+		words = append(words, word)
+		size += len(word) + 1
+		chars += utf8.RuneCountInString(word)
+	}
+
+	sort.Strings(words)
+
+	vocab := &vocabulary{
+		words:    words,
+		buf:      make([]byte, 0, size),
+		starts:   make([]int32, 0, len(words)),
+		suffixes: make([]int32, 0, chars),
+	}
+
+	for _, word := range words {
+		start := len(vocab.buf)
+
+		vocab.starts = append(vocab.starts, int32(start))
+
+		for i := range word {
+			vocab.suffixes = append(vocab.suffixes, int32(start+i))
+		}
+
+		vocab.buf = append(vocab.buf, word...)
+		vocab.buf = append(vocab.buf, 0)
+	}
+
+	sort.Slice(vocab.suffixes, func(i, j int) bool {
+		return bytes.Compare(vocab.suffix(i), vocab.suffix(j)) < 0
+	})
+
+	return vocab
+}
+
+// each calls fn with every indexed token which can contain the i-th token of the given query: any token containing
+// it if it's the query's only token, one ending with it if it's the first, one starting with it if it's the last,
+// and only the token itself otherwise. A token may be passed more than once.
+func (vocab *vocabulary) each(q query, i int, fn func(word string)) {
+	token := q.tokens[i]
+
+	first := i == 0 && !q.leading
+	last := i == len(q.tokens)-1 && !q.trailing
+
+	switch {
+	case first && last:
+		// Tokens containing the query token have a suffix starting with it.
+		for j := vocab.searchSuffixes(token); j < len(vocab.suffixes) && bytes.HasPrefix(vocab.suffix(j), []byte(token)); j++ {
+			fn(vocab.word(j))
+		}
+
+	case first:
+		for j := vocab.searchSuffixes(token); j < len(vocab.suffixes) && string(vocab.suffix(j)) == token; j++ {
+			fn(vocab.word(j))
+		}
+
+	case last:
+		for j := sort.SearchStrings(vocab.words, token); j < len(vocab.words) && strings.HasPrefix(vocab.words[j], token); j++ {
+			fn(vocab.words[j])
+		}
+
+	default:
+		if j := sort.SearchStrings(vocab.words, token); j < len(vocab.words) && vocab.words[j] == token {
+			fn(token)
+		}
+	}
+}
+
+func (vocab *vocabulary) searchSuffixes(token string) int {
+	return sort.Search(len(vocab.suffixes), func(j int) bool {
+		return string(vocab.suffix(j)) >= token
+	})
+}
+
+// suffix returns the j-th suffix of the suffix array, up to the end of its token.
+func (vocab *vocabulary) suffix(j int) []byte {
+	rest := vocab.buf[vocab.suffixes[j]:]
+
+	return rest[:bytes.IndexByte(rest, 0)]
+}
+
+// word returns the token the j-th suffix of the suffix array belongs to.
+func (vocab *vocabulary) word(j int) string {
+	offset := vocab.suffixes[j]
+
+	k := sort.Search(len(vocab.starts), func(k int) bool {
+		return vocab.starts[k] > offset
+	})
+
+	return vocab.words[k-1]
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"strings"
 
 	"github.com/ProtonMail/gluon/async"
 	"github.com/ProtonMail/gluon/imap/command"
@@ -17,6 +18,9 @@ import (
 type commandResult struct {
 	command command.Command
 	err     error
+
+	// literal indicates whether the command had literals, which made it count as receiving literals.
+	literal bool
 }
 
 func (s *Session) startCommandReader(ctx context.Context) <-chan commandResult {
@@ -33,13 +37,24 @@ func (s *Session) startCommandReader(ctx context.Context) <-chan commandResult {
 			{0x16, 0x00, 0x00}, // 0.0
 		}
 
-		parser := command.NewParserWithLiteralContinuationCb(s.scanner, func() error { return response.Continuation().Send(s) })
+		var literal bool
+
+		parser := command.NewParserWithLiteralContinuationCb(s.scanner, func() error {
+			if !literal {
+				literal = true
+				s.receivingLiterals.Add(1)
+			}
+
+			return response.Continuation().Send(s)
+		})
 
 		for {
 			s.inputCollector.Reset()
+			literal = false
 
 			cmd, err := parser.Parse()
 			s.logIncoming(string(s.inputCollector.Bytes()))
+			s.traceIncoming(parser.LastParsedTag(), parser.LastParsedCommand(), string(s.inputCollector.Bytes()))
 			if err != nil {
 				var parserError *rfcparser.Error
 				if !errors.As(err, &parserError) {
@@ -70,6 +85,18 @@ func (s *Session) startCommandReader(ctx context.Context) <-chan commandResult {
 			}
 
 			switch c := cmd.Payload.(type) {
+			case *command.Authenticate:
+				// The response to the continuation request isn't a command, so it's read before the next one is parsed.
+				if c.InitialResponse == nil && strings.EqualFold(c.Mechanism, "EXTERNAL") {
+					line, readErr := s.readAuthenticateResponse()
+					if readErr != nil {
+						s.log.WithError(readErr).Error("Cannot read authentication response")
+						return
+					}
+
+					c.InitialResponse, err = command.ParseAuthenticateResponse(line)
+				}
+
 			case *command.StartTLS:
 				// TLS needs to be handled here to ensure that next command read is over the TLS connection.
 				if err = s.handleStartTLS(cmd.Tag, c); err != nil {
@@ -81,7 +108,7 @@ func (s *Session) startCommandReader(ctx context.Context) <-chan commandResult {
 			}
 
 			select {
-			case cmdCh <- commandResult{command: cmd, err: err}:
+			case cmdCh <- commandResult{command: cmd, err: err, literal: literal}:
 				// ...
 
 			case <-ctx.Done():
@@ -95,3 +122,13 @@ func (s *Session) startCommandReader(ctx context.Context) <-chan commandResult {
 
 	return cmdCh
 }
+
+// readAuthenticateResponse sends an empty SASL challenge to a client which didn't send an initial response with its
+// AUTHENTICATE command, and reads the line it responds with.
+func (s *Session) readAuthenticateResponse() ([]byte, error) {
+	if err := response.Challenge(nil).Send(s); err != nil {
+		return nil, err
+	}
+
+	return s.scanner.ConsumeUntilNewLine()
+}
@@ -0,0 +1,71 @@
+package session
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ProtonMail/gluon/events"
+	"github.com/ProtonMail/gluon/internal/response"
+)
+
+// byeWriteTimeout bounds how long a session closed by the server waits to tell the client, whose connection may be
+// gone.
+const byeWriteTimeout = 10 * time.Second
+
+// errClosed is returned by command handlers once the server closed the session.
+var errClosed = errors.New("session closed by the server")
+
+// disconnectRequest asks a session to close with the given BYE.
+type disconnectRequest struct {
+	reason events.SessionRemovedReason
+	bye    response.Response
+}
+
+// Disconnect asks the session to send the client a BYE with the given reason and close. If the session is handling a
+// command, including receiving its literals, it is closed once the command is done. Disconnect doesn't wait for the
+// session to close.
+func (s *Session) Disconnect(reason string) {
+	s.requestDisconnect(disconnectRequest{
+		reason: events.SessionDisconnected,
+		bye:    response.Bye().WithMessage(reason),
+	})
+}
+
+// Drain asks the session to close as Disconnect does because the server is going away, telling the client it may
+// reconnect later.
+func (s *Session) Drain() {
+	s.requestDisconnect(disconnectRequest{
+		reason: events.SessionDrained,
+		bye:    response.Bye().WithItems(response.ItemUnavailable()).WithMessage("Server restarting"),
+	})
+}
+
+func (s *Session) requestDisconnect(req disconnectRequest) {
+	select {
+	case s.disconnectCh <- req:
+	default:
+		// The session is already asked to disconnect.
+	}
+}
+
+// disconnected closes the session after it was asked to by Disconnect or Drain.
+func (s *Session) disconnected(req disconnectRequest) error {
+	s.log.WithField("reason", req.reason).Info("Session disconnected")
+
+	return s.closeWithBye(req.reason, req.bye)
+}
+
+// closeWithBye sends the given BYE and returns errClosed. The client isn't waited for if it doesn't read the BYE.
+func (s *Session) closeWithBye(reason events.SessionRemovedReason, bye response.Response) error {
+	s.removedReason = reason
+
+	if err := s.conn.SetWriteDeadline(time.Now().Add(byeWriteTimeout)); err != nil {
+		return err
+	}
+
+	if err := bye.Send(s); err != nil {
+		s.log.WithError(err).Debug("Failed to send BYE")
+	}
+
+	return errClosed
+}
@@ -16,10 +16,15 @@ var (
 	ErrReadOnly    = errors.New("the mailbox is read-only")
 
 	ErrTLSUnavailable       = errors.New("TLS is unavailable")
+	ErrTLSRequired          = errors.New("TLS is required to log in")
 	ErrNotAuthenticated     = errors.New("session is not authenticated")
 	ErrAlreadyAuthenticated = errors.New("session is already authenticated")
 
 	ErrNotImplemented = errors.New("not implemented")
+
+	ErrUnsupportedMechanism     = errors.New("unsupported authentication mechanism")
+	ErrNoClientCertificate      = errors.New("no client certificate")
+	ErrCertificateNotAuthorized = errors.New("client certificate doesn't log in to any user")
 )
 
 func shouldReportIMAPCommandError(err error) bool {
@@ -21,7 +21,19 @@ func (s *Session) handleOther(
 		logging.DoAnnotated(state.NewStateContext(ctx, s.state), func(ctx context.Context) {
 			defer close(resCh)
 
-			if err := s.handleCommand(ctx, tag, cmd, resCh); err != nil {
+			// Alerts are sent before the command's own responses so that the client sees them as soon as possible.
+			if s.state != nil {
+				for _, res := range s.state.PopAlerts() {
+					resCh <- res
+				}
+			}
+
+			ctx, span := s.startCommandSpan(ctx, tag, cmd)
+
+			err := s.handleCommand(ctx, tag, cmd, resCh)
+			s.endCommandSpan(span, err)
+
+			if err != nil {
 				s.log.WithError(err).WithField("cmd", cmd.SanitizedString()).Error("Command failed")
 				if res, ok := response.FromError(err); ok {
 					resCh <- res
@@ -54,7 +66,8 @@ func (s *Session) handleCommand(
 		return s.handleAnyCommand(ctx, tag, cmd, ch)
 
 	case
-		*command.Login:
+		*command.Login,
+		*command.Authenticate:
 		return s.handleNotAuthenticatedCommand(ctx, tag, cmd, ch)
 
 	case
@@ -124,6 +137,10 @@ func (s *Session) handleNotAuthenticatedCommand(
 	ch chan response.Response,
 ) error {
 	switch cmd := cmd.(type) {
+	case *command.Authenticate:
+		// 6.2.2. AUTHENTICATE Command
+		return s.handleAuthenticate(ctx, tag, cmd, ch)
+
 	case *command.Login:
 		// 6.2.3. LOGIN Command
 		return s.handleLogin(ctx, tag, cmd, ch)
@@ -0,0 +1,58 @@
+package session
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"strings"
+
+	"github.com/ProtonMail/gluon/imap/command"
+	"github.com/ProtonMail/gluon/internal/backend"
+	"github.com/ProtonMail/gluon/internal/response"
+	"github.com/ProtonMail/gluon/profiling"
+)
+
+// handleAuthenticate logs in clients with the certificate they presented during the TLS handshake (SASL EXTERNAL,
+// RFC 4422). The response is either sent with the command (RFC 4959) or after an empty challenge, which the command
+// reader sends and reads the response to. Failed logins are throttled like those with a password.
+func (s *Session) handleAuthenticate(ctx context.Context, tag string, cmd *command.Authenticate, ch chan response.Response) error {
+	profiling.Start(ctx, profiling.CmdTypeAuthenticate)
+	defer profiling.Stop(ctx, profiling.CmdTypeAuthenticate)
+
+	s.userLock.Lock()
+	defer s.userLock.Unlock()
+
+	s.capsLock.Lock()
+	defer s.capsLock.Unlock()
+
+	if s.state != nil {
+		return response.Bad(tag).WithError(ErrAlreadyAuthenticated)
+	}
+
+	if !strings.EqualFold(cmd.Mechanism, "EXTERNAL") {
+		return response.No(tag).WithError(ErrUnsupportedMechanism)
+	}
+
+	conn, ok := s.conn.(*tls.Conn)
+	if !ok || s.certAuthenticator == nil || len(conn.ConnectionState().PeerCertificates) == 0 {
+		return response.No(tag).WithError(ErrNoClientCertificate)
+	}
+
+	cert, authzID := conn.ConnectionState().PeerCertificates[0], string(cmd.InitialResponse)
+
+	username := authzID
+	if username == "" {
+		username = cert.Subject.CommonName
+	}
+
+	state, err := s.backend.GetCertificateState(ctx, s.certAuthenticator, cert, authzID, username, s.conn.RemoteAddr())
+	if errors.Is(err, backend.ErrNoSuchUser) {
+		return s.loginFailed(ctx, tag, username, response.No(tag).WithError(ErrCertificateNotAuthorized), ch)
+	} else if err != nil {
+		return s.loginFailed(ctx, tag, username, err, ch)
+	}
+
+	s.loggedIn(tag, state, ch)
+
+	return nil
+}
@@ -3,6 +3,7 @@ package session
 import (
 	"context"
 
+	"github.com/ProtonMail/gluon/imap"
 	"github.com/ProtonMail/gluon/imap/command"
 	"github.com/ProtonMail/gluon/internal/contexts"
 	"github.com/ProtonMail/gluon/internal/response"
@@ -16,7 +17,7 @@ func (s *Session) handleClose(ctx context.Context, tag string, _ *command.Close,
 
 	ctx = contexts.AsClose(ctx)
 
-	if !mailbox.ReadOnly() {
+	if !mailbox.ReadOnly() && mailbox.Permissions().Has(imap.PermExpunge) {
 		if err := mailbox.Expunge(ctx, nil); err != nil {
 			return nil, err
 		}
@@ -38,6 +38,8 @@ func (s *Session) handleCopy(ctx context.Context, tag string, cmd *command.Copy,
 		return response.Bad(tag).WithError(err), nil
 	} else if errors.Is(err, state.ErrNoSuchMailbox) {
 		return response.No(tag).WithError(err).WithItems(response.ItemTryCreate()), nil
+	} else if errors.Is(err, state.ErrPermissionDenied) {
+		return response.No(tag).WithError(err), nil
 	} else if err != nil {
 		observability.AddMessageRelatedMetric(ctx, metrics.GenerateFailedToCopyMessagesMetric())
 		return nil, err
@@ -20,6 +20,10 @@ func (s *Session) handleExamine(ctx context.Context, tag string, cmd *command.Ex
 	}
 
 	if err := s.state.Examine(ctx, nameUTF8, func(mailbox *state.Mailbox) error {
+		s.updateInfo(func(info *Info) {
+			info.Mailbox = mailbox.Name()
+		})
+
 		flags, err := mailbox.Flags(ctx)
 		if err != nil {
 			return err
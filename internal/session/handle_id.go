@@ -28,6 +28,10 @@ func (s *Session) handleIDSet(ctx context.Context, tag string, cmd *command.IDSe
 	// Update session IMAP ID.
 	s.imapID = imap.NewIMAPIDFromKeyMap(cmd.Values)
 
+	s.updateInfo(func(info *Info) {
+		info.IMAPID = s.imapID
+	})
+
 	// If logged in and a mailbox has been selected, set the IMAP ID in the state's metadata.
 	if s.state != nil {
 		s.state.SetConnMetadataKeyValue(imap.IMAPIDConnMetadataKey, s.imapID)
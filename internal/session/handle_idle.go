@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/ProtonMail/gluon/async"
+	"github.com/ProtonMail/gluon/events"
 	"github.com/ProtonMail/gluon/imap/command"
 	"github.com/ProtonMail/gluon/internal/response"
 	"github.com/ProtonMail/gluon/logging"
@@ -47,10 +48,37 @@ func (s *Session) handleIdle(ctx context.Context, tag string, _ *command.Idle, c
 			}
 		}
 
+		var timer inactivityTimer
+		defer timer.stop()
+
+		timer.reset(s.timeouts.Idle)
+
+		var keepaliveCh <-chan time.Time
+
+		if s.timeouts.IdleKeepalive > 0 {
+			keepalive := time.NewTicker(s.timeouts.IdleKeepalive)
+			defer keepalive.Stop()
+
+			keepaliveCh = keepalive.C
+		}
+
 		var cmd commandResult
 
 		for {
 			select {
+			case <-timer.C():
+				return s.timeOut(events.SessionIdleTimeout)
+
+			case req := <-s.disconnectCh:
+				return s.disconnected(req)
+
+			case <-keepaliveCh:
+				if err := response.Ok().WithMessage("Still here").Send(s); err != nil {
+					return err
+				}
+
+				continue
+
 			case res, ok := <-cmdCh:
 				if !ok {
 					return nil
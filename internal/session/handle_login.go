@@ -2,11 +2,16 @@ package session
 
 import (
 	"context"
+	"errors"
 
 	"github.com/ProtonMail/gluon/events"
 	"github.com/ProtonMail/gluon/imap"
 	"github.com/ProtonMail/gluon/imap/command"
+	"github.com/ProtonMail/gluon/internal/backend"
 	"github.com/ProtonMail/gluon/internal/response"
+	"github.com/ProtonMail/gluon/internal/state"
+	"github.com/ProtonMail/gluon/observability"
+	"github.com/ProtonMail/gluon/observability/metrics"
 	"github.com/ProtonMail/gluon/profiling"
 )
 
@@ -26,16 +31,56 @@ func (s *Session) handleLogin(ctx context.Context, tag string, cmd *command.Logi
 		return response.Bad(tag).WithError(ErrAlreadyAuthenticated)
 	}
 
-	state, err := s.backend.GetState(ctx, cmd.UserID, []byte(cmd.Password), s.sessionID)
+	if s.requireTLS && !s.isTLS() {
+		return response.No(tag).WithItems(response.ItemPrivacyRequired()).WithError(ErrTLSRequired)
+	}
+
+	state, err := s.backend.GetState(ctx, cmd.UserID, []byte(cmd.Password), s.sessionID, s.conn.RemoteAddr())
 	if err != nil {
-		s.eventCh <- events.LoginFailed{
-			SessionID: s.sessionID,
-			Username:  cmd.UserID,
-		}
+		return s.loginFailed(ctx, tag, cmd.UserID, err, ch)
+	}
 
-		return err
+	s.loggedIn(tag, state, ch)
+
+	return nil
+}
+
+// loginFailed reports a failed login with the given username and returns the response to send.
+func (s *Session) loginFailed(ctx context.Context, tag, username string, err error, ch chan response.Response) error {
+	event := events.LoginFailed{
+		SessionID:  s.sessionID,
+		Username:   username,
+		RemoteAddr: s.conn.RemoteAddr(),
+	}
+
+	if blocked := new(backend.LoginBlockedError); errors.As(err, &blocked) {
+		event.Blocked = true
+		event.Delay = blocked.Delay
+		event.Until = blocked.Until
 	}
 
+	s.eventCh <- event
+
+	// The user's connector can't reach the remote; tell the client to come back later and hang up.
+	if errors.Is(err, backend.ErrUserUnavailable) {
+		ch <- response.Bye().WithItems(response.ItemUnavailable()).WithMessage("Mail server is unavailable, please try again later")
+
+		s.disconnect = true
+
+		return nil
+	}
+
+	if errors.Is(err, backend.ErrTooManyConnections) {
+		observability.AddImapMetric(ctx, metrics.GenerateTooManyUserConnectionsMetric())
+
+		return response.No(tag).WithItems(response.ItemLimit()).WithError(err)
+	}
+
+	return err
+}
+
+// loggedIn makes the session use the state of the user it logged in to. The caller holds the user and caps locks.
+func (s *Session) loggedIn(tag string, state *state.State, ch chan response.Response) {
 	s.state = state
 
 	ch <- response.Ok(tag).WithItems(response.ItemCapability(s.caps...)).WithMessage("Logged in")
@@ -48,6 +93,4 @@ func (s *Session) handleLogin(ctx context.Context, tag string, cmd *command.Logi
 	// We set the IMAP ID extension value after login, since it's possible that the client may have sent it before.
 	// This ensures that the ID is correctly set for the connection.
 	state.SetConnMetadataKeyValue(imap.IMAPIDConnMetadataKey, s.imapID)
-
-	return nil
 }
@@ -20,7 +20,15 @@ func (s *Session) handleSelect(ctx context.Context, tag string, cmd *command.Sel
 		return err
 	}
 
+	var readOnly bool
+
 	if err := s.state.Select(ctx, nameUTF8, func(mailbox *state.Mailbox) error {
+		s.updateInfo(func(info *Info) {
+			info.Mailbox = mailbox.Name()
+		})
+
+		readOnly = mailbox.ReadOnly()
+
 		flags, err := mailbox.Flags(ctx)
 		if err != nil {
 			return err
@@ -52,7 +60,12 @@ func (s *Session) handleSelect(ctx context.Context, tag string, cmd *command.Sel
 		return err
 	}
 
-	ch <- response.Ok(tag).WithItems(response.ItemReadWrite()).WithMessage("SELECT")
+	// A mailbox whose permissions forbid any change is opened read-only, as if it had been examined.
+	if readOnly {
+		ch <- response.Ok(tag).WithItems(response.ItemReadOnly()).WithMessage("SELECT")
+	} else {
+		ch <- response.Ok(tag).WithItems(response.ItemReadWrite()).WithMessage("SELECT")
+	}
 
 	s.eventCh <- events.Select{
 		SessionID: s.sessionID,
@@ -25,6 +25,8 @@ func (s *Session) handleStartTLS(tag string, _ *command.StartTLS) error {
 
 	s.conn = conn
 
+	s.tlsEstablished(conn)
+
 	s.inputCollector.Reset()
 	s.inputCollector.SetSource(bufio.NewReader(s.conn))
 
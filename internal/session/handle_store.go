@@ -37,6 +37,8 @@ func (s *Session) handleStore(ctx context.Context, tag string, cmd *command.Stor
 
 	if err := mailbox.Store(ctx, cmd.SeqSet, cmd.Action, flags); errors.Is(err, state.ErrNoSuchMessage) {
 		return response.Bad(tag).WithError(err), nil
+	} else if errors.Is(err, state.ErrPermissionDenied) {
+		return response.No(tag).WithError(err), nil
 	} else if err != nil {
 		// A result of either a failed request (API unreachable), or the message does not exist on remote.
 		observability.AddMessageRelatedMetric(ctx, metrics.GenerateFailedToStoreFlagsOnMessages())
@@ -0,0 +1,93 @@
+package session
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/ProtonMail/gluon/imap"
+)
+
+// Info describes a session at some point in time.
+type Info struct {
+	SessionID  int
+	UserID     string
+	RemoteAddr net.Addr
+
+	// Mailbox is the name of the selected mailbox, if any.
+	Mailbox string
+
+	IMAPID      imap.IMAPID
+	ConnectedAt time.Time
+
+	// BytesIn and BytesOut count the bytes read from and written to the connection, including TLS overhead.
+	BytesIn  int64
+	BytesOut int64
+
+	// Command is the sanitized command being handled, if any.
+	Command string
+}
+
+// Info returns a snapshot of the session. It may be called from any goroutine.
+func (s *Session) Info() Info {
+	s.infoLock.Lock()
+	defer s.infoLock.Unlock()
+
+	info := s.info
+	info.BytesIn = s.counter.in.Load()
+	info.BytesOut = s.counter.out.Load()
+
+	return info
+}
+
+func (s *Session) updateInfo(fn func(*Info)) {
+	s.infoLock.Lock()
+	defer s.infoLock.Unlock()
+
+	fn(&s.info)
+}
+
+// commandStarted records the command the session handles until commandDone is called.
+func (s *Session) commandStarted(cmd string) {
+	s.updateInfo(func(info *Info) {
+		info.Command = cmd
+	})
+}
+
+// commandDone records the changes the last command made to the session.
+func (s *Session) commandDone() {
+	s.updateInfo(func(info *Info) {
+		info.Command = ""
+
+		if s.state != nil {
+			info.UserID = s.state.UserID()
+		}
+
+		if s.state == nil || !s.state.IsSelected() {
+			info.Mailbox = ""
+		}
+	})
+}
+
+// countingConn counts the bytes read from and written to a connection.
+type countingConn struct {
+	net.Conn
+
+	in, out atomic.Int64
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+
+	c.in.Add(int64(n))
+
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+
+	c.out.Add(int64(n))
+
+	return n, err
+}
@@ -6,15 +6,18 @@ import (
 	"bufio"
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ProtonMail/gluon/async"
+	"github.com/ProtonMail/gluon/auth"
 	"github.com/ProtonMail/gluon/events"
 	"github.com/ProtonMail/gluon/imap"
 	"github.com/ProtonMail/gluon/imap/command"
@@ -64,13 +67,41 @@ type Session struct {
 	// loggers which can be set to log incoming and outgoing IMAP communications.
 	inLogger, outLogger io.Writer
 
+	// tracer records the lines exchanged with the client, if tracing is enabled.
+	tracer *tracer
+
 	// tlsConfig holds TLS information (used, for example, for STARTTLS).
 	tlsConfig *tls.Config
 
+	// requireTLS refuses logins until the session uses TLS.
+	requireTLS bool
+
+	// certAuthenticator decides which user a client certificate logs in to, if clients may log in with one.
+	certAuthenticator auth.CertificateAuthenticator
+
 	// idleBulkTime to control how often IDLE responses are sent. 0 means
 	// immediate response with no response merging.
 	idleBulkTime time.Duration
 
+	// timeouts decides how long the session may stay inactive.
+	timeouts limits.SessionTimeouts
+
+	// removedReason is why the session ended; it is set before Serve returns.
+	removedReason events.SessionRemovedReason
+
+	// disconnectCh receives the requests to disconnect the session.
+	disconnectCh chan disconnectRequest
+
+	// receivingLiterals counts the commands whose literals are being received. Disconnecting waits for them.
+	receivingLiterals atomic.Int32
+
+	// counter counts the bytes exchanged over the connection, which it wraps.
+	counter *countingConn
+
+	// info describes the session to other goroutines; it is protected by infoLock.
+	info     Info
+	infoLock sync.Mutex
+
 	// imapID holds the IMAP ID extension data for this client. This is necessary, since this information may arrive
 	// before the client logs in or selects a mailbox.
 	imapID imap.IMAPID
@@ -84,6 +115,9 @@ type Session struct {
 	// handleWG is used to wait for all commands to finish before closing the session.
 	handleWG async.WaitGroup
 
+	// disconnect indicates whether the session should be closed once the current command has been handled.
+	disconnect bool
+
 	/// errorCount error counter
 	errorCount int
 
@@ -102,13 +136,22 @@ func New(
 	profiler profiling.CmdProfilerBuilder,
 	eventCh chan<- events.Event,
 	idleBulkTime time.Duration,
+	timeouts limits.SessionTimeouts,
 	panicHandler async.PanicHandler,
 ) *Session {
-	inputCollector := command.NewInputCollector(bufio.NewReader(conn))
+	counter := &countingConn{Conn: conn}
+	inputCollector := command.NewInputCollector(bufio.NewReader(counter))
 	scanner := rfcparser.NewScannerWithReader(inputCollector)
 
 	return &Session{
-		conn:               conn,
+		conn:         counter,
+		counter:      counter,
+		disconnectCh: make(chan disconnectRequest, 1),
+		info: Info{
+			SessionID:   sessionID,
+			RemoteAddr:  conn.RemoteAddr(),
+			ConnectedAt: time.Now(),
+		},
 		inputCollector:     inputCollector,
 		scanner:            scanner,
 		backend:            backend,
@@ -116,6 +159,7 @@ func New(
 		sessionID:          sessionID,
 		eventCh:            eventCh,
 		idleBulkTime:       idleBulkTime,
+		timeouts:           timeouts,
 		version:            version,
 		cmdProfilerBuilder: profiler,
 		handleWG:           async.MakeWaitGroup(panicHandler),
@@ -154,6 +198,12 @@ func (s *Session) Serve(ctx context.Context) error {
 	defer s.done(ctx)
 	defer s.handleWG.Wait()
 
+	// Clients failing the handshake, like port scanners, aren't worth reporting.
+	if err := s.handshake(ctx); err != nil {
+		s.log.WithError(err).Debug("TLS handshake failed")
+		return nil
+	}
+
 	if err := s.greet(); err != nil {
 		return err
 	}
@@ -161,7 +211,16 @@ func (s *Session) Serve(ctx context.Context) error {
 	profiler := s.cmdProfilerBuilder.New()
 	defer s.cmdProfilerBuilder.Collect(profiler)
 
-	return s.serve(profiling.WithProfiler(ctx, profiler))
+	if err := s.serve(profiling.WithProfiler(ctx, profiler)); !errors.Is(err, errClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// RemovedReason returns why the session ended. It is only meaningful once Serve returned.
+func (s *Session) RemovedReason() events.SessionRemovedReason {
+	return s.removedReason
 }
 
 func (s *Session) serve(ctx context.Context) error {
@@ -170,8 +229,38 @@ func (s *Session) serve(ctx context.Context) error {
 
 	cmdCh := s.startCommandReader(ctx)
 
+	var timer inactivityTimer
+	defer timer.stop()
+
+	timeout, reason := s.inactivityTimeout()
+	timer.reset(timeout)
+
+	// pending holds a disconnect request which waits for the client to finish sending a command.
+	var pending *disconnectRequest
+
+	disconnectCh := s.disconnectCh
+
 	for {
 		select {
+		case <-timer.C():
+			// Clients sending the literals of a command are active however long they take; the timeout restarts once
+			// the command completes.
+			if s.receivingLiterals.Load() > 0 {
+				timer.reset(timeout)
+				continue
+			}
+
+			return s.timeOut(reason)
+
+		case req := <-disconnectCh:
+			// Clients sending the literals of a command, such as the message of an APPEND, may finish it.
+			if s.receivingLiterals.Load() > 0 {
+				pending, disconnectCh = &req, nil
+				continue
+			}
+
+			return s.disconnected(req)
+
 		case update := <-s.state.GetStateUpdatesCh():
 			if err := s.state.ApplyUpdate(ctx, update); err != nil {
 				s.log.WithError(err).Error("Failed to apply state update")
@@ -184,6 +273,10 @@ func (s *Session) serve(ctx context.Context) error {
 				return nil
 			}
 
+			if res.literal {
+				s.receivingLiterals.Add(-1)
+			}
+
 			if res.err != nil {
 				if err := response.Bad(res.command.Tag).WithError(res.err).Send(s); err != nil {
 					return err
@@ -199,11 +292,21 @@ func (s *Session) serve(ctx context.Context) error {
 					return nil
 				}
 
+				if pending != nil {
+					return s.disconnected(*pending)
+				}
+
+				// Even an invalid command shows the client is still there.
+				timeout, reason = s.inactivityTimeout()
+				timer.reset(timeout)
+
 				continue
 			} else {
 				s.errorCount = 0
 			}
 
+			s.commandStarted(res.command.SanitizedString())
+
 			// Before proceeding with command execution, check whether we still have a valid state.
 			// State can become invalid at any time, e.g.: deletion of a selected mailbox by another client.
 			if s.state != nil && !s.state.IsValid() {
@@ -212,10 +315,22 @@ func (s *Session) serve(ctx context.Context) error {
 
 			switch cmd := res.command.Payload.(type) {
 			case *command.Logout:
-				return s.handleLogout(ctx, res.command.Tag, cmd)
+				cmdCtx, span := s.startCommandSpan(ctx, res.command.Tag, cmd)
+
+				err := s.handleLogout(cmdCtx, res.command.Tag, cmd)
+				s.endCommandSpan(span, err)
+
+				return err
 
 			case *command.Idle:
-				if err := s.handleIdle(ctx, res.command.Tag, cmd, cmdCh); err != nil {
+				cmdCtx, span := s.startCommandSpan(ctx, res.command.Tag, cmd)
+
+				err := s.handleIdle(cmdCtx, res.command.Tag, cmd, cmdCh)
+				s.endCommandSpan(span, err)
+
+				if errors.Is(err, errClosed) {
+					return err
+				} else if err != nil {
 					if err := response.No(res.command.Tag).WithError(err).Send(s); err != nil {
 						return fmt.Errorf("failed to send response to client: %w", err)
 					}
@@ -237,8 +352,22 @@ func (s *Session) serve(ctx context.Context) error {
 						return fmt.Errorf("failed to send response to client: %w", err)
 					}
 				}
+
+				if s.disconnect {
+					return nil
+				}
+			}
+
+			s.commandDone()
+
+			if pending != nil {
+				return s.disconnected(*pending)
 			}
 
+			// The timeout may have changed with the command, for instance once the client logged in.
+			timeout, reason = s.inactivityTimeout()
+			timer.reset(timeout)
+
 		case <-s.state.Done():
 			return nil
 
@@ -250,6 +379,7 @@ func (s *Session) serve(ctx context.Context) error {
 
 func (s *Session) WriteResponse(res string) error {
 	s.logOutgoing(res)
+	s.traceOutgoing(res)
 
 	if _, err := s.conn.Write([]byte(res + "\r\n")); err != nil {
 		return err
@@ -0,0 +1,53 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/ProtonMail/gluon/imap/command"
+	"github.com/ProtonMail/gluon/internal/response"
+	"github.com/ProtonMail/gluon/telemetry"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// startCommandSpan starts the span covering the handling of a command.
+func (s *Session) startCommandSpan(ctx context.Context, tag string, cmd command.Payload) (context.Context, oteltrace.Span) {
+	name := commandName(cmd)
+
+	return telemetry.Start(ctx, "imap."+name,
+		telemetry.SessionIDKey.Int(s.sessionID),
+		telemetry.CommandKey.String(name),
+		telemetry.CommandTagKey.String(tag),
+	)
+}
+
+// endCommandSpan ends the span of a command, attributing it to the user the session is logged in to, if any.
+func (s *Session) endCommandSpan(span oteltrace.Span, err error) {
+	if userID := s.Info().UserID; userID != "" {
+		span.SetAttributes(telemetry.UserIDKey.String(userID))
+	}
+
+	// Commands can fail with a bare response, such as NO with only a response code, which isn't a usable error.
+	if res, ok := response.FromError(err); ok {
+		err = errors.New(res.String())
+	}
+
+	telemetry.End(span, err)
+}
+
+// commandName returns the name of the command, such as FETCH or UID FETCH, without any of its arguments.
+func commandName(cmd command.Payload) string {
+	fields := strings.Fields(cmd.SanitizedString())
+
+	switch {
+	case len(fields) == 0:
+		return "UNKNOWN"
+
+	case len(fields) > 1 && fields[0] == "UID":
+		return fields[0] + " " + fields[1]
+
+	default:
+		return fields[0]
+	}
+}
@@ -0,0 +1,55 @@
+package session
+
+import (
+	"time"
+
+	"github.com/ProtonMail/gluon/events"
+	"github.com/ProtonMail/gluon/internal/response"
+)
+
+// inactivityTimer fires once the session waited too long for the client. A zero timer never fires.
+type inactivityTimer struct {
+	timer *time.Timer
+}
+
+// reset restarts the timer with the given timeout, or stops it if the timeout is zero.
+func (t *inactivityTimer) reset(timeout time.Duration) {
+	t.stop()
+
+	if timeout > 0 {
+		t.timer = time.NewTimer(timeout)
+	}
+}
+
+func (t *inactivityTimer) stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+}
+
+// C returns the channel the timer fires on, or nil if it is stopped.
+func (t *inactivityTimer) C() <-chan time.Time {
+	if t.timer == nil {
+		return nil
+	}
+
+	return t.timer.C
+}
+
+// inactivityTimeout returns how long the session may wait for the next command, and why it is removed if it waits
+// longer.
+func (s *Session) inactivityTimeout() (time.Duration, events.SessionRemovedReason) {
+	if s.state == nil {
+		return s.timeouts.PreAuth, events.SessionPreAuthTimeout
+	}
+
+	return s.timeouts.AutoLogout, events.SessionAutoLogout
+}
+
+// timeOut logs the client out for the given reason.
+func (s *Session) timeOut(reason events.SessionRemovedReason) error {
+	s.log.WithField("reason", reason).Info("Session timed out")
+
+	return s.closeWithBye(reason, response.Bye().WithAutoLogout())
+}
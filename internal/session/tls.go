@@ -0,0 +1,85 @@
+package session
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"time"
+
+	"github.com/ProtonMail/gluon/auth"
+	"github.com/ProtonMail/gluon/imap"
+)
+
+// handshakeTimeout bounds the TLS handshake of sessions using implicit TLS when there is no pre-auth timeout.
+const handshakeTimeout = time.Minute
+
+// SetImplicitTLS makes the session use TLS from the start, as on port 993, rather than after STARTTLS.
+func (s *Session) SetImplicitTLS(cfg *tls.Config) {
+	if cfg == nil {
+		panic("setting a nil TLS config")
+	}
+
+	s.conn = tls.Server(s.conn, cfg)
+
+	s.inputCollector.SetSource(bufio.NewReader(s.conn))
+}
+
+// SetRequireTLS refuses logins until the session uses TLS.
+func (s *Session) SetRequireTLS() {
+	s.requireTLS = true
+
+	if !s.isTLS() {
+		s.addCapability(imap.LoginDisabled)
+	}
+}
+
+// SetCertAuthenticator lets clients which presented a certificate log in with AUTHENTICATE EXTERNAL.
+func (s *Session) SetCertAuthenticator(authenticator auth.CertificateAuthenticator) {
+	if authenticator == nil {
+		panic("setting a nil certificate authenticator")
+	}
+
+	s.certAuthenticator = authenticator
+}
+
+func (s *Session) isTLS() bool {
+	_, ok := s.conn.(*tls.Conn)
+
+	return ok
+}
+
+// handshake completes the TLS handshake of sessions using implicit TLS, so that the greeting can advertise what the
+// client certificate allows. It is bounded by the pre-auth timeout.
+func (s *Session) handshake(ctx context.Context) error {
+	conn, ok := s.conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+
+	timeout := s.timeouts.PreAuth
+	if timeout <= 0 {
+		timeout = handshakeTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return err
+	}
+
+	s.tlsEstablished(conn)
+
+	return nil
+}
+
+// tlsEstablished updates the capabilities once the session uses TLS.
+func (s *Session) tlsEstablished(conn *tls.Conn) {
+	s.remCapability(imap.StartTLS)
+	s.remCapability(imap.LoginDisabled)
+
+	if s.certAuthenticator != nil && len(conn.ConnectionState().PeerCertificates) > 0 {
+		s.addCapability(imap.AuthExternal)
+		s.addCapability(imap.SASLIR)
+	}
+}
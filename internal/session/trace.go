@@ -0,0 +1,113 @@
+package session
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/gluon/trace"
+)
+
+// tracer records the lines a session exchanges with its client.
+type tracer struct {
+	sink      trace.Sink
+	redaction trace.Redaction
+
+	// commands holds the commands waiting for their tagged response, by tag.
+	commands     map[string]tracedCommand
+	commandsLock sync.Mutex
+}
+
+type tracedCommand struct {
+	name  string
+	start time.Time
+}
+
+// SetTracer makes the session trace the lines it exchanges to the given sink, redacted as given.
+func (s *Session) SetTracer(sink trace.Sink, redaction trace.Redaction) {
+	if sink == nil {
+		panic("setting a nil trace sink")
+	}
+
+	s.tracer = &tracer{
+		sink:      sink,
+		redaction: redaction,
+		commands:  make(map[string]tracedCommand),
+	}
+}
+
+// traceIncoming traces a command read from the client. The command name is empty if it couldn't be parsed.
+func (s *Session) traceIncoming(tag, name, line string) {
+	if s.tracer == nil {
+		return
+	}
+
+	name = strings.ToUpper(name)
+
+	if tag != "" {
+		s.tracer.commandsLock.Lock()
+		s.tracer.commands[tag] = tracedCommand{name: name, start: time.Now()}
+		s.tracer.commandsLock.Unlock()
+	}
+
+	s.tracer.sink.Trace(trace.Record{
+		Time:      time.Now(),
+		SessionID: s.sessionID,
+		UserID:    s.Info().UserID,
+		Direction: trace.Incoming,
+		Tag:       tag,
+		Command:   name,
+		Line:      s.tracer.redaction.Incoming(tag, name, strings.TrimRight(line, "\r\n")),
+	})
+}
+
+// traceOutgoing traces a response sent to the client. Tagged responses complete the command with the same tag.
+func (s *Session) traceOutgoing(line string) {
+	if s.tracer == nil {
+		return
+	}
+
+	record := trace.Record{
+		Time:      time.Now(),
+		SessionID: s.sessionID,
+		UserID:    s.Info().UserID,
+		Direction: trace.Outgoing,
+		Line:      s.tracer.redaction.Outgoing(line),
+	}
+
+	fields := strings.SplitN(line, " ", 3)
+
+	switch {
+	case fields[0] == "+":
+		// Continuation requests have no status.
+
+	case fields[0] == "*":
+		if len(fields) > 1 && isStatus(fields[1]) {
+			record.Status = fields[1]
+		}
+
+	case len(fields) > 1:
+		record.Tag, record.Status = fields[0], fields[1]
+
+		s.tracer.commandsLock.Lock()
+		cmd, ok := s.tracer.commands[record.Tag]
+		delete(s.tracer.commands, record.Tag)
+		s.tracer.commandsLock.Unlock()
+
+		if ok {
+			record.Command, record.Duration = cmd.name, time.Since(cmd.start)
+		}
+	}
+
+	s.tracer.sink.Trace(record)
+}
+
+func isStatus(word string) bool {
+	switch word {
+	case "OK", "NO", "BAD", "BYE", "PREAUTH":
+		return true
+
+	default:
+		return false
+	}
+}
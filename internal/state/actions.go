@@ -36,6 +36,7 @@ func (state *State) actionCreateAndGetMailbox(ctx context.Context, tx db.Transac
 			res.Flags,
 			res.PermanentFlags,
 			res.Attributes,
+			res.Permissions,
 			uidValidity,
 		)
 		if err != nil {
@@ -145,7 +146,9 @@ func (state *State) actionCreateMessage(
 		return nil, 0, fmt.Errorf("failed to set internal ID: %w", err)
 	}
 
-	if err := state.user.GetStore().SetUnchecked(internalID, literalWithHeader); err != nil {
+	hasher := db.NewLiteralHasher(literalWithHeader)
+
+	if err := stateStoreSetUnchecked(ctx, state, internalID, hasher, literalSize); err != nil {
 		return nil, 0, fmt.Errorf("failed to store message literal: %w", err)
 	}
 
@@ -156,6 +159,9 @@ func (state *State) actionCreateMessage(
 		Structure:   parsedMessage.Structure,
 		Envelope:    parsedMessage.Envelope,
 		InternalID:  internalID,
+
+		HeaderFields: db.NewMessageHeaderFields(newLiteral),
+		LiteralHash:  hasher.Sum(),
 	}
 
 	messageUID, flagSet, err := tx.CreateMessageAndAddToMailbox(ctx, mboxID.InternalID, &req)
@@ -200,7 +206,7 @@ func (state *State) actionCreateRecoveredMessage(
 		return nil, true, nil
 	}
 
-	if err := state.user.GetStore().SetUnchecked(internalID, bytes.NewReader(literal)); err != nil {
+	if err := stateStoreSetUnchecked(ctx, state, internalID, bytes.NewReader(literal), len(literal)); err != nil {
 		return nil, false, fmt.Errorf("failed to store message literal: %w", err)
 	}
 
@@ -215,6 +221,9 @@ func (state *State) actionCreateRecoveredMessage(
 		Structure:   parsedMessage.Structure,
 		Envelope:    parsedMessage.Envelope,
 		InternalID:  internalID,
+
+		HeaderFields: db.NewMessageHeaderFields(literal),
+		LiteralHash:  db.NewLiteralHash(literal),
 	}
 
 	recoveryMBoxID := state.user.GetRecoveryMailboxID()
@@ -328,7 +337,7 @@ func (state *State) actionImportRecoveredMessage(
 		return nil, db.MessageIDPair{}, false, err
 	}
 
-	literal, err := state.user.GetStore().Get(id)
+	literal, err := stateStoreGet(ctx, state, id)
 	if err != nil {
 		return nil, db.MessageIDPair{}, false, err
 	}
@@ -363,7 +372,9 @@ func (state *State) actionImportRecoveredMessage(
 		return nil, db.MessageIDPair{}, false, fmt.Errorf("failed to set internal ID: %w", err)
 	}
 
-	if err := state.user.GetStore().SetUnchecked(internalID, literalReader); err != nil {
+	hasher := db.NewLiteralHasher(literalReader)
+
+	if err := stateStoreSetUnchecked(ctx, state, internalID, hasher, literalSize); err != nil {
 		return nil, db.MessageIDPair{}, false, fmt.Errorf("failed to store message literal: %w", err)
 	}
 
@@ -374,6 +385,9 @@ func (state *State) actionImportRecoveredMessage(
 		Structure:   parsedMessage.Structure,
 		Envelope:    parsedMessage.Envelope,
 		InternalID:  internalID,
+
+		HeaderFields: db.NewMessageHeaderFields(newLiteral),
+		LiteralHash:  hasher.Sum(),
 	}
 
 	if err := tx.CreateMessages(ctx, &req); err != nil {
@@ -12,6 +12,7 @@ var (
 	ErrSessionNotSelected  = errors.New("session is not selected")
 
 	ErrOperationNotAllowed            = errors.New("operation not allowed")
+	ErrPermissionDenied               = errors.New("permission denied")
 	ErrMailboxNameBeginsWithSeparator = errors.New("invalid mailbox name: begins with hierarchy separator")
 	ErrMailboxNameAdjacentSeparator   = errors.New("invalid mailbox name: has adjacent hierarchy separators")
 )
@@ -24,6 +25,7 @@ func IsStateError(err error) bool {
 		errors.Is(err, ErrAlreadyUnsubscribed) ||
 		errors.Is(err, ErrSessionNotSelected) ||
 		errors.Is(err, ErrOperationNotAllowed) ||
+		errors.Is(err, ErrPermissionDenied) ||
 		errors.Is(err, ErrMailboxNameBeginsWithSeparator) ||
 		errors.Is(err, ErrMailboxNameAdjacentSeparator)
 }
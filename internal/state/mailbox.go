@@ -23,6 +23,7 @@ type Mailbox struct {
 	name        string
 	subscribed  bool
 	uidValidity imap.UID
+	perms       imap.MailboxPermissions
 
 	state *State
 	snap  *snapshot
@@ -46,6 +47,7 @@ func newMailbox(mbox *db.Mailbox, state *State, snap *snapshot) *Mailbox {
 		id:          id,
 		name:        mbox.Name,
 		uidValidity: mbox.UIDValidity,
+		perms:       mbox.Permissions,
 
 		state: state,
 
@@ -70,6 +72,10 @@ func (m *Mailbox) ReadOnly() bool {
 	return m.readOnly
 }
 
+func (m *Mailbox) Permissions() imap.MailboxPermissions {
+	return m.perms
+}
+
 func (m *Mailbox) ExpungeIssued() bool {
 	var issued bool
 
@@ -94,6 +100,10 @@ func (m *Mailbox) Flags(ctx context.Context) (imap.FlagSet, error) {
 }
 
 func (m *Mailbox) PermanentFlags(ctx context.Context) (imap.FlagSet, error) {
+	if !m.perms.Has(imap.PermWriteFlags) {
+		return imap.NewFlagSet(), nil
+	}
+
 	return stateDBReadResult(ctx, m.state, func(ctx context.Context, client db.ReadOnly) (imap.FlagSet, error) {
 		return client.GetMailboxPermanentFlags(ctx, m.id.InternalID)
 	})
@@ -237,6 +247,10 @@ func (m *Mailbox) AppendRegular(ctx context.Context, literal []byte, flags imap.
 var ErrKnownRecoveredMessage = errors.New("known recovered message, possible duplication")
 
 func (m *Mailbox) Append(ctx context.Context, literal []byte, flags imap.FlagSet, date time.Time) (imap.UID, error) {
+	if !m.perms.Has(imap.PermInsert) {
+		return 0, fmt.Errorf("%w: mailbox does not accept new messages", ErrPermissionDenied)
+	}
+
 	uid, err := m.AppendRegular(ctx, literal, flags, date)
 	if err != nil {
 		// Can't store messages that exceed size limits
@@ -288,6 +302,10 @@ func (m *Mailbox) Copy(ctx context.Context, seq []command.SeqRange, name string)
 		return nil, err
 	}
 
+	if !mbox.Permissions.Has(imap.PermInsert) {
+		return nil, fmt.Errorf("%w: mailbox does not accept new messages", ErrPermissionDenied)
+	}
+
 	messages, err := m.snap.getMessagesInRange(ctx, seq)
 	if err != nil {
 		return nil, err
@@ -343,6 +361,14 @@ func (m *Mailbox) Move(ctx context.Context, seq []command.SeqRange, name string)
 		return nil, err
 	}
 
+	if !m.perms.Has(imap.PermExpunge) {
+		return nil, fmt.Errorf("%w: messages can't be removed from this mailbox", ErrPermissionDenied)
+	}
+
+	if !mbox.Permissions.Has(imap.PermInsert) {
+		return nil, fmt.Errorf("%w: mailbox does not accept new messages", ErrPermissionDenied)
+	}
+
 	messages, err := m.snap.getMessagesInRange(ctx, seq)
 	if err != nil {
 		return nil, err
@@ -380,6 +406,10 @@ func (m *Mailbox) Move(ctx context.Context, seq []command.SeqRange, name string)
 }
 
 func (m *Mailbox) Store(ctx context.Context, seqSet []command.SeqRange, action command.StoreAction, flags imap.FlagSet) error {
+	if !m.perms.Has(imap.PermWriteFlags) {
+		return fmt.Errorf("%w: message flags can't be changed in this mailbox", ErrPermissionDenied)
+	}
+
 	messages, err := m.snap.getMessagesInRange(ctx, seqSet)
 	if err != nil {
 		return err
@@ -402,6 +432,10 @@ func (m *Mailbox) Store(ctx context.Context, seqSet []command.SeqRange, action c
 }
 
 func (m *Mailbox) Expunge(ctx context.Context, seq []command.SeqRange) error {
+	if !m.perms.Has(imap.PermExpunge) {
+		return fmt.Errorf("%w: messages can't be expunged from this mailbox", ErrPermissionDenied)
+	}
+
 	var msgIDs []db.MessageIDPair
 
 	if seq != nil {
@@ -15,6 +15,7 @@ import (
 	"github.com/ProtonMail/gluon/internal/contexts"
 	"github.com/ProtonMail/gluon/internal/response"
 	"github.com/ProtonMail/gluon/rfc822"
+	"github.com/ProtonMail/gluon/telemetry"
 	"github.com/bradenaw/juniper/parallel"
 	"github.com/bradenaw/juniper/xslices"
 )
@@ -27,6 +28,8 @@ func (m *Mailbox) Fetch(ctx context.Context, cmd *command.Fetch, ch chan respons
 		return err
 	}
 
+	telemetry.SetAttributes(ctx, telemetry.MessageCountKey.Int(len(snapMessages)))
+
 	operations := make([]func(snapMsgWithSeq, *db.Message, []byte) (response.Item, error), 0, len(cmd.Attributes))
 
 	var (
@@ -154,7 +157,7 @@ func (m *Mailbox) Fetch(ctx context.Context, cmd *command.Fetch, ch chan respons
 			items = append(items, response.ItemUID(msg.UID))
 		}
 
-		if setSeen && !m.ReadOnly() {
+		if setSeen && !m.ReadOnly() && m.perms.Has(imap.PermWriteFlags) {
 			if !msg.flags.ContainsUnchecked(imap.FlagSeenLowerCase) {
 				msg.flags.AddToSelf(imap.FlagSeen)
 
@@ -14,7 +14,7 @@ import (
 	"github.com/ProtonMail/gluon/imap"
 	"github.com/ProtonMail/gluon/imap/command"
 	"github.com/ProtonMail/gluon/internal/contexts"
-	"github.com/ProtonMail/gluon/rfc5322"
+	"github.com/ProtonMail/gluon/internal/search"
 	"github.com/ProtonMail/gluon/rfc822"
 	"github.com/bradenaw/juniper/parallel"
 	"github.com/bradenaw/juniper/xslices"
@@ -41,6 +41,10 @@ func (m *Mailbox) Search(ctx context.Context, keys []command.SearchKey, decoder
 		return nil, err
 	}
 
+	if err := searchHeaderFields(ctx, m, op.headerKeys); err != nil {
+		return nil, err
+	}
+
 	msgCount := m.snap.len()
 
 	result := make([]uint32, msgCount)
@@ -108,6 +112,21 @@ func buildSearchData(ctx context.Context, m *Mailbox, op *buildSearchOpResult, m
 		data.literal = l
 	}
 
+	literal := data.literal
+
+	data.loadLiteral = func() ([]byte, error) {
+		if literal == nil {
+			l, err := m.state.getLiteral(ctx, message.ID)
+			if err != nil {
+				return nil, err
+			}
+
+			literal = l
+		}
+
+		return literal, nil
+	}
+
 	if op.needsHeader {
 		headerBytes, _ := rfc822.Split(data.literal)
 
@@ -122,6 +141,63 @@ func buildSearchData(ctx context.Context, m *Mailbox, op *buildSearchOpResult, m
 	return data, nil
 }
 
+// searchHeaderFields evaluates the given keys against the stored header fields of the messages of the mailbox,
+// with a single query.
+func searchHeaderFields(ctx context.Context, m *Mailbox, keys []*headerSearchKey) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	result, err := stateDBReadResult(ctx, m.state, func(ctx context.Context, client db.ReadOnly) (db.HeaderSearchResult, error) {
+		return client.SearchMessageHeaders(ctx, m.snap.mboxID.InternalID, xslices.Map(keys, func(key *headerSearchKey) db.HeaderSearchKey {
+			return key.key
+		}))
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, key := range keys {
+		key.matches = result.Matches[i]
+		key.missing = result.Missing
+	}
+
+	return nil
+}
+
+// headerSearchKey is a search key evaluated by the database against the stored header fields of messages.
+type headerSearchKey struct {
+	key db.HeaderSearchKey
+
+	// matches holds the messages which match the key.
+	matches map[imap.InternalMessageID]struct{}
+
+	// missing holds the messages whose header fields weren't stored yet; they're matched against their literal.
+	missing map[imap.InternalMessageID]struct{}
+}
+
+func (key *headerSearchKey) match(s *searchData) (bool, error) {
+	id := s.message.ID.InternalID
+
+	if _, ok := key.missing[id]; !ok {
+		_, ok := key.matches[id]
+		return ok, nil
+	}
+
+	if s.headerFields == nil {
+		literal, err := s.loadLiteral()
+		if err != nil {
+			return false, err
+		}
+
+		if s.headerFields = db.NewMessageHeaderFields(literal); s.headerFields == nil {
+			return false, fmt.Errorf("failed to parse message header")
+		}
+	}
+
+	return key.key.Matches(s.headerFields), nil
+}
+
 func applySearch(ctx context.Context, m *Mailbox, msg snapMsgWithSeq, searchOp *buildSearchOpResult) (bool, error) {
 	data, err := buildSearchData(ctx, m, searchOp, msg)
 	if err != nil {
@@ -137,13 +213,20 @@ func applySearch(ctx context.Context, m *Mailbox, msg snapMsgWithSeq, searchOp *
 }
 
 type searchData struct {
-	message   snapMsgWithSeq
-	literal   []byte
+	message snapMsgWithSeq
+	literal []byte
+
+	// loadLiteral returns the literal, loading it from the store if it wasn't needed by the search op upfront.
+	loadLiteral func() ([]byte, error)
+
 	dbMessage struct {
 		date time.Time
 		size int
 	}
 	header *rfc822.Header
+
+	// headerFields holds the header fields of messages which weren't stored in the database, once parsed.
+	headerFields *db.MessageHeaderFields
 }
 
 type searchOp = func(*searchData) (bool, error)
@@ -153,12 +236,16 @@ type buildSearchOpResult struct {
 	needsLiteral bool
 	needsMessage bool
 	needsHeader  bool
+
+	// headerKeys are the keys of the op evaluated against the header fields stored in the database.
+	headerKeys []*headerSearchKey
 }
 
 func (b *buildSearchOpResult) merge(other *buildSearchOpResult) {
 	b.needsLiteral = b.needsLiteral || other.needsLiteral
 	b.needsMessage = b.needsMessage || other.needsMessage
 	b.needsHeader = b.needsHeader || other.needsHeader
+	b.headerKeys = append(b.headerKeys, other.headerKeys...)
 }
 
 type searchOpResultOption interface {
@@ -176,6 +263,39 @@ func needsHeader() searchOpResultOption {
 	return &withHeaderSearchOpResultOption{}
 }
 
+type withHeaderFieldsSearchOpResultOption struct {
+	key *headerSearchKey
+}
+
+func (o withHeaderFieldsSearchOpResultOption) apply(s *buildSearchOpResult) {
+	s.headerKeys = append(s.headerKeys, o.key)
+}
+
+func needsHeaderFields(key *headerSearchKey) searchOpResultOption {
+	return &withHeaderFieldsSearchOpResultOption{key: key}
+}
+
+// buildHeaderFieldsSearchOp returns a search op evaluating the given key against the stored header fields.
+func buildHeaderFieldsSearchOp(key db.HeaderSearchKey) *buildSearchOpResult {
+	headerKey := &headerSearchKey{key: key}
+
+	return newBuildSearchOpResult(headerKey.match, needsHeaderFields(headerKey))
+}
+
+// buildHeaderFieldContainsSearchOp returns a search op matching messages whose given header field contains the key.
+func buildHeaderFieldContainsSearchOp(field db.HeaderField, value string, decoder *encoding.Decoder) (*buildSearchOpResult, error) {
+	decodedKey, err := decoder.Bytes([]byte(value))
+	if err != nil {
+		return nil, err
+	}
+
+	return buildHeaderFieldsSearchOp(db.HeaderSearchKey{
+		Op:    db.HeaderSearchContains,
+		Field: field,
+		Value: string(decodedKey),
+	}), nil
+}
+
 type withLiteralSearchOpResultOption struct{}
 
 func (withLiteralSearchOpResultOption) apply(s *buildSearchOpResult) {
@@ -221,7 +341,7 @@ func buildSearchOp(m *Mailbox, key command.SearchKey, decoder *encoding.Decoder)
 		return buildSearchOpBefore(key)
 
 	case *command.SearchKeyBody:
-		return buildSearchOpBody(key, decoder)
+		return buildSearchOpBody(m, key, decoder)
 
 	case *command.SearchKeyCC:
 		return buildSearchOpCc(key, decoder)
@@ -287,7 +407,7 @@ func buildSearchOp(m *Mailbox, key command.SearchKey, decoder *encoding.Decoder)
 		return buildSearchOpSubject(key, decoder)
 
 	case *command.SearchKeyText:
-		return buildSearchOpText(key, decoder)
+		return buildSearchOpText(m, key, decoder)
 
 	case *command.SearchKeyTo:
 		return buildSearchOpTo(key, decoder)
@@ -341,20 +461,7 @@ func buildSearchOpAnswered() (*buildSearchOpResult, error) {
 }
 
 func buildSearchOpBcc(key *command.SearchKeyBCC, decoder *encoding.Decoder) (*buildSearchOpResult, error) {
-	decodedKey, err := decoder.Bytes([]byte(key.Value))
-	if err != nil {
-		return nil, err
-	}
-
-	decodedKeyStr := strings.ToLower(string(decodedKey))
-
-	op := func(s *searchData) (bool, error) {
-		value := s.header.Get("Bcc")
-
-		return strings.Contains(strings.ToLower(value), decodedKeyStr), nil
-	}
-
-	return newBuildSearchOpResult(op, needsHeader()), nil
+	return buildHeaderFieldContainsSearchOp(db.HeaderFieldBcc, key.Value, decoder)
 }
 
 func buildSearchOpBefore(key *command.SearchKeyBefore) (*buildSearchOpResult, error) {
@@ -365,7 +472,7 @@ func buildSearchOpBefore(key *command.SearchKeyBefore) (*buildSearchOpResult, er
 	return newBuildSearchOpResult(op, needsDBMessage()), nil
 }
 
-func buildSearchOpBody(key *command.SearchKeyBody, decoder *encoding.Decoder) (*buildSearchOpResult, error) {
+func buildSearchOpBody(m *Mailbox, key *command.SearchKeyBody, decoder *encoding.Decoder) (*buildSearchOpResult, error) {
 	keyBytes, err := decoder.Bytes([]byte(key.Value))
 	if err != nil {
 		return nil, err
@@ -373,30 +480,23 @@ func buildSearchOpBody(key *command.SearchKeyBody, decoder *encoding.Decoder) (*
 
 	keyBytesLower := bytes.ToLower(keyBytes)
 
-	op := func(s *searchData) (bool, error) {
-		section := rfc822.Parse(s.literal)
-
-		return bytes.Contains(bytes.ToLower(section.Body()), keyBytesLower), nil
+	scan := func(literal []byte) bool {
+		return bytes.Contains(bytes.ToLower(rfc822.Parse(literal).Body()), keyBytesLower)
 	}
 
-	return newBuildSearchOpResult(op, needsLiteral()), nil
-}
-
-func buildSearchOpCc(key *command.SearchKeyCC, decoder *encoding.Decoder) (*buildSearchOpResult, error) {
-	decodedKey, err := decoder.Bytes([]byte(key.Value))
-	if err != nil {
-		return nil, err
+	if op, ok := buildIndexedSearchOp(m, string(keyBytes), search.FieldBody); ok {
+		return newBuildSearchOpResult(op), nil
 	}
 
-	decodedKeyStr := strings.ToLower(string(decodedKey))
-
 	op := func(s *searchData) (bool, error) {
-		value := s.header.Get("Cc")
-
-		return strings.Contains(strings.ToLower(value), decodedKeyStr), nil
+		return scan(s.literal), nil
 	}
 
-	return newBuildSearchOpResult(op, needsHeader()), nil
+	return newBuildSearchOpResult(op, needsLiteral()), nil
+}
+
+func buildSearchOpCc(key *command.SearchKeyCC, decoder *encoding.Decoder) (*buildSearchOpResult, error) {
+	return buildHeaderFieldContainsSearchOp(db.HeaderFieldCc, key.Value, decoder)
 }
 
 func buildSearchOpDeleted() (*buildSearchOpResult, error) {
@@ -424,23 +524,14 @@ func buildSearchOpFlagged() (*buildSearchOpResult, error) {
 }
 
 func buildSearchOpFrom(key *command.SearchKeyFrom, decoder *encoding.Decoder) (*buildSearchOpResult, error) {
-	decodedKey, err := decoder.Bytes([]byte(key.Value))
-	if err != nil {
-		return nil, err
-	}
-
-	decodedKeyStr := strings.ToLower(string(decodedKey))
-
-	op := func(s *searchData) (bool, error) {
-		value := s.header.Get("From")
-
-		return strings.Contains(strings.ToLower(value), decodedKeyStr), nil
-	}
-
-	return newBuildSearchOpResult(op, needsHeader()), nil
+	return buildHeaderFieldContainsSearchOp(db.HeaderFieldFrom, key.Value, decoder)
 }
 
 func buildSearchOpHeader(key *command.SearchKeyHeader, decoder *encoding.Decoder) (*buildSearchOpResult, error) {
+	if field, ok := db.HeaderFieldByName(key.Field); ok {
+		return buildHeaderFieldContainsSearchOp(field, key.Value, decoder)
+	}
+
 	decodedKey, err := decoder.Bytes([]byte(key.Value))
 	if err != nil {
 		return nil, err
@@ -573,61 +664,15 @@ func buildSearchOpSeen() (*buildSearchOpResult, error) {
 }
 
 func buildSearchOpSentBefore(key *command.SearchKeySentBefore) (*buildSearchOpResult, error) {
-	beforeDate := key.Value
-
-	op := func(s *searchData) (bool, error) {
-		value := s.header.Get("Date")
-
-		date, err := rfc5322.ParseDateTime(value)
-		if err != nil {
-			return false, err
-		}
-
-		date = convertToDateWithoutTZ(date)
-
-		return date.Before(beforeDate), nil
-	}
-
-	return newBuildSearchOpResult(op, needsHeader()), nil
+	return buildHeaderFieldsSearchOp(db.HeaderSearchKey{Op: db.HeaderSearchSentBefore, Date: convertToDateWithoutTZ(key.Value)}), nil
 }
 
 func buildSearchOpSentOn(key *command.SearchKeySentOn) (*buildSearchOpResult, error) {
-	onDate := key.Value
-
-	op := func(s *searchData) (bool, error) {
-		value := s.header.Get("Date")
-
-		date, err := rfc5322.ParseDateTime(value)
-		if err != nil {
-			return false, err
-		}
-
-		// GODT-1598: Is this correct?
-		date = convertToDateWithoutTZ(date)
-
-		return date.Equal(onDate), nil
-	}
-
-	return newBuildSearchOpResult(op, needsHeader()), nil
+	return buildHeaderFieldsSearchOp(db.HeaderSearchKey{Op: db.HeaderSearchSentOn, Date: convertToDateWithoutTZ(key.Value)}), nil
 }
 
 func buildSearchOpSentSince(key *command.SearchKeySentSince) (*buildSearchOpResult, error) {
-	sinceDate := key.Value
-
-	op := func(s *searchData) (bool, error) {
-		value := s.header.Get("Date")
-
-		date, err := rfc5322.ParseDateTime(value)
-		if err != nil {
-			return false, err
-		}
-
-		date = convertToDateWithoutTZ(date)
-
-		return date.Equal(sinceDate) || date.After(sinceDate), nil
-	}
-
-	return newBuildSearchOpResult(op, needsHeader()), nil
+	return buildHeaderFieldsSearchOp(db.HeaderSearchKey{Op: db.HeaderSearchSentSince, Date: convertToDateWithoutTZ(key.Value)}), nil
 }
 
 func buildSearchOpSince(key *command.SearchKeySince) (*buildSearchOpResult, error) {
@@ -653,52 +698,58 @@ func buildSearchOpSmaller(key *command.SearchKeySmaller) (*buildSearchOpResult,
 }
 
 func buildSearchOpSubject(key *command.SearchKeySubject, decoder *encoding.Decoder) (*buildSearchOpResult, error) {
+	return buildHeaderFieldContainsSearchOp(db.HeaderFieldSubject, key.Value, decoder)
+}
+
+func buildSearchOpText(m *Mailbox, key *command.SearchKeyText, decoder *encoding.Decoder) (*buildSearchOpResult, error) {
 	decodedKey, err := decoder.Bytes([]byte(key.Value))
 	if err != nil {
 		return nil, err
 	}
 
-	decodedKeyStr := strings.ToLower(string(decodedKey))
-
-	op := func(s *searchData) (bool, error) {
-		value := s.header.Get("Subject")
+	decodedKeyLower := bytes.ToLower(decodedKey)
 
-		return strings.Contains(strings.ToLower(value), decodedKeyStr), nil
+	scan := func(literal []byte) bool {
+		return bytes.Contains(bytes.ToLower(literal), decodedKeyLower)
 	}
 
-	return newBuildSearchOpResult(op, needsHeader()), nil
-}
-
-func buildSearchOpText(key *command.SearchKeyText, decoder *encoding.Decoder) (*buildSearchOpResult, error) {
-	decodedKey, err := decoder.Bytes([]byte(key.Value))
-	if err != nil {
-		return nil, err
+	if op, ok := buildIndexedSearchOp(m, string(decodedKey), search.FieldAll); ok {
+		return newBuildSearchOpResult(op), nil
 	}
 
-	decodedKeyLower := bytes.ToLower(decodedKey)
-
 	op := func(s *searchData) (bool, error) {
-		return bytes.Contains(bytes.ToLower(s.literal), decodedKeyLower), nil
+		return scan(s.literal), nil
 	}
 
 	return newBuildSearchOpResult(op, needsLiteral()), nil
 }
 
-func buildSearchOpTo(key *command.SearchKeyTo, decoder *encoding.Decoder) (*buildSearchOpResult, error) {
-	decodedKey, err := decoder.Bytes([]byte(key.Value))
-	if err != nil {
-		return nil, err
+// buildIndexedSearchOp returns a search op which looks the key up in the user's search index, if there is one.
+//
+// With an index, a message matches if the key's words appear, in order and ignoring case and separators, among the
+// tokens the index extracts from it: those of its decoded headers for TEXT, and those of its decoded text parts and
+// MIME part headers for both BODY and TEXT. The same matcher is used whether or not the message was indexed yet, so
+// that indexing never changes the result; only candidates whose match isn't certain from the index alone and
+// messages which weren't completely indexed are loaded from the store. Without an index, or for keys which can't be
+// looked up in it, the raw literal is scanned for the key instead.
+func buildIndexedSearchOp(m *Mailbox, key string, fields search.Field) (searchOp, bool) {
+	index := m.state.user.GetSearchIndex()
+	if index == nil {
+		return nil, false
 	}
 
-	decodedKeyStr := strings.ToLower(string(decodedKey))
-
-	op := func(s *searchData) (bool, error) {
-		value := s.header.Get("To")
-
-		return strings.Contains(strings.ToLower(value), decodedKeyStr), nil
+	res, ok := index.Lookup(key, fields)
+	if !ok {
+		return nil, false
 	}
 
-	return newBuildSearchOpResult(op, needsHeader()), nil
+	return func(s *searchData) (bool, error) {
+		return res.Matches(s.message.ID.InternalID, s.loadLiteral)
+	}, true
+}
+
+func buildSearchOpTo(key *command.SearchKeyTo, decoder *encoding.Decoder) (*buildSearchOpResult, error) {
+	return buildHeaderFieldContainsSearchOp(db.HeaderFieldTo, key.Value, decoder)
 }
 
 func buildSearchOpUID(m *Mailbox, key *command.SearchKeyUID) (*buildSearchOpResult, error) {
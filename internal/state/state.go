@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"strings"
 	"sync/atomic"
 
@@ -16,6 +17,7 @@ import (
 	"github.com/ProtonMail/gluon/limits"
 	"github.com/ProtonMail/gluon/reporter"
 	"github.com/ProtonMail/gluon/rfc822"
+	"github.com/ProtonMail/gluon/telemetry"
 	"github.com/bradenaw/juniper/xmaps"
 	"github.com/bradenaw/juniper/xslices"
 	"github.com/sirupsen/logrus"
@@ -36,6 +38,9 @@ type State struct {
 
 	res []Responder
 
+	// alerts holds alerts which are sent to the client before the response of its next command.
+	alerts []string
+
 	snap *snapshot
 	ro   bool
 
@@ -180,6 +185,10 @@ func (state *State) Select(ctx context.Context, name string, fn func(*Mailbox) e
 		return err
 	}
 
+	if !mbox.Permissions.Has(imap.PermRead) {
+		return fmt.Errorf("%w: mailbox can't be selected", ErrPermissionDenied)
+	}
+
 	if state.snap != nil {
 		if err := state.close(); err != nil {
 			return err
@@ -200,7 +209,9 @@ func (state *State) Select(ctx context.Context, name string, fn func(*Mailbox) e
 	}
 
 	state.snap = snap
-	state.ro = false
+	state.ro = mbox.Permissions.IsReadOnly()
+
+	setMailboxAttributes(ctx, mbox, state.snap)
 
 	return fn(newMailbox(mbox, state, state.snap))
 }
@@ -217,6 +228,10 @@ func (state *State) Examine(ctx context.Context, name string, fn func(*Mailbox)
 		return err
 	}
 
+	if !mbox.Permissions.Has(imap.PermRead) {
+		return fmt.Errorf("%w: mailbox can't be examined", ErrPermissionDenied)
+	}
+
 	if state.snap != nil {
 		if err := state.close(); err != nil {
 			return err
@@ -233,6 +248,8 @@ func (state *State) Examine(ctx context.Context, name string, fn func(*Mailbox)
 	state.snap = snap
 	state.ro = true
 
+	setMailboxAttributes(ctx, mbox, state.snap)
+
 	return fn(newMailbox(mbox, state, state.snap))
 }
 
@@ -280,16 +297,24 @@ func (state *State) Create(ctx context.Context, name string) error {
 			return nil, ErrExistingMailbox
 		}
 
+		// parent is the deepest existing superior, under which the new mailboxes are created.
+		var parent *db.Mailbox
+
 		for _, superior := range listSuperiors(name, state.delimiter) {
-			if exists, err := tx.MailboxExistsWithName(ctx, superior); err != nil {
-				return nil, err
-			} else if exists {
+			if mbox, err := tx.GetMailboxByName(ctx, superior); err == nil {
+				parent = mbox
 				continue
+			} else if !errors.Is(err, db.ErrNotFound) {
+				return nil, err
 			}
 
 			mboxesToCreate = append(mboxesToCreate, superior)
 		}
 
+		if parent != nil && !parent.Permissions.Has(imap.PermCreateChildren) {
+			return nil, fmt.Errorf("%w: mailboxes can't be created below %v", ErrPermissionDenied, parent.Name)
+		}
+
 		mboxesToCreate = append(mboxesToCreate, name)
 
 		var allUpdates []Update
@@ -561,6 +586,8 @@ func (state *State) Selected(ctx context.Context, fn func(*Mailbox) error) error
 		return err
 	}
 
+	setMailboxAttributes(ctx, mbox, state.snap)
+
 	return fn(newMailbox(mbox, state, state.snap))
 }
 
@@ -648,6 +675,26 @@ func (state *State) markInvalid() {
 	state.invalid = true
 }
 
+// PopAlerts returns the alerts which haven't yet been sent to the client as untagged OK [ALERT] responses.
+func (state *State) PopAlerts() []response.Response {
+	alerts := xslices.Map(state.alerts, func(alert string) response.Response {
+		return response.Ok().WithItems(response.ItemAlert()).WithMessage(alert)
+	})
+
+	state.alerts = nil
+
+	return alerts
+}
+
+// pushAlert sends the alert to the client immediately if it is idling, otherwise it is kept until its next command.
+func (state *State) pushAlert(alert string) {
+	if state.idleCh != nil {
+		state.idleCh <- response.Ok().WithItems(response.ItemAlert()).WithMessage(alert)
+	} else {
+		state.alerts = append(state.alerts, alert)
+	}
+}
+
 // renameInbox creates a new mailbox and moves everything there.
 func (state *State) renameInbox(ctx context.Context, tx db.Transaction, inbox *db.Mailbox, newName string) ([]Update, error) {
 	uidValidity, err := state.user.GenerateUIDValidity()
@@ -689,6 +736,8 @@ func (state *State) beginIdle(ctx context.Context) ([]response.Response, error)
 		return nil, err
 	}
 
+	res = append(state.PopAlerts(), res...)
+
 	state.idleCh = make(chan response.Response)
 
 	return res, nil
@@ -703,7 +752,7 @@ func (state *State) endIdle() {
 func (state *State) getLiteral(ctx context.Context, messageID db.MessageIDPair) ([]byte, error) {
 	var literal []byte
 
-	storeLiteral, firstErr := state.user.GetStore().Get(messageID.InternalID)
+	storeLiteral, firstErr := stateStoreGet(ctx, state, messageID.InternalID)
 	if firstErr != nil {
 		// Do not attempt to recovered messages from the connector.
 		if ids.IsRecoveredRemoteMessageID(messageID.RemoteID) {
@@ -724,7 +773,7 @@ func (state *State) getLiteral(ctx context.Context, messageID db.MessageIDPair)
 			return nil, fmt.Errorf("failed to set internal ID on downloaded message: %w", err)
 		}
 
-		if err := state.user.GetStore().Set(messageID.InternalID, bytes.NewReader(literalWithHeader)); err != nil {
+		if err := stateStoreSet(ctx, state, messageID.InternalID, bytes.NewReader(literalWithHeader), len(literalWithHeader)); err != nil {
 			state.log.Errorf("Failed to store download message from connector: %v", err)
 			return nil, fmt.Errorf("message failed to load from cache (%v), failed to store new downloaded message: %w", firstErr, err)
 		}
@@ -889,15 +938,32 @@ func (state *State) close() error {
 	return nil
 }
 
-func stateDBRead(ctx context.Context, state *State, fn func(context.Context, db.ReadOnly) error) error {
+// setMailboxAttributes describes the mailbox the current command operates on.
+func setMailboxAttributes(ctx context.Context, mbox *db.Mailbox, snap *snapshot) {
+	telemetry.SetAttributes(ctx,
+		telemetry.MailboxKey.String(mbox.ID.ShortID()),
+		telemetry.MailboxMessagesKey.Int(snap.len()),
+	)
+}
+
+func stateDBRead(ctx context.Context, state *State, fn func(context.Context, db.ReadOnly) error) (err error) {
+	ctx, span := telemetry.Start(ctx, "db.read")
+	defer func() { telemetry.End(span, err) }()
+
 	return state.user.GetDB().Read(ctx, fn)
 }
 
-func stateDBReadResult[T any](ctx context.Context, state *State, fn func(context.Context, db.ReadOnly) (T, error)) (T, error) {
+func stateDBReadResult[T any](ctx context.Context, state *State, fn func(context.Context, db.ReadOnly) (T, error)) (_ T, err error) {
+	ctx, span := telemetry.Start(ctx, "db.read")
+	defer func() { telemetry.End(span, err) }()
+
 	return db.ClientReadType(ctx, state.user.GetDB(), fn)
 }
 
-func stateDBWrite(ctx context.Context, state *State, fn func(context.Context, db.Transaction) ([]Update, error)) error {
+func stateDBWrite(ctx context.Context, state *State, fn func(context.Context, db.Transaction) ([]Update, error)) (err error) {
+	ctx, span := telemetry.Start(ctx, "db.write")
+	defer func() { telemetry.End(span, err) }()
+
 	var updates []Update
 
 	if err := state.user.GetDB().Write(ctx, func(ctx context.Context, tx db.Transaction) error {
@@ -920,7 +986,10 @@ func stateDBWrite(ctx context.Context, state *State, fn func(context.Context, db
 	return nil
 }
 
-func stateDBWriteResult[T any](ctx context.Context, state *State, fn func(context.Context, db.Transaction) ([]Update, T, error)) (T, error) {
+func stateDBWriteResult[T any](ctx context.Context, state *State, fn func(context.Context, db.Transaction) ([]Update, T, error)) (_ T, err error) {
+	ctx, span := telemetry.Start(ctx, "db.write")
+	defer func() { telemetry.End(span, err) }()
+
 	var updates []Update
 
 	result, err := db.ClientWriteType(ctx, state.user.GetDB(), func(ctx context.Context, tx db.Transaction) (T, error) {
@@ -944,3 +1013,32 @@ func stateDBWriteResult[T any](ctx context.Context, state *State, fn func(contex
 
 	return result, nil
 }
+
+func stateStoreGet(ctx context.Context, state *State, id imap.InternalMessageID) (_ []byte, err error) {
+	_, span := telemetry.Start(ctx, "store.get", telemetry.MessageIDKey.String(id.ShortID()))
+	defer func() { telemetry.End(span, err) }()
+
+	literal, err := state.user.GetStore().Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(telemetry.MessageSizeKey.Int(len(literal)))
+
+	return literal, nil
+}
+
+func stateStoreSet(ctx context.Context, state *State, id imap.InternalMessageID, literal io.Reader, size int) (err error) {
+	_, span := telemetry.Start(ctx, "store.set", telemetry.MessageIDKey.String(id.ShortID()), telemetry.MessageSizeKey.Int(size))
+	defer func() { telemetry.End(span, err) }()
+
+	return state.user.GetStore().Set(id, literal)
+}
+
+// stateStoreSetUnchecked stores the literal of a newly created message, which no one else can be accessing yet.
+func stateStoreSetUnchecked(ctx context.Context, state *State, id imap.InternalMessageID, literal io.Reader, size int) (err error) {
+	_, span := telemetry.Start(ctx, "store.set", telemetry.MessageIDKey.String(id.ShortID()), telemetry.MessageSizeKey.Int(size))
+	defer func() { telemetry.End(span, err) }()
+
+	return state.user.GetStore().SetUnchecked(id, literal)
+}
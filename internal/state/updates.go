@@ -536,3 +536,26 @@ func (u *uidValidityBumpedStateUpdate) Apply(ctx context.Context, tx db.Transact
 func (u *uidValidityBumpedStateUpdate) String() string {
 	return "UIDValidityBumpedStateUpdate"
 }
+
+type alertStateUpdate struct {
+	alert string
+}
+
+func NewAlertStateUpdate(alert string) Update {
+	return &alertStateUpdate{alert: alert}
+}
+
+// Filter accepts every state as alerts are relevant whether or not a mailbox is selected.
+func (u *alertStateUpdate) Filter(*State) bool {
+	return true
+}
+
+func (u *alertStateUpdate) Apply(ctx context.Context, tx db.Transaction, s *State) error {
+	s.pushAlert(u.alert)
+
+	return nil
+}
+
+func (u *alertStateUpdate) String() string {
+	return fmt.Sprintf("AlertStateUpdate: %v", u.alert)
+}
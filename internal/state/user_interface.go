@@ -5,6 +5,7 @@ import (
 
 	"github.com/ProtonMail/gluon/db"
 	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/internal/search"
 	"github.com/ProtonMail/gluon/internal/utils"
 	"github.com/ProtonMail/gluon/store"
 )
@@ -32,4 +33,7 @@ type UserInterface interface {
 	GenerateUIDValidity() (imap.UID, error)
 
 	GetRecoveredMessageHashesMap() *utils.MessageHashesMap
+
+	// GetSearchIndex returns the user's full-text search index, or nil if indexing is disabled.
+	GetSearchIndex() *search.Index
 }
@@ -0,0 +1,14 @@
+package limits
+
+// Connections limits how many sessions may be connected at once. A limit of zero disables it.
+type Connections struct {
+	// MaxTotal is how many sessions may be connected to the server. Further connections are refused at greeting.
+	MaxTotal int
+
+	// MaxPerIP is how many sessions may be connected from the same remote IP. Further connections from it are refused
+	// at greeting.
+	MaxPerIP int
+
+	// MaxPerUser is how many sessions may be logged in to the same user. Further logins to it are refused.
+	MaxPerUser int
+}
@@ -0,0 +1,50 @@
+package limits
+
+import "time"
+
+// LoginThrottle decides how failed logins are throttled. Failures are counted separately for each remote address and
+// each username, so that a client failing to log in only holds back logins from its own address and for the username
+// it tries.
+type LoginThrottle struct {
+	// MaxAttempts is the number of failed logins after which further logins from the same address or for the same
+	// username are delayed. Logins are delayed again after each further MaxAttempts failures.
+	MaxAttempts int
+
+	// Delay is how long logins are delayed the first time. Each further time, the delay doubles, up to MaxDelay.
+	// If MaxDelay is zero, the delay doesn't grow.
+	Delay    time.Duration
+	MaxDelay time.Duration
+
+	// ResetAfter is how long after its last failed login an address or username starts over with no failures.
+	// A successful login also clears the failures of its username, but not of its address. If ResetAfter is zero,
+	// failures are only cleared by successful logins.
+	ResetAfter time.Duration
+}
+
+// DefaultLoginThrottle returns the policy used unless another is configured. Logins aren't delayed until Delay is set.
+func DefaultLoginThrottle() LoginThrottle {
+	return LoginThrottle{
+		MaxAttempts: 3,
+		MaxDelay:    5 * time.Minute,
+		ResetAfter:  15 * time.Minute,
+	}
+}
+
+// DelayAfter returns how long logins are delayed once the given number of logins failed, or zero if they aren't.
+func (t LoginThrottle) DelayAfter(failures int) time.Duration {
+	if t.MaxAttempts <= 0 || failures < t.MaxAttempts || failures%t.MaxAttempts != 0 {
+		return 0
+	}
+
+	delay := t.Delay
+
+	for i := 1; i < failures/t.MaxAttempts && delay < t.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	if t.MaxDelay > 0 && delay > t.MaxDelay {
+		return t.MaxDelay
+	}
+
+	return delay
+}
@@ -0,0 +1,32 @@
+package limits
+
+import "time"
+
+// SessionTimeouts decides how long sessions may stay inactive before the server logs them out. A timeout of zero
+// disables it.
+type SessionTimeouts struct {
+	// PreAuth is how long a session which isn't logged in yet may wait between commands.
+	PreAuth time.Duration
+
+	// AutoLogout is how long a logged in session may wait between commands. RFC 9051 requires it to be at least
+	// 30 minutes.
+	AutoLogout time.Duration
+
+	// Idle is how long a session may stay in IDLE before it is logged out. Clients are expected to restart IDLE
+	// before that, as RFC 2177 recommends doing every 29 minutes.
+	Idle time.Duration
+
+	// IdleKeepalive is how often an untagged OK is sent to sessions in IDLE, so that connections with nothing to
+	// report aren't dropped by NATs and firewalls in the way.
+	IdleKeepalive time.Duration
+}
+
+// DefaultSessionTimeouts returns the timeouts used unless others are configured.
+func DefaultSessionTimeouts() SessionTimeouts {
+	return SessionTimeouts{
+		PreAuth:       2 * time.Minute,
+		AutoLogout:    30 * time.Minute,
+		Idle:          30 * time.Minute,
+		IdleKeepalive: 2 * time.Minute,
+	}
+}
@@ -0,0 +1,55 @@
+// Package listener describes how the server treats the connections accepted from each of its listeners.
+package listener
+
+import (
+	"crypto/tls"
+
+	"github.com/ProtonMail/gluon/auth"
+)
+
+// Security decides whether connections accepted from a listener use TLS.
+type Security int
+
+const (
+	// StartTLS serves plaintext connections which clients may upgrade with STARTTLS, as on port 143. STARTTLS is only
+	// offered if there is a TLS config.
+	StartTLS Security = iota
+
+	// ImplicitTLS serves connections over TLS from the start, as on port 993.
+	ImplicitTLS
+
+	// PlaintextLoopback serves plaintext connections from loopback addresses only; others are refused.
+	PlaintextLoopback
+)
+
+func (s Security) String() string {
+	switch s {
+	case StartTLS:
+		return "starttls"
+
+	case ImplicitTLS:
+		return "implicit-tls"
+
+	case PlaintextLoopback:
+		return "plaintext-loopback"
+
+	default:
+		return "unknown"
+	}
+}
+
+// Policy decides how the server treats the connections accepted from a listener.
+type Policy struct {
+	Security Security
+
+	// TLSConfig is used for the connections of the listener instead of the server's, set with gluon.WithTLS.
+	TLSConfig *tls.Config
+
+	// RequireTLS refuses logins until the connection uses TLS, advertising LOGINDISABLED meanwhile.
+	RequireTLS bool
+
+	// CertAuthenticator lets clients which presented a certificate during the TLS handshake log in with
+	// AUTHENTICATE EXTERNAL. The TLS config must ask clients for certificates and verify them, for instance with
+	// tls.VerifyClientCertIfGiven.
+	CertAuthenticator auth.CertificateAuthenticator
+}
@@ -0,0 +1,218 @@
+package listener
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"syscall"
+	"time"
+
+	"github.com/ProtonMail/gluon/async"
+	"github.com/ProtonMail/gluon/logging"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultProxyHeaderTimeout bounds how long a trusted proxy may take to send the PROXY header of a connection.
+	defaultProxyHeaderTimeout = 10 * time.Second
+
+	// minAcceptBackoff and maxAcceptBackoff bound how long accepting waits after a temporary error, doubling each time.
+	minAcceptBackoff = 5 * time.Millisecond
+	maxAcceptBackoff = time.Second
+)
+
+// ProxyConfig decides which connections of a proxy listener carry a PROXY protocol header.
+type ProxyConfig struct {
+	// TrustedSources are the networks of the proxies in front of the listener. Connections from them must start with
+	// a PROXY header, v1 or v2, giving the address of the client. Connections from elsewhere are served as they are.
+	TrustedSources []netip.Prefix
+
+	// HeaderTimeout bounds how long trusted proxies may take to send the header. It defaults to 10 seconds.
+	HeaderTimeout time.Duration
+}
+
+// NewProxyListener returns a listener accepting the connections of the given one, with the client addresses given by
+// the PROXY protocol headers of trusted proxies as their remote addresses. Connections from trusted proxies without a
+// valid header are closed without being returned. Panics while accepting connections are passed to the panic handler.
+func NewProxyListener(l net.Listener, config ProxyConfig, panicHandler async.PanicHandler) net.Listener {
+	if config.HeaderTimeout <= 0 {
+		config.HeaderTimeout = defaultProxyHeaderTimeout
+	}
+
+	proxy := &proxyListener{
+		Listener:     l,
+		config:       config,
+		connCh:       make(chan net.Conn),
+		doneCh:       make(chan struct{}),
+		panicHandler: panicHandler,
+		log:          logrus.WithField("pkg", "gluon/listener").WithField("addr", l.Addr()),
+	}
+
+	async.GoAnnotated(context.Background(), panicHandler, func(context.Context) {
+		proxy.accept()
+	}, logging.Labels{
+		"Action": "Accepting proxied connections",
+		"Addr":   l.Addr().String(),
+	})
+
+	return proxy
+}
+
+type proxyListener struct {
+	net.Listener
+
+	config ProxyConfig
+
+	// connCh holds the connections whose header was read.
+	connCh chan net.Conn
+
+	// doneCh is closed once the underlying listener failed to accept with err.
+	doneCh chan struct{}
+	err    error
+
+	panicHandler async.PanicHandler
+
+	log *logrus.Entry
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.connCh:
+		return conn, nil
+
+	case <-l.doneCh:
+		return nil, l.err
+	}
+}
+
+// accept reads the headers of the accepted connections concurrently so that slow proxies don't hold up others.
+// Temporary errors, such as running out of file descriptors, are retried after a growing delay.
+func (l *proxyListener) accept() {
+	defer close(l.doneCh)
+
+	var backoff time.Duration
+
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			if !isTemporaryAcceptError(err) {
+				l.err = err
+				return
+			}
+
+			backoff = min(max(2*backoff, minAcceptBackoff), maxAcceptBackoff)
+
+			l.log.WithError(err).WithField("backoff", backoff).Warn("Failed to accept connection, retrying")
+
+			time.Sleep(backoff)
+
+			continue
+		}
+
+		backoff = 0
+
+		async.GoAnnotated(context.Background(), l.panicHandler, func(context.Context) {
+			l.serveConn(conn)
+		}, logging.Labels{
+			"Action":     "Reading PROXY header",
+			"RemoteAddr": conn.RemoteAddr().String(),
+		})
+	}
+}
+
+// serveConn reads the header of the given connection and passes it to Accept.
+func (l *proxyListener) serveConn(conn net.Conn) {
+	conn, err := l.readHeader(conn)
+	if err != nil {
+		l.log.WithError(err).WithField("remoteAddr", conn.RemoteAddr()).Debug("Dropping connection with invalid PROXY header")
+		_ = conn.Close()
+
+		return
+	}
+
+	select {
+	case l.connCh <- conn:
+
+	case <-l.doneCh:
+		_ = conn.Close()
+	}
+}
+
+// isTemporaryAcceptError returns whether accepting may succeed again after the given error, for instance once file
+// descriptors were released.
+func isTemporaryAcceptError(err error) bool {
+	for _, errno := range []syscall.Errno{syscall.EMFILE, syscall.ENFILE, syscall.ENOBUFS, syscall.ENOMEM, syscall.ECONNABORTED} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readHeader returns the given connection with the client address given by its PROXY header, if it comes from a
+// trusted proxy.
+func (l *proxyListener) readHeader(conn net.Conn) (net.Conn, error) {
+	if !l.isTrusted(conn.RemoteAddr()) {
+		return conn, nil
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(l.config.HeaderTimeout)); err != nil {
+		return conn, err
+	}
+
+	r := bufio.NewReader(conn)
+
+	remoteAddr, err := readProxyHeader(r)
+	if err != nil {
+		return conn, err
+	}
+
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return conn, err
+	}
+
+	// Proxies may send health checks which aren't relayed for any client.
+	if remoteAddr == nil {
+		remoteAddr = conn.RemoteAddr()
+	}
+
+	return &proxyConn{Conn: conn, r: r, remoteAddr: remoteAddr}, nil
+}
+
+func (l *proxyListener) isTrusted(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+
+	ip := tcpAddr.AddrPort().Addr().Unmap()
+
+	for _, prefix := range l.config.TrustedSources {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// proxyConn is a connection relayed by a proxy for the client at remoteAddr.
+type proxyConn struct {
+	net.Conn
+
+	// r holds what the proxy sent after the header.
+	r *bufio.Reader
+
+	remoteAddr net.Addr
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
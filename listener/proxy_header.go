@@ -0,0 +1,169 @@
+package listener
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidProxyHeader is returned when a trusted proxy sends a malformed PROXY protocol header.
+var ErrInvalidProxyHeader = errors.New("invalid PROXY protocol header")
+
+// proxyV2Signature starts the binary v2 header.
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyV1MaxLength is the length of the longest v1 header, including its CRLF.
+const proxyV1MaxLength = 107
+
+// readProxyHeader reads a PROXY protocol header of either version and returns the address of the client it gives.
+// It returns a nil address for headers which don't relay a client, such as those of health checks.
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	// A v1 header is never shorter than the v2 signature.
+	signature, err := r.Peek(len(proxyV2Signature))
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(signature, proxyV2Signature) {
+		return readProxyV2Header(r)
+	}
+
+	return readProxyV1Header(r)
+}
+
+// readProxyV1Header reads a text header such as "PROXY TCP4 192.0.2.1 198.51.100.1 56324 143\r\n".
+func readProxyV1Header(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= proxyV1MaxLength {
+			return nil, fmt.Errorf("%w: v1 header too long", ErrInvalidProxyHeader)
+		}
+
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		line = append(line, b)
+	}
+
+	fields := strings.Split(strings.TrimSuffix(string(line), "\r\n"), " ")
+
+	if fields[0] != "PROXY" || len(fields) < 2 {
+		return nil, fmt.Errorf("%w: not a PROXY header", ErrInvalidProxyHeader)
+	}
+
+	switch fields[1] {
+	case "UNKNOWN":
+		return nil, nil
+
+	case "TCP4", "TCP6":
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("%w: expected 6 fields, got %v", ErrInvalidProxyHeader, len(fields))
+		}
+
+	default:
+		return nil, fmt.Errorf("%w: unsupported protocol %q", ErrInvalidProxyHeader, fields[1])
+	}
+
+	source, err := parseProxyV1Addr(fields[1], fields[2], fields[4], "source")
+	if err != nil {
+		return nil, err
+	}
+
+	// The destination isn't used, but a header with a malformed one is as invalid as with a malformed source.
+	if _, err := parseProxyV1Addr(fields[1], fields[3], fields[5], "destination"); err != nil {
+		return nil, err
+	}
+
+	return net.TCPAddrFromAddrPort(source), nil
+}
+
+// parseProxyV1Addr parses an address and port of a v1 header of the given protocol.
+func parseProxyV1Addr(proto, addr, port, name string) (netip.AddrPort, error) {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("%w: invalid %v address: %v", ErrInvalidProxyHeader, name, err)
+	}
+
+	if ip.Is4() != (proto == "TCP4") {
+		return netip.AddrPort{}, fmt.Errorf("%w: %v address %v isn't a %v address", ErrInvalidProxyHeader, name, ip, proto)
+	}
+
+	n, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("%w: invalid %v port %q", ErrInvalidProxyHeader, name, port)
+	}
+
+	return netip.AddrPortFrom(ip, uint16(n)), nil
+}
+
+// readProxyV2Header reads a binary header: the signature, the version and command, the address family and protocol,
+// the length of the rest, then the addresses and any TLVs, which are ignored.
+func readProxyV2Header(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, len(proxyV2Signature)+4)
+
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	verCmd, famProto := header[len(proxyV2Signature)], header[len(proxyV2Signature)+1]
+
+	if verCmd>>4 != 2 {
+		return nil, fmt.Errorf("%w: unsupported version %v", ErrInvalidProxyHeader, verCmd>>4)
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(header[len(proxyV2Signature)+2:]))
+
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	switch verCmd & 0x0F {
+	case 0x0: // LOCAL
+		return nil, nil
+
+	case 0x1: // PROXY
+
+	default:
+		return nil, fmt.Errorf("%w: unsupported command %v", ErrInvalidProxyHeader, verCmd&0x0F)
+	}
+
+	var ipLen int
+
+	switch famProto {
+	case 0x11: // TCP over IPv4
+		ipLen = net.IPv4len
+
+	case 0x21: // TCP over IPv6
+		ipLen = net.IPv6len
+
+	case 0x00, 0x31: // UNSPEC or UNIX stream, which carry no client address.
+		return nil, nil
+
+	default:
+		return nil, fmt.Errorf("%w: unsupported address family and protocol %#x", ErrInvalidProxyHeader, famProto)
+	}
+
+	// The source and destination addresses are followed by the source and destination ports.
+	if len(payload) < 2*ipLen+4 {
+		return nil, fmt.Errorf("%w: addresses too short", ErrInvalidProxyHeader)
+	}
+
+	ip, ok := netip.AddrFromSlice(payload[:ipLen])
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid source address", ErrInvalidProxyHeader)
+	}
+
+	port := binary.BigEndian.Uint16(payload[2*ipLen:])
+
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, port)), nil
+}
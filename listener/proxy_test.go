@@ -0,0 +1,170 @@
+package listener
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/ProtonMail/gluon/async"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadProxyHeader(t *testing.T) {
+	v2 := func(verCmd, famProto byte, payload ...byte) string {
+		return string(proxyV2Signature) + string([]byte{verCmd, famProto, 0, byte(len(payload))}) + string(payload)
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		want   string
+		err    bool
+	}{
+		{name: "v1 tcp4", header: "PROXY TCP4 192.0.2.1 198.51.100.1 56324 143\r\n", want: "192.0.2.1:56324"},
+		{name: "v1 tcp6", header: "PROXY TCP6 2001:db8::1 2001:db8::2 56324 143\r\n", want: "[2001:db8::1]:56324"},
+		{name: "v1 unknown", header: "PROXY UNKNOWN\r\n"},
+		{name: "v1 family mismatch", header: "PROXY TCP4 2001:db8::1 2001:db8::2 56324 143\r\n", err: true},
+		{name: "v1 bad port", header: "PROXY TCP4 192.0.2.1 198.51.100.1 70000 143\r\n", err: true},
+		{name: "v1 bad destination", header: "PROXY TCP4 192.0.2.1 198.51.100 56324 143\r\n", err: true},
+		{name: "v1 destination family mismatch", header: "PROXY TCP4 192.0.2.1 2001:db8::2 56324 143\r\n", err: true},
+		{name: "v1 bad destination port", header: "PROXY TCP4 192.0.2.1 198.51.100.1 56324 imap\r\n", err: true},
+		{name: "v1 missing fields", header: "PROXY TCP4 192.0.2.1\r\n", err: true},
+		{name: "v1 too long", header: "PROXY " + strings.Repeat("A", proxyV1MaxLength) + "\r\n", err: true},
+		{name: "not a header", header: "A001 CAPABILITY\r\n", err: true},
+		{name: "v2 tcp4", header: v2(0x21, 0x11, 192, 0, 2, 1, 198, 51, 100, 1, 0xDC, 0x04, 0, 143), want: "192.0.2.1:56324"},
+		{name: "v2 local", header: v2(0x20, 0x00)},
+		{name: "v2 short addresses", header: v2(0x21, 0x11, 192, 0, 2, 1), err: true},
+		{name: "v2 bad version", header: v2(0x11, 0x11, 192, 0, 2, 1, 198, 51, 100, 1, 0xDC, 0x04, 0, 143), err: true},
+		{name: "v2 udp", header: v2(0x21, 0x12, 192, 0, 2, 1, 198, 51, 100, 1, 0xDC, 0x04, 0, 143), err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(tc.header + "A001 NOOP\r\n"))
+
+			addr, err := readProxyHeader(r)
+			if tc.err {
+				require.ErrorIs(t, err, ErrInvalidProxyHeader)
+				return
+			}
+
+			require.NoError(t, err)
+
+			if tc.want == "" {
+				require.Nil(t, addr)
+			} else {
+				require.Equal(t, tc.want, addr.String())
+			}
+
+			// What follows the header is left to read.
+			rest, err := io.ReadAll(r)
+			require.NoError(t, err)
+			require.Equal(t, "A001 NOOP\r\n", string(rest))
+		})
+	}
+}
+
+func TestProxyListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	proxy := NewProxyListener(l, ProxyConfig{TrustedSources: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}}, async.NoopPanicHandler{})
+	defer proxy.Close()
+
+	// A connection without a valid header is dropped.
+	bad, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer bad.Close()
+
+	_, err = bad.Write([]byte("A001 CAPABILITY\r\n"))
+	require.NoError(t, err)
+
+	// A connection with one is accepted with the client's address.
+	good, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer good.Close()
+
+	_, err = good.Write([]byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 143\r\nA001 NOOP\r\n"))
+	require.NoError(t, err)
+
+	conn, err := proxy.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.Equal(t, "192.0.2.1:56324", conn.RemoteAddr().String())
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "A001 NOOP\r\n", line)
+
+	_, err = bad.Read(make([]byte, 1))
+	require.Error(t, err)
+
+	// Closing the listener ends Accept.
+	require.NoError(t, proxy.Close())
+
+	_, err = proxy.Accept()
+	require.ErrorIs(t, err, net.ErrClosed)
+}
+
+func TestProxyListenerUntrusted(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	proxy := NewProxyListener(l, ProxyConfig{TrustedSources: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}}, async.NoopPanicHandler{})
+	defer proxy.Close()
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+
+	// Connections from elsewhere keep their own address.
+	conn, err := proxy.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.Equal(t, client.LocalAddr().String(), conn.RemoteAddr().String())
+}
+
+func TestProxyListenerTemporaryError(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	// Accepting fails as when the process ran out of file descriptors.
+	proxy := NewProxyListener(&failingListener{Listener: l, errs: []error{
+		&net.OpError{Op: "accept", Net: "tcp", Err: syscall.EMFILE},
+		&net.OpError{Op: "accept", Net: "tcp", Err: syscall.EMFILE},
+	}}, ProxyConfig{}, async.NoopPanicHandler{})
+	defer proxy.Close()
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+
+	// The connection is still accepted once the errors are over.
+	conn, err := proxy.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+}
+
+// failingListener fails to accept with the given errors before accepting connections.
+type failingListener struct {
+	net.Listener
+
+	errs []error
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	if len(l.errs) > 0 {
+		err := l.errs[0]
+		l.errs = l.errs[1:]
+
+		return nil, err
+	}
+
+	return l.Listener.Accept()
+}
@@ -0,0 +1,43 @@
+package gluon
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/ProtonMail/gluon/listener"
+)
+
+// checkListenerPolicy returns ErrInvalidListenerPolicy if the given policy can't be applied. The policy's TLS config
+// is the one its connections use, whether it was set on the policy or on the server.
+func checkListenerPolicy(policy listener.Policy) error {
+	hasTLS := policy.TLSConfig != nil && policy.Security != listener.PlaintextLoopback
+
+	switch {
+	case policy.Security == listener.ImplicitTLS && policy.TLSConfig == nil:
+		return fmt.Errorf("%w: implicit TLS needs a TLS config", ErrInvalidListenerPolicy)
+
+	case policy.RequireTLS && !hasTLS:
+		return fmt.Errorf("%w: TLS is required but unavailable", ErrInvalidListenerPolicy)
+
+	case policy.CertAuthenticator != nil && !hasTLS:
+		return fmt.Errorf("%w: client certificates need TLS", ErrInvalidListenerPolicy)
+
+	default:
+		return nil
+	}
+}
+
+// isLoopback returns whether the given remote address is on this host.
+func isLoopback(addr net.Addr) bool {
+	if addr == nil {
+		return false
+	}
+
+	if addr.Network() == "unix" {
+		return true
+	}
+
+	ip := net.ParseIP(remoteIP(addr))
+
+	return ip != nil && ip.IsLoopback()
+}
@@ -58,3 +58,15 @@ func GenerateDatabaseMigrationFailed() map[string]interface{} {
 func GenerateFailedToStoreFlagsOnMessages() map[string]interface{} {
 	return generateGluonErrorMetric("failedToStoreFlagsOnMessages")
 }
+
+func GenerateTooManyConnectionsMetric() map[string]interface{} {
+	return generateGluonErrorMetric("tooManyConnections")
+}
+
+func GenerateTooManyConnectionsFromIPMetric() map[string]interface{} {
+	return generateGluonErrorMetric("tooManyConnectionsFromIP")
+}
+
+func GenerateTooManyUserConnectionsMetric() map[string]interface{} {
+	return generateGluonErrorMetric("tooManyUserConnections")
+}
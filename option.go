@@ -6,14 +6,19 @@ import (
 	"time"
 
 	"github.com/ProtonMail/gluon/async"
+	"github.com/ProtonMail/gluon/auth"
 	"github.com/ProtonMail/gluon/db"
 	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/internal/db_impl/memory"
+	"github.com/ProtonMail/gluon/internal/db_impl/sqlite3"
 	limits2 "github.com/ProtonMail/gluon/limits"
 	"github.com/ProtonMail/gluon/observability"
 	"github.com/ProtonMail/gluon/profiling"
 	"github.com/ProtonMail/gluon/reporter"
 	"github.com/ProtonMail/gluon/store"
+	"github.com/ProtonMail/gluon/trace"
 	"github.com/ProtonMail/gluon/version"
+	oteltrace "go.opentelemetry.io/otel/trace"
 )
 
 // Option represents a type that can be used to configure the server.
@@ -37,6 +42,7 @@ func (opt withDelimiter) config(builder *serverBuilder) {
 }
 
 // WithLoginJailTime instructs the server to use the given login jail time.
+// It is the delay before further logins after the first too many failed ones; see WithLoginThrottle.
 func WithLoginJailTime(loginJailTime time.Duration) Option {
 	return &withLoginJailTime{
 		loginJailTime: loginJailTime,
@@ -44,13 +50,46 @@ func WithLoginJailTime(loginJailTime time.Duration) Option {
 }
 
 func (opt withLoginJailTime) config(builder *serverBuilder) {
-	builder.loginJailTime = opt.loginJailTime
+	builder.loginThrottle.Delay = opt.loginJailTime
 }
 
 type withLoginJailTime struct {
 	loginJailTime time.Duration
 }
 
+// WithLoginThrottle sets how failed logins are throttled. Failures are counted by remote address and by username, and
+// logins are delayed for longer each time either fails too often. The default is limits.DefaultLoginThrottle, with
+// the delay set by WithLoginJailTime.
+func WithLoginThrottle(throttle limits2.LoginThrottle) Option {
+	return &withLoginThrottle{
+		throttle: throttle,
+	}
+}
+
+func (opt withLoginThrottle) config(builder *serverBuilder) {
+	builder.loginThrottle = opt.throttle
+}
+
+type withLoginThrottle struct {
+	throttle limits2.LoginThrottle
+}
+
+// WithAuthenticator decides which user each login is for with the given authenticator, instead of asking the
+// connectors of the loaded users to authorize it.
+func WithAuthenticator(authenticator auth.Authenticator) Option {
+	return &withAuthenticator{
+		authenticator: authenticator,
+	}
+}
+
+func (opt withAuthenticator) config(builder *serverBuilder) {
+	builder.authenticator = opt.authenticator
+}
+
+type withAuthenticator struct {
+	authenticator auth.Authenticator
+}
+
 // WithTLS instructs the server to use the given TLS config.
 func WithTLS(cfg *tls.Config) Option {
 	return &withTLS{
@@ -81,7 +120,41 @@ func (opt withIdleBulkTime) config(builder *serverBuilder) {
 	builder.idleBulkTime = opt.idleBulkTime
 }
 
+// WithSessionTimeouts sets how long sessions may stay inactive before they are logged out, and how often sessions in
+// IDLE are sent keepalives. The default is limits.DefaultSessionTimeouts.
+func WithSessionTimeouts(timeouts limits2.SessionTimeouts) Option {
+	return &withSessionTimeouts{
+		timeouts: timeouts,
+	}
+}
+
+type withSessionTimeouts struct {
+	timeouts limits2.SessionTimeouts
+}
+
+func (opt withSessionTimeouts) config(builder *serverBuilder) {
+	builder.sessionTimeouts = opt.timeouts
+}
+
+// WithConnectionLimits sets how many sessions may be connected at once, in total, from the same remote IP and logged in
+// to the same user. Connections over the limits are refused with a BYE [LIMIT] and logins with a NO [LIMIT]. There are
+// no limits by default.
+func WithConnectionLimits(limits limits2.Connections) Option {
+	return &withConnectionLimits{
+		limits: limits,
+	}
+}
+
+type withConnectionLimits struct {
+	limits limits2.Connections
+}
+
+func (opt withConnectionLimits) config(builder *serverBuilder) {
+	builder.connLimits = opt.limits
+}
+
 // WithLogger instructs the server to write incoming and outgoing IMAP communication to the given io.Writers.
+// Everything is written as is, including passwords and messages; see WithTrace for traces which can be shared.
 func WithLogger(in, out io.Writer) Option {
 	return &withLogger{
 		in:  in,
@@ -98,6 +171,25 @@ func (opt withLogger) config(builder *serverBuilder) {
 	builder.outLogger = opt.out
 }
 
+// WithTrace instructs the server to record the IMAP communication of all sessions to the given sink, with the
+// given redaction applied. Use trace.NewJSONSink to write JSON lines.
+func WithTrace(sink trace.Sink, redaction trace.Redaction) Option {
+	return &withTrace{
+		sink:      sink,
+		redaction: redaction,
+	}
+}
+
+type withTrace struct {
+	sink      trace.Sink
+	redaction trace.Redaction
+}
+
+func (opt withTrace) config(builder *serverBuilder) {
+	builder.traceSink = opt.sink
+	builder.traceRedaction = opt.redaction
+}
+
 type withVersionInfo struct {
 	versionInfo version.Info
 }
@@ -195,6 +287,63 @@ func WithDisableParallelism() Option {
 	return &withDisableParallelism{}
 }
 
+type withRejectUnavailableLogins struct{}
+
+func (withRejectUnavailableLogins) config(builder *serverBuilder) {
+	builder.rejectUnavailable = true
+}
+
+// WithRejectUnavailableLogins instructs the server to reject logins of users whose connector reported itself as
+// offline or whose authentication expired. Such logins are answered with BYE [UNAVAILABLE].
+func WithRejectUnavailableLogins() Option {
+	return &withRejectUnavailableLogins{}
+}
+
+type withFlagConflictPolicy struct {
+	policy imap.FlagConflictPolicy
+}
+
+func (opt withFlagConflictPolicy) config(builder *serverBuilder) {
+	builder.flagConflictPolicy = opt.policy
+}
+
+// WithFlagConflictPolicy sets how a message's flags are resolved when a client changes them while the connector
+// concurrently reports different flags for the same message. The default is imap.FlagConflictRemoteWins.
+// Every detected conflict is published as an events.MessageFlagsConflict event.
+func WithFlagConflictPolicy(policy imap.FlagConflictPolicy) Option {
+	return &withFlagConflictPolicy{policy: policy}
+}
+
+type withSearchIndex struct{}
+
+func (withSearchIndex) config(builder *serverBuilder) {
+	builder.searchIndex = true
+}
+
+// WithSearchIndex maintains an encrypted full-text index of each user's messages in the data directory.
+// BODY and TEXT searches use it to avoid reading every message from the store; messages which aren't indexed yet
+// are scanned as usual.
+func WithSearchIndex() Option {
+	return &withSearchIndex{}
+}
+
+type withStoreBudget struct {
+	budget int64
+}
+
+func (opt withStoreBudget) config(builder *serverBuilder) {
+	builder.storeBudget = opt.budget
+}
+
+// WithStoreBudget limits the space the message literals of each user may take on disk to the given number of bytes.
+// Once the budget is exceeded, the least recently used literals are evicted and fetched from the connector again
+// when they are next needed. Literals of messages the connector doesn't know, such as recovered messages, are never
+// evicted. The store must implement store.Evictor, as the on-disk store does; users of other stores fail to load.
+// A budget of zero means no limit.
+func WithStoreBudget(bytes int64) Option {
+	return &withStoreBudget{budget: bytes}
+}
+
 type withPanicHandler struct {
 	panicHandler async.PanicHandler
 }
@@ -245,6 +394,18 @@ func WithDBClient(ci db.ClientInterface) Option {
 	return &withDBClient{ci: ci}
 }
 
+// WithInMemoryDB keeps each user's database in memory rather than in the database directory.
+// The databases are lost when the server stops, which makes this suitable for tests and ephemeral deployments only.
+func WithInMemoryDB() Option {
+	return &withDBClient{ci: memory.NewBuilder()}
+}
+
+// WithEncryptedDB encrypts each user's database with a key derived from the passphrase the user is loaded with, the
+// same way its messages are. Existing plaintext databases are encrypted when their user is next loaded.
+func WithEncryptedDB() Option {
+	return &withDBClient{ci: sqlite3.NewBuilder(sqlite3.Encrypt())}
+}
+
 type withObservabilitySender struct {
 	sender observability.Sender
 }
@@ -257,3 +418,18 @@ func WithObservabilitySender(sender observability.Sender, imapErrorType, message
 	observability.SetupMetricTypes(imapErrorType, messageErrorType, otherErrorType)
 	return &withObservabilitySender{sender: sender}
 }
+
+// WithTracerProvider instructs the server to record OpenTelemetry spans with the given provider: one per IMAP command,
+// with children for the database transactions, store accesses and connector calls it makes.
+// Without it, no spans are recorded.
+func WithTracerProvider(provider oteltrace.TracerProvider) Option {
+	return &withTracerProvider{provider: provider}
+}
+
+type withTracerProvider struct {
+	provider oteltrace.TracerProvider
+}
+
+func (opt withTracerProvider) config(builder *serverBuilder) {
+	builder.tracerProvider = opt.provider
+}
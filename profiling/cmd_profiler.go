@@ -31,6 +31,7 @@ const (
 	CmdTypeUIDStore
 	CmdTypeUIDFetch
 	CmdTypeUIDSearch
+	CmdTypeAuthenticate
 	CmdTypeTotal
 )
 
@@ -96,6 +97,8 @@ func CmdTypeToString(cmdType int) string {
 		return "USTORE "
 	case CmdTypeUIDSearch:
 		return "USEARCH"
+	case CmdTypeAuthenticate:
+		return "AUTH   "
 
 	default:
 		return "Unknown"
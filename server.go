@@ -15,18 +15,24 @@ import (
 	"github.com/ProtonMail/gluon/connector"
 	"github.com/ProtonMail/gluon/events"
 	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/integrity"
 	"github.com/ProtonMail/gluon/internal/backend"
 	"github.com/ProtonMail/gluon/internal/contexts"
 	"github.com/ProtonMail/gluon/internal/session"
+	"github.com/ProtonMail/gluon/limits"
+	"github.com/ProtonMail/gluon/listener"
 	"github.com/ProtonMail/gluon/logging"
 	"github.com/ProtonMail/gluon/observability"
 	"github.com/ProtonMail/gluon/profiling"
 	"github.com/ProtonMail/gluon/reporter"
 	"github.com/ProtonMail/gluon/store"
+	"github.com/ProtonMail/gluon/telemetry"
+	"github.com/ProtonMail/gluon/trace"
 	"github.com/ProtonMail/gluon/version"
 	"github.com/ProtonMail/gluon/watcher"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/sirupsen/logrus"
+	oteltrace "go.opentelemetry.io/otel/trace"
 )
 
 // Server is the gluon IMAP server.
@@ -50,9 +56,19 @@ type Server struct {
 	// serveDoneCh is used to stop the server.
 	serveDoneCh chan struct{}
 
+	// drainCh is closed once the server is draining; the listeners are closed and sessions asked to close.
+	drainCh chan struct{}
+
+	// listeners holds the listeners being served, which are closed when the server drains.
+	listeners     map[net.Listener]struct{}
+	listenersLock sync.Mutex
+
 	// serveWG keeps track of serving goroutines.
 	serveWG async.WaitGroup
 
+	// backendEventsDoneCh is closed once all events published by the backend have been forwarded to the watchers.
+	backendEventsDoneCh chan struct{}
+
 	// nextID holds the ID that will be given to the next session.
 	nextID     int
 	nextIDLock sync.Mutex
@@ -60,6 +76,10 @@ type Server struct {
 	// inLogger and outLogger are used to log incoming and outgoing IMAP communications.
 	inLogger, outLogger io.Writer
 
+	// traceSink receives the IMAP communications of sessions, redacted with traceRedaction.
+	traceSink      trace.Sink
+	traceRedaction trace.Redaction
+
 	// tlsConfig is used to serve over TLS.
 	tlsConfig *tls.Config
 
@@ -83,6 +103,12 @@ type Server struct {
 	// immediate response with no response merging.
 	idleBulkTime time.Duration
 
+	// sessionTimeouts decides how long sessions may stay inactive.
+	sessionTimeouts limits.SessionTimeouts
+
+	// connCounter counts connected sessions to enforce the connection limits.
+	connCounter *connCounter
+
 	// disableParallelism indicates whether the server is allowed to parallelize certain IMAP commands.
 	disableParallelism bool
 
@@ -91,6 +117,9 @@ type Server struct {
 	panicHandler async.PanicHandler
 
 	observabilitySender observability.Sender
+
+	// tracerProvider records the spans of commands and of the work they do, if set.
+	tracerProvider oteltrace.TracerProvider
 }
 
 // New creates a new server with the given options.
@@ -126,6 +155,7 @@ func (s *Server) AddUser(ctx context.Context, conn connector.Connector, passphra
 func (s *Server) LoadUser(ctx context.Context, conn connector.Connector, userID string, passphrase []byte) (bool, error) {
 	ctx = observability.NewContextWithObservabilitySender(ctx, s.observabilitySender)
 	ctx = reporter.NewContextWithReporter(ctx, s.reporter)
+	ctx = telemetry.NewContextWithTracerProvider(ctx, s.tracerProvider)
 
 	isNew, err := s.backend.AddUser(ctx, userID, conn, passphrase, s.uidValidityGenerator)
 	if err != nil {
@@ -160,6 +190,78 @@ func (s *Server) RemoveUser(ctx context.Context, userID string, removeFiles bool
 	return nil
 }
 
+// DowngradeDatabase migrates the database of the given user back to an older schema version, so that an older version
+// of the server can use it. The user must not be loaded. It fails with db.ErrMigrationNotReversible, leaving the
+// database as is, if a migration since that version can't be reverted.
+func (s *Server) DowngradeDatabase(ctx context.Context, userID string, passphrase []byte, version int) error {
+	ctx = reporter.NewContextWithReporter(ctx, s.reporter)
+
+	return s.backend.DowngradeDatabase(ctx, userID, passphrase, version)
+}
+
+// ResyncUser brings the database of the given user in line with the given snapshot of the remote.
+// Unlike RemoveUser followed by AddUser, mailboxes keep their UIDVALIDITY and messages which still exist keep their
+// UIDs; only the differences between the snapshot and the database are applied, as regular imap updates.
+func (s *Server) ResyncUser(ctx context.Context, userID string, snapshot connector.Snapshot) error {
+	ctx = reporter.NewContextWithReporter(ctx, s.reporter)
+
+	return s.backend.ResyncUser(ctx, userID, snapshot)
+}
+
+// SetUserSieveScript sets the sieve script used to filter messages delivered to the inbox of the given user.
+// The script is validated before it is stored; scripts adding flags other than \Seen, \Flagged and $Forwarded are
+// rejected since the connector can't store them. An empty script disables filtering.
+func (s *Server) SetUserSieveScript(ctx context.Context, userID, script string) error {
+	ctx = reporter.NewContextWithReporter(ctx, s.reporter)
+
+	return s.backend.SetSieveScript(ctx, userID, script)
+}
+
+// GetUserSieveScript returns the sieve script of the given user, or an empty string if none is set.
+func (s *Server) GetUserSieveScript(ctx context.Context, userID string) (string, error) {
+	ctx = reporter.NewContextWithReporter(ctx, s.reporter)
+
+	return s.backend.GetSieveScript(ctx, userID)
+}
+
+// RebuildSearchIndex discards the full-text search index of the given user and indexes all its messages again.
+// It fails if the server wasn't built with WithSearchIndex.
+func (s *Server) RebuildSearchIndex(ctx context.Context, userID string) error {
+	ctx = reporter.NewContextWithReporter(ctx, s.reporter)
+
+	return s.backend.RebuildSearchIndex(ctx, userID)
+}
+
+// CheckUser checks the database and message store of the given user for inconsistencies while it stays online.
+// If repair is set, problems which can be fixed locally are fixed; the report tells which ones were.
+func (s *Server) CheckUser(ctx context.Context, userID string, repair bool) (*integrity.Report, error) {
+	ctx = reporter.NewContextWithReporter(ctx, s.reporter)
+
+	return s.backend.CheckUser(ctx, userID, repair)
+}
+
+// RotateUserPassphrase re-encrypts the message store of the given user, and its database and search index if they are
+// encrypted, with newPassphrase while the user stays online. If the rotation is interrupted, the user must be loaded
+// with newPassphrase, which resumes it in the background.
+func (s *Server) RotateUserPassphrase(ctx context.Context, userID string, oldPassphrase, newPassphrase []byte) error {
+	ctx = reporter.NewContextWithReporter(ctx, s.reporter)
+
+	return s.backend.RotateUserPassphrase(ctx, userID, oldPassphrase, newPassphrase)
+}
+
+// EvictUserStore evicts the least recently used literals of the given user until its store is within the budget set
+// with WithStoreBudget. This otherwise happens periodically in the background.
+func (s *Server) EvictUserStore(ctx context.Context, userID string) error {
+	ctx = reporter.NewContextWithReporter(ctx, s.reporter)
+
+	return s.backend.EvictUserStore(ctx, userID)
+}
+
+// GetUserStoreSize returns the space taken by the message literals of the given user on disk.
+func (s *Server) GetUserStoreSize(ctx context.Context, userID string) (int64, error) {
+	return s.backend.GetUserStoreSize(ctx, userID)
+}
+
 // AddWatcher adds a new watcher which watches events of the given types.
 // If no types are specified, the watcher watches all events.
 func (s *Server) AddWatcher(ofType ...events.Event) <-chan events.Event {
@@ -175,13 +277,35 @@ func (s *Server) AddWatcher(ofType ...events.Event) <-chan events.Event {
 
 // Serve serves connections accepted from the given listener.
 // It stops serving when the context is canceled, the listener is closed, or the server is closed.
+// Clients may upgrade their connections with STARTTLS if the server has a TLS config; see ServeWithPolicy.
 func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	return s.ServeWithPolicy(ctx, l, listener.Policy{})
+}
+
+// ServeWithPolicy serves connections accepted from the given listener as Serve does, treating them according to the
+// given policy. It returns ErrInvalidListenerPolicy if the policy can't be applied, and ErrServerDraining if the
+// server is draining.
+func (s *Server) ServeWithPolicy(ctx context.Context, l net.Listener, policy listener.Policy) error {
+	if policy.TLSConfig == nil {
+		policy.TLSConfig = s.tlsConfig
+	}
+
+	if err := checkListenerPolicy(policy); err != nil {
+		return err
+	}
+
+	if err := s.addListener(l); err != nil {
+		return err
+	}
+
 	ctx = observability.NewContextWithObservabilitySender(ctx, s.observabilitySender)
 	ctx = reporter.NewContextWithReporter(ctx, s.reporter)
+	ctx = telemetry.NewContextWithTracerProvider(ctx, s.tracerProvider)
 	ctx = contexts.NewDisableParallelismCtx(ctx, s.disableParallelism)
 
 	s.publish(events.ListenerAdded{
-		Addr: l.Addr(),
+		Addr:   l.Addr(),
+		Policy: policy,
 	})
 
 	s.serveWG.Go(func() {
@@ -189,16 +313,65 @@ func (s *Server) Serve(ctx context.Context, l net.Listener) error {
 			Addr: l.Addr(),
 		})
 
-		s.serve(ctx, newConnCh(l, s.panicHandler))
+		defer s.removeListener(l)
+
+		s.serve(ctx, newConnCh(l, s.panicHandler), policy)
 	})
 
 	return nil
 }
 
+// addListener records a listener to close when the server drains, unless it is draining already.
+func (s *Server) addListener(l net.Listener) error {
+	s.listenersLock.Lock()
+	defer s.listenersLock.Unlock()
+
+	if s.isDraining() {
+		return ErrServerDraining
+	}
+
+	s.listeners[l] = struct{}{}
+
+	return nil
+}
+
+func (s *Server) removeListener(l net.Listener) {
+	s.listenersLock.Lock()
+	defer s.listenersLock.Unlock()
+
+	delete(s.listeners, l)
+}
+
+// stopListening marks the server as draining and closes the listeners being served, so that no more connections are
+// accepted. Sessions added meanwhile see that the server is draining. It returns false if the server already was.
+func (s *Server) stopListening() bool {
+	s.listenersLock.Lock()
+	defer s.listenersLock.Unlock()
+
+	if s.isDraining() {
+		return false
+	}
+
+	close(s.drainCh)
+
+	for l := range s.listeners {
+		if err := l.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			logrus.WithError(err).WithField("addr", l.Addr()).Warn("Failed to close listener while draining")
+		}
+	}
+
+	return true
+}
+
 // serve handles incoming connections and starts a new goroutine for each.
-func (s *Server) serve(ctx context.Context, connCh <-chan net.Conn) {
+func (s *Server) serve(ctx context.Context, connCh <-chan net.Conn, policy listener.Policy) {
 	connWG := async.MakeWaitGroup(s.panicHandler)
 
+	// connsDoneCh is closed once the server is draining and all connections are done.
+	var connsDoneCh chan struct{}
+
+	drainCh := s.drainCh
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -209,8 +382,28 @@ func (s *Server) serve(ctx context.Context, connCh <-chan net.Conn) {
 			logrus.Debug("Stopping serve, server stopped")
 			return
 
+		case <-drainCh:
+			logrus.Debug("Draining serve, waiting for sessions to close")
+
+			drainCh, connsDoneCh = nil, make(chan struct{})
+
+			go func(connsDoneCh chan struct{}) {
+				defer async.HandlePanic(s.panicHandler)
+				defer close(connsDoneCh)
+
+				connWG.Wait()
+			}(connsDoneCh)
+
+		case <-connsDoneCh:
+			logrus.Debug("Stopping serve, server drained")
+			return
+
 		case conn, ok := <-connCh:
-			if !ok {
+			if !ok && connsDoneCh != nil {
+				// The listener is closed while draining; the sessions it accepted are still being drained.
+				connCh = nil
+				continue
+			} else if !ok {
 				logrus.Debug("Stopping serve, listener closed")
 				return
 			}
@@ -218,8 +411,28 @@ func (s *Server) serve(ctx context.Context, connCh <-chan net.Conn) {
 			defer conn.Close()
 
 			connWG.Go(func() {
-				session, sessionID := s.addSession(ctx, conn)
-				defer s.removeSession(sessionID)
+				if bye, metric, ok := s.admitConn(conn, policy); !ok {
+					if metric != nil {
+						observability.AddImapMetric(ctx, metric)
+					}
+
+					logrus.WithField("remoteAddr", conn.RemoteAddr()).WithField("reason", bye.String()).Info("Refusing connection")
+
+					if err := rejectConn(conn, bye); err != nil {
+						logrus.WithError(err).Debug("Failed to tell client the connection is refused")
+					}
+
+					_ = conn.Close()
+
+					return
+				}
+
+				session, sessionID := s.addSession(ctx, conn, policy)
+				defer func() {
+					// The connection no longer counts once the session is reported removed.
+					s.connCounter.release(conn.RemoteAddr())
+					s.removeSession(sessionID, session.RemovedReason())
+				}()
 
 				logging.DoAnnotated(ctx, func(ctx context.Context) {
 					if err := session.Serve(ctx); err != nil {
@@ -256,6 +469,61 @@ func (s *Server) GetDatabasePath() string {
 	return s.databaseDir
 }
 
+// Drain closes the server gracefully, for instance before it is restarted. It closes the listeners being served, so
+// that no more connections are accepted, and asks the sessions to close with a BYE [UNAVAILABLE] once they are done
+// with the command they are handling. Listeners handed over to another process should be duplicated first, e.g. with
+// (*net.TCPListener).File, as closing them here would otherwise stop that process from accepting too.
+//
+// Once the sessions are closed, it waits until the connector updates which are already queued for the users are
+// applied, and closes the server as Close does. Updates the connectors haven't delivered yet aren't waited for.
+// If the context is done first, the remaining sessions are closed abruptly and the updates not waited for.
+// The server must not be closed again afterwards; draining it again returns ErrServerDraining.
+func (s *Server) Drain(ctx context.Context) error {
+	if !s.stopListening() {
+		return ErrServerDraining
+	}
+
+	s.sessionsLock.Lock()
+
+	for _, session := range s.sessions {
+		session.Drain()
+	}
+
+	s.sessionsLock.Unlock()
+
+	drainedCh := make(chan struct{})
+
+	go func() {
+		defer async.HandlePanic(s.panicHandler)
+		defer close(drainedCh)
+
+		s.serveWG.Wait()
+	}()
+
+	select {
+	case <-drainedCh:
+		if err := s.backend.Flush(ctx); err != nil {
+			logrus.WithError(err).Warn("Failed to flush connector updates while draining")
+		}
+
+	case <-ctx.Done():
+		logrus.WithError(ctx.Err()).Warn("Sessions didn't close in time, closing the server")
+	}
+
+	return s.Close(context.WithoutCancel(ctx))
+}
+
+// isDraining returns whether Drain was called.
+func (s *Server) isDraining() bool {
+	select {
+	case <-s.drainCh:
+		return true
+
+	default:
+		return false
+	}
+}
+
 // Close closes the server.
 func (s *Server) Close(ctx context.Context) error {
 	ctx = reporter.NewContextWithReporter(ctx, s.reporter)
@@ -271,6 +539,9 @@ func (s *Server) Close(ctx context.Context) error {
 		return fmt.Errorf("failed to close backend: %w", err)
 	}
 
+	// Wait until the remaining backend events have been published.
+	<-s.backendEventsDoneCh
+
 	// Close the server error channel.
 	s.serveErrCh.Close()
 
@@ -287,16 +558,33 @@ func (s *Server) Close(ctx context.Context) error {
 	return nil
 }
 
-func (s *Server) addSession(ctx context.Context, conn net.Conn) (*session.Session, int) {
+func (s *Server) addSession(ctx context.Context, conn net.Conn, policy listener.Policy) (*session.Session, int) {
 	s.sessionsLock.Lock()
 	defer s.sessionsLock.Unlock()
 
 	nextID := s.getNextID()
 
-	s.sessions[nextID] = session.New(conn, s.backend, nextID, s.versionInfo, s.cmdExecProfBuilder, s.newEventCh(ctx), s.idleBulkTime, s.panicHandler)
+	s.sessions[nextID] = session.New(conn, s.backend, nextID, s.versionInfo, s.cmdExecProfBuilder, s.newEventCh(ctx), s.idleBulkTime, s.sessionTimeouts, s.panicHandler)
+
+	switch policy.Security {
+	case listener.StartTLS:
+		if policy.TLSConfig != nil {
+			s.sessions[nextID].SetTLSConfig(policy.TLSConfig)
+		}
+
+	case listener.ImplicitTLS:
+		s.sessions[nextID].SetImplicitTLS(policy.TLSConfig)
 
-	if s.tlsConfig != nil {
-		s.sessions[nextID].SetTLSConfig(s.tlsConfig)
+	case listener.PlaintextLoopback:
+		// Plaintext connections can't be upgraded.
+	}
+
+	if policy.RequireTLS {
+		s.sessions[nextID].SetRequireTLS()
+	}
+
+	if policy.CertAuthenticator != nil {
+		s.sessions[nextID].SetCertAuthenticator(policy.CertAuthenticator)
 	}
 
 	if s.inLogger != nil {
@@ -307,6 +595,15 @@ func (s *Server) addSession(ctx context.Context, conn net.Conn) (*session.Sessio
 		s.sessions[nextID].SetOutgoingLogger(s.outLogger)
 	}
 
+	if s.traceSink != nil {
+		s.sessions[nextID].SetTracer(s.traceSink, s.traceRedaction)
+	}
+
+	// The connection may have been accepted just as the server started draining.
+	if s.isDraining() {
+		s.sessions[nextID].Drain()
+	}
+
 	s.publish(events.SessionAdded{
 		SessionID:  nextID,
 		LocalAddr:  conn.LocalAddr(),
@@ -316,7 +613,7 @@ func (s *Server) addSession(ctx context.Context, conn net.Conn) (*session.Sessio
 	return s.sessions[nextID], nextID
 }
 
-func (s *Server) removeSession(sessionID int) {
+func (s *Server) removeSession(sessionID int, reason events.SessionRemovedReason) {
 	s.sessionsLock.Lock()
 	defer s.sessionsLock.Unlock()
 
@@ -324,6 +621,7 @@ func (s *Server) removeSession(sessionID int) {
 
 	s.publish(events.SessionRemoved{
 		SessionID: sessionID,
+		Reason:    reason,
 	})
 }
 
@@ -350,6 +648,19 @@ func (s *Server) newEventCh(ctx context.Context) chan events.Event {
 	return eventCh
 }
 
+// forwardBackendEvents publishes events originating from the backend until the backend is closed.
+func (s *Server) forwardBackendEvents() {
+	async.GoAnnotated(context.Background(), s.panicHandler, func(ctx context.Context) {
+		defer close(s.backendEventsDoneCh)
+
+		for event := range s.backend.GetEvents() {
+			s.publish(event)
+		}
+	}, logging.Labels{
+		"Action": "Publishing backend events",
+	})
+}
+
 func (s *Server) publish(event events.Event) {
 	s.watchersLock.RLock()
 	defer s.watchersLock.RUnlock()
@@ -0,0 +1,86 @@
+package gluon
+
+import (
+	"net"
+	"time"
+
+	"github.com/ProtonMail/gluon/imap"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// SessionInfo describes a connected session at the time it was listed.
+type SessionInfo struct {
+	SessionID int
+
+	// UserID is the ID of the user the session is logged in to, if any.
+	UserID     string
+	RemoteAddr net.Addr
+
+	// Mailbox is the name of the selected mailbox, if any.
+	Mailbox string
+
+	// IMAPID is what the client sent with the ID command, if anything.
+	IMAPID      imap.IMAPID
+	ConnectedAt time.Time
+
+	// BytesIn and BytesOut count the bytes read from and written to the connection, including TLS overhead.
+	BytesIn  int64
+	BytesOut int64
+
+	// Command is the command being handled, with sensitive information stripped out, if any.
+	Command string
+}
+
+// ListSessions returns the sessions currently connected, ordered by ID.
+func (s *Server) ListSessions() []SessionInfo {
+	s.sessionsLock.RLock()
+	defer s.sessionsLock.RUnlock()
+
+	ids := maps.Keys(s.sessions)
+	slices.Sort(ids)
+
+	infos := make([]SessionInfo, 0, len(ids))
+
+	for _, id := range ids {
+		infos = append(infos, SessionInfo(s.sessions[id].Info()))
+	}
+
+	return infos
+}
+
+// DisconnectSession sends the session with the given ID a BYE with the given reason and closes it, once it is done
+// with the command it is handling. It returns ErrNoSuchSession if there is no such session. It doesn't wait for the
+// session to be closed; an events.SessionRemoved event is published when it is.
+func (s *Server) DisconnectSession(sessionID int, reason string) error {
+	s.sessionsLock.RLock()
+	defer s.sessionsLock.RUnlock()
+
+	sess, ok := s.sessions[sessionID]
+	if !ok {
+		return ErrNoSuchSession
+	}
+
+	sess.Disconnect(reason)
+
+	return nil
+}
+
+// DisconnectUser disconnects all sessions logged in to the given user as DisconnectSession does. It returns how many
+// sessions were disconnected.
+func (s *Server) DisconnectUser(userID string) int {
+	s.sessionsLock.RLock()
+	defer s.sessionsLock.RUnlock()
+
+	var count int
+
+	for _, sess := range s.sessions {
+		if sess.Info().UserID == userID {
+			sess.Disconnect("Disconnected by the server")
+
+			count++
+		}
+	}
+
+	return count
+}
@@ -0,0 +1,350 @@
+package sieve
+
+import (
+	"mime"
+	"net/mail"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+const (
+	comparatorASCIICaseMap = "i;ascii-casemap"
+	comparatorOctet        = "i;octet"
+)
+
+type matchType int
+
+const (
+	matchIs matchType = iota
+	matchContains
+	matchMatches
+)
+
+type addressPart string
+
+const (
+	addressAll       addressPart = ":all"
+	addressLocalPart addressPart = ":localpart"
+	addressDomain    addressPart = ":domain"
+)
+
+// execution holds the state of a single script execution.
+type execution struct {
+	msg Message
+
+	implicitKeep bool
+	keep         bool
+	fileInto     []string
+	flags        []string
+	stopped      bool
+}
+
+func (e *execution) run(actions []action) {
+	for _, act := range actions {
+		if e.stopped {
+			return
+		}
+
+		act.exec(e)
+	}
+}
+
+func (e *execution) result() Result {
+	return Result{
+		Keep:     e.keep || e.implicitKeep,
+		FileInto: e.fileInto,
+		Flags:    e.flags,
+	}
+}
+
+type action interface {
+	exec(*execution)
+}
+
+type requireAction struct{}
+
+func (*requireAction) exec(*execution) {}
+
+type stopAction struct{}
+
+func (*stopAction) exec(e *execution) {
+	e.stopped = true
+}
+
+type keepAction struct{}
+
+func (*keepAction) exec(e *execution) {
+	e.keep = true
+}
+
+type discardAction struct{}
+
+func (*discardAction) exec(e *execution) {
+	e.implicitKeep = false
+}
+
+type fileIntoAction struct {
+	mailbox string
+}
+
+func (a *fileIntoAction) exec(e *execution) {
+	e.implicitKeep = false
+
+	if !slices.Contains(e.fileInto, a.mailbox) {
+		e.fileInto = append(e.fileInto, a.mailbox)
+	}
+}
+
+type addFlagAction struct {
+	flags []string
+}
+
+func (a *addFlagAction) exec(e *execution) {
+	for _, flag := range a.flags {
+		if !slices.ContainsFunc(e.flags, func(other string) bool { return strings.EqualFold(flag, other) }) {
+			e.flags = append(e.flags, flag)
+		}
+	}
+}
+
+type ifBranch struct {
+	cond  test
+	block []action
+}
+
+type ifAction struct {
+	branches  []ifBranch
+	elseBlock []action
+}
+
+func (a *ifAction) exec(e *execution) {
+	for _, branch := range a.branches {
+		if branch.cond.eval(e.msg) {
+			e.run(branch.block)
+			return
+		}
+	}
+
+	e.run(a.elseBlock)
+}
+
+type test interface {
+	eval(Message) bool
+}
+
+type constTest bool
+
+func (t constTest) eval(Message) bool {
+	return bool(t)
+}
+
+type notTest struct {
+	test test
+}
+
+func (t *notTest) eval(msg Message) bool {
+	return !t.test.eval(msg)
+}
+
+type listTest struct {
+	tests []test
+	all   bool
+}
+
+func (t *listTest) eval(msg Message) bool {
+	for _, test := range t.tests {
+		if test.eval(msg) != t.all {
+			return !t.all
+		}
+	}
+
+	return t.all
+}
+
+type existsTest struct {
+	names []string
+}
+
+func (t *existsTest) eval(msg Message) bool {
+	for _, name := range t.names {
+		if len(getHeaderValues(msg, name)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+type sizeTest struct {
+	over  bool
+	limit int64
+}
+
+func (t *sizeTest) eval(msg Message) bool {
+	if t.over {
+		return int64(msg.Size) > t.limit
+	}
+
+	return int64(msg.Size) < t.limit
+}
+
+type headerTest struct {
+	address    bool
+	comparator string
+	match      matchType
+	part       addressPart
+	names      []string
+	keys       []string
+}
+
+func (t *headerTest) eval(msg Message) bool {
+	for _, name := range t.names {
+		for _, value := range getHeaderValues(msg, name) {
+			var values []string
+
+			if t.address {
+				values = getAddressParts(value, t.part)
+			} else {
+				values = []string{value}
+			}
+
+			for _, value := range values {
+				for _, key := range t.keys {
+					if t.matches(value, key) {
+						return true
+					}
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+func (t *headerTest) matches(value, key string) bool {
+	if t.comparator == comparatorASCIICaseMap {
+		value, key = strings.ToLower(value), strings.ToLower(key)
+	}
+
+	switch t.match {
+	case matchContains:
+		return strings.Contains(value, key)
+
+	case matchMatches:
+		return wildcardMatch(value, key)
+
+	default:
+		return value == key
+	}
+}
+
+// getHeaderValues returns the decoded values of all header fields with the given name.
+func getHeaderValues(msg Message, name string) []string {
+	if msg.Header == nil {
+		return nil
+	}
+
+	var values []string
+
+	decoder := new(mime.WordDecoder)
+
+	msg.Header.Entries(func(key, val string) {
+		if !strings.EqualFold(key, name) {
+			return
+		}
+
+		if decoded, err := decoder.DecodeHeader(val); err == nil {
+			val = decoded
+		}
+
+		values = append(values, strings.TrimSpace(val))
+	})
+
+	return values
+}
+
+// getAddressParts returns the requested part of each address in the given header value.
+func getAddressParts(value string, part addressPart) []string {
+	var addrs []string
+
+	if list, err := mail.ParseAddressList(value); err == nil {
+		for _, addr := range list {
+			addrs = append(addrs, addr.Address)
+		}
+	} else {
+		addrs = []string{value}
+	}
+
+	if part == addressAll {
+		return addrs
+	}
+
+	parts := make([]string, 0, len(addrs))
+
+	for _, addr := range addrs {
+		idx := strings.LastIndexByte(addr, '@')
+
+		switch {
+		case idx < 0 && part == addressLocalPart:
+			parts = append(parts, addr)
+
+		case idx < 0:
+			continue
+
+		case part == addressLocalPart:
+			parts = append(parts, addr[:idx])
+
+		default:
+			parts = append(parts, addr[idx+1:])
+		}
+	}
+
+	return parts
+}
+
+// wildcardMatch implements the :matches match type, where "*" matches any sequence and "?" matches one character.
+// A backslash escapes the following character.
+func wildcardMatch(value, pattern string) bool {
+	// starPattern and starValue record where to resume after the last "*" if the current attempt fails.
+	starPattern, starValue := -1, 0
+
+	for p, v := 0, 0; v < len(value) || p < len(pattern); {
+		if p < len(pattern) {
+			switch c := pattern[p]; {
+			case c == '*':
+				starPattern, starValue = p, v
+				p++
+
+				continue
+
+			case c == '?' && v < len(value):
+				p++
+				v++
+
+				continue
+
+			case c == '\\' && p+1 < len(pattern) && v < len(value) && pattern[p+1] == value[v]:
+				p += 2
+				v++
+
+				continue
+
+			case c != '\\' && c != '?' && v < len(value) && c == value[v]:
+				p++
+				v++
+
+				continue
+			}
+		}
+
+		if starPattern < 0 || starValue >= len(value) {
+			return false
+		}
+
+		starValue++
+		p, v = starPattern+1, starValue
+	}
+
+	return true
+}
@@ -0,0 +1,300 @@
+package sieve
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type tokenType int
+
+const (
+	tokenEOF tokenType = iota
+	tokenIdentifier
+	tokenTag
+	tokenString
+	tokenNumber
+	tokenLeftBracket
+	tokenRightBracket
+	tokenLeftParen
+	tokenRightParen
+	tokenLeftBrace
+	tokenRightBrace
+	tokenComma
+	tokenSemicolon
+)
+
+type token struct {
+	typ  tokenType
+	text string
+	num  int64
+	line int
+}
+
+func (t token) String() string {
+	switch t.typ {
+	case tokenEOF:
+		return "end of script"
+
+	case tokenString:
+		return strconv.Quote(t.text)
+
+	case tokenNumber:
+		return strconv.FormatInt(t.num, 10)
+
+	default:
+		return t.text
+	}
+}
+
+type lexer struct {
+	src  string
+	pos  int
+	line int
+}
+
+// tokenize splits the script into tokens, dropping whitespace and comments.
+func tokenize(src string) ([]token, error) {
+	l := &lexer{src: src, line: 1}
+
+	var tokens []token
+
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, tok)
+
+		if tok.typ == tokenEOF {
+			return tokens, nil
+		}
+	}
+}
+
+func (l *lexer) next() (token, error) {
+	if err := l.skipWhitespaceAndComments(); err != nil {
+		return token{}, err
+	}
+
+	if l.pos >= len(l.src) {
+		return token{typ: tokenEOF, line: l.line}, nil
+	}
+
+	c := l.src[l.pos]
+
+	switch {
+	case c == '[':
+		return l.single(tokenLeftBracket), nil
+
+	case c == ']':
+		return l.single(tokenRightBracket), nil
+
+	case c == '(':
+		return l.single(tokenLeftParen), nil
+
+	case c == ')':
+		return l.single(tokenRightParen), nil
+
+	case c == '{':
+		return l.single(tokenLeftBrace), nil
+
+	case c == '}':
+		return l.single(tokenRightBrace), nil
+
+	case c == ',':
+		return l.single(tokenComma), nil
+
+	case c == ';':
+		return l.single(tokenSemicolon), nil
+
+	case c == '"':
+		return l.quotedString()
+
+	case c == ':':
+		l.pos++
+
+		if l.pos >= len(l.src) || !isIdentifierStart(l.src[l.pos]) {
+			return token{}, l.errorf("expected tag name after ':'")
+		}
+
+		return token{typ: tokenTag, text: ":" + strings.ToLower(l.identifier()), line: l.line}, nil
+
+	case isDigit(c):
+		return l.number()
+
+	case isIdentifierStart(c):
+		ident := strings.ToLower(l.identifier())
+
+		if ident == "text" && l.pos < len(l.src) && l.src[l.pos] == ':' {
+			l.pos++
+			return l.multiLineString()
+		}
+
+		return token{typ: tokenIdentifier, text: ident, line: l.line}, nil
+
+	default:
+		return token{}, l.errorf("unexpected character %q", c)
+	}
+}
+
+func (l *lexer) single(typ tokenType) token {
+	tok := token{typ: typ, text: string(l.src[l.pos]), line: l.line}
+
+	l.pos++
+
+	return tok
+}
+
+func (l *lexer) skipWhitespaceAndComments() error {
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; {
+		case c == '\n':
+			l.line++
+			l.pos++
+
+		case c == ' ' || c == '\t' || c == '\r':
+			l.pos++
+
+		case c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+
+		case strings.HasPrefix(l.src[l.pos:], "/*"):
+			end := strings.Index(l.src[l.pos+2:], "*/")
+			if end < 0 {
+				return l.errorf("unterminated comment")
+			}
+
+			l.line += strings.Count(l.src[l.pos:l.pos+2+end], "\n")
+			l.pos += end + 4
+
+		default:
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (l *lexer) identifier() string {
+	start := l.pos
+
+	for l.pos < len(l.src) && (isIdentifierStart(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+		l.pos++
+	}
+
+	return l.src[start:l.pos]
+}
+
+func (l *lexer) number() (token, error) {
+	start := l.pos
+
+	for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+		l.pos++
+	}
+
+	num, err := strconv.ParseInt(l.src[start:l.pos], 10, 64)
+	if err != nil {
+		return token{}, l.errorf("invalid number %q", l.src[start:l.pos])
+	}
+
+	if l.pos < len(l.src) {
+		switch l.src[l.pos] {
+		case 'k', 'K':
+			num <<= 10
+			l.pos++
+
+		case 'm', 'M':
+			num <<= 20
+			l.pos++
+
+		case 'g', 'G':
+			num <<= 30
+			l.pos++
+		}
+	}
+
+	return token{typ: tokenNumber, text: l.src[start:l.pos], num: num, line: l.line}, nil
+}
+
+func (l *lexer) quotedString() (token, error) {
+	line := l.line
+
+	var b strings.Builder
+
+	for l.pos++; l.pos < len(l.src); l.pos++ {
+		switch c := l.src[l.pos]; c {
+		case '"':
+			l.pos++
+			return token{typ: tokenString, text: b.String(), line: line}, nil
+
+		case '\\':
+			if l.pos++; l.pos >= len(l.src) {
+				return token{}, l.errorf("unterminated string")
+			}
+
+			b.WriteByte(l.src[l.pos])
+
+		case '\n':
+			l.line++
+			b.WriteByte(c)
+
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return token{}, l.errorf("unterminated string")
+}
+
+// multiLineString reads a "text:" string, which ends with a line containing a single dot.
+func (l *lexer) multiLineString() (token, error) {
+	line := l.line
+
+	// Skip the remainder of the line containing "text:".
+	eol := strings.IndexByte(l.src[l.pos:], '\n')
+	if eol < 0 {
+		return token{}, l.errorf("unterminated multi-line string")
+	}
+
+	l.pos += eol + 1
+	l.line++
+
+	var lines []string
+
+	for l.pos < len(l.src) {
+		end := strings.IndexByte(l.src[l.pos:], '\n')
+		if end < 0 {
+			end = len(l.src) - l.pos
+		}
+
+		text := strings.TrimSuffix(l.src[l.pos:l.pos+end], "\r")
+
+		l.pos += end + 1
+		l.line++
+
+		if text == "." {
+			return token{typ: tokenString, text: strings.Join(lines, "\r\n"), line: line}, nil
+		}
+
+		// Lines starting with a dot are dot-stuffed.
+		lines = append(lines, strings.TrimPrefix(text, "."))
+	}
+
+	return token{}, l.errorf("unterminated multi-line string")
+}
+
+func (l *lexer) errorf(format string, args ...any) error {
+	return &ParseError{Line: l.line, Msg: fmt.Sprintf(format, args...)}
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isIdentifierStart(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
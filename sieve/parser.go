@@ -0,0 +1,403 @@
+package sieve
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// supportedExtensions lists the capabilities that may be passed to "require".
+var supportedExtensions = []string{"fileinto", "imap4flags"}
+
+type parser struct {
+	tokens []token
+	pos    int
+
+	// extensions holds the extensions enabled with "require".
+	extensions []string
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) advance() token {
+	tok := p.tokens[p.pos]
+
+	if tok.typ != tokenEOF {
+		p.pos++
+	}
+
+	return tok
+}
+
+func (p *parser) expect(typ tokenType, what string) (token, error) {
+	tok := p.advance()
+
+	if tok.typ != typ {
+		return token{}, p.errorf(tok, "expected %v, got %v", what, tok)
+	}
+
+	return tok, nil
+}
+
+func (p *parser) errorf(tok token, format string, args ...any) error {
+	return &ParseError{Line: tok.line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// parseCommands parses commands until the end of the script or the end of the current block.
+func (p *parser) parseCommands(inBlock bool) ([]action, error) {
+	var actions []action
+
+	for {
+		tok := p.peek()
+
+		switch {
+		case tok.typ == tokenEOF && !inBlock:
+			return actions, nil
+
+		case tok.typ == tokenRightBrace && inBlock:
+			p.advance()
+			return actions, nil
+
+		case tok.typ != tokenIdentifier:
+			return nil, p.errorf(tok, "expected command, got %v", tok)
+		}
+
+		act, err := p.parseCommand(!inBlock && (len(actions) == 0 || isRequire(actions[len(actions)-1])))
+		if err != nil {
+			return nil, err
+		}
+
+		actions = append(actions, act)
+	}
+}
+
+func (p *parser) parseCommand(requireAllowed bool) (action, error) {
+	tok := p.advance()
+
+	switch tok.text {
+	case "require":
+		if !requireAllowed {
+			return nil, p.errorf(tok, "require must come before any other command")
+		}
+
+		exts, err := p.parseStringList()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ext := range exts {
+			if !slices.Contains(supportedExtensions, ext) {
+				return nil, p.errorf(tok, "unsupported extension %q", ext)
+			}
+
+			p.extensions = append(p.extensions, ext)
+		}
+
+		return &requireAction{}, p.endCommand()
+
+	case "if":
+		return p.parseIf()
+
+	case "elsif", "else":
+		return nil, p.errorf(tok, "%v without if", tok.text)
+
+	case "stop":
+		return &stopAction{}, p.endCommand()
+
+	case "keep":
+		return &keepAction{}, p.endCommand()
+
+	case "discard":
+		return &discardAction{}, p.endCommand()
+
+	case "fileinto":
+		if !slices.Contains(p.extensions, "fileinto") {
+			return nil, p.errorf(tok, `fileinto requires the "fileinto" extension`)
+		}
+
+		mailbox, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+
+		return &fileIntoAction{mailbox: mailbox}, p.endCommand()
+
+	case "addflag":
+		if !slices.Contains(p.extensions, "imap4flags") {
+			return nil, p.errorf(tok, `addflag requires the "imap4flags" extension`)
+		}
+
+		flags, err := p.parseStringList()
+		if err != nil {
+			return nil, err
+		}
+
+		return &addFlagAction{flags: splitFlags(flags)}, p.endCommand()
+
+	default:
+		return nil, p.errorf(tok, "unsupported command %q", tok.text)
+	}
+}
+
+func (p *parser) endCommand() error {
+	_, err := p.expect(tokenSemicolon, `";"`)
+
+	return err
+}
+
+func (p *parser) parseIf() (action, error) {
+	act := &ifAction{}
+
+	for {
+		cond, err := p.parseTest()
+		if err != nil {
+			return nil, err
+		}
+
+		block, err := p.parseBlock()
+		if err != nil {
+			return nil, err
+		}
+
+		act.branches = append(act.branches, ifBranch{cond: cond, block: block})
+
+		if tok := p.peek(); tok.typ != tokenIdentifier || tok.text != "elsif" {
+			break
+		}
+
+		p.advance()
+	}
+
+	if tok := p.peek(); tok.typ == tokenIdentifier && tok.text == "else" {
+		p.advance()
+
+		block, err := p.parseBlock()
+		if err != nil {
+			return nil, err
+		}
+
+		act.elseBlock = block
+	}
+
+	return act, nil
+}
+
+func (p *parser) parseBlock() ([]action, error) {
+	if _, err := p.expect(tokenLeftBrace, `"{"`); err != nil {
+		return nil, err
+	}
+
+	return p.parseCommands(true)
+}
+
+func (p *parser) parseTest() (test, error) {
+	tok, err := p.expect(tokenIdentifier, "test")
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok.text {
+	case "true":
+		return constTest(true), nil
+
+	case "false":
+		return constTest(false), nil
+
+	case "not":
+		inner, err := p.parseTest()
+		if err != nil {
+			return nil, err
+		}
+
+		return &notTest{test: inner}, nil
+
+	case "allof", "anyof":
+		tests, err := p.parseTestList()
+		if err != nil {
+			return nil, err
+		}
+
+		return &listTest{tests: tests, all: tok.text == "allof"}, nil
+
+	case "exists":
+		names, err := p.parseStringList()
+		if err != nil {
+			return nil, err
+		}
+
+		return &existsTest{names: names}, nil
+
+	case "size":
+		return p.parseSizeTest(tok)
+
+	case "header", "address":
+		return p.parseHeaderTest(tok)
+
+	default:
+		return nil, p.errorf(tok, "unsupported test %q", tok.text)
+	}
+}
+
+func (p *parser) parseTestList() ([]test, error) {
+	if _, err := p.expect(tokenLeftParen, `"("`); err != nil {
+		return nil, err
+	}
+
+	var tests []test
+
+	for {
+		t, err := p.parseTest()
+		if err != nil {
+			return nil, err
+		}
+
+		tests = append(tests, t)
+
+		tok := p.advance()
+
+		if tok.typ == tokenRightParen {
+			return tests, nil
+		} else if tok.typ != tokenComma {
+			return nil, p.errorf(tok, `expected "," or ")", got %v`, tok)
+		}
+	}
+}
+
+func (p *parser) parseSizeTest(tok token) (test, error) {
+	tag, err := p.expect(tokenTag, ":over or :under")
+	if err != nil {
+		return nil, err
+	}
+
+	if tag.text != ":over" && tag.text != ":under" {
+		return nil, p.errorf(tag, "expected :over or :under, got %v", tag)
+	}
+
+	num, err := p.expect(tokenNumber, "number")
+	if err != nil {
+		return nil, err
+	}
+
+	return &sizeTest{over: tag.text == ":over", limit: num.num}, nil
+}
+
+func (p *parser) parseHeaderTest(tok token) (test, error) {
+	t := &headerTest{
+		address:    tok.text == "address",
+		comparator: comparatorASCIICaseMap,
+		match:      matchIs,
+		part:       addressAll,
+	}
+
+	for p.peek().typ == tokenTag {
+		tag := p.advance()
+
+		switch tag.text {
+		case ":is":
+			t.match = matchIs
+
+		case ":contains":
+			t.match = matchContains
+
+		case ":matches":
+			t.match = matchMatches
+
+		case ":comparator":
+			name, err := p.parseString()
+			if err != nil {
+				return nil, err
+			}
+
+			switch name {
+			case comparatorASCIICaseMap, comparatorOctet:
+				t.comparator = name
+
+			default:
+				return nil, p.errorf(tag, "unsupported comparator %q", name)
+			}
+
+		case ":all", ":localpart", ":domain":
+			if !t.address {
+				return nil, p.errorf(tag, "unexpected tag %v", tag)
+			}
+
+			t.part = addressPart(tag.text)
+
+		default:
+			return nil, p.errorf(tag, "unexpected tag %v", tag)
+		}
+	}
+
+	names, err := p.parseStringList()
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := p.parseStringList()
+	if err != nil {
+		return nil, err
+	}
+
+	t.names, t.keys = names, keys
+
+	return t, nil
+}
+
+func (p *parser) parseString() (string, error) {
+	tok, err := p.expect(tokenString, "string")
+	if err != nil {
+		return "", err
+	}
+
+	return tok.text, nil
+}
+
+// parseStringList parses either a single string or a bracketed list of strings.
+func (p *parser) parseStringList() ([]string, error) {
+	if p.peek().typ == tokenString {
+		return []string{p.advance().text}, nil
+	}
+
+	if _, err := p.expect(tokenLeftBracket, "string or string list"); err != nil {
+		return nil, err
+	}
+
+	var list []string
+
+	for {
+		str, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, str)
+
+		tok := p.advance()
+
+		if tok.typ == tokenRightBracket {
+			return list, nil
+		} else if tok.typ != tokenComma {
+			return nil, p.errorf(tok, `expected "," or "]", got %v`, tok)
+		}
+	}
+}
+
+// splitFlags splits space-separated flags as allowed by imap4flags.
+func splitFlags(list []string) []string {
+	var flags []string
+
+	for _, item := range list {
+		flags = append(flags, strings.Fields(item)...)
+	}
+
+	return flags
+}
+
+func isRequire(act action) bool {
+	_, ok := act.(*requireAction)
+
+	return ok
+}
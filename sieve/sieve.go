@@ -0,0 +1,115 @@
+// Package sieve implements a subset of the Sieve mail filtering language (RFC 5228).
+//
+// The supported commands are require, if/elsif/else, stop, keep, discard, fileinto (RFC 5228) and addflag
+// (RFC 5232). The supported tests are true, false, not, allof, anyof, exists, header, address and size.
+package sieve
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ProtonMail/gluon/rfc822"
+	"golang.org/x/exp/slices"
+)
+
+// ParseError is returned when a script can't be parsed.
+type ParseError struct {
+	Line int
+	Msg  string
+}
+
+func (err *ParseError) Error() string {
+	return fmt.Sprintf("sieve: line %v: %v", err.Line, err.Msg)
+}
+
+// Script is a parsed sieve script.
+type Script struct {
+	actions []action
+}
+
+// Parse parses the given sieve script.
+func Parse(src string) (*Script, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+
+	actions, err := p.parseCommands(false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Script{actions: actions}, nil
+}
+
+// Flags returns the flags the script may add to messages, whatever the messages it's executed against.
+func (s *Script) Flags() []string {
+	var flags []string
+
+	walkActions(s.actions, func(act action) {
+		if act, ok := act.(*addFlagAction); ok {
+			for _, flag := range act.flags {
+				if !slices.ContainsFunc(flags, func(other string) bool { return strings.EqualFold(flag, other) }) {
+					flags = append(flags, flag)
+				}
+			}
+		}
+	})
+
+	return flags
+}
+
+// walkActions calls fn for the given actions and those nested in them.
+func walkActions(actions []action, fn func(action)) {
+	for _, act := range actions {
+		fn(act)
+
+		if act, ok := act.(*ifAction); ok {
+			for _, branch := range act.branches {
+				walkActions(branch.block, fn)
+			}
+
+			walkActions(act.elseBlock, fn)
+		}
+	}
+}
+
+// Message is the message a script is executed against.
+type Message struct {
+	// Header is the message's header.
+	Header *rfc822.Header
+
+	// Size is the size of the full message literal in bytes.
+	Size int
+}
+
+// Result describes what should happen to a message after a script has been executed.
+type Result struct {
+	// Keep is true if the message should be kept in the mailbox it was delivered to.
+	Keep bool
+
+	// FileInto holds the names of the mailboxes the message should be filed into.
+	FileInto []string
+
+	// Flags holds the flags which should be added to the message.
+	Flags []string
+}
+
+// IsDiscarded returns whether the message should be discarded; it is neither kept nor filed into any mailbox.
+func (res Result) IsDiscarded() bool {
+	return !res.Keep && len(res.FileInto) == 0
+}
+
+// Execute runs the script against the given message.
+func (s *Script) Execute(msg Message) Result {
+	exec := &execution{
+		msg:          msg,
+		implicitKeep: true,
+	}
+
+	exec.run(s.actions)
+
+	return exec.result()
+}
@@ -0,0 +1,181 @@
+package sieve
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ProtonMail/gluon/rfc822"
+	"github.com/stretchr/testify/require"
+)
+
+const testLiteral = "From: Alice <alice@example.com>\r\n" +
+	"To: bob@example.org, Carol <carol@lists.example.net>\r\n" +
+	"Subject: =?UTF-8?Q?Weekly_report?=\r\n" +
+	"X-Spam-Flag: YES\r\n" +
+	"X-Spam-Flag: NO\r\n" +
+	"\r\n" +
+	"Hello world\r\n"
+
+func newTestMessage(t *testing.T) Message {
+	header, err := rfc822.Parse([]byte(testLiteral)).ParseHeader()
+	require.NoError(t, err)
+
+	return Message{Header: header, Size: len(testLiteral)}
+}
+
+func execute(t *testing.T, src string) Result {
+	script, err := Parse(src)
+	require.NoError(t, err)
+
+	return script.Execute(newTestMessage(t))
+}
+
+func TestImplicitKeep(t *testing.T) {
+	res := execute(t, `# Nothing to do here.`)
+
+	require.True(t, res.Keep)
+	require.Empty(t, res.FileInto)
+	require.False(t, res.IsDiscarded())
+}
+
+func TestDiscard(t *testing.T) {
+	res := execute(t, `if header :contains "subject" "report" { discard; }`)
+
+	require.False(t, res.Keep)
+	require.True(t, res.IsDiscarded())
+}
+
+func TestFileInto(t *testing.T) {
+	res := execute(t, `
+		require ["fileinto"];
+
+		if address :domain "from" "example.com" {
+			fileinto "Work";
+			fileinto "Work";
+		}
+	`)
+
+	require.False(t, res.Keep)
+	require.Equal(t, []string{"Work"}, res.FileInto)
+}
+
+func TestFileIntoAndKeep(t *testing.T) {
+	res := execute(t, `require "fileinto"; fileinto "Archive"; keep;`)
+
+	require.True(t, res.Keep)
+	require.Equal(t, []string{"Archive"}, res.FileInto)
+}
+
+func TestAddFlag(t *testing.T) {
+	res := execute(t, `
+		require "imap4flags";
+
+		addflag "\\Flagged $Work";
+		addflag ["\\flagged", "$Report"];
+	`)
+
+	require.True(t, res.Keep)
+	require.Equal(t, []string{`\Flagged`, "$Work", "$Report"}, res.Flags)
+}
+
+func TestScriptFlags(t *testing.T) {
+	script, err := Parse(`
+		require "imap4flags";
+
+		if header :is "subject" "report" {
+			addflag "$Report";
+		} else {
+			addflag ["\\Seen", "$report"];
+		}
+	`)
+	require.NoError(t, err)
+
+	// Flags are listed whichever branch adds them.
+	require.Equal(t, []string{"$Report", `\Seen`}, script.Flags())
+}
+
+func TestStop(t *testing.T) {
+	res := execute(t, `stop; discard;`)
+
+	require.True(t, res.Keep)
+}
+
+func TestElsif(t *testing.T) {
+	res := execute(t, `
+		require "fileinto";
+
+		if header :is "subject" "nope" {
+			fileinto "A";
+		} elsif header :matches "subject" "weekly*" {
+			fileinto "B";
+		} else {
+			fileinto "C";
+		}
+	`)
+
+	require.Equal(t, []string{"B"}, res.FileInto)
+}
+
+func TestTests(t *testing.T) {
+	tests := map[string]bool{
+		`true`:                          true,
+		`false`:                         false,
+		`not false`:                     true,
+		`allof (true, false)`:           false,
+		`anyof (false, true)`:           true,
+		`exists ["from", "to"]`:         true,
+		`exists ["from", "cc"]`:         false,
+		`size :over 10`:                 true,
+		`size :under 1K`:                true,
+		`size :over 1M`:                 false,
+		`header :is "x-spam-flag" "no"`: true,
+		`header :comparator "i;octet" :is "x-spam-flag" "no"`: false,
+		`header :contains ["to", "cc"] "lists"`:               true,
+		`header :matches "from" "alice <*@example.?om>"`:      true,
+		`header :matches "subject" "*\\?"`:                    false,
+		`header :is "subject" "Weekly report"`:                true,
+		`address :is "to" "carol@lists.example.net"`:          true,
+		`address :all :is "from" "Alice"`:                     false,
+		`address :localpart :is "to" "bob"`:                   true,
+		`address :domain :matches "to" "*.example.*"`:         true,
+		`address :domain :is "from" "example.org"`:            false,
+	}
+
+	for test, want := range tests {
+		res := execute(t, `if `+test+` { discard; }`)
+
+		require.Equal(t, want, res.IsDiscarded(), test)
+	}
+}
+
+func TestMultiLineString(t *testing.T) {
+	res := execute(t, "if header :contains \"subject\" text:\r\nreport\r\n.\r\n{ discard; }")
+
+	require.True(t, res.IsDiscarded())
+}
+
+func TestParseErrors(t *testing.T) {
+	scripts := []string{
+		`fileinto "Work";`,
+		`require "vacation";`,
+		`keep; require "fileinto";`,
+		`if true { require "fileinto"; }`,
+		`keep`,
+		`if true keep;`,
+		`else { keep; }`,
+		`if header :over "from" "x" { keep; }`,
+		`if size :over "10" { keep; }`,
+		`if header :comparator "i;unicode-casemap" "from" "x" { keep; }`,
+		`if allof (true false) { keep; }`,
+		`redirect "someone@example.com";`,
+		`if header "subject" "unterminated { keep; }`,
+		`/* unterminated comment`,
+	}
+
+	for _, script := range scripts {
+		_, err := Parse(script)
+
+		var parseErr *ParseError
+		require.True(t, errors.As(err, &parseErr), script)
+	}
+}
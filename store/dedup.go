@@ -0,0 +1,652 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/internal/fsutil"
+	"github.com/ProtonMail/gluon/internal/ids"
+	"github.com/ProtonMail/gluon/rfc822"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/maps"
+)
+
+// dedupStore keeps a single copy of identical literals. Each literal is stored in the underlying store as a blob
+// keyed by a hash of its contents, and the messages referencing each blob are recorded in a journal next to it.
+// The header naming the message of a literal is left out of its blob and added back when it is read, since it would
+// otherwise make every literal unique.
+//
+// The journal is updated after a blob is written and before it is deleted, and synced before either is acknowledged,
+// so a crash can at worst leave a blob which no message references; such blobs are removed when the store is next
+// opened.
+type dedupStore struct {
+	impl *WriteControlledStore
+
+	// key is the key of the keyed hash identifying blobs, so that blob IDs don't reveal the contents of literals.
+	// It is random and kept next to the journal, sealed with the passphrase, so it survives passphrase rotations.
+	key     []byte
+	keyPath string
+
+	// journal is appended to whenever a message starts or stops referencing a blob. It is compacted when the store is
+	// opened, and again once it holds journalCompactionRatio entries for each message with a literal.
+	journal        *os.File
+	journalPath    string
+	journalEntries int
+
+	// blobs maps each message to the blob holding its literal, and refs counts the references to each blob,
+	// including those of literals which are still being written.
+	blobs map[imap.InternalMessageID]blobRef
+	refs  map[imap.InternalMessageID]int
+
+	// written holds the blobs known to be in the underlying store.
+	written map[imap.InternalMessageID]struct{}
+
+	lock sync.Mutex
+}
+
+type blobRef struct {
+	blobID imap.InternalMessageID
+
+	// stripped is set if the header naming the message was left out of the blob.
+	stripped bool
+}
+
+// NewDedupStore returns a store which keeps a single copy of identical literals in impl, recording which messages
+// reference which literal in the journal at the given path. A store which was used without deduplication before keeps
+// its literals; only literals written from then on are deduplicated.
+//
+// Once a store is deduplicated, it must always be opened with NewDedupStore.
+func NewDedupStore(impl Store, journalPath string, passphrase []byte) (Store, error) {
+	store := &dedupStore{
+		impl:        NewWriteControlledStore(impl),
+		keyPath:     getDedupKeyPath(journalPath),
+		journalPath: journalPath,
+		blobs:       make(map[imap.InternalMessageID]blobRef),
+		refs:        make(map[imap.InternalMessageID]int),
+		written:     make(map[imap.InternalMessageID]struct{}),
+	}
+
+	if err := store.loadKey(journalPath, passphrase); err != nil {
+		return nil, fmt.Errorf("failed to load dedup key: %w", err)
+	}
+
+	if err := store.load(journalPath); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+func (s *dedupStore) Get(messageID imap.InternalMessageID) ([]byte, error) {
+	s.lock.Lock()
+	ref, ok := s.blobs[messageID]
+	s.lock.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("no literal stored for message %v: %w", messageID.ShortID(), fs.ErrNotExist)
+	}
+
+	literal, err := s.impl.Get(ref.blobID)
+	if err != nil {
+		return nil, err
+	}
+
+	if ref.stripped {
+		return rfc822.SetHeaderValue(literal, ids.InternalIDKey, messageID.String())
+	}
+
+	return literal, nil
+}
+
+func (s *dedupStore) Set(messageID imap.InternalMessageID, reader io.Reader) error {
+	literal, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	literal, stripped := stripMessageID(messageID, literal)
+	blobID := s.blobID(literal)
+
+	// The reference is taken before the blob is written so that it isn't deleted in the meantime.
+	s.lock.Lock()
+	s.refs[blobID]++
+	_, written := s.written[blobID]
+	s.lock.Unlock()
+
+	if !written {
+		if err := s.impl.Set(blobID, bytes.NewReader(literal)); err != nil {
+			s.lock.Lock()
+			defer s.lock.Unlock()
+
+			return errors.Join(err, s.unref(blobID))
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.written[blobID] = struct{}{}
+
+	ref := blobRef{blobID: blobID, stripped: stripped}
+
+	if err := s.record(messageID, &ref); err != nil {
+		return errors.Join(err, s.unref(blobID))
+	}
+
+	if err := s.syncJournal(); err != nil {
+		return errors.Join(err, s.unref(blobID))
+	}
+
+	oldRef, replaced := s.blobs[messageID]
+
+	s.blobs[messageID] = ref
+
+	defer s.compactIfNeeded()
+
+	if replaced {
+		return s.unref(oldRef.blobID)
+	}
+
+	return nil
+}
+
+func (s *dedupStore) Delete(messageIDs ...imap.InternalMessageID) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.drop(messageIDs)
+}
+
+func (s *dedupStore) List() ([]imap.InternalMessageID, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return maps.Keys(s.blobs), nil
+}
+
+func (s *dedupStore) Close() error {
+	return errors.Join(s.journal.Close(), s.impl.Close())
+}
+
+// StartRotation starts the rotation of the underlying store and seals the key with the new passphrase, which the
+// store is opened with from now on.
+func (s *dedupStore) StartRotation(oldPassphrase, newPassphrase []byte) error {
+	if err := s.impl.StartRotation(oldPassphrase, newPassphrase); err != nil {
+		return err
+	}
+
+	return s.saveKey(newPassphrase)
+}
+
+func (s *dedupStore) RotationPassphrase() []byte {
+	return s.impl.RotationPassphrase()
+}
+
+// RotateLiteral rotates the blob holding the literal of the given message, which may be shared with other messages.
+func (s *dedupStore) RotateLiteral(messageID imap.InternalMessageID) error {
+	s.lock.Lock()
+	ref, ok := s.blobs[messageID]
+	s.lock.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	return s.impl.RotateLiteral(ref.blobID)
+}
+
+func (s *dedupStore) FinishRotation() error {
+	return s.impl.FinishRotation()
+}
+
+// Usage reports the usage of the blob holding the literal of each message, with its size split evenly between the
+// messages sharing it.
+func (s *dedupStore) Usage() ([]Usage, error) {
+	blobUsage, err := s.impl.Usage()
+	if err != nil {
+		return nil, err
+	}
+
+	blobs := make(map[imap.InternalMessageID]Usage, len(blobUsage))
+
+	for _, u := range blobUsage {
+		blobs[u.MessageID] = u
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	usage := make([]Usage, 0, len(s.blobs))
+
+	for messageID, ref := range s.blobs {
+		blob, ok := blobs[ref.blobID]
+		if !ok {
+			continue
+		}
+
+		usage = append(usage, Usage{
+			MessageID:  messageID,
+			Size:       blob.Size / int64(max(s.refs[ref.blobID], 1)),
+			LastAccess: blob.LastAccess,
+		})
+	}
+
+	return usage, nil
+}
+
+// Evict drops the literals of the given messages; a blob is only removed once none of the messages sharing it remain.
+func (s *dedupStore) Evict(messageIDs ...imap.InternalMessageID) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.drop(messageIDs)
+}
+
+// blobID returns the ID of the blob holding the given literal.
+func (s *dedupStore) blobID(literal []byte) imap.InternalMessageID {
+	mac := hmac.New(sha256.New, s.key)
+
+	if _, err := mac.Write(literal); err != nil {
+		panic(err)
+	}
+
+	return imap.InternalMessageID{UUID: uuid.UUID(mac.Sum(nil)[:16])}
+}
+
+// unref drops a reference to the given blob and deletes it once nothing references it anymore.
+// It must be called with the lock held, so that the blob isn't referenced again while it is being deleted.
+func (s *dedupStore) unref(blobID imap.InternalMessageID) error {
+	if s.refs[blobID]--; s.refs[blobID] > 0 {
+		return nil
+	}
+
+	delete(s.refs, blobID)
+
+	if _, ok := s.written[blobID]; !ok {
+		return nil
+	}
+
+	delete(s.written, blobID)
+
+	if err := s.impl.Delete(blobID); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// drop records that the given messages no longer reference their blob and releases the references once the journal
+// is synced. Messages without a literal are skipped. It must be called with the lock held.
+func (s *dedupStore) drop(messageIDs []imap.InternalMessageID) error {
+	dropped := make(map[imap.InternalMessageID]blobRef, len(messageIDs))
+
+	for _, messageID := range messageIDs {
+		ref, ok := s.blobs[messageID]
+		if !ok {
+			continue
+		}
+
+		if err := s.record(messageID, nil); err != nil {
+			return err
+		}
+
+		delete(s.blobs, messageID)
+
+		dropped[messageID] = ref
+	}
+
+	if len(dropped) == 0 {
+		return nil
+	}
+
+	if err := s.syncJournal(); err != nil {
+		return err
+	}
+
+	defer s.compactIfNeeded()
+
+	var errs []error
+
+	for _, ref := range dropped {
+		errs = append(errs, s.unref(ref.blobID))
+	}
+
+	return errors.Join(errs...)
+}
+
+// record appends the blob now referenced by the given message to the journal, or that it references none if ref is
+// nil. It must be called with the lock held.
+func (s *dedupStore) record(messageID imap.InternalMessageID, ref *blobRef) error {
+	line := "- " + messageID.String() + "\n"
+
+	if ref != nil {
+		line = ref.journalLine(messageID)
+	}
+
+	if _, err := s.journal.WriteString(line); err != nil {
+		return fmt.Errorf("failed to write dedup journal: %w", err)
+	}
+
+	s.journalEntries++
+
+	return nil
+}
+
+// syncJournal flushes the entries recorded so far to disk. It must be called with the lock held.
+func (s *dedupStore) syncJournal() error {
+	if err := s.journal.Sync(); err != nil {
+		return fmt.Errorf("failed to sync dedup journal: %w", err)
+	}
+
+	return nil
+}
+
+const (
+	// journalCompactionRatio is the number of journal entries per message with a literal past which the journal is
+	// compacted, so that the work of compacting is spread over as many updates as it has entries.
+	journalCompactionRatio = 4
+
+	// minJournalCompactionEntries is the number of journal entries below which it isn't compacted, however few
+	// messages have a literal.
+	minJournalCompactionEntries = 1024
+)
+
+// compactIfNeeded compacts the journal once it holds too many entries which were superseded. The entries it holds are
+// already synced, so a failure to compact it only leaves it as it is. It must be called with the lock held.
+func (s *dedupStore) compactIfNeeded() {
+	if s.journalEntries <= max(journalCompactionRatio*len(s.blobs), minJournalCompactionEntries) {
+		return
+	}
+
+	if err := s.openCompacted(); err != nil {
+		logrus.WithError(err).Warn("Failed to compact dedup journal")
+	}
+}
+
+// dedupKeyAAD binds the sealed key to its purpose.
+var dedupKeyAAD = []byte("GLUON-DEDUP-KEY")
+
+// loadKey loads the key identifying blobs, creating it if the store has none yet.
+func (s *dedupStore) loadKey(journalPath string, passphrase []byte) error {
+	sealed, err := os.ReadFile(s.keyPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		if _, err := os.Stat(journalPath); err == nil {
+			// Stores deduplicated before the key was kept identify their blobs with a key derived from the passphrase.
+			s.key = hash(append([]byte("GLUON-DEDUP"), passphrase...))
+		} else if errors.Is(err, fs.ErrNotExist) {
+			s.key = make([]byte, 32)
+
+			if _, err := rand.Read(s.key); err != nil {
+				return err
+			}
+		} else {
+			return err
+		}
+
+		return s.saveKey(passphrase)
+	} else if err != nil {
+		return err
+	}
+
+	if s.key, err = openDedupKey(sealed, passphrase); err == nil {
+		return nil
+	}
+
+	// A rotation may have been interrupted after it started, but before the key was sealed with the new passphrase.
+	oldPassphrase := s.impl.RotationPassphrase()
+	if oldPassphrase == nil {
+		return err
+	}
+
+	if s.key, err = openDedupKey(sealed, oldPassphrase); err != nil {
+		return err
+	}
+
+	return s.saveKey(passphrase)
+}
+
+// saveKey seals the key with the given passphrase and replaces the key file with it.
+func (s *dedupStore) saveKey(passphrase []byte) error {
+	gcm, err := NewCipher(passphrase)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.keyPath), 0o700); err != nil {
+		return err
+	}
+
+	return fsutil.WriteFile(s.keyPath, gcm.Seal(nonce, nonce, s.key, dedupKeyAAD), 0o600)
+}
+
+func openDedupKey(sealed, passphrase []byte) ([]byte, error) {
+	gcm, err := NewCipher(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("dedup key file is truncated")
+	}
+
+	key, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], dedupKeyAAD)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decrypt dedup key", ErrWrongPassphrase)
+	}
+
+	return key, nil
+}
+
+// load replays the journal at the given path, removes blobs which no message references and compacts the journal.
+// Without a journal, every literal already in the underlying store becomes a blob referenced by its own message.
+func (s *dedupStore) load(path string) error {
+	blobIDs, err := s.impl.List()
+	if err != nil {
+		return err
+	}
+
+	if file, err := os.Open(path); errors.Is(err, fs.ErrNotExist) {
+		for _, id := range blobIDs {
+			s.blobs[id] = blobRef{blobID: id}
+		}
+	} else if err != nil {
+		return err
+	} else {
+		err := replayJournal(file, s.blobs)
+
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to read dedup journal: %w", err)
+		}
+	}
+
+	for _, ref := range s.blobs {
+		s.refs[ref.blobID]++
+	}
+
+	for _, blobID := range blobIDs {
+		if _, ok := s.refs[blobID]; ok {
+			s.written[blobID] = struct{}{}
+			continue
+		}
+
+		if err := s.impl.Delete(blobID); err != nil {
+			return err
+		}
+	}
+
+	for messageID, ref := range s.blobs {
+		if _, ok := s.written[ref.blobID]; !ok {
+			logrus.WithField("messageID", messageID.ShortID()).Warn("Dedup journal references a missing literal")
+		}
+	}
+
+	return s.openCompacted()
+}
+
+// openCompacted replaces the journal with one recording only the current references, and appends to it from then on.
+func (s *dedupStore) openCompacted() error {
+	if err := os.MkdirAll(filepath.Dir(s.journalPath), 0o700); err != nil {
+		return err
+	}
+
+	var b strings.Builder
+
+	for messageID, ref := range s.blobs {
+		b.WriteString(ref.journalLine(messageID))
+	}
+
+	if err := fsutil.WriteFile(s.journalPath, []byte(b.String()), 0o600); err != nil {
+		return err
+	}
+
+	journal, err := os.OpenFile(s.journalPath, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if s.journal != nil {
+		if err := s.journal.Close(); err != nil {
+			logrus.WithError(err).Warn("Failed to close dedup journal")
+		}
+	}
+
+	s.journal = journal
+	s.journalEntries = len(s.blobs)
+
+	return nil
+}
+
+func (ref blobRef) journalLine(messageID imap.InternalMessageID) string {
+	line := "+ " + messageID.String() + " " + ref.blobID.String()
+
+	if ref.stripped {
+		line += " " + strippedFlag
+	}
+
+	return line + "\n"
+}
+
+// strippedFlag marks the journal entries of messages whose blob lacks the header naming them.
+const strippedFlag = "s"
+
+func replayJournal(r io.Reader, blobs map[imap.InternalMessageID]blobRef) error {
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+
+		// The last line may be incomplete if the process was interrupted while writing it.
+		if len(fields) < 2 {
+			continue
+		}
+
+		messageID, err := imap.InternalMessageIDFromString(fields[1])
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case fields[0] == "+" && len(fields) >= 3:
+			blobID, err := imap.InternalMessageIDFromString(fields[2])
+			if err != nil {
+				continue
+			}
+
+			blobs[messageID] = blobRef{blobID: blobID, stripped: len(fields) > 3 && fields[3] == strippedFlag}
+
+		case fields[0] == "-":
+			delete(blobs, messageID)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// stripMessageID removes the header naming the given message from its literal. The literal is returned unchanged if
+// it lacks the header, or if adding it back wouldn't give the exact same literal.
+func stripMessageID(messageID imap.InternalMessageID, literal []byte) ([]byte, bool) {
+	if id, err := rfc822.GetHeaderValue(literal, ids.InternalIDKey); err != nil || id != messageID.String() {
+		return literal, false
+	}
+
+	stripped, err := rfc822.EraseHeaderValue(literal, ids.InternalIDKey)
+	if err != nil {
+		return literal, false
+	}
+
+	if restored, err := rfc822.SetHeaderValue(stripped, ids.InternalIDKey, messageID.String()); err != nil || !bytes.Equal(restored, literal) {
+		return literal, false
+	}
+
+	return stripped, true
+}
+
+// DedupStoreBuilder builds stores which keep a single copy of identical literals of a user.
+type DedupStoreBuilder struct {
+	builder Builder
+}
+
+// NewDedupStoreBuilder returns a builder which deduplicates the stores built by builder.
+// The journal of each store is kept next to it, in the directory the store is built in.
+func NewDedupStoreBuilder(builder Builder) *DedupStoreBuilder {
+	return &DedupStoreBuilder{builder: builder}
+}
+
+func (d *DedupStoreBuilder) New(dir, userID string, passphrase []byte) (Store, error) {
+	impl, err := d.builder.New(dir, userID, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := NewDedupStore(impl, getDedupJournalPath(dir, userID), passphrase)
+	if err != nil {
+		return nil, errors.Join(err, impl.Close())
+	}
+
+	return store, nil
+}
+
+func (d *DedupStoreBuilder) Delete(dir, userID string) error {
+	if err := d.builder.Delete(dir, userID); err != nil {
+		return err
+	}
+
+	for _, path := range []string{getDedupJournalPath(dir, userID), getDedupKeyPath(getDedupJournalPath(dir, userID))} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func getDedupJournalPath(dir, userID string) string {
+	return filepath.Join(dir, userID+".dedup")
+}
+
+// getDedupKeyPath returns the path of the key file kept next to the journal at the given path.
+func getDedupKeyPath(journalPath string) string {
+	return journalPath + "-key"
+}
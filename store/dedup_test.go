@@ -0,0 +1,204 @@
+package store_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/internal/ids"
+	"github.com/ProtonMail/gluon/rfc822"
+	"github.com/ProtonMail/gluon/store"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedupStore(t *testing.T) {
+	dir := t.TempDir()
+	impl, st := newDedupStore(t, dir)
+
+	a, b, c := imap.NewInternalMessageID(), imap.NewInternalMessageID(), imap.NewInternalMessageID()
+
+	require.NoError(t, st.Set(a, bytes.NewReader([]byte("shared"))))
+	require.NoError(t, st.Set(b, bytes.NewReader([]byte("shared"))))
+	require.NoError(t, st.Set(c, bytes.NewReader([]byte("other"))))
+
+	requireBlobs(t, impl, 2)
+	requireLiterals(t, st, map[imap.InternalMessageID][]byte{a: []byte("shared"), b: []byte("shared"), c: []byte("other")})
+
+	ids, err := st.List()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []imap.InternalMessageID{a, b, c}, ids)
+
+	// The shared literal is kept for as long as a message references it.
+	require.NoError(t, st.Delete(a))
+	requireBlobs(t, impl, 2)
+	requireLiterals(t, st, map[imap.InternalMessageID][]byte{b: []byte("shared")})
+
+	_, err = st.Get(a)
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	require.NoError(t, st.Delete(a))
+
+	// Replacing the literal of a message drops its reference to the old one.
+	require.NoError(t, st.Set(c, bytes.NewReader([]byte("shared"))))
+	requireBlobs(t, impl, 1)
+
+	require.NoError(t, st.Delete(b, c))
+	requireBlobs(t, impl, 0)
+	require.NoError(t, st.Close())
+}
+
+func TestDedupStore_IgnoresMessageIDHeader(t *testing.T) {
+	dir := t.TempDir()
+	impl, st := newDedupStore(t, dir)
+
+	literals := make(map[imap.InternalMessageID][]byte)
+
+	for i := 0; i < 3; i++ {
+		id := imap.NewInternalMessageID()
+
+		literal, err := rfc822.SetHeaderValue([]byte("To: someone@pm.me\r\n\r\nbody"), ids.InternalIDKey, id.String())
+		require.NoError(t, err)
+		require.NoError(t, st.Set(id, bytes.NewReader(literal)))
+
+		literals[id] = literal
+	}
+
+	requireBlobs(t, impl, 1)
+	requireLiterals(t, st, literals)
+	require.NoError(t, st.Close())
+
+	_, st = newDedupStore(t, dir)
+	requireLiterals(t, st, literals)
+	require.NoError(t, st.Close())
+}
+
+func TestDedupStore_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	_, st := newDedupStore(t, dir)
+
+	literals := map[imap.InternalMessageID][]byte{
+		imap.NewInternalMessageID(): []byte("shared"),
+		imap.NewInternalMessageID(): []byte("shared"),
+		imap.NewInternalMessageID(): []byte("other"),
+	}
+
+	for id, literal := range literals {
+		require.NoError(t, st.Set(id, bytes.NewReader(literal)))
+	}
+
+	require.NoError(t, st.Close())
+
+	impl, st := newDedupStore(t, dir)
+	requireBlobs(t, impl, 2)
+	requireLiterals(t, st, literals)
+
+	// A blob written right before a crash, which no message references yet, is removed.
+	require.NoError(t, impl.Set(imap.NewInternalMessageID(), bytes.NewReader([]byte("orphan"))))
+	require.NoError(t, st.Close())
+
+	impl, st = newDedupStore(t, dir)
+	requireBlobs(t, impl, 2)
+	requireLiterals(t, st, literals)
+	require.NoError(t, st.Close())
+}
+
+func TestDedupStore_CompactsJournal(t *testing.T) {
+	dir := t.TempDir()
+	_, st := newDedupStore(t, dir)
+
+	id := imap.NewInternalMessageID()
+
+	// Every update appends to the journal, which is compacted once it is mostly superseded entries.
+	for i := 0; i < 3000; i++ {
+		require.NoError(t, st.Set(id, bytes.NewReader([]byte(fmt.Sprintf("literal %v", i)))))
+
+		b, err := os.ReadFile(filepath.Join(dir, "user.dedup"))
+		require.NoError(t, err)
+		require.LessOrEqual(t, bytes.Count(b, []byte("\n")), 1025)
+	}
+
+	require.NoError(t, st.Close())
+
+	impl, st := newDedupStore(t, dir)
+	requireBlobs(t, impl, 1)
+	requireLiterals(t, st, map[imap.InternalMessageID][]byte{id: []byte("literal 2999")})
+	require.NoError(t, st.Close())
+}
+
+func TestDedupStore_KeepsExistingLiterals(t *testing.T) {
+	dir := t.TempDir()
+
+	impl, err := store.NewOnDiskStore(filepath.Join(dir, "user"), []byte("pass"))
+	require.NoError(t, err)
+
+	id := imap.NewInternalMessageID()
+	require.NoError(t, impl.Set(id, bytes.NewReader([]byte("existing"))))
+
+	_, st := newDedupStore(t, dir)
+	requireLiterals(t, st, map[imap.InternalMessageID][]byte{id: []byte("existing")})
+
+	ids, err := st.List()
+	require.NoError(t, err)
+	require.Equal(t, []imap.InternalMessageID{id}, ids)
+	require.NoError(t, st.Close())
+}
+
+func TestDedupStore_KeySurvivesRotation(t *testing.T) {
+	dir := t.TempDir()
+	a, b, c := imap.NewInternalMessageID(), imap.NewInternalMessageID(), imap.NewInternalMessageID()
+
+	impl, st := openDedupStore(t, dir, []byte("old"))
+	require.NoError(t, st.Set(a, bytes.NewReader([]byte("shared"))))
+	require.NoError(t, st.(store.Rotator).StartRotation([]byte("old"), []byte("new")))
+	require.NoError(t, st.Close())
+
+	// Literals written after the rotation are still identified by the same key, and so still deduplicated.
+	impl, st = openDedupStore(t, dir, []byte("new"))
+	require.NoError(t, st.Set(b, bytes.NewReader([]byte("shared"))))
+	requireBlobs(t, impl, 1)
+	require.NoError(t, st.Close())
+
+	// The key can't be opened without a passphrase of the store.
+	impl, err := store.NewOnDiskStore(filepath.Join(dir, "user"), []byte("new"))
+	require.NoError(t, err)
+
+	_, err = store.NewDedupStore(impl, filepath.Join(dir, "user.dedup"), []byte("wrong"))
+	require.ErrorIs(t, err, store.ErrWrongPassphrase)
+	require.NoError(t, impl.Close())
+
+	// If the process stops after the rotation of the underlying store started, the key is still sealed with the old
+	// passphrase; it's resealed once the store is opened with the new one.
+	impl, err = store.NewOnDiskStore(filepath.Join(dir, "user"), []byte("new"))
+	require.NoError(t, err)
+	require.NoError(t, impl.(store.Rotator).FinishRotation())
+	require.NoError(t, impl.(store.Rotator).StartRotation([]byte("new"), []byte("newer")))
+	require.NoError(t, impl.Close())
+
+	impl, st = openDedupStore(t, dir, []byte("newer"))
+	require.NoError(t, st.Set(c, bytes.NewReader([]byte("shared"))))
+	requireBlobs(t, impl, 1)
+	require.NoError(t, st.Close())
+}
+
+func openDedupStore(t *testing.T, dir string, passphrase []byte) (store.Store, store.Store) {
+	impl, err := store.NewOnDiskStore(filepath.Join(dir, "user"), passphrase)
+	require.NoError(t, err)
+
+	st, err := store.NewDedupStore(impl, filepath.Join(dir, "user.dedup"), passphrase)
+	require.NoError(t, err)
+
+	return impl, st
+}
+
+func newDedupStore(t *testing.T, dir string) (store.Store, store.Store) {
+	return openDedupStore(t, dir, []byte("pass"))
+}
+
+func requireBlobs(t *testing.T, impl store.Store, n int) {
+	ids, err := impl.List()
+	require.NoError(t, err)
+	require.Len(t, ids, n)
+}
@@ -12,6 +12,8 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/ProtonMail/gluon/imap"
 	"github.com/pierrec/lz4/v4"
@@ -23,6 +25,15 @@ type onDiskStore struct {
 	gcm      cipher.AEAD
 	sem      *Semaphore
 	fallback Fallback
+
+	// key is the hash of the passphrase new literals are encrypted with.
+	key []byte
+
+	// rotation is the passphrase rotation in progress, or nil if there is none.
+	rotation *rotation
+
+	// keyLock guards the cipher, key and rotation, which change when a rotation starts or finishes.
+	keyLock sync.RWMutex
 }
 
 func NewCipher(pass []byte) (cipher.AEAD, error) {
@@ -49,9 +60,16 @@ func NewOnDiskStore(path string, pass []byte, opt ...Option) (Store, error) {
 		return nil, err
 	}
 
+	rotation, err := loadRotation(path, gcm)
+	if err != nil {
+		return nil, err
+	}
+
 	store := &onDiskStore{
-		path: path,
-		gcm:  gcm,
+		path:     path,
+		gcm:      gcm,
+		key:      hash(pass),
+		rotation: rotation,
 	}
 
 	for _, opt := range opt {
@@ -74,13 +92,12 @@ func (c *onDiskStore) Set(messageID imap.InternalMessageID, in io.Reader) error
 		defer c.sem.Unlock()
 	}
 
-	nonce := make([]byte, c.gcm.NonceSize())
-	if _, err := rand.Read(nonce); err != nil {
-		return err
-	}
+	gcm, _ := c.ciphers()
 
-	fullPath := filepath.Join(c.path, messageID.String())
+	return c.write(filepath.Join(c.path, messageID.String()), gcm, in)
+}
 
+func (c *onDiskStore) write(fullPath string, gcm cipher.AEAD, in io.Reader) error {
 	file, err := os.OpenFile(fullPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
 	if err != nil {
 		return err
@@ -94,6 +111,16 @@ func (c *onDiskStore) Set(messageID imap.InternalMessageID, in io.Reader) error
 		return fmt.Errorf("failed to write store header to file")
 	}
 
+	return writeLiteral(file, gcm, in)
+}
+
+// writeLiteral compresses the literal read from in and writes it to file, encrypted in blocks preceded by the nonce.
+func writeLiteral(file io.Writer, gcm cipher.AEAD, in io.Reader) error {
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
 	reader, writer := io.Pipe()
 	defer writer.Close()
 
@@ -108,8 +135,8 @@ func (c *onDiskStore) Set(messageID imap.InternalMessageID, in io.Reader) error
 		writer.CloseWithError(err)
 	}()
 
-	encryptionOverhead := c.gcm.Overhead()
-	encryptedBlockSized := getEncryptedBlockSize(c.gcm, blockSize)
+	encryptionOverhead := gcm.Overhead()
+	encryptedBlockSized := getEncryptedBlockSize(gcm, blockSize)
 
 	compressedBlock := make([]byte, blockSize)
 	encryptedBlock := make([]byte, encryptedBlockSized)
@@ -136,7 +163,7 @@ func (c *onDiskStore) Set(messageID imap.InternalMessageID, in io.Reader) error
 
 		// Encrypt the compressed block.
 		encryptedBlock = encryptedBlock[:0] // Reset slice.
-		encrypted := c.gcm.Seal(encryptedBlock, nonce, compressedBlock[0:bytesRead], nil)
+		encrypted := gcm.Seal(encryptedBlock, nonce, compressedBlock[0:bytesRead], nil)
 		encryptedLen := bytesRead + encryptionOverhead
 
 		// Write to disk.
@@ -154,6 +181,17 @@ func (c *onDiskStore) Get(messageID imap.InternalMessageID) ([]byte, error) {
 		defer c.sem.Unlock()
 	}
 
+	literal, err := c.get(messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	c.touch(messageID)
+
+	return literal, nil
+}
+
+func (c *onDiskStore) get(messageID imap.InternalMessageID) ([]byte, error) {
 	file, err := os.Open(filepath.Join(c.path, messageID.String()))
 	if err != nil {
 		return nil, err
@@ -193,7 +231,24 @@ func (c *onDiskStore) Get(messageID imap.InternalMessageID) ([]byte, error) {
 		fileSize = stat.Size() - int64(len(storeHeaderBytes))
 	}
 
-	nonce := make([]byte, c.gcm.NonceSize())
+	gcm, oldGCM := c.ciphers()
+
+	literal, err := readLiteral(file, gcm, fileSize)
+	if err != nil && oldGCM != nil {
+		// The literal may not have been rotated to the new passphrase yet.
+		if _, err := file.Seek(int64(len(storeHeaderBytes)), io.SeekStart); err != nil {
+			return nil, err
+		}
+
+		return readLiteral(file, oldGCM, fileSize)
+	}
+
+	return literal, err
+}
+
+// readLiteral decrypts and decompresses a literal written by writeLiteral.
+func readLiteral(file io.Reader, gcm cipher.AEAD, fileSize int64) ([]byte, error) {
+	nonce := make([]byte, gcm.NonceSize())
 
 	// Read nonce from file.
 	if _, err := io.ReadFull(file, nonce); err != nil {
@@ -202,8 +257,8 @@ func (c *onDiskStore) Get(messageID imap.InternalMessageID) ([]byte, error) {
 
 	reader, writer := io.Pipe()
 
-	encryptionOverhead := c.gcm.Overhead()
-	encryptedBlockSize := getEncryptedBlockSize(c.gcm, blockSize)
+	encryptionOverhead := gcm.Overhead()
+	encryptedBlockSize := getEncryptedBlockSize(gcm, blockSize)
 
 	go func() {
 		defer writer.Close()
@@ -226,7 +281,7 @@ func (c *onDiskStore) Get(messageID imap.InternalMessageID) ([]byte, error) {
 			// Decrypt read bytes.
 			decryptBuffer = decryptBuffer[:0] // Reset slice.
 
-			decrypted, err := c.gcm.Open(decryptBuffer, nonce, readBuffer[0:bytesRead], nil)
+			decrypted, err := gcm.Open(decryptBuffer, nonce, readBuffer[0:bytesRead], nil)
 			if err != nil {
 				writer.CloseWithError(fmt.Errorf("failed to decrypt block (offset:%v): %w", totalBytesRead, err))
 				return
@@ -266,7 +321,7 @@ func (c *onDiskStore) Delete(messageIDs ...imap.InternalMessageID) error {
 	}
 
 	for _, messageID := range messageIDs {
-		if err := os.Remove(filepath.Join(c.path, messageID.String())); err != nil {
+		if err := os.Remove(filepath.Join(c.path, messageID.String())); err != nil && !errors.Is(err, fs.ErrNotExist) {
 			return err
 		}
 	}
@@ -291,6 +346,11 @@ func (c *onDiskStore) List() ([]imap.InternalMessageID, error) {
 			return nil
 		}
 
+		// Hidden files hold the store's own state, such as the progress of a passphrase rotation.
+		if strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+
 		id, err := imap.InternalMessageIDFromString(info.Name())
 		if err != nil {
 			logrus.WithError(err).Errorf("Invalid id file in cache: %v", info.Name())
@@ -331,7 +391,27 @@ func (c *onDiskStore) readFromFallback(file *os.File) ([]byte, error) {
 		return nil, fmt.Errorf("failed to rewind file to start")
 	}
 
-	return c.fallback.Read(c.gcm, file)
+	gcm, oldGCM := c.ciphers()
+
+	// Files in an old format are only rewritten once they are rotated, so they may still use the old passphrase.
+	if oldGCM != nil {
+		gcm = oldGCM
+	}
+
+	return c.fallback.Read(gcm, file)
+}
+
+// ciphers returns the cipher new literals are encrypted with and, while a rotation is in progress, the cipher of
+// the passphrase it rotates from.
+func (c *onDiskStore) ciphers() (cipher.AEAD, cipher.AEAD) {
+	c.keyLock.RLock()
+	defer c.keyLock.RUnlock()
+
+	if c.rotation == nil {
+		return c.gcm, nil
+	}
+
+	return c.gcm, c.rotation.oldGCM
 }
 
 func getEncryptedBlockSize(aead cipher.AEAD, blockSize int) int {
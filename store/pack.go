@@ -0,0 +1,875 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/internal/fsutil"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+var ErrUnpackedStore = errors.New("the store holds literals in separate files which must be migrated first")
+
+// errPackStoreClosed is returned by a compaction which was abandoned because the store is being closed.
+var errPackStoreClosed = errors.New("pack store closed")
+
+// Compactor is implemented by stores which reclaim the space of replaced and deleted literals in bulk.
+type Compactor interface {
+	Compact() error
+}
+
+const (
+	packSuffix        = ".pack"
+	packIndexFileName = "index"
+
+	// maxPackSize is the size past which a new pack is started.
+	maxPackSize = 256 << 20
+
+	// minCompactGarbage is the space replaced and deleted literals must take before the packs are compacted.
+	minCompactGarbage = 32 << 20
+)
+
+const (
+	recordLiteral   = byte('L')
+	recordTombstone = byte('D')
+
+	// recordHeaderSize is the size of the kind, message ID and payload length preceding each record's payload.
+	recordHeaderSize = 1 + 16 + 4
+)
+
+// packIndexHeader starts every index file and is followed by the index and its checksum.
+var packIndexHeader = []byte("GLUON-PACK-IDX\x00\x01")
+
+// packStore keeps the literals of a user in a few large append-only pack files instead of a file per message.
+// Each record of a pack is either a literal, compressed and encrypted as by the on-disk store, or a tombstone marking
+// a literal as deleted. Where the latest literal of each message is stored is kept in memory and saved to an index
+// when the store is closed; records appended to the packs since the index was saved are replayed when it is opened.
+// Records are synced before Set and Delete return. Once most of the space of the packs is taken by replaced and
+// deleted literals, the live ones are copied to new packs in the background and the old ones are removed.
+//
+// The pack store implements neither Rotator nor Evictor, so it can't be used along with passphrase rotation or a
+// store budget.
+type packStore struct {
+	path string
+	gcm  cipher.AEAD
+
+	// packs holds the open pack files by number. Records are appended to the one with the highest number.
+	packs      map[uint32]*os.File
+	active     uint32
+	activeSize int64
+
+	// base is the number of the first pack written by the last compaction. Packs numbered below it are obsolete.
+	base uint32
+
+	entries map[imap.InternalMessageID]packEntry
+
+	// size is the space taken by all packs, and live the space taken by the records entries refer to.
+	size, live int64
+
+	lock sync.RWMutex
+
+	// compactLock serializes compactions, which only hold lock while they start and finish.
+	compactLock sync.Mutex
+
+	// compactCh wakes up the background compaction, which stops once quitCh is closed.
+	compactCh chan struct{}
+	quitCh    chan struct{}
+	wg        sync.WaitGroup
+}
+
+// packEntry locates the payload of a literal record.
+type packEntry struct {
+	pack   uint32
+	offset int64
+	length uint32
+}
+
+func (e packEntry) recordSize() int64 {
+	return recordHeaderSize + int64(e.length)
+}
+
+// NewPackStore opens the pack store at the given path, creating it if needed.
+// It fails with ErrUnpackedStore if the directory holds literals written by the on-disk store.
+func NewPackStore(path string, pass []byte) (Store, error) {
+	if err := os.MkdirAll(path, 0o700); err != nil {
+		return nil, err
+	}
+
+	if loose, err := hasLooseLiterals(path); err != nil {
+		return nil, err
+	} else if loose {
+		return nil, ErrUnpackedStore
+	}
+
+	gcm, err := NewCipher(pass)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &packStore{
+		path:      path,
+		gcm:       gcm,
+		packs:     make(map[uint32]*os.File),
+		entries:   make(map[imap.InternalMessageID]packEntry),
+		compactCh: make(chan struct{}, 1),
+		quitCh:    make(chan struct{}),
+	}
+
+	if err := store.load(); err != nil {
+		return nil, errors.Join(err, store.closePacks())
+	}
+
+	store.requestCompaction()
+
+	store.wg.Add(1)
+
+	go store.compactInBackground()
+
+	return store, nil
+}
+
+func (p *packStore) Get(messageID imap.InternalMessageID) ([]byte, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	entry, ok := p.entries[messageID]
+	if !ok {
+		return nil, fmt.Errorf("no literal stored for message %v: %w", messageID.ShortID(), fs.ErrNotExist)
+	}
+
+	return readLiteral(io.NewSectionReader(p.packs[entry.pack], entry.offset, int64(entry.length)), p.gcm, int64(entry.length))
+}
+
+func (p *packStore) Set(messageID imap.InternalMessageID, reader io.Reader) error {
+	// The literal is compressed and encrypted before taking the lock so that writes don't hold up reads.
+	var payload bytes.Buffer
+
+	if err := writeLiteral(&payload, p.gcm, reader); err != nil {
+		return err
+	}
+
+	if payload.Len() > maxPackSize {
+		return fmt.Errorf("literal of message %v is too large to be packed", messageID.ShortID())
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	entry, err := p.append(recordLiteral, messageID, payload.Bytes())
+	if err != nil {
+		return err
+	}
+
+	if err := p.packs[p.active].Sync(); err != nil {
+		return fmt.Errorf("failed to sync pack: %w", err)
+	}
+
+	if old, ok := p.entries[messageID]; ok {
+		p.live -= old.recordSize()
+	}
+
+	p.entries[messageID] = entry
+	p.live += entry.recordSize()
+
+	p.requestCompaction()
+
+	return nil
+}
+
+func (p *packStore) Delete(messageIDs ...imap.InternalMessageID) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	// Tombstones may span packs, each of which is synced before a new one is started.
+	for _, messageID := range messageIDs {
+		entry, ok := p.entries[messageID]
+		if !ok {
+			continue
+		}
+
+		if _, err := p.append(recordTombstone, messageID, nil); err != nil {
+			return err
+		}
+
+		delete(p.entries, messageID)
+		p.live -= entry.recordSize()
+	}
+
+	if err := p.packs[p.active].Sync(); err != nil {
+		return fmt.Errorf("failed to sync pack: %w", err)
+	}
+
+	p.requestCompaction()
+
+	return nil
+}
+
+func (p *packStore) List() ([]imap.InternalMessageID, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return maps.Keys(p.entries), nil
+}
+
+// Close stops the background compaction, abandoning one in progress, saves the index, so that the packs needn't be
+// read when the store is next opened, and closes the packs.
+func (p *packStore) Close() error {
+	close(p.quitCh)
+	p.wg.Wait()
+
+	p.compactLock.Lock()
+	defer p.compactLock.Unlock()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return errors.Join(p.saveIndex(), p.closePacks())
+}
+
+// Compact copies the live literals to new packs and removes the old ones.
+func (p *packStore) Compact() error {
+	p.compactLock.Lock()
+	defer p.compactLock.Unlock()
+
+	return p.compact()
+}
+
+// append writes a record to the active pack, starting a new pack first if it would grow too large.
+// It must be called with the lock held.
+func (p *packStore) append(kind byte, messageID imap.InternalMessageID, payload []byte) (packEntry, error) {
+	record := newRecord(kind, messageID, payload)
+
+	if p.activeSize > 0 && p.activeSize+int64(len(record)) > maxPackSize {
+		if err := p.packs[p.active].Sync(); err != nil {
+			return packEntry{}, fmt.Errorf("failed to sync pack: %w", err)
+		}
+
+		if err := p.openPack(p.active + 1); err != nil {
+			return packEntry{}, err
+		}
+	}
+
+	if _, err := p.packs[p.active].WriteAt(record, p.activeSize); err != nil {
+		return packEntry{}, fmt.Errorf("failed to write to pack: %w", err)
+	}
+
+	entry := packEntry{pack: p.active, offset: p.activeSize + recordHeaderSize, length: uint32(len(payload))}
+
+	p.activeSize += int64(len(record))
+	p.size += int64(len(record))
+
+	return entry, nil
+}
+
+// openPack creates the pack with the given number and makes it the active one.
+func (p *packStore) openPack(number uint32) error {
+	file, err := p.createPack(number)
+	if err != nil {
+		return err
+	}
+
+	p.packs[number] = file
+	p.active = number
+	p.activeSize = 0
+
+	return nil
+}
+
+// createPack creates the pack with the given number and syncs the directory, so that records synced to the pack
+// can't be lost along with its directory entry.
+func (p *packStore) createPack(number uint32) (*os.File, error) {
+	file, err := os.OpenFile(p.packPath(number), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fsutil.SyncDir(p.path); err != nil {
+		return nil, errors.Join(err, file.Close())
+	}
+
+	return file, nil
+}
+
+// newRecord returns a record of the given kind holding the given payload.
+func newRecord(kind byte, messageID imap.InternalMessageID, payload []byte) []byte {
+	record := make([]byte, recordHeaderSize, recordHeaderSize+len(payload))
+
+	record[0] = kind
+	copy(record[1:17], messageID.UUID[:])
+	binary.BigEndian.PutUint32(record[17:recordHeaderSize], uint32(len(payload)))
+
+	return append(record, payload...)
+}
+
+func (p *packStore) packPath(number uint32) string {
+	return filepath.Join(p.path, fmt.Sprintf("%08d%v", number, packSuffix))
+}
+
+func (p *packStore) needsCompaction() bool {
+	garbage := p.size - p.live
+
+	return garbage > minCompactGarbage && garbage > p.live
+}
+
+// requestCompaction wakes up the background compaction if enough space is taken by replaced and deleted literals.
+// It must be called with the lock held.
+func (p *packStore) requestCompaction() {
+	if !p.needsCompaction() {
+		return
+	}
+
+	select {
+	case p.compactCh <- struct{}{}:
+	default:
+	}
+}
+
+// compactInBackground compacts the packs whenever requested until the store is closed.
+// A failed compaction is logged; the packs are left as they were and compacted again on the next request.
+func (p *packStore) compactInBackground() {
+	defer p.wg.Done()
+
+	for {
+		select {
+		case <-p.quitCh:
+			return
+
+		case <-p.compactCh:
+			if err := p.compactIfNeeded(); err != nil && !errors.Is(err, errPackStoreClosed) {
+				logrus.WithError(err).WithField("path", p.path).Error("Failed to compact packs")
+			}
+		}
+	}
+}
+
+func (p *packStore) compactIfNeeded() error {
+	p.compactLock.Lock()
+	defer p.compactLock.Unlock()
+
+	p.lock.RLock()
+	needed := p.needsCompaction()
+	p.lock.RUnlock()
+
+	if !needed {
+		return nil
+	}
+
+	return p.compact()
+}
+
+// packCompaction is a compaction in progress.
+type packCompaction struct {
+	// base is the number of the first pack the live literals are copied to.
+	base uint32
+
+	// oldPacks holds the packs to remove once the copies are indexed, which took oldSize.
+	oldPacks map[uint32]*os.File
+	oldSize  int64
+
+	// entries holds the live literals when the compaction started, and copies where each was copied to.
+	entries map[imap.InternalMessageID]packEntry
+	copies  map[imap.InternalMessageID]packEntry
+
+	// packs holds the packs the literals were copied to, which take size.
+	packs map[uint32]*os.File
+	size  int64
+}
+
+// compact copies the live literals to new packs, numbered after the existing ones, and removes the old packs once the
+// synced index points to the new ones. Literals written meanwhile go to a pack numbered after those the copies can
+// take, so that if the compaction is interrupted, they are replayed after the copies along with the old packs.
+// The lock is only held while the compaction starts and finishes. It must be called with compactLock held.
+func (p *packStore) compact() error {
+	c, err := p.startCompaction()
+	if err != nil {
+		return err
+	}
+
+	if err := p.copyLiterals(c); err != nil {
+		var closeErr error
+
+		for number, file := range c.packs {
+			closeErr = errors.Join(closeErr, file.Close(), os.Remove(p.packPath(number)))
+		}
+
+		return errors.Join(err, closeErr)
+	}
+
+	return p.finishCompaction(c)
+}
+
+func (p *packStore) startCompaction() (*packCompaction, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	c := &packCompaction{
+		base:     p.active + 1,
+		oldPacks: maps.Clone(p.packs),
+		oldSize:  p.size,
+		entries:  maps.Clone(p.entries),
+		copies:   make(map[imap.InternalMessageID]packEntry, len(p.entries)),
+		packs:    make(map[uint32]*os.File),
+	}
+
+	// Each pack but the last is filled past half of maxPackSize, so the copies take at most this many packs.
+	reserved := uint32(2 * (p.live/maxPackSize + 1))
+
+	if err := p.packs[p.active].Sync(); err != nil {
+		return nil, fmt.Errorf("failed to sync pack: %w", err)
+	}
+
+	if err := p.openPack(c.base + reserved); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// copyLiterals copies the live literals of the old packs to new packs and syncs them.
+// The old packs are only read, and aren't written to anymore, so the lock needn't be held.
+func (p *packStore) copyLiterals(c *packCompaction) error {
+	// Copy the literals in the order they are stored in, which keeps the reads sequential.
+	ids := maps.Keys(c.entries)
+
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := c.entries[ids[i]], c.entries[ids[j]]
+		return a.pack < b.pack || (a.pack == b.pack && a.offset < b.offset)
+	})
+
+	var (
+		number = c.base
+		size   int64
+	)
+
+	file, err := p.createPack(number)
+	if err != nil {
+		return err
+	}
+
+	c.packs[number] = file
+
+	for _, id := range ids {
+		select {
+		case <-p.quitCh:
+			return errPackStoreClosed
+
+		default:
+		}
+
+		entry := c.entries[id]
+
+		payload := make([]byte, entry.length)
+
+		if _, err := c.oldPacks[entry.pack].ReadAt(payload, entry.offset); err != nil {
+			return fmt.Errorf("failed to read literal of message %v: %w", id.ShortID(), err)
+		}
+
+		record := newRecord(recordLiteral, id, payload)
+
+		if size > 0 && size+int64(len(record)) > maxPackSize {
+			if err := file.Sync(); err != nil {
+				return fmt.Errorf("failed to sync pack: %w", err)
+			}
+
+			number++
+
+			if file, err = p.createPack(number); err != nil {
+				return err
+			}
+
+			c.packs[number] = file
+			size = 0
+		}
+
+		if _, err := file.WriteAt(record, size); err != nil {
+			return fmt.Errorf("failed to write to pack: %w", err)
+		}
+
+		c.copies[id] = packEntry{pack: number, offset: size + recordHeaderSize, length: entry.length}
+
+		size += int64(len(record))
+		c.size += int64(len(record))
+	}
+
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync pack: %w", err)
+	}
+
+	return nil
+}
+
+// finishCompaction points the entries of the literals which weren't replaced or deleted meanwhile to their copies,
+// saves the index and removes the old packs.
+func (p *packStore) finishCompaction(c *packCompaction) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for id, entry := range c.entries {
+		if current, ok := p.entries[id]; ok && current == entry {
+			p.entries[id] = c.copies[id]
+		}
+	}
+
+	for number, file := range c.packs {
+		p.packs[number] = file
+	}
+
+	p.base = c.base
+	p.size += c.size - c.oldSize
+
+	if err := p.saveIndex(); err != nil {
+		return err
+	}
+
+	for number, file := range c.oldPacks {
+		delete(p.packs, number)
+
+		if err := file.Close(); err != nil {
+			return err
+		}
+
+		if err := os.Remove(p.packPath(number)); err != nil {
+			return err
+		}
+	}
+
+	return fsutil.SyncDir(p.path)
+}
+
+func (p *packStore) closePacks() error {
+	var err error
+
+	for _, file := range p.packs {
+		err = errors.Join(err, file.Close())
+	}
+
+	return err
+}
+
+// load opens the packs and locates the latest literal of each message, from the index and from the records appended
+// since it was saved. Packs made obsolete by a compaction are removed.
+func (p *packStore) load() error {
+	numbers, err := p.listPacks()
+	if err != nil {
+		return err
+	}
+
+	base, indexed, err := p.loadIndex()
+	if err != nil {
+		return err
+	}
+
+	for _, number := range numbers {
+		if number < base {
+			if err := os.Remove(p.packPath(number)); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		file, err := os.OpenFile(p.packPath(number), os.O_RDWR, 0o600)
+		if err != nil {
+			return err
+		}
+
+		p.packs[number] = file
+
+		size, err := p.replay(number, file, indexed[number])
+		if err != nil {
+			return fmt.Errorf("failed to read pack %v: %w", number, err)
+		}
+
+		p.active, p.activeSize = number, size
+		p.size += size
+	}
+
+	if len(p.packs) == 0 {
+		if err := p.openPack(max(base, 1)); err != nil {
+			return err
+		}
+	}
+
+	p.base = base
+
+	for id, entry := range p.entries {
+		if _, ok := p.packs[entry.pack]; !ok {
+			return fmt.Errorf("literal of message %v is indexed in missing pack %v", id.ShortID(), entry.pack)
+		}
+
+		p.live += entry.recordSize()
+	}
+
+	return nil
+}
+
+// listPacks returns the numbers of the packs in the store in ascending order.
+func (p *packStore) listPacks() ([]uint32, error) {
+	dirEntries, err := os.ReadDir(p.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var numbers []uint32
+
+	for _, dirEntry := range dirEntries {
+		name, ok := strings.CutSuffix(dirEntry.Name(), packSuffix)
+		if !ok {
+			continue
+		}
+
+		number, err := strconv.ParseUint(name, 10, 32)
+		if err != nil {
+			continue
+		}
+
+		numbers = append(numbers, uint32(number))
+	}
+
+	slices.Sort(numbers)
+
+	return numbers, nil
+}
+
+// replay applies the records of the given pack following offset to the entries and returns the size of the pack.
+// A record which was only partly written when the process was interrupted is cut off.
+func (p *packStore) replay(number uint32, file *os.File, offset int64) (int64, error) {
+	stat, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	if offset > stat.Size() {
+		return 0, fmt.Errorf("pack is shorter than indexed")
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	reader := bufio.NewReader(file)
+	header := make([]byte, recordHeaderSize)
+
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return offset, nil
+			}
+
+			break
+		}
+
+		// A record of an unknown kind, like zeroes left by a crash after the file grew, is a torn tail as well.
+		if header[0] != recordLiteral && header[0] != recordTombstone {
+			break
+		}
+
+		length := binary.BigEndian.Uint32(header[17:recordHeaderSize])
+
+		if offset+recordHeaderSize+int64(length) > stat.Size() {
+			break
+		}
+
+		if _, err := reader.Discard(int(length)); err != nil {
+			return 0, err
+		}
+
+		messageID := imap.InternalMessageID{UUID: uuid.UUID(header[1:17])}
+
+		switch header[0] {
+		case recordLiteral:
+			p.entries[messageID] = packEntry{pack: number, offset: offset + recordHeaderSize, length: length}
+
+		case recordTombstone:
+			delete(p.entries, messageID)
+		}
+
+		offset += recordHeaderSize + int64(length)
+	}
+
+	return offset, file.Truncate(offset)
+}
+
+// saveIndex writes the entries to the index along with the size of each pack they cover.
+//
+// The index holds:
+//   - the base pack number and the number of packs,
+//   - for each pack, its number and size,
+//   - the number of entries,
+//   - for each entry, the message ID, pack number, payload offset and payload length,
+//
+// followed by the SHA-256 of everything before it.
+func (p *packStore) saveIndex() error {
+	var buf bytes.Buffer
+
+	buf.Write(packIndexHeader)
+
+	write := func(v any) {
+		_ = binary.Write(&buf, binary.BigEndian, v)
+	}
+
+	numbers := maps.Keys(p.packs)
+	slices.Sort(numbers)
+
+	write(p.base)
+	write(uint32(len(numbers)))
+
+	for _, number := range numbers {
+		size := p.activeSize
+
+		if number != p.active {
+			stat, err := p.packs[number].Stat()
+			if err != nil {
+				return err
+			}
+
+			size = stat.Size()
+		}
+
+		write(number)
+		write(size)
+	}
+
+	write(uint32(len(p.entries)))
+
+	for id, entry := range p.entries {
+		buf.Write(id.UUID[:])
+		write(entry.pack)
+		write(entry.offset)
+		write(entry.length)
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+	buf.Write(sum[:])
+
+	return fsutil.WriteFile(filepath.Join(p.path, packIndexFileName), buf.Bytes(), 0o600)
+}
+
+// loadIndex loads the entries from the index and returns the base pack number and the size of each pack it covers.
+// If the index is missing or damaged, the packs are replayed in full instead.
+func (p *packStore) loadIndex() (uint32, map[uint32]int64, error) {
+	b, err := os.ReadFile(filepath.Join(p.path, packIndexFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil, nil
+	} else if err != nil {
+		return 0, nil, err
+	}
+
+	if len(b) < len(packIndexHeader)+sha256.Size || !bytes.HasPrefix(b, packIndexHeader) {
+		return 0, nil, nil
+	}
+
+	contents, sum := b[:len(b)-sha256.Size], b[len(b)-sha256.Size:]
+
+	if actual := sha256.Sum256(contents); !bytes.Equal(actual[:], sum) {
+		return 0, nil, nil
+	}
+
+	reader := bytes.NewReader(contents[len(packIndexHeader):])
+
+	read := func(v any) {
+		if err == nil {
+			err = binary.Read(reader, binary.BigEndian, v)
+		}
+	}
+
+	var base, packCount, entryCount uint32
+
+	read(&base)
+	read(&packCount)
+
+	indexed := make(map[uint32]int64, packCount)
+
+	for i := uint32(0); i < packCount && err == nil; i++ {
+		var (
+			number uint32
+			size   int64
+		)
+
+		read(&number)
+		read(&size)
+
+		indexed[number] = size
+	}
+
+	read(&entryCount)
+
+	for i := uint32(0); i < entryCount && err == nil; i++ {
+		var (
+			id    uuid.UUID
+			entry packEntry
+		)
+
+		read(&id)
+		read(&entry.pack)
+		read(&entry.offset)
+		read(&entry.length)
+
+		p.entries[imap.InternalMessageID{UUID: id}] = entry
+	}
+
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid pack index: %w", err)
+	}
+
+	return base, indexed, nil
+}
+
+// hasLooseLiterals returns whether the directory at the given path holds literals in separate files.
+func hasLooseLiterals(path string) (bool, error) {
+	dirEntries, err := os.ReadDir(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	for _, dirEntry := range dirEntries {
+		if _, err := imap.InternalMessageIDFromString(dirEntry.Name()); err == nil {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// PackStoreBuilder builds pack stores. They support neither passphrase rotation nor a store budget.
+type PackStoreBuilder struct{}
+
+// New opens the pack store of the given user, first migrating the literals the on-disk store may have written there.
+func (*PackStoreBuilder) New(dir, userID string, passphrase []byte) (Store, error) {
+	if err := MigrateToPackStore(dir, userID, passphrase); err != nil {
+		return nil, fmt.Errorf("failed to migrate store: %w", err)
+	}
+
+	return NewPackStore(filepath.Join(dir, userID), passphrase)
+}
+
+func (*PackStoreBuilder) Delete(dir, userID string) error {
+	storePath := filepath.Join(dir, userID)
+
+	for _, path := range []string{storePath, storePath + packingSuffix, storePath + unpackedSuffix} {
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
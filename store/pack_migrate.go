@@ -0,0 +1,107 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// packingSuffix names the directory a store is packed into before it replaces the unpacked one.
+	packingSuffix = ".packing"
+
+	// unpackedSuffix names the directory the unpacked store is moved to until it is removed.
+	unpackedSuffix = ".unpacked"
+)
+
+// MigrateToPackStore moves the literals of the given user from the file per message written by the on-disk store into
+// a pack store in the same place. It does nothing if there are no such files.
+//
+// The literals are packed into a separate directory which then replaces the unpacked store, so the store is never
+// left half-migrated; a migration which was interrupted is finished or started over when this is called again.
+// Literals which can't be read are left out. Stores with a passphrase rotation in progress can't be migrated until it
+// is finished.
+func MigrateToPackStore(dir, userID string, passphrase []byte, opt ...Option) error {
+	path := filepath.Join(dir, userID)
+	packingPath, unpackedPath := path+packingSuffix, path+unpackedSuffix
+
+	if _, err := os.Stat(unpackedPath); err == nil {
+		return finishPackMigration(path, packingPath, unpackedPath)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	if loose, err := hasLooseLiterals(path); err != nil || !loose {
+		return err
+	}
+
+	if err := os.RemoveAll(packingPath); err != nil {
+		return err
+	}
+
+	src, err := NewOnDiskStore(path, passphrase, opt...)
+	if err != nil {
+		return err
+	}
+
+	if rotator, ok := src.(Rotator); ok && rotator.RotationPassphrase() != nil {
+		return ErrRotationInProgress
+	}
+
+	dst, err := NewPackStore(packingPath, passphrase)
+	if err != nil {
+		return err
+	}
+
+	if err := copyLiterals(src, dst); err != nil {
+		return errors.Join(err, dst.Close())
+	}
+
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(path, unpackedPath); err != nil {
+		return err
+	}
+
+	return finishPackMigration(path, packingPath, unpackedPath)
+}
+
+// finishPackMigration puts the packed store in place of the unpacked one, once the latter was moved aside.
+func finishPackMigration(path, packingPath, unpackedPath string) error {
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		if err := os.Rename(packingPath, path); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(unpackedPath)
+}
+
+func copyLiterals(src, dst Store) error {
+	ids, err := src.List()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		literal, err := src.Get(id)
+		if err != nil {
+			logrus.WithError(err).WithField("messageID", id.ShortID()).Warn("Leaving out unreadable literal")
+			continue
+		}
+
+		if err := dst.Set(id, bytes.NewReader(literal)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
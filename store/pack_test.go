@@ -0,0 +1,274 @@
+package store_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/store"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPackStore(t *testing.T) {
+	dir := t.TempDir()
+
+	st, err := store.NewPackStore(dir, []byte("pass"))
+	require.NoError(t, err)
+
+	literals := setLiterals(t, st, 5)
+
+	// Literals larger than a block are split like in the on-disk store.
+	large := make([]byte, 1024*1024)
+	_, err = rand.Read(large) //nolint:gosec
+	require.NoError(t, err)
+
+	largeID := imap.NewInternalMessageID()
+	require.NoError(t, st.Set(largeID, bytes.NewReader(large)))
+	literals[largeID] = large
+
+	requireLiterals(t, st, literals)
+
+	// Replaced literals are read from their latest record; deleted ones are gone.
+	for id := range setLiterals(t, st, 1) {
+		require.NoError(t, st.Delete(id))
+
+		_, err := st.Get(id)
+		require.ErrorIs(t, err, os.ErrNotExist)
+	}
+
+	for id := range literals {
+		literals[id] = []byte("To: replaced@pm.me\r\n\r\n" + id.String())
+		require.NoError(t, st.Set(id, bytes.NewReader(literals[id])))
+
+		break
+	}
+
+	requireLiterals(t, st, literals)
+	requirePackedIDs(t, st, literals)
+	require.NoError(t, st.Close())
+
+	// The store is loaded from its index.
+	st, err = store.NewPackStore(dir, []byte("pass"))
+	require.NoError(t, err)
+	requireLiterals(t, st, literals)
+	requirePackedIDs(t, st, literals)
+
+	// Literals written after the index was saved are replayed from the packs, as when the process was interrupted.
+	for id, literal := range setLiterals(t, st, 2) {
+		literals[id] = literal
+	}
+
+	st, err = store.NewPackStore(dir, []byte("pass"))
+	require.NoError(t, err)
+	requireLiterals(t, st, literals)
+	require.NoError(t, st.Close())
+
+	// Without an index, all packs are replayed.
+	require.NoError(t, os.Remove(filepath.Join(dir, "index")))
+
+	st, err = store.NewPackStore(dir, []byte("pass"))
+	require.NoError(t, err)
+	requireLiterals(t, st, literals)
+	requirePackedIDs(t, st, literals)
+	require.NoError(t, st.Close())
+}
+
+func TestPackStore_Compact(t *testing.T) {
+	dir := t.TempDir()
+
+	st, err := store.NewPackStore(dir, []byte("pass"))
+	require.NoError(t, err)
+
+	literals := setLiterals(t, st, 10)
+
+	for id := range setLiterals(t, st, 10) {
+		require.NoError(t, st.Delete(id))
+	}
+
+	before := packSize(t, dir)
+
+	require.NoError(t, st.(store.Compactor).Compact())
+	require.Less(t, packSize(t, dir), before)
+	requireLiterals(t, st, literals)
+	requirePackedIDs(t, st, literals)
+
+	// Literals written after compacting go to the new pack.
+	for id, literal := range setLiterals(t, st, 1) {
+		literals[id] = literal
+	}
+
+	require.NoError(t, st.Close())
+
+	st, err = store.NewPackStore(dir, []byte("pass"))
+	require.NoError(t, err)
+	requireLiterals(t, st, literals)
+	requirePackedIDs(t, st, literals)
+}
+
+func TestPackStore_TruncatedRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	st, err := store.NewPackStore(dir, []byte("pass"))
+	require.NoError(t, err)
+
+	literals := setLiterals(t, st, 3)
+
+	// The process is interrupted while a record is written.
+	packs, err := filepath.Glob(filepath.Join(dir, "*.pack"))
+	require.NoError(t, err)
+	require.Len(t, packs, 1)
+
+	file, err := os.OpenFile(packs[0], os.O_WRONLY|os.O_APPEND, 0o600)
+	require.NoError(t, err)
+	_, err = file.Write([]byte{'L', 1, 2, 3})
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	st, err = store.NewPackStore(dir, []byte("pass"))
+	require.NoError(t, err)
+	requireLiterals(t, st, literals)
+
+	for id, literal := range setLiterals(t, st, 1) {
+		literals[id] = literal
+	}
+
+	st, err = store.NewPackStore(dir, []byte("pass"))
+	require.NoError(t, err)
+	requireLiterals(t, st, literals)
+}
+
+func TestPackStore_ZeroedTail(t *testing.T) {
+	dir := t.TempDir()
+
+	st, err := store.NewPackStore(dir, []byte("pass"))
+	require.NoError(t, err)
+
+	literals := setLiterals(t, st, 3)
+	require.NoError(t, st.Close())
+
+	// A crash may leave the pack grown past its last record, with only zeroes written there.
+	packs, err := filepath.Glob(filepath.Join(dir, "*.pack"))
+	require.NoError(t, err)
+	require.Len(t, packs, 1)
+
+	file, err := os.OpenFile(packs[0], os.O_WRONLY|os.O_APPEND, 0o600)
+	require.NoError(t, err)
+	_, err = file.Write(make([]byte, 4096))
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	st, err = store.NewPackStore(dir, []byte("pass"))
+	require.NoError(t, err)
+	requireLiterals(t, st, literals)
+
+	for id, literal := range setLiterals(t, st, 1) {
+		literals[id] = literal
+	}
+
+	require.NoError(t, st.Close())
+
+	st, err = store.NewPackStore(dir, []byte("pass"))
+	require.NoError(t, err)
+	requireLiterals(t, st, literals)
+	require.NoError(t, st.Close())
+}
+
+func TestMigrateToPackStore(t *testing.T) {
+	dir := t.TempDir()
+
+	unpacked, err := new(store.OnDiskStoreBuilder).New(dir, "user", []byte("pass"))
+	require.NoError(t, err)
+
+	literals := setLiterals(t, unpacked, 5)
+
+	_, err = store.NewPackStore(filepath.Join(dir, "user"), []byte("pass"))
+	require.ErrorIs(t, err, store.ErrUnpackedStore)
+
+	require.NoError(t, store.MigrateToPackStore(dir, "user", []byte("pass")))
+	require.NoError(t, store.MigrateToPackStore(dir, "user", []byte("pass")))
+
+	st, err := new(store.PackStoreBuilder).New(dir, "user", []byte("pass"))
+	require.NoError(t, err)
+	requireLiterals(t, st, literals)
+	requirePackedIDs(t, st, literals)
+	require.NoError(t, st.Close())
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	for _, entry := range dirEntryNames(t, filepath.Join(dir, "user")) {
+		_, err := imap.InternalMessageIDFromString(entry)
+		require.Error(t, err)
+	}
+
+	require.NoError(t, new(store.PackStoreBuilder).Delete(dir, "user"))
+
+	entries, err = os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestMigrateToPackStore_Interrupted(t *testing.T) {
+	dir := t.TempDir()
+
+	unpacked, err := new(store.OnDiskStoreBuilder).New(dir, "user", []byte("pass"))
+	require.NoError(t, err)
+
+	literals := setLiterals(t, unpacked, 3)
+
+	// The migration is interrupted after the unpacked store was moved aside.
+	require.NoError(t, store.MigrateToPackStore(dir, "user", []byte("pass")))
+	require.NoError(t, os.Rename(filepath.Join(dir, "user"), filepath.Join(dir, "user.packing")))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "user.unpacked"), 0o700))
+
+	st, err := new(store.PackStoreBuilder).New(dir, "user", []byte("pass"))
+	require.NoError(t, err)
+	requireLiterals(t, st, literals)
+	require.NoError(t, st.Close())
+
+	require.NoDirExists(t, filepath.Join(dir, "user.packing"))
+	require.NoDirExists(t, filepath.Join(dir, "user.unpacked"))
+}
+
+func requirePackedIDs(t *testing.T, st store.Store, literals map[imap.InternalMessageID][]byte) {
+	ids, err := st.List()
+	require.NoError(t, err)
+	require.Len(t, ids, len(literals))
+
+	for _, id := range ids {
+		require.Contains(t, literals, id)
+	}
+}
+
+func packSize(t *testing.T, dir string) int64 {
+	packs, err := filepath.Glob(filepath.Join(dir, "*.pack"))
+	require.NoError(t, err)
+
+	var size int64
+
+	for _, pack := range packs {
+		info, err := os.Stat(pack)
+		require.NoError(t, err)
+
+		size += info.Size()
+	}
+
+	return size
+}
+
+func dirEntryNames(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	names := make([]string, 0, len(entries))
+
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	return names
+}
@@ -0,0 +1,319 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/internal/fsutil"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrWrongPassphrase     = errors.New("the passphrase doesn't match the store's passphrase")
+	ErrRotationInProgress  = errors.New("a passphrase rotation is in progress")
+	ErrRotationUnsupported = errors.New("the store doesn't support passphrase rotation")
+)
+
+// Rotator is implemented by stores which can re-encrypt their literals with a new passphrase while in use.
+//
+// A rotation is started once, after which new literals are encrypted with the new passphrase and existing ones remain
+// readable with either passphrase. Each literal is then rotated in turn, and the rotation is finished once all are.
+// The progress is kept on disk so that a store opened with the new passphrase picks up an interrupted rotation.
+type Rotator interface {
+	// StartRotation makes newPassphrase the passphrase of the store. Starting the rotation which is already in
+	// progress again has no effect.
+	StartRotation(oldPassphrase, newPassphrase []byte) error
+
+	// RotationPassphrase returns the passphrase being rotated from, or nil if no rotation is in progress.
+	RotationPassphrase() []byte
+
+	// RotateLiteral re-encrypts the given literal with the new passphrase, unless it already was.
+	RotateLiteral(messageID imap.InternalMessageID) error
+
+	// FinishRotation forgets the old passphrase. Literals which weren't rotated can no longer be read.
+	FinishRotation() error
+}
+
+// rotationFileName is the file which records the progress of a rotation in the store directory.
+// Its first line holds the old passphrase, encrypted with the new one, and each further line a rotated literal.
+const rotationFileName = ".rotation"
+
+// rotationAAD binds the encrypted passphrase to its purpose.
+var rotationAAD = []byte("GLUON-ROTATION")
+
+type rotation struct {
+	oldGCM        cipher.AEAD
+	oldPassphrase []byte
+
+	// rotated holds the literals which are known to be encrypted with the new passphrase.
+	rotated map[imap.InternalMessageID]struct{}
+}
+
+// loadRotation loads the rotation in progress in the store at the given path, or nil if there is none.
+// It fails if the store wasn't opened with the passphrase the rotation is to.
+func loadRotation(path string, gcm cipher.AEAD) (*rotation, error) {
+	file, err := os.Open(filepath.Join(path, rotationFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	if !scanner.Scan() {
+		return nil, fmt.Errorf("rotation file is empty: %w", scanner.Err())
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(scanner.Text())
+	if err != nil {
+		return nil, fmt.Errorf("invalid rotation file: %w", err)
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("rotation file is truncated")
+	}
+
+	oldPassphrase, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], rotationAAD)
+	if err != nil {
+		return nil, fmt.Errorf("%w: the store must be opened with the new passphrase", ErrRotationInProgress)
+	}
+
+	oldGCM, err := NewCipher(oldPassphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	rotated := make(map[imap.InternalMessageID]struct{})
+
+	for scanner.Scan() {
+		// The last line may be incomplete if the process was interrupted while writing it.
+		id, err := imap.InternalMessageIDFromString(scanner.Text())
+		if err != nil {
+			continue
+		}
+
+		rotated[id] = struct{}{}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return &rotation{oldGCM: oldGCM, oldPassphrase: oldPassphrase, rotated: rotated}, nil
+}
+
+func (c *onDiskStore) StartRotation(oldPassphrase, newPassphrase []byte) error {
+	c.keyLock.Lock()
+	defer c.keyLock.Unlock()
+
+	if c.rotation != nil {
+		if bytes.Equal(c.rotation.oldPassphrase, oldPassphrase) && subtle.ConstantTimeCompare(c.key, hash(newPassphrase)) == 1 {
+			return nil
+		}
+
+		return ErrRotationInProgress
+	}
+
+	if subtle.ConstantTimeCompare(c.key, hash(oldPassphrase)) != 1 {
+		return ErrWrongPassphrase
+	}
+
+	gcm, err := NewCipher(newPassphrase)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(c.path, 0o700); err != nil {
+		return err
+	}
+
+	line := base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, oldPassphrase, rotationAAD)) + "\n"
+
+	// The rotation only starts once it is recorded in full, so a crash before leaves the old passphrase in use.
+	if err := fsutil.WriteFile(filepath.Join(c.path, rotationFileName), []byte(line), 0o600); err != nil {
+		return err
+	}
+
+	c.rotation = &rotation{
+		oldGCM:        c.gcm,
+		oldPassphrase: bytes.Clone(oldPassphrase),
+		rotated:       make(map[imap.InternalMessageID]struct{}),
+	}
+
+	c.gcm = gcm
+	c.key = hash(newPassphrase)
+
+	return nil
+}
+
+func (c *onDiskStore) RotationPassphrase() []byte {
+	c.keyLock.RLock()
+	defer c.keyLock.RUnlock()
+
+	if c.rotation == nil {
+		return nil
+	}
+
+	return bytes.Clone(c.rotation.oldPassphrase)
+}
+
+func (c *onDiskStore) RotateLiteral(messageID imap.InternalMessageID) error {
+	if c.sem != nil {
+		c.sem.Lock()
+		defer c.sem.Unlock()
+	}
+
+	c.keyLock.RLock()
+	gcm, rotation := c.gcm, c.rotation
+	c.keyLock.RUnlock()
+
+	if rotation == nil {
+		return nil
+	}
+
+	c.keyLock.RLock()
+	_, done := rotation.rotated[messageID]
+	c.keyLock.RUnlock()
+
+	if done {
+		return nil
+	}
+
+	literal, ok, err := c.readForRotation(messageID, gcm, rotation.oldGCM)
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		// Write the literal next to the old one so that a crash leaves either of them in place.
+		tmpPath := filepath.Join(c.path, "."+messageID.String()+".tmp")
+
+		if err := c.write(tmpPath, gcm, bytes.NewReader(literal)); err != nil {
+			return err
+		}
+
+		if err := fsutil.SyncFile(tmpPath); err != nil {
+			return err
+		}
+
+		if err := os.Rename(tmpPath, filepath.Join(c.path, messageID.String())); err != nil {
+			return err
+		}
+
+		// The literal must be on disk with the new passphrase before it is recorded as rotated.
+		if err := fsutil.SyncDir(c.path); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.OpenFile(filepath.Join(c.path, rotationFileName), os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	if _, err := file.WriteString(messageID.String() + "\n"); err != nil {
+		return err
+	}
+
+	c.keyLock.Lock()
+	rotation.rotated[messageID] = struct{}{}
+	c.keyLock.Unlock()
+
+	return nil
+}
+
+// readForRotation returns the literal which needs to be encrypted with the new passphrase.
+// It returns false if there is nothing to rotate: the literal was deleted, is already encrypted with the new
+// passphrase, or can't be read with either passphrase.
+func (c *onDiskStore) readForRotation(messageID imap.InternalMessageID, gcm, oldGCM cipher.AEAD) ([]byte, bool, error) {
+	file, err := os.Open(filepath.Join(c.path, messageID.String()))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	defer file.Close()
+
+	var fileSize int64
+
+	if stat, err := file.Stat(); err == nil {
+		fileSize = stat.Size() - int64(len(storeHeaderBytes))
+	}
+
+	header := make([]byte, len(storeHeaderBytes))
+
+	if _, err := io.ReadFull(file, header); err != nil || !bytes.Equal(header, storeHeaderBytes) {
+		if c.fallback == nil {
+			logrus.WithField("messageID", messageID.ShortID()).Warn("Skipping rotation of invalid store file")
+			return nil, false, nil
+		}
+
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, false, err
+		}
+
+		literal, err := c.fallback.Read(oldGCM, file)
+		if err != nil {
+			logrus.WithError(err).WithField("messageID", messageID.ShortID()).Warn("Skipping rotation of unreadable store file")
+			return nil, false, nil
+		}
+
+		return literal, true, nil
+	}
+
+	// The literal may have been rotated before the rotation's progress was last recorded.
+	if _, err := readLiteral(file, gcm, fileSize); err == nil {
+		return nil, false, nil
+	}
+
+	if _, err := file.Seek(int64(len(storeHeaderBytes)), io.SeekStart); err != nil {
+		return nil, false, err
+	}
+
+	literal, err := readLiteral(file, oldGCM, fileSize)
+	if err != nil {
+		logrus.WithError(err).WithField("messageID", messageID.ShortID()).Warn("Skipping rotation of unreadable store file")
+		return nil, false, nil
+	}
+
+	return literal, true, nil
+}
+
+func (c *onDiskStore) FinishRotation() error {
+	c.keyLock.Lock()
+	defer c.keyLock.Unlock()
+
+	if c.rotation == nil {
+		return nil
+	}
+
+	if err := os.Remove(filepath.Join(c.path, rotationFileName)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	c.rotation = nil
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package store_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/store"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_RotatePassphrase(t *testing.T) {
+	dir := t.TempDir()
+
+	st, err := store.NewOnDiskStore(dir, []byte("old"))
+	require.NoError(t, err)
+
+	literals := setLiterals(t, st, 3)
+	rotator := st.(store.Rotator)
+
+	require.ErrorIs(t, rotator.StartRotation([]byte("wrong"), []byte("new")), store.ErrWrongPassphrase)
+	require.NoError(t, rotator.StartRotation([]byte("old"), []byte("new")))
+	require.NoError(t, rotator.StartRotation([]byte("old"), []byte("new")))
+	require.ErrorIs(t, rotator.StartRotation([]byte("old"), []byte("other")), store.ErrRotationInProgress)
+	require.Equal(t, []byte("old"), rotator.RotationPassphrase())
+
+	// Literals written during the rotation use the new passphrase right away.
+	for id, literal := range setLiterals(t, st, 1) {
+		literals[id] = literal
+	}
+
+	requireLiterals(t, st, literals)
+
+	ids, err := st.List()
+	require.NoError(t, err)
+	require.Len(t, ids, len(literals))
+
+	for _, id := range ids {
+		require.NoError(t, rotator.RotateLiteral(id))
+	}
+
+	require.NoError(t, rotator.FinishRotation())
+	require.Nil(t, rotator.RotationPassphrase())
+	requireLiterals(t, st, literals)
+
+	reopened, err := store.NewOnDiskStore(dir, []byte("new"))
+	require.NoError(t, err)
+	requireLiterals(t, reopened, literals)
+
+	reopened, err = store.NewOnDiskStore(dir, []byte("old"))
+	require.NoError(t, err)
+
+	for id := range literals {
+		_, err := reopened.Get(id)
+		require.Error(t, err)
+	}
+}
+
+func TestStore_RotatePassphraseResumes(t *testing.T) {
+	dir := t.TempDir()
+
+	st, err := store.NewOnDiskStore(dir, []byte("old"))
+	require.NoError(t, err)
+
+	literals := setLiterals(t, st, 4)
+
+	require.NoError(t, st.(store.Rotator).StartRotation([]byte("old"), []byte("new")))
+
+	ids, err := st.List()
+	require.NoError(t, err)
+	require.NoError(t, st.(store.Rotator).RotateLiteral(ids[0]))
+
+	// The store is dropped mid-rotation, as if the process had crashed.
+	_, err = store.NewOnDiskStore(dir, []byte("old"))
+	require.ErrorIs(t, err, store.ErrRotationInProgress)
+
+	st, err = store.NewOnDiskStore(dir, []byte("new"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("old"), st.(store.Rotator).RotationPassphrase())
+	requireLiterals(t, st, literals)
+
+	ids, err = st.List()
+	require.NoError(t, err)
+	require.Len(t, ids, len(literals))
+
+	for _, id := range ids {
+		require.NoError(t, st.(store.Rotator).RotateLiteral(id))
+	}
+
+	require.NoError(t, st.(store.Rotator).FinishRotation())
+
+	st, err = store.NewOnDiskStore(dir, []byte("new"))
+	require.NoError(t, err)
+	require.Nil(t, st.(store.Rotator).RotationPassphrase())
+	requireLiterals(t, st, literals)
+}
+
+func setLiterals(t *testing.T, st store.Store, n int) map[imap.InternalMessageID][]byte {
+	literals := make(map[imap.InternalMessageID][]byte)
+
+	for i := 0; i < n; i++ {
+		id, literal := imap.NewInternalMessageID(), []byte("To: "+imap.NewInternalMessageID().String()+"\r\n\r\nbody")
+
+		require.NoError(t, st.Set(id, bytes.NewReader(literal)))
+
+		literals[id] = literal
+	}
+
+	return literals
+}
+
+func requireLiterals(t *testing.T, st store.Store, literals map[imap.InternalMessageID][]byte) {
+	for id, literal := range literals {
+		b, err := st.Get(id)
+		require.NoError(t, err)
+		require.Equal(t, literal, b)
+	}
+}
@@ -9,6 +9,7 @@ import (
 type Store interface {
 	Get(messageID imap.InternalMessageID) ([]byte, error)
 	Set(messageID imap.InternalMessageID, reader io.Reader) error
+	// Delete removes the literals of the given messages. Messages without a literal are skipped.
 	Delete(messageID ...imap.InternalMessageID) error
 	Close() error
 	List() ([]imap.InternalMessageID, error)
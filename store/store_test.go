@@ -152,6 +152,43 @@ func TestOnDiskStore(t *testing.T) {
 	testStoreList(t, store)
 }
 
+func TestStore_DeleteMissing(t *testing.T) {
+	dir := t.TempDir()
+
+	onDisk, err := store.NewOnDiskStore(filepath.Join(dir, "disk"), []byte("pass"))
+	require.NoError(t, err)
+
+	dedupImpl, err := store.NewOnDiskStore(filepath.Join(dir, "dedup"), []byte("pass"))
+	require.NoError(t, err)
+
+	dedup, err := store.NewDedupStore(dedupImpl, filepath.Join(dir, "dedup.journal"), []byte("pass"))
+	require.NoError(t, err)
+
+	pack, err := store.NewPackStore(filepath.Join(dir, "pack"), []byte("pass"))
+	require.NoError(t, err)
+
+	for name, st := range map[string]store.Store{"disk": onDisk, "dedup": dedup, "pack": pack} {
+		st := st
+
+		t.Run(name, func(t *testing.T) {
+			id1, id2 := imap.NewInternalMessageID(), imap.NewInternalMessageID()
+
+			require.NoError(t, st.Set(id1, bytes.NewReader([]byte("literal1"))))
+			require.NoError(t, st.Set(id2, bytes.NewReader([]byte("literal2"))))
+
+			// Literals which are already gone don't stop the others from being deleted.
+			require.NoError(t, st.Delete(id1))
+			require.NoError(t, st.Delete(id1, imap.NewInternalMessageID(), id2))
+
+			list, err := st.List()
+			require.NoError(t, err)
+			require.Empty(t, list)
+
+			require.NoError(t, st.Close())
+		})
+	}
+}
+
 func testStore(t *testing.T, store store.Store) {
 	id1 := imap.NewInternalMessageID()
 	id2 := imap.NewInternalMessageID()
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/gluon/imap"
+)
+
+var ErrEvictionUnsupported = errors.New("the store doesn't support eviction")
+
+// Usage is the space taken by the literal of a message and when it was last read or written.
+type Usage struct {
+	MessageID  imap.InternalMessageID
+	Size       int64
+	LastAccess time.Time
+}
+
+// Evictor is implemented by stores which account for the space taken by their literals, so that the least recently
+// used ones can be evicted when the store grows too large. Evicted literals are expected to be fetched again when
+// they are next needed.
+type Evictor interface {
+	// Usage returns the usage of each literal in the store.
+	Usage() ([]Usage, error)
+
+	// Evict removes the literals of the given messages to free space. Literals which aren't stored are ignored.
+	Evict(messageIDs ...imap.InternalMessageID) error
+}
+
+// accessResolution is how precisely the last access of a literal is recorded. Reading a literal only updates its
+// modification time once the recorded one is older than this, so that reads don't all turn into writes.
+const accessResolution = time.Minute
+
+// TotalSize returns the space taken by all literals of the given usage.
+func TotalSize(usage []Usage) int64 {
+	var size int64
+
+	for _, u := range usage {
+		size += u.Size
+	}
+
+	return size
+}
+
+// Usage reports the size of each file in the store, and its modification time as the time of its last access.
+func (c *onDiskStore) Usage() ([]Usage, error) {
+	if c.sem != nil {
+		c.sem.Lock()
+		defer c.sem.Unlock()
+	}
+
+	entries, err := os.ReadDir(c.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	usage := make([]Usage, 0, len(entries))
+
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		id, err := imap.InternalMessageIDFromString(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		info, err := entry.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		usage = append(usage, Usage{MessageID: id, Size: info.Size(), LastAccess: info.ModTime()})
+	}
+
+	return usage, nil
+}
+
+func (c *onDiskStore) Evict(messageIDs ...imap.InternalMessageID) error {
+	if c.sem != nil {
+		c.sem.Lock()
+		defer c.sem.Unlock()
+	}
+
+	for _, messageID := range messageIDs {
+		if err := os.Remove(filepath.Join(c.path, messageID.String())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// touch records that the literal of the given message was just accessed.
+func (c *onDiskStore) touch(messageID imap.InternalMessageID) {
+	path := filepath.Join(c.path, messageID.String())
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+
+	if now := time.Now(); now.Sub(info.ModTime()) >= accessResolution {
+		_ = os.Chtimes(path, now, now)
+	}
+}
@@ -0,0 +1,113 @@
+package store_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/store"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_Usage(t *testing.T) {
+	dir := t.TempDir()
+
+	st, err := store.NewOnDiskStore(dir, []byte("pass"))
+	require.NoError(t, err)
+
+	literals := setLiterals(t, st, 3)
+	evictor := st.(store.Evictor)
+
+	usage, err := evictor.Usage()
+	require.NoError(t, err)
+	require.Len(t, usage, len(literals))
+
+	var size int64
+
+	for _, u := range usage {
+		require.Contains(t, literals, u.MessageID)
+
+		info, err := os.Stat(filepath.Join(dir, u.MessageID.String()))
+		require.NoError(t, err)
+		require.Equal(t, info.Size(), u.Size)
+
+		size += u.Size
+	}
+
+	require.Equal(t, size, store.TotalSize(usage))
+
+	// Reading a literal marks it as recently used.
+	old := time.Now().Add(-time.Hour)
+
+	for id := range literals {
+		require.NoError(t, os.Chtimes(filepath.Join(dir, id.String()), old, old))
+	}
+
+	var read imap.InternalMessageID
+
+	for id := range literals {
+		read = id
+		break
+	}
+
+	_, err = st.Get(read)
+	require.NoError(t, err)
+
+	usage, err = evictor.Usage()
+	require.NoError(t, err)
+
+	for _, u := range usage {
+		if u.MessageID == read {
+			require.True(t, u.LastAccess.After(old.Add(time.Minute)))
+		} else {
+			require.True(t, u.LastAccess.Equal(old))
+		}
+	}
+
+	// Evicting ignores literals which aren't stored.
+	require.NoError(t, evictor.Evict(read, imap.NewInternalMessageID()))
+
+	_, err = st.Get(read)
+	require.Error(t, err)
+
+	usage, err = evictor.Usage()
+	require.NoError(t, err)
+	require.Len(t, usage, len(literals)-1)
+}
+
+func TestDedupStore_Usage(t *testing.T) {
+	impl, st := newDedupStore(t, t.TempDir())
+
+	literal := []byte("To: someone@pm.me\r\n\r\nbody")
+	id1, id2 := imap.NewInternalMessageID(), imap.NewInternalMessageID()
+
+	require.NoError(t, st.Set(id1, bytes.NewReader(literal)))
+	require.NoError(t, st.Set(id2, bytes.NewReader(literal)))
+
+	blobUsage, err := impl.(store.Evictor).Usage()
+	require.NoError(t, err)
+	require.Len(t, blobUsage, 1)
+
+	// The blob's size is split between the messages sharing it.
+	usage, err := st.(store.Evictor).Usage()
+	require.NoError(t, err)
+	require.Len(t, usage, 2)
+
+	for _, u := range usage {
+		require.Equal(t, blobUsage[0].Size/2, u.Size)
+	}
+
+	// The blob is kept until every message sharing it is evicted.
+	require.NoError(t, st.(store.Evictor).Evict(id1))
+	requireBlobs(t, impl, 1)
+
+	b, err := st.Get(id2)
+	require.NoError(t, err)
+	require.Equal(t, literal, b)
+
+	require.NoError(t, st.(store.Evictor).Evict(id1, id2))
+	requireBlobs(t, impl, 0)
+}
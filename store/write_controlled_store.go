@@ -127,6 +127,82 @@ func (w *WriteControlledStore) List() ([]imap.InternalMessageID, error) {
 	return w.impl.List()
 }
 
+func (w *WriteControlledStore) StartRotation(oldPassphrase, newPassphrase []byte) error {
+	rotator, ok := w.impl.(Rotator)
+	if !ok {
+		return ErrRotationUnsupported
+	}
+
+	return rotator.StartRotation(oldPassphrase, newPassphrase)
+}
+
+func (w *WriteControlledStore) RotationPassphrase() []byte {
+	rotator, ok := w.impl.(Rotator)
+	if !ok {
+		return nil
+	}
+
+	return rotator.RotationPassphrase()
+}
+
+// RotateLiteral rotates the given literal while holding its write lock, so it can't change while being rotated.
+func (w *WriteControlledStore) RotateLiteral(messageID imap.InternalMessageID) error {
+	rotator, ok := w.impl.(Rotator)
+	if !ok {
+		return ErrRotationUnsupported
+	}
+
+	syncRef := w.acquireSyncRef(messageID)
+	defer w.releaseSyncRef(messageID, syncRef)
+
+	syncRef.lock.Lock()
+	defer syncRef.lock.Unlock()
+
+	return rotator.RotateLiteral(messageID)
+}
+
+func (w *WriteControlledStore) FinishRotation() error {
+	rotator, ok := w.impl.(Rotator)
+	if !ok {
+		return ErrRotationUnsupported
+	}
+
+	return rotator.FinishRotation()
+}
+
+func (w *WriteControlledStore) Usage() ([]Usage, error) {
+	evictor, ok := w.impl.(Evictor)
+	if !ok {
+		return nil, ErrEvictionUnsupported
+	}
+
+	return evictor.Usage()
+}
+
+// Evict evicts each literal while holding its write lock, so it isn't removed while being read.
+func (w *WriteControlledStore) Evict(messageIDs ...imap.InternalMessageID) error {
+	evictor, ok := w.impl.(Evictor)
+	if !ok {
+		return ErrEvictionUnsupported
+	}
+
+	for _, id := range messageIDs {
+		if err := func() error {
+			syncRef := w.acquireSyncRef(id)
+			defer w.releaseSyncRef(id, syncRef)
+
+			syncRef.lock.Lock()
+			defer syncRef.lock.Unlock()
+
+			return evictor.Evict(id)
+		}(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 type WriteControlledStoreBuilder struct {
 	builder Builder
 }
@@ -0,0 +1,16 @@
+package telemetry
+
+import "go.opentelemetry.io/otel/attribute"
+
+// Attribute keys set on spans.
+const (
+	SessionIDKey       = attribute.Key("gluon.session.id")
+	UserIDKey          = attribute.Key("gluon.user.id")
+	CommandKey         = attribute.Key("gluon.command")
+	CommandTagKey      = attribute.Key("gluon.command.tag")
+	MailboxKey         = attribute.Key("gluon.mailbox.id")
+	MailboxMessagesKey = attribute.Key("gluon.mailbox.messages")
+	MessageCountKey    = attribute.Key("gluon.messages")
+	MessageIDKey       = attribute.Key("gluon.message.id")
+	MessageSizeKey     = attribute.Key("gluon.message.size")
+)
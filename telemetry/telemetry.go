@@ -0,0 +1,59 @@
+// Package telemetry records OpenTelemetry spans for the work done by the server, such as IMAP commands, database
+// transactions, store accesses and connector calls.
+package telemetry
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// InstrumentationName is the name of the tracer used for all spans.
+const InstrumentationName = "github.com/ProtonMail/gluon"
+
+type tracerKeyType struct{}
+
+var tracerKeyVal tracerKeyType
+
+var noopTracer = noop.NewTracerProvider().Tracer(InstrumentationName)
+
+// NewContextWithTracerProvider returns a context whose spans are recorded with the given provider.
+func NewContextWithTracerProvider(ctx context.Context, provider oteltrace.TracerProvider) context.Context {
+	if provider == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, tracerKeyVal, provider.Tracer(InstrumentationName))
+}
+
+func getTracerFromContext(ctx context.Context) oteltrace.Tracer {
+	if tracer, ok := ctx.Value(tracerKeyVal).(oteltrace.Tracer); ok {
+		return tracer
+	}
+
+	return noopTracer
+}
+
+// Start starts a span with the given name and attributes, as a child of the span in the context if any.
+// If the context has no tracer provider, the span records nothing.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, oteltrace.Span) {
+	return getTracerFromContext(ctx).Start(ctx, name, oteltrace.WithAttributes(attrs...))
+}
+
+// End ends the span, marking it as failed if err is not nil.
+func End(span oteltrace.Span, err error) {
+	if err != nil && span.IsRecording() {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// SetAttributes sets attributes on the span in the context, if any.
+func SetAttributes(ctx context.Context, attrs ...attribute.KeyValue) {
+	oteltrace.SpanFromContext(ctx).SetAttributes(attrs...)
+}
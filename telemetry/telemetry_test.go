@@ -0,0 +1,44 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestStartWithoutProvider(t *testing.T) {
+	_, span := Start(context.Background(), "test")
+	defer span.End()
+
+	require.False(t, span.IsRecording())
+}
+
+func TestStartWithProvider(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+
+	ctx := NewContextWithTracerProvider(context.Background(), sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	ctx, parent := Start(ctx, "parent", CommandKey.String("FETCH"))
+	SetAttributes(ctx, MessageCountKey.Int(3))
+
+	_, child := Start(ctx, "child")
+	End(child, errors.New("failed"))
+	End(parent, nil)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+
+	require.Equal(t, "child", spans[0].Name())
+	require.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent().SpanID())
+	require.Equal(t, codes.Error, spans[0].Status().Code)
+
+	require.Equal(t, "parent", spans[1].Name())
+	require.Equal(t, codes.Unset, spans[1].Status().Code)
+	require.ElementsMatch(t, []attribute.KeyValue{CommandKey.String("FETCH"), MessageCountKey.Int(3)}, spans[1].Attributes())
+}
@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/ProtonMail/gluon/events"
+	"github.com/ProtonMail/gluon/limits"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectionLimitTotal(t *testing.T) {
+	sender := &testMetricSender{}
+
+	options := defaultServerOptions(t, withConnectionLimits(limits.Connections{MaxTotal: 2}), withObservabilitySender(sender))
+
+	runTest(t, options, []int{1, 2}, func(c map[int]*testConnection, s *testSession) {
+		requireConnectionRefused(t, s)
+		require.Equal(t, []string{"tooManyConnections"}, sender.errorTypes())
+
+		eventCh := s.server.AddWatcher(events.SessionRemoved{})
+
+		// Once a session is closed, another can connect.
+		c[1].C("A001 logout").S("* BYE").OK("A001")
+		<-eventCh
+
+		other := s.newConnection()
+		defer func() { require.NoError(t, other.disconnect()) }()
+
+		other.C("B001 login user pass").OK("B001")
+	})
+}
+
+func TestConnectionLimitPerIP(t *testing.T) {
+	runTest(t, defaultServerOptions(t, withConnectionLimits(limits.Connections{MaxPerIP: 2})), []int{1, 2}, func(_ map[int]*testConnection, s *testSession) {
+		requireConnectionRefused(t, s)
+
+		// Connections from other addresses aren't limited.
+		other := newConnectionFrom(t, s, "127.0.0.2")
+		defer func() { require.NoError(t, other.disconnect()) }()
+
+		other.C("B001 login user pass").OK("B001")
+	})
+}
+
+func TestConnectionLimitPerUser(t *testing.T) {
+	sender := &testMetricSender{}
+
+	options := defaultServerOptions(t, withConnectionLimits(limits.Connections{MaxPerUser: 1}), withObservabilitySender(sender))
+
+	runTest(t, options, []int{1, 2}, func(c map[int]*testConnection, s *testSession) {
+		c[1].C("A001 login user pass").OK("A001")
+
+		c[2].C("B001 login user pass").NO("B001", "LIMIT")
+		require.Equal(t, []string{"tooManyUserConnections"}, sender.errorTypes())
+
+		// Once the first session logged out, the second can log in.
+		eventCh := s.server.AddWatcher(events.SessionRemoved{})
+
+		c[1].C("A002 logout").S("* BYE").OK("A002")
+		<-eventCh
+
+		c[2].C("B002 login user pass").OK("B002")
+	})
+}
+
+// requireConnectionRefused connects to the server and requires the connection to be refused because of a connection
+// limit.
+func requireConnectionRefused(t *testing.T, s *testSession) {
+	conn, err := net.Dial(s.listener.Addr().Network(), s.listener.Addr().String())
+	require.NoError(t, err)
+
+	c := newTestConnection(t, conn)
+	c.S("* BYE [LIMIT] Too many connections, please try again later")
+	c.expectClosed()
+
+	require.NoError(t, c.disconnect())
+}
+
+// testMetricSender records the metrics sent by the server.
+type testMetricSender struct {
+	metrics []map[string]interface{}
+	lock    sync.Mutex
+}
+
+func (s *testMetricSender) AddMetrics(metrics ...map[string]interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.metrics = append(s.metrics, metrics...)
+}
+
+func (s *testMetricSender) AddDistinctMetrics(_ interface{}, metrics ...map[string]interface{}) {
+	s.AddMetrics(metrics...)
+}
+
+// errorTypes returns the error types of the recorded metrics.
+func (s *testMetricSender) errorTypes() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var errorTypes []string
+
+	for _, metric := range s.metrics {
+		data, ok := metric["Data"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if labels, ok := data["Labels"].(map[string]string); ok {
+			errorTypes = append(errorTypes, labels["errorType"])
+		}
+	}
+
+	return errorTypes
+}
@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/gluon/store"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedupStore(t *testing.T) {
+	options := defaultServerOptions(t, withStoreBuilder(store.NewDedupStoreBuilder(&store.OnDiskStoreBuilder{})))
+	literal := []byte(buildRFC5322TestLiteral(`To: 1@pm.me`))
+
+	var userID string
+
+	runOneToOneTestWithAuth(t, options, func(c *testConnection, s *testSession) {
+		userID = s.userIDs["user"]
+
+		mbox1, mbox2 := s.mailboxCreated("user", []string{"mbox1"}), s.mailboxCreated("user", []string{"mbox2"})
+
+		original := s.messageCreated("user", mbox1, literal, time.Now())
+		s.messageCreated("user", mbox2, literal, time.Now())
+		other := s.messageCreated("user", mbox2, []byte(buildRFC5322TestLiteral(`To: 2@pm.me`)), time.Now())
+		s.flush("user")
+
+		require.Equal(t, 2, countBlobs(t, options, userID))
+
+		report, err := s.server.CheckUser(context.Background(), userID, false)
+		require.NoError(t, err)
+		require.Equal(t, 3, report.Messages)
+		require.Empty(t, report.Problems)
+
+		s.messageDeleted("user", original)
+		s.messageDeleted("user", other)
+		s.flush("user")
+	})
+
+	// The literal of a deleted message is kept for as long as a copy uses it.
+	runOneToOneTestWithAuth(t, options, func(c *testConnection, s *testSession) {
+		require.Equal(t, 1, countBlobs(t, options, userID))
+
+		report, err := s.server.CheckUser(context.Background(), userID, false)
+		require.NoError(t, err)
+		require.Equal(t, 1, report.Messages)
+		require.Empty(t, report.Problems)
+
+		c.C(`A001 SELECT mbox2`).Se(`A001 OK [READ-WRITE] SELECT`)
+		c.C(`A002 FETCH 1 (BODY.PEEK[HEADER.FIELDS (To)])`).Sxe(`1@pm.me`).OK(`A002`)
+	})
+}
+
+// countBlobs returns the number of literals the store of the given user holds on disk.
+func countBlobs(t *testing.T, options *serverOptions, userID string) int {
+	entries, err := os.ReadDir(filepath.Join(options.dataDir, userID))
+	require.NoError(t, err)
+
+	var n int
+
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), ".") {
+			n++
+		}
+	}
+
+	return n
+}
@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/gluon"
+	"github.com/ProtonMail/gluon/events"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrainClosesIdleSessions(t *testing.T) {
+	runTest(t, defaultServerOptions(t), []int{1, 2}, func(c map[int]*testConnection, s *testSession) {
+		c[1].C("A001 login user pass").OK("A001")
+
+		c[2].C("B001 login user pass").OK("B001")
+		c[2].C("B002 select inbox").OK("B002")
+		c[2].C("B003 idle").S("+ Ready")
+
+		drainErrCh := drainInBackground(s, 5*time.Second)
+
+		for _, c := range c {
+			c.S("* BYE [UNAVAILABLE] Server restarting")
+			c.expectClosed()
+		}
+
+		require.NoError(t, <-drainErrCh)
+	})
+}
+
+func TestDrainWaitsForAppend(t *testing.T) {
+	runTest(t, defaultServerOptions(t), []int{1, 2}, func(c map[int]*testConnection, s *testSession) {
+		eventCh := s.server.AddWatcher(events.SessionRemoved{})
+
+		literal := "Date: Mon, 02 Jan 2006 15:04:05 +0000\r\nFrom: sender@pm.me\r\nTo: user@pm.me\r\n\r\nHello"
+
+		c[1].C("A001 login user pass").OK("A001")
+		c[1].Cf("A002 APPEND INBOX {%v}", len(literal)).S("+ Ready")
+
+		drainErrCh := drainInBackground(s, 5*time.Second)
+
+		// Idle sessions are closed right away.
+		c[2].S("* BYE [UNAVAILABLE] Server restarting")
+		c[2].expectClosed()
+
+		requireSessionRemoved(t, eventCh, events.SessionDrained)
+
+		// The listener is closed, so new connections are refused.
+		_, err := net.Dial(s.listener.Addr().Network(), s.listener.Addr().String())
+		require.Error(t, err)
+
+		// Listeners can't be served anymore.
+		l, err := net.Listen("tcp", net.JoinHostPort("localhost", "0"))
+		require.NoError(t, err)
+		defer l.Close()
+
+		require.ErrorIs(t, s.server.Serve(context.Background(), l), gluon.ErrServerDraining)
+
+		// The server can't be drained twice.
+		require.ErrorIs(t, s.server.Drain(context.Background()), gluon.ErrServerDraining)
+
+		// The client sending a message may finish it.
+		c[1].C(literal).Sx("A002 OK.*")
+		c[1].S("* BYE [UNAVAILABLE] Server restarting")
+		c[1].expectClosed()
+
+		require.NoError(t, <-drainErrCh)
+	})
+}
+
+func TestDrainDeadline(t *testing.T) {
+	runOneToOneTestWithAuth(t, defaultServerOptions(t), func(c *testConnection, s *testSession) {
+		c.C("A001 APPEND INBOX {100}").S("+ Ready")
+
+		// The client never finishes its message, so it is closed abruptly once the deadline passes.
+		require.NoError(t, <-drainInBackground(s, 100*time.Millisecond))
+
+		c.expectClosed()
+	})
+}
+
+// drainInBackground drains the server with the given deadline and returns a channel receiving the result.
+func drainInBackground(s *testSession, timeout time.Duration) <-chan error {
+	errCh := make(chan error, 1)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		errCh <- s.drain(ctx)
+	}()
+
+	return errCh
+}
@@ -0,0 +1,34 @@
+package tests
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/gluon/internal/db_impl"
+	"github.com/ProtonMail/gluon/internal/db_impl/sqlite3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptedDatabase(t *testing.T) {
+	options := defaultServerOptions(t, withDatabase(db_impl.NewSQLiteDB(sqlite3.Encrypt())))
+
+	runOneToOneTestWithAuth(t, options, func(c *testConnection, s *testSession) {
+		c.C(`A001 CREATE saved-messages`).OK(`A001`)
+
+		c.doAppend(`saved-messages`, buildRFC5322TestLiteral(`To: 1@pm.me`), `\Seen`).expect("OK")
+
+		b, err := os.ReadFile(filepath.Join(s.server.GetDatabasePath(), s.userIDs["user"]+".db"))
+		require.NoError(t, err)
+		require.False(t, bytes.Contains(b, []byte("saved-messages")))
+	})
+
+	runOneToOneTestWithAuth(t, options, func(c *testConnection, _ *testSession) {
+		c.C(`A001 SELECT saved-messages`).Se(`A001 OK [READ-WRITE] SELECT`)
+
+		c.C(`A002 FETCH 1:* (FLAGS)`)
+		c.S(`* 1 FETCH (FLAGS (\Recent \Seen))`)
+		c.OK(`A002`)
+	})
+}
@@ -0,0 +1,137 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/gluon/events"
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/stretchr/testify/require"
+)
+
+// storeSeenWithConflict marks the first message as seen locally and, before the connector's acknowledgement arrives,
+// has the connector report the message as unseen.
+func storeSeenWithConflict(c *testConnection, s *testSession, messageID imap.MessageID) {
+	s.withUpdatesLost("user", func() {
+		c.C(`A002 STORE 1 +FLAGS.SILENT (\Seen)`).OK(`A002`)
+	})
+
+	s.messageSeen("user", messageID, false)
+	s.flush("user")
+
+	c.C(`A003 NOOP`).OK(`A003`)
+}
+
+func TestFlagConflictRemoteWins(t *testing.T) {
+	runOneToOneTestWithAuth(t, defaultServerOptions(t), func(c *testConnection, s *testSession) {
+		eventCh := s.server.AddWatcher(events.MessageFlagsConflict{})
+
+		mboxID := s.mailboxCreated("user", []string{"mbox"})
+		messageID := s.messageCreated("user", mboxID, []byte("To: 1@pm.me"), time.Now())
+
+		c.C(`A001 SELECT mbox`).OK(`A001`)
+
+		storeSeenWithConflict(c, s, messageID)
+
+		c.C(`A004 FETCH 1 (FLAGS)`).S(`* 1 FETCH (FLAGS (\Recent))`).OK(`A004`)
+
+		event := requireFlagConflictEvent(t, eventCh)
+		require.Equal(t, messageID, event.MessageID)
+		require.Equal(t, imap.FlagConflictRemoteWins, event.Policy)
+		require.True(t, event.LocalFlags.ContainsUnchecked(imap.FlagSeenLowerCase))
+		require.False(t, event.RemoteFlags.ContainsUnchecked(imap.FlagSeenLowerCase))
+		require.False(t, event.ResolvedFlags.ContainsUnchecked(imap.FlagSeenLowerCase))
+	})
+}
+
+func TestFlagConflictLocalWins(t *testing.T) {
+	options := defaultServerOptions(t, withFlagConflictPolicy(imap.FlagConflictLocalWins))
+
+	runOneToOneTestWithAuth(t, options, func(c *testConnection, s *testSession) {
+		eventCh := s.server.AddWatcher(events.MessageFlagsConflict{})
+
+		mboxID := s.mailboxCreated("user", []string{"mbox"})
+		messageID := s.messageCreated("user", mboxID, []byte("To: 1@pm.me"), time.Now())
+
+		c.C(`A001 SELECT mbox`).OK(`A001`)
+
+		storeSeenWithConflict(c, s, messageID)
+
+		// The local value was sent to the connector again; its acknowledgement must not undo the resolution.
+		s.flush("user")
+
+		c.C(`A004 FETCH 1 (FLAGS)`).S(`* 1 FETCH (FLAGS (\Recent \Seen))`).OK(`A004`)
+
+		event := requireFlagConflictEvent(t, eventCh)
+		require.Equal(t, imap.FlagConflictLocalWins, event.Policy)
+		require.True(t, event.ResolvedFlags.ContainsUnchecked(imap.FlagSeenLowerCase))
+	})
+}
+
+func TestFlagConflictMergeUnion(t *testing.T) {
+	options := defaultServerOptions(t, withFlagConflictPolicy(imap.FlagConflictMergeUnion))
+
+	runOneToOneTestWithAuth(t, options, func(c *testConnection, s *testSession) {
+		eventCh := s.server.AddWatcher(events.MessageFlagsConflict{})
+
+		mboxID := s.mailboxCreated("user", []string{"mbox"})
+		messageID := s.messageCreated("user", mboxID, []byte("To: 1@pm.me"), time.Now(), imap.FlagFlagged)
+
+		c.C(`A001 SELECT mbox`).OK(`A001`)
+
+		storeSeenWithConflict(c, s, messageID)
+		s.flush("user")
+
+		c.C(`A004 FETCH 1 (FLAGS)`).S(`* 1 FETCH (FLAGS (\Flagged \Recent \Seen))`).OK(`A004`)
+
+		event := requireFlagConflictEvent(t, eventCh)
+		require.Equal(t, imap.FlagConflictMergeUnion, event.Policy)
+		require.True(t, event.ResolvedFlags.ContainsUnchecked(imap.FlagSeenLowerCase))
+		require.True(t, event.ResolvedFlags.ContainsUnchecked(imap.FlagFlaggedLowerCase))
+	})
+}
+
+func TestFlagConflictNotRaisedAfterAcknowledgement(t *testing.T) {
+	options := defaultServerOptions(t, withFlagConflictPolicy(imap.FlagConflictLocalWins))
+
+	runOneToOneTestWithAuth(t, options, func(c *testConnection, s *testSession) {
+		eventCh := s.server.AddWatcher(events.MessageFlagsConflict{})
+
+		mboxID := s.mailboxCreated("user", []string{"mbox"})
+		messageID := s.messageCreated("user", mboxID, []byte("To: 1@pm.me"), time.Now())
+
+		c.C(`A001 SELECT mbox`).OK(`A001`)
+
+		// The connector acknowledges the change, so a later remote change is not a conflict.
+		c.C(`A002 STORE 1 +FLAGS.SILENT (\Seen)`).OK(`A002`)
+		s.flush("user")
+
+		s.messageSeen("user", messageID, false)
+		s.flush("user")
+
+		c.C(`A003 NOOP`).OK(`A003`)
+		c.C(`A004 FETCH 1 (FLAGS)`).S(`* 1 FETCH (FLAGS (\Recent))`).OK(`A004`)
+
+		select {
+		case event := <-eventCh:
+			t.Fatalf("unexpected conflict event: %+v", event)
+
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+}
+
+func requireFlagConflictEvent(t *testing.T, eventCh <-chan events.Event) events.MessageFlagsConflict {
+	select {
+	case event := <-eventCh:
+		conflict, ok := event.(events.MessageFlagsConflict)
+		require.True(t, ok)
+
+		return conflict
+
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for conflict event")
+	}
+
+	return events.MessageFlagsConflict{}
+}
@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/gluon/events"
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectorHealthAlert(t *testing.T) {
+	runOneToOneTestWithAuth(t, defaultServerOptions(t), func(c *testConnection, s *testSession) {
+		eventCh := s.server.AddWatcher(events.ConnectorHealthChanged{})
+
+		s.healthChanged("user", imap.HealthDegraded)
+
+		event, ok := (<-eventCh).(events.ConnectorHealthChanged)
+		require.True(t, ok)
+		require.Equal(t, s.userIDs["user"], event.UserID)
+		require.Equal(t, imap.HealthDegraded, event.Health)
+
+		c.C(`A001 NOOP`)
+		c.S(`* OK [ALERT] Connection to the mail server is degraded, changes may be delayed`)
+		c.OK(`A001`)
+
+		// Reporting the same health again does not produce another alert.
+		s.healthChanged("user", imap.HealthDegraded)
+
+		c.C(`A002 NOOP`).Sx(`A002 OK`)
+
+		s.healthChanged("user", imap.HealthOnline)
+
+		event, ok = (<-eventCh).(events.ConnectorHealthChanged)
+		require.True(t, ok)
+		require.Equal(t, imap.HealthOnline, event.Health)
+
+		c.C(`A003 NOOP`)
+		c.S(`* OK [ALERT] Connection to the mail server was restored`)
+		c.OK(`A003`)
+	})
+}
+
+func TestConnectorHealthAlertIdle(t *testing.T) {
+	runOneToOneTestWithAuth(t, defaultServerOptions(t), func(c *testConnection, s *testSession) {
+		c.C(`A001 SELECT INBOX`).OK(`A001`)
+
+		c.C(`A002 IDLE`).Continue()
+
+		s.healthChanged("user", imap.HealthOffline)
+
+		c.S(`* OK [ALERT] Connection to the mail server was lost, mailbox contents may be out of date`)
+
+		c.C(`DONE`).OK(`A002`)
+	})
+}
+
+func TestConnectorHealthAlertOnLogin(t *testing.T) {
+	runOneToOneTest(t, defaultServerOptions(t), func(c *testConnection, s *testSession) {
+		s.healthChanged("user", imap.HealthOffline)
+
+		c.C(`A001 LOGIN user pass`).OK(`A001`)
+
+		c.C(`A002 NOOP`)
+		c.S(`* OK [ALERT] Connection to the mail server was lost, mailbox contents may be out of date`)
+		c.OK(`A002`)
+	})
+}
+
+func TestConnectorHealthRejectLogin(t *testing.T) {
+	runOneToOneTest(t, defaultServerOptions(t, withRejectUnavailableLogins()), func(c *testConnection, s *testSession) {
+		s.healthChanged("user", imap.HealthAuthExpired)
+
+		c.C(`A001 LOGIN user pass`)
+		c.S(`* BYE [UNAVAILABLE] Mail server is unavailable, please try again later`)
+		c.expectClosed()
+
+		// Degraded connectors still accept logins.
+		s.healthChanged("user", imap.HealthDegraded)
+
+		s.withConnection("user", func(c *testConnection) {
+			c.C(`B001 NOOP`)
+			c.S(`* OK [ALERT] Connection to the mail server is degraded, changes may be delayed`)
+			c.OK(`B001`)
+		})
+	})
+}
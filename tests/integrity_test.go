@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/gluon/db"
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/integrity"
+	"github.com/ProtonMail/gluon/store"
+	"github.com/bradenaw/juniper/xslices"
+	"github.com/stretchr/testify/require"
+)
+
+// keepingStoreBuilder builds on-disk stores and keeps the last one so tests can tamper with it.
+type keepingStoreBuilder struct {
+	store.OnDiskStoreBuilder
+
+	store store.Store
+}
+
+func (b *keepingStoreBuilder) New(dir, userID string, passphrase []byte) (store.Store, error) {
+	st, err := b.OnDiskStoreBuilder.New(dir, userID, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	b.store = st
+
+	return st, nil
+}
+
+func TestCheckUser(t *testing.T) {
+	builder := &keepingStoreBuilder{}
+
+	runOneToOneTestWithAuth(t, defaultServerOptions(t, withStoreBuilder(builder)), func(c *testConnection, s *testSession) {
+		ctx, userID := context.Background(), s.userIDs["user"]
+
+		c.doAppend(`INBOX`, buildRFC5322TestLiteral(`To: 1@pm.me`)).expect("OK")
+		c.doAppend(`INBOX`, buildRFC5322TestLiteral(`To: 2@pm.me`)).expect("OK")
+		c.doAppend(`INBOX`, buildRFC5322TestLiteral(`To: 3@pm.me`)).expect("OK")
+		c.doAppend(`INBOX`, buildRFC5322TestLiteral(`To: 4@pm.me`)).expect("OK")
+
+		report, err := s.server.CheckUser(ctx, userID, false)
+		require.NoError(t, err)
+		require.Equal(t, userID, report.UserID)
+		require.Equal(t, 4, report.Messages)
+		require.NotZero(t, report.Mailboxes)
+		require.Empty(t, report.Problems)
+		require.True(t, report.OK())
+
+		messageIDs, err := builder.store.List()
+		require.NoError(t, err)
+		require.Len(t, messageIDs, 4)
+
+		missing, corrupt, flagged, tampered := messageIDs[0], messageIDs[1], messageIDs[2], messageIDs[3]
+		stale, unfiled := imap.NewInternalMessageID(), imap.NewInternalMessageID()
+
+		// A literal damaged in place keeps its size and header; only its hash tells it apart.
+		literal, err := builder.store.Get(tampered)
+		require.NoError(t, err)
+
+		literal[len(literal)-1] ^= 1
+
+		require.NoError(t, builder.store.Set(tampered, bytes.NewReader(literal)))
+
+		require.NoError(t, builder.store.Delete(missing))
+		require.NoError(t, builder.store.Set(corrupt, strings.NewReader(buildRFC5322TestLiteral(`To: someone-else@pm.me`))))
+		require.NoError(t, builder.store.Set(stale, strings.NewReader(buildRFC5322TestLiteral(`To: nobody@pm.me`))))
+
+		require.NoError(t, s.withUserDB("user", func(client db.Client, ctx context.Context) {
+			require.NoError(t, client.Write(ctx, func(ctx context.Context, tx db.Transaction) error {
+				if err := tx.CreateMessages(ctx, &db.CreateMessageReq{
+					Message:    imap.Message{ID: "unfiled", Flags: imap.NewFlagSet(), Date: time.Now()},
+					InternalID: unfiled,
+				}); err != nil {
+					return err
+				}
+
+				return tx.AddFlagToMessages(ctx, []imap.InternalMessageID{flagged}, imap.FlagRecent)
+			}))
+		}))
+
+		report, err = s.server.CheckUser(ctx, userID, false)
+		require.NoError(t, err)
+		require.False(t, report.OK())
+		require.ElementsMatch(t, []integrity.Problem{
+			{Kind: integrity.KindMissingLiteral, MessageID: missing},
+			{Kind: integrity.KindCorruptLiteral, MessageID: corrupt},
+			{Kind: integrity.KindMessageFlags, MessageID: flagged},
+			{Kind: integrity.KindStaleLiteral, MessageID: stale},
+			{Kind: integrity.KindCorruptLiteral, MessageID: tampered},
+			{Kind: integrity.KindNoMailbox, MessageID: unfiled},
+			{Kind: integrity.KindMissingLiteral, MessageID: unfiled},
+		}, withoutDetail(report.Problems))
+
+		// Only the problems which don't need data from the connector are repaired.
+		report, err = s.server.CheckUser(ctx, userID, true)
+		require.NoError(t, err)
+		require.False(t, report.OK())
+		require.ElementsMatch(t, []integrity.Problem{
+			{Kind: integrity.KindMissingLiteral, MessageID: missing},
+			{Kind: integrity.KindCorruptLiteral, MessageID: corrupt},
+			{Kind: integrity.KindMessageFlags, MessageID: flagged, Repaired: true},
+			{Kind: integrity.KindStaleLiteral, MessageID: stale, Repaired: true},
+			{Kind: integrity.KindCorruptLiteral, MessageID: tampered},
+			{Kind: integrity.KindNoMailbox, MessageID: unfiled},
+			{Kind: integrity.KindMissingLiteral, MessageID: unfiled},
+		}, withoutDetail(report.Problems))
+
+		report, err = s.server.CheckUser(ctx, userID, false)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []integrity.Problem{
+			{Kind: integrity.KindMissingLiteral, MessageID: missing},
+			{Kind: integrity.KindCorruptLiteral, MessageID: corrupt},
+			{Kind: integrity.KindCorruptLiteral, MessageID: tampered},
+			{Kind: integrity.KindNoMailbox, MessageID: unfiled},
+			{Kind: integrity.KindMissingLiteral, MessageID: unfiled},
+		}, withoutDetail(report.Problems))
+
+		_, err = s.server.CheckUser(ctx, "no-such-user", false)
+		require.Error(t, err)
+	})
+}
+
+func withoutDetail(problems []integrity.Problem) []integrity.Problem {
+	return xslices.Map(problems, func(p integrity.Problem) integrity.Problem {
+		p.Detail = ""
+		return p
+	})
+}
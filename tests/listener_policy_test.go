@@ -0,0 +1,307 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/gluon"
+	"github.com/ProtonMail/gluon/auth"
+	"github.com/ProtonMail/gluon/events"
+	"github.com/ProtonMail/gluon/limits"
+	"github.com/ProtonMail/gluon/listener"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenerImplicitTLS(t *testing.T) {
+	runTest(t, defaultServerOptions(t), []int{}, func(_ map[int]*testConnection, s *testSession) {
+		l := serveWithPolicy(t, s, listener.Policy{Security: listener.ImplicitTLS})
+
+		c := dialTLS(t, l, nil)
+		defer func() { require.NoError(t, c.disconnect()) }()
+
+		// The connection already uses TLS so STARTTLS isn't offered.
+		c.C("A001 capability")
+		c.S(`* CAPABILITY ID IDLE IMAP4rev1`)
+		c.OK("A001")
+
+		c.C("A002 login user pass").OK("A002")
+	})
+}
+
+func TestListenerImplicitTLSRefusesPlaintext(t *testing.T) {
+	runTest(t, defaultServerOptions(t), []int{}, func(_ map[int]*testConnection, s *testSession) {
+		l := serveWithPolicy(t, s, listener.Policy{Security: listener.ImplicitTLS})
+
+		conn, err := net.Dial(l.Addr().Network(), l.Addr().String())
+		require.NoError(t, err)
+
+		c := newTestConnection(t, conn)
+
+		// The server waits for a TLS handshake which never comes.
+		c.C("A001 capability")
+		c.expectClosed()
+	})
+}
+
+func TestListenerRequireTLS(t *testing.T) {
+	runTest(t, defaultServerOptions(t), []int{}, func(_ map[int]*testConnection, s *testSession) {
+		l := serveWithPolicy(t, s, listener.Policy{RequireTLS: true})
+
+		conn, err := net.Dial(l.Addr().Network(), l.Addr().String())
+		require.NoError(t, err)
+
+		c := newTestConnection(t, conn).Sx(`\* OK.*`)
+		defer func() { require.NoError(t, c.disconnect()) }()
+
+		c.C("A001 capability")
+		c.S(`* CAPABILITY ID IDLE IMAP4rev1 LOGINDISABLED STARTTLS`)
+		c.OK("A001")
+
+		c.C("A002 login user pass").NO("A002", "PRIVACYREQUIRED")
+
+		c.C("A003 starttls")
+		c.S("A003 OK Begin TLS negotiation now")
+		c.upgradeConnection()
+
+		c.C("A004 capability")
+		c.S(`* CAPABILITY ID IDLE IMAP4rev1`)
+		c.OK("A004")
+
+		c.C("A005 login user pass").OK("A005")
+	})
+}
+
+func TestListenerAuthenticateExternal(t *testing.T) {
+	runTest(t, defaultServerOptions(t), []int{}, func(_ map[int]*testConnection, s *testSession) {
+		clientCert := newClientCert(t)
+
+		authenticator := &testCertAuthenticator{
+			cert:     clientCert.Certificate[0],
+			username: "user",
+			userID:   s.userIDs["user"],
+		}
+
+		l := serveWithPolicy(t, s, listener.Policy{
+			Security:          listener.ImplicitTLS,
+			TLSConfig:         newClientAuthTLSConfig(t, clientCert),
+			CertAuthenticator: authenticator,
+		})
+
+		// Clients which presented a certificate may authenticate with it.
+		c := dialTLS(t, l, &clientCert)
+		defer func() { require.NoError(t, c.disconnect()) }()
+
+		c.C("A001 capability")
+		c.S(`* CAPABILITY AUTH=EXTERNAL ID IDLE IMAP4rev1 SASL-IR`)
+		c.OK("A001")
+
+		c.C("A002 authenticate PLAIN " + base64.StdEncoding.EncodeToString([]byte("user"))).NO("A002")
+		c.C("A003 authenticate EXTERNAL " + base64.StdEncoding.EncodeToString([]byte("other"))).NO("A003")
+		c.C("A004 authenticate EXTERNAL " + base64.StdEncoding.EncodeToString([]byte("user"))).OK("A004")
+		c.C("A005 select inbox").OK("A005")
+
+		// Clients which didn't can't.
+		other := dialTLS(t, l, nil)
+		defer func() { require.NoError(t, other.disconnect()) }()
+
+		other.C("B001 capability")
+		other.S(`* CAPABILITY ID IDLE IMAP4rev1`)
+		other.OK("B001")
+
+		other.C("B002 authenticate EXTERNAL =").NO("B002")
+	})
+}
+
+func TestListenerAuthenticateExternalContinuation(t *testing.T) {
+	runTest(t, defaultServerOptions(t), []int{}, func(_ map[int]*testConnection, s *testSession) {
+		clientCert := newClientCert(t)
+
+		l := serveWithPolicy(t, s, listener.Policy{
+			Security:  listener.ImplicitTLS,
+			TLSConfig: newClientAuthTLSConfig(t, clientCert),
+			CertAuthenticator: &testCertAuthenticator{
+				cert:     clientCert.Certificate[0],
+				username: "user",
+				userID:   s.userIDs["user"],
+			},
+		})
+
+		c := dialTLS(t, l, &clientCert)
+		defer func() { require.NoError(t, c.disconnect()) }()
+
+		// Clients which don't send an initial response are asked for one.
+		c.C("A001 authenticate EXTERNAL").S("+ ")
+		c.C("*").BAD("A001")
+
+		c.C("A002 authenticate EXTERNAL").S("+ ")
+		c.C("not*base64").BAD("A002")
+
+		c.C("A003 authenticate EXTERNAL").S("+ ")
+		c.C(base64.StdEncoding.EncodeToString([]byte("user"))).OK("A003")
+		c.C("A004 select inbox").OK("A004")
+	})
+}
+
+func TestListenerAuthenticateExternalThrottle(t *testing.T) {
+	throttle := limits.LoginThrottle{MaxAttempts: 2, Delay: time.Second, ResetAfter: time.Minute}
+
+	runTest(t, defaultServerOptions(t, withLoginThrottle(throttle)), []int{}, func(_ map[int]*testConnection, s *testSession) {
+		clientCert := newClientCert(t)
+
+		l := serveWithPolicy(t, s, listener.Policy{
+			Security:  listener.ImplicitTLS,
+			TLSConfig: newClientAuthTLSConfig(t, clientCert),
+			CertAuthenticator: &testCertAuthenticator{
+				cert:     clientCert.Certificate[0],
+				username: "user",
+				userID:   s.userIDs["user"],
+			},
+		})
+
+		eventCh := s.server.AddWatcher(events.LoginFailed{})
+
+		c := dialTLS(t, l, &clientCert)
+		defer func() { require.NoError(t, c.disconnect()) }()
+
+		// Certificates which don't log in to any user count as failed logins.
+		c.C("A001 authenticate EXTERNAL " + base64.StdEncoding.EncodeToString([]byte("other"))).NO("A001")
+		require.False(t, (<-eventCh).(events.LoginFailed).Blocked)
+
+		c.C("A002 authenticate EXTERNAL " + base64.StdEncoding.EncodeToString([]byte("other"))).NO("A002")
+		blocked := (<-eventCh).(events.LoginFailed)
+		require.True(t, blocked.Blocked)
+
+		// Further logins from the address are delayed.
+		c.C("A003 authenticate EXTERNAL " + base64.StdEncoding.EncodeToString([]byte("user"))).OK("A003")
+		require.False(t, time.Now().Before(blocked.Until))
+	})
+}
+
+func TestListenerAddedPolicy(t *testing.T) {
+	runTest(t, defaultServerOptions(t), []int{}, func(_ map[int]*testConnection, s *testSession) {
+		eventCh := s.server.AddWatcher(events.ListenerAdded{})
+
+		l := serveWithPolicy(t, s, listener.Policy{Security: listener.ImplicitTLS, RequireTLS: true})
+
+		event, ok := (<-eventCh).(events.ListenerAdded)
+		require.True(t, ok)
+		require.Equal(t, l.Addr(), event.Addr)
+		require.Equal(t, listener.ImplicitTLS, event.Policy.Security)
+		require.True(t, event.Policy.RequireTLS)
+
+		// The listener uses the server's TLS config as none was given.
+		require.NotNil(t, event.Policy.TLSConfig)
+	})
+}
+
+func TestListenerInvalidPolicy(t *testing.T) {
+	runTest(t, defaultServerOptions(t), []int{}, func(_ map[int]*testConnection, s *testSession) {
+		l, err := net.Listen("tcp", net.JoinHostPort("localhost", "0"))
+		require.NoError(t, err)
+		defer l.Close()
+
+		err = s.server.ServeWithPolicy(context.Background(), l, listener.Policy{Security: listener.PlaintextLoopback, RequireTLS: true})
+		require.ErrorIs(t, err, gluon.ErrInvalidListenerPolicy)
+	})
+}
+
+// serveWithPolicy makes the server serve another listener with the given policy until the test ends.
+func serveWithPolicy(t *testing.T, s *testSession, policy listener.Policy) net.Listener {
+	l, err := net.Listen("tcp", net.JoinHostPort("localhost", "0"))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	t.Cleanup(func() {
+		cancel()
+		l.Close()
+	})
+
+	require.NoError(t, s.server.ServeWithPolicy(ctx, l, policy))
+
+	return l
+}
+
+// dialTLS connects to the given implicit TLS listener, presenting the given client certificate if any.
+func dialTLS(t *testing.T, l net.Listener, clientCert *tls.Certificate) *testConnection {
+	cert, err := x509.ParseCertificate(testCert.Certificate[0])
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	config := &tls.Config{ServerName: cert.DNSNames[0], RootCAs: pool, MinVersion: tls.VersionTLS13}
+
+	if clientCert != nil {
+		config.Certificates = []tls.Certificate{*clientCert}
+	}
+
+	conn, err := tls.Dial(l.Addr().Network(), l.Addr().String(), config)
+	require.NoError(t, err)
+
+	return newTestConnection(t, conn).Sx(`\* OK.*`)
+}
+
+// newClientCert returns a self-signed certificate clients can authenticate with.
+func newClientCert(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// newClientAuthTLSConfig returns a server TLS config verifying client certificates issued by the given one.
+func newClientAuthTLSConfig(t *testing.T, clientCert tls.Certificate) *tls.Config {
+	cert, err := x509.ParseCertificate(clientCert.Certificate[0])
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{testCert},
+		MinVersion:   tls.VersionTLS13,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    pool,
+	}
+}
+
+// testCertAuthenticator maps a single certificate to a single user.
+type testCertAuthenticator struct {
+	cert     []byte
+	username string
+	userID   string
+}
+
+func (a *testCertAuthenticator) AuthenticateCertificate(_ context.Context, cert *x509.Certificate, authzID string) (string, error) {
+	if !bytes.Equal(cert.Raw, a.cert) || authzID != a.username {
+		return "", auth.ErrInvalidCredentials
+	}
+
+	return a.userID, nil
+}
@@ -1,12 +1,20 @@
 package tests
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/ProtonMail/gluon/async"
+	"github.com/ProtonMail/gluon/auth"
+	"github.com/ProtonMail/gluon/connector"
 	"github.com/ProtonMail/gluon/events"
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/limits"
 	"github.com/stretchr/testify/require"
 )
 
@@ -160,6 +168,162 @@ func TestLoginEvents(t *testing.T) {
 	})
 }
 
+func TestLoginThrottleBackoff(t *testing.T) {
+	throttle := limits.LoginThrottle{MaxAttempts: 2, Delay: 500 * time.Millisecond, MaxDelay: time.Second, ResetAfter: time.Minute}
+
+	runOneToOneTest(t, defaultServerOptions(t, withLoginThrottle(throttle)), func(c *testConnection, s *testSession) {
+		require.IsType(t, events.UserAdded{}, <-s.eventCh)
+		require.IsType(t, events.ListenerAdded{}, <-s.eventCh)
+		require.IsType(t, events.SessionAdded{}, <-s.eventCh)
+
+		requireLoginFailed := func(blocked bool, delay time.Duration) events.LoginFailed {
+			event, ok := (<-s.eventCh).(events.LoginFailed)
+			require.True(t, ok)
+			require.Equal(t, "user", event.Username)
+			require.NotNil(t, event.RemoteAddr)
+			require.Equal(t, blocked, event.Blocked)
+			require.Equal(t, delay, event.Delay)
+
+			return event
+		}
+
+		c.C("A001 login user badpass").NO("A001")
+		requireLoginFailed(false, 0)
+
+		c.C("A002 login user badpass").NO("A002")
+		blocked := requireLoginFailed(true, 500*time.Millisecond)
+
+		// The next login is only answered once the delay is over.
+		c.C("A003 login user badpass").NO("A003")
+		require.False(t, time.Now().Before(blocked.Until))
+		requireLoginFailed(false, 0)
+
+		// The delay doubles each time.
+		c.C("A004 login user badpass").NO("A004")
+		blocked = requireLoginFailed(true, time.Second)
+
+		c.C("A005 login user pass").OK("A005")
+		require.False(t, time.Now().Before(blocked.Until))
+	})
+}
+
+func TestLoginThrottleByAddressAndUsername(t *testing.T) {
+	throttle := limits.LoginThrottle{MaxAttempts: 2, Delay: time.Second, ResetAfter: time.Minute}
+
+	runOneToOneTest(t, defaultServerOptions(t, withLoginThrottle(throttle)), func(c *testConnection, s *testSession) {
+		c.C("A001 login user badpass").NO("A001")
+		c.C("A002 login user badpass").NO("A002")
+
+		blocked := waitLoginBlocked(t, s)
+
+		other := newConnectionFrom(t, s, "127.0.0.2")
+		defer func() { require.NoError(t, other.disconnect()) }()
+
+		// Logins for other usernames from other addresses aren't delayed.
+		other.C("B001 login other badpass").NO("B001")
+		require.True(t, time.Now().Before(blocked.Until))
+
+		// Logins for the same username are, wherever they come from and whatever its case.
+		other.C("B002 login USER badpass").NO("B002")
+		require.False(t, time.Now().Before(blocked.Until))
+
+		other.C("B003 login user pass").OK("B003")
+	})
+}
+
+// waitLoginBlocked waits for a login to fail once too often.
+func waitLoginBlocked(t *testing.T, s *testSession) events.LoginFailed {
+	for event := range s.eventCh {
+		if event, ok := event.(events.LoginFailed); ok && event.Blocked {
+			return event
+		}
+	}
+
+	panic("event channel closed")
+}
+
+func TestLoginAuthenticator(t *testing.T) {
+	authenticator := newTestAuthenticator()
+
+	runOneToOneTest(t, defaultServerOptions(t, withAuthenticator(authenticator)), func(c *testConnection, s *testSession) {
+		authenticator.add("someone@example.com", "secret", s.userIDs["user"])
+
+		// The connector isn't asked once the server has an authenticator.
+		c.C("A001 login user pass").NO("A001")
+		c.C("A002 login someone@example.com secret").OK("A002")
+		c.C("A003 select inbox").OK("A003")
+	})
+}
+
+func TestLoginConcurrent(t *testing.T) {
+	authenticator := newTestAuthenticator()
+
+	runTest(t, defaultServerOptions(t, withAuthenticator(authenticator)), []int{1, 2}, func(c map[int]*testConnection, s *testSession) {
+		authenticator.add("slow", "secret", s.userIDs["user"])
+		authenticator.add("fast", "secret", s.userIDs["user"])
+
+		release := authenticator.block("slow")
+
+		// A login taking long to authenticate doesn't hold up others.
+		c[1].C("A001 login slow secret")
+		c[2].C("B001 login fast secret").OK("B001")
+
+		close(release)
+
+		c[1].OK("A001")
+	})
+}
+
+func TestLoginUsernameIndex(t *testing.T) {
+	builder := &countingConnectorBuilder{}
+
+	runTest(t, defaultServerOptions(t, withConnectorBuilder(builder), withCredentials([]credentials{
+		{usernames: []string{"user1"}, password: "pass1"},
+		{usernames: []string{"user2", "alias2"}, password: "pass2"},
+	})), []int{1, 2}, func(c map[int]*testConnection, _ *testSession) {
+		// Only the connector owning a username is asked to authorize it.
+		c[1].C("A001 login user2 pass2").OK("A001")
+		c[2].C("B001 login ALIAS2 pass2").NO("B001")
+		c[2].C("B002 login alias2 pass2").OK("B002")
+
+		require.Zero(t, builder.authorizations("user1"))
+		require.Equal(t, 3, builder.authorizations("user2"))
+	})
+}
+
+func TestLoginUsernamesChanged(t *testing.T) {
+	builder := &countingConnectorBuilder{}
+
+	runTest(t, defaultServerOptions(t, withConnectorBuilder(builder), withCredentials([]credentials{
+		{usernames: []string{"user1"}, password: "pass1"},
+		{usernames: []string{"user2", "alias2"}, password: "pass2"},
+	})), []int{1, 2, 3}, func(c map[int]*testConnection, s *testSession) {
+		c[1].C("A001 login alias1 pass1").NO("A001")
+
+		// The usernames are indexed again once the connectors report that they changed.
+		s.setUsernames("user1", []string{"user1", "alias1"})
+		s.setUsernames("user2", []string{"user2"})
+
+		c[2].C("B001 login alias1 pass1").OK("B001")
+		c[3].C("C001 login alias2 pass2").NO("C001")
+
+		require.Equal(t, 1, builder.authorizations("user1"))
+		require.Zero(t, builder.authorizations("user2"))
+	})
+}
+
+// newConnectionFrom connects to the server from the given loopback address, skipping the test if it isn't available.
+func newConnectionFrom(t *testing.T, s *testSession, ip string) *testConnection {
+	dialer := net.Dialer{LocalAddr: &net.TCPAddr{IP: net.ParseIP(ip)}}
+
+	conn, err := dialer.Dial(s.listener.Addr().Network(), s.listener.Addr().String())
+	if err != nil {
+		t.Skipf("Can't connect from %v: %v", ip, err)
+	}
+
+	return newTestConnection(t, conn).Sx(`\* OK.*`)
+}
+
 func timeFunc(fn func()) time.Duration {
 	start := time.Now()
 
@@ -167,3 +331,100 @@ func timeFunc(fn func()) time.Duration {
 
 	return time.Since(start)
 }
+
+type testAuthenticator struct {
+	lock    sync.Mutex
+	userIDs map[string]string
+	blocked map[string]chan struct{}
+}
+
+func newTestAuthenticator() *testAuthenticator {
+	return &testAuthenticator{
+		userIDs: make(map[string]string),
+		blocked: make(map[string]chan struct{}),
+	}
+}
+
+func (a *testAuthenticator) add(username, password, userID string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.userIDs[username+":"+password] = userID
+}
+
+// block makes logins with the given username wait until the returned channel is closed.
+func (a *testAuthenticator) block(username string) chan struct{} {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.blocked[username] = make(chan struct{})
+
+	return a.blocked[username]
+}
+
+func (a *testAuthenticator) Authenticate(ctx context.Context, username string, password []byte) (string, error) {
+	a.lock.Lock()
+	userID, ok := a.userIDs[username+":"+string(password)]
+	blocked := a.blocked[username]
+	a.lock.Unlock()
+
+	if blocked != nil {
+		select {
+		case <-blocked:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+
+	if !ok {
+		return "", auth.ErrInvalidCredentials
+	}
+
+	return userID, nil
+}
+
+// countingConnectorBuilder builds connectors which count how often they are asked to authorize a login.
+type countingConnectorBuilder struct {
+	dummyConnectorBuilder
+
+	lock  sync.Mutex
+	conns map[string]*countingConnector
+}
+
+func (b *countingConnectorBuilder) New(usernames []string, password []byte, period time.Duration, flags, permFlags, attrs imap.FlagSet) Connector {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.conns == nil {
+		b.conns = make(map[string]*countingConnector)
+	}
+
+	conn := &countingConnector{Connector: b.dummyConnectorBuilder.New(usernames, password, period, flags, permFlags, attrs)}
+
+	b.conns[usernames[0]] = conn
+
+	return conn
+}
+
+func (b *countingConnectorBuilder) authorizations(username string) int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return int(b.conns[username].count.Load())
+}
+
+type countingConnector struct {
+	Connector
+
+	count atomic.Int32
+}
+
+func (conn *countingConnector) Authorize(ctx context.Context, username string, password []byte) bool {
+	conn.count.Add(1)
+
+	return conn.Connector.Authorize(ctx, username, password)
+}
+
+func (conn *countingConnector) Usernames() []string {
+	return conn.Connector.(connector.UsernameOwner).Usernames()
+}
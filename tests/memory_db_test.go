@@ -0,0 +1,33 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/gluon/internal/db_impl"
+)
+
+func TestInMemoryDatabase(t *testing.T) {
+	options := defaultServerOptions(t, withDatabase(db_impl.NewMemoryDB()))
+
+	runOneToOneTestWithAuth(t, options, func(c *testConnection, _ *testSession) {
+		c.C(`A001 CREATE saved-messages`).OK(`A001`)
+
+		c.doAppend(`saved-messages`, buildRFC5322TestLiteral(`To: 1@pm.me`), `\Seen`).expect("OK")
+		c.doAppend(`saved-messages`, buildRFC5322TestLiteral(`To: 2@pm.me`)).expect("OK")
+
+		c.C(`A002 SELECT saved-messages`).Se(`A002 OK [READ-WRITE] SELECT`)
+
+		c.C(`A003 STORE 2 +FLAGS (\Flagged)`)
+		c.S(`* 2 FETCH (FLAGS (\Flagged \Recent))`)
+		c.OK(`A003`)
+	})
+
+	// The databases outlive the server for as long as the builder exists.
+	runOneToOneTestWithAuth(t, options, func(c *testConnection, _ *testSession) {
+		c.C(`A001 SELECT saved-messages`).Se(`A001 OK [READ-WRITE] SELECT`)
+
+		c.C(`A002 FETCH 1:* (FLAGS)`)
+		c.S(`* 1 FETCH (FLAGS (\Seen))`, `* 2 FETCH (FLAGS (\Flagged))`)
+		c.OK(`A002`)
+	})
+}
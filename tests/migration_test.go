@@ -3,7 +3,12 @@ package tests
 import (
 	"context"
 	"testing"
+	"time"
 
+	"github.com/ProtonMail/gluon"
+	"github.com/ProtonMail/gluon/connector"
+	"github.com/ProtonMail/gluon/db"
+	"github.com/ProtonMail/gluon/imap"
 	"github.com/ProtonMail/gluon/internal/db_impl"
 	"github.com/stretchr/testify/require"
 )
@@ -22,3 +27,81 @@ func TestFailedMigrationRestsDatabase(t *testing.T) {
 
 	runServer(t, serverOptions, func(session *testSession) {})
 }
+
+func TestFutureDatabaseIsKept(t *testing.T) {
+	ctx := context.Background()
+	options := defaultServerOptions(t)
+
+	var userID string
+
+	runOneToOneTestWithAuth(t, options, func(c *testConnection, s *testSession) {
+		userID = s.userIDs["user"]
+
+		c.C(`A001 CREATE saved-messages`).OK(`A001`)
+	})
+
+	// A newer version which isn't compatible with us has used the database.
+	require.NoError(t, db_impl.TestUpdateDBVersion(ctx, options.databaseDir, userID, 99999))
+	require.NoError(t, db_impl.TestUpdateDBMinCompatibleVersion(ctx, options.databaseDir, userID, 99999))
+
+	withUnloadedServer(t, options, func(server *gluon.Server) {
+		conn := connector.NewDummy(nil, nil, time.Hour, imap.NewFlagSet(), imap.NewFlagSet(), imap.NewFlagSet())
+		defer func() { require.NoError(t, conn.Close(ctx)) }()
+
+		_, err := server.LoadUser(ctx, conn, userID, []byte(options.defaultPassword()))
+		require.ErrorIs(t, err, db.ErrInvalidDatabaseVersion)
+
+		var futureErr *db.FutureVersionError
+
+		require.ErrorAs(t, err, &futureErr)
+		require.Equal(t, 99999, futureErr.Version)
+	})
+
+	// Once the newer version downgraded the database again, it can be used with its contents.
+	require.NoError(t, db_impl.TestUpdateDBMinCompatibleVersion(ctx, options.databaseDir, userID, 0))
+
+	runOneToOneTestWithAuth(t, options, func(c *testConnection, _ *testSession) {
+		c.C(`A001 SELECT saved-messages`).OK(`A001`)
+	})
+}
+
+func TestDowngradeDatabase(t *testing.T) {
+	ctx := context.Background()
+	options := defaultServerOptions(t)
+
+	var userID string
+
+	runOneToOneTestWithAuth(t, options, func(c *testConnection, s *testSession) {
+		userID = s.userIDs["user"]
+
+		c.C(`A001 CREATE saved-messages`).OK(`A001`)
+
+		// Loaded users can't be downgraded.
+		require.Error(t, s.server.DowngradeDatabase(ctx, userID, nil, 3))
+	})
+
+	withUnloadedServer(t, options, func(server *gluon.Server) {
+		require.ErrorIs(t, server.DowngradeDatabase(ctx, userID, []byte(options.defaultPassword()), 0), db.ErrMigrationNotReversible)
+		require.NoError(t, server.DowngradeDatabase(ctx, userID, []byte(options.defaultPassword()), 3))
+		require.Error(t, server.DowngradeDatabase(ctx, "no-such-user", nil, 3))
+	})
+
+	// Loading the user migrates it up again.
+	runOneToOneTestWithAuth(t, options, func(c *testConnection, _ *testSession) {
+		c.C(`A001 SELECT saved-messages`).OK(`A001`)
+	})
+}
+
+// withUnloadedServer runs fn with a server using the directories of options, without loading any user.
+func withUnloadedServer(t *testing.T, options *serverOptions, fn func(*gluon.Server)) {
+	server, err := gluon.New(
+		gluon.WithDataDir(options.dataDir),
+		gluon.WithDatabaseDir(options.databaseDir),
+		gluon.WithDBClient(options.database),
+	)
+	require.NoError(t, err)
+
+	defer func() { require.NoError(t, server.Close(context.Background())) }()
+
+	fn(server)
+}
@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/gluon"
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/store"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPackStore(t *testing.T) {
+	options := defaultServerOptions(t)
+
+	var userID string
+
+	// The messages are first stored with a file per message.
+	runOneToOneTestWithAuth(t, options, func(c *testConnection, s *testSession) {
+		userID = s.userIDs["user"]
+
+		c.doAppend(`INBOX`, buildRFC5322TestLiteral(`To: 1@pm.me`)).expect("OK")
+		c.doAppend(`INBOX`, buildRFC5322TestLiteral(`To: 2@pm.me`)).expect("OK")
+	})
+
+	options.storeBuilder = &store.PackStoreBuilder{}
+
+	// They are moved to pack files when the user is next loaded.
+	runOneToOneTestWithAuth(t, options, func(c *testConnection, s *testSession) {
+		entries, err := os.ReadDir(filepath.Join(options.dataDir, userID))
+		require.NoError(t, err)
+
+		for _, entry := range entries {
+			_, err := imap.InternalMessageIDFromString(entry.Name())
+			require.Error(t, err)
+		}
+
+		c.doAppend(`INBOX`, buildRFC5322TestLiteral(`To: 3@pm.me`)).expect("OK")
+
+		report, err := s.server.CheckUser(context.Background(), userID, false)
+		require.NoError(t, err)
+		require.Equal(t, 3, report.Messages)
+		require.Empty(t, report.Problems)
+	})
+
+	runOneToOneTestWithAuth(t, options, func(c *testConnection, s *testSession) {
+		c.C(`A001 SELECT INBOX`).Se(`A001 OK [READ-WRITE] SELECT`)
+		c.C(`A002 FETCH 1:3 (BODY.PEEK[HEADER.FIELDS (To)])`)
+		c.Sxe(`1@pm.me`)
+		c.Sxe(`2@pm.me`)
+		c.Sxe(`3@pm.me`)
+		c.OK(`A002`)
+	})
+}
+
+func TestPackStore_Budget(t *testing.T) {
+	options := defaultServerOptions(t)
+
+	server, err := gluon.New(
+		gluon.WithDataDir(options.dataDir),
+		gluon.WithDatabaseDir(options.databaseDir),
+		gluon.WithStoreBuilder(&store.PackStoreBuilder{}),
+		gluon.WithStoreBudget(1<<20),
+	)
+	require.NoError(t, err)
+
+	defer func() { require.NoError(t, server.Close(context.Background())) }()
+
+	creds := options.credentials[0]
+
+	conn := options.connectorBuilder.New(
+		creds.usernames,
+		[]byte(creds.password),
+		defaultPeriod,
+		defaultFlags,
+		defaultPermanentFlags,
+		defaultAttributes,
+	)
+
+	defer func() { require.NoError(t, conn.Close(context.Background())) }()
+
+	// The pack store can't evict literals, so the user can't be loaded with a budget.
+	_, err = server.LoadUser(context.Background(), conn, "user", []byte(creds.password))
+	require.ErrorIs(t, err, store.ErrEvictionUnsupported)
+}
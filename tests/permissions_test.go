@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/gluon/imap"
+)
+
+func TestPermissionsReadOnlyMailbox(t *testing.T) {
+	runOneToOneTestWithAuth(t, defaultServerOptions(t), func(c *testConnection, s *testSession) {
+		mboxID := s.mailboxCreatedWithPermissions("user", []string{"All Mail"}, imap.PermRead)
+		s.messageCreated("user", mboxID, []byte("To: 1@pm.me"), time.Now())
+
+		c.C(`A001 SELECT "All Mail"`)
+		c.Se(`* OK [PERMANENTFLAGS ()] Flags permitted`)
+		c.Se(`A001 OK [READ-ONLY] SELECT`)
+
+		c.C(`A002 STORE 1 +FLAGS (\Seen)`).NO(`A002`)
+		c.C(`A003 EXPUNGE`).NO(`A003`)
+
+		// Fetching the body doesn't implicitly set \Seen.
+		c.C(`A004 FETCH 1 (BODY[])`).Sxe(`\* 1 FETCH`).OK(`A004`)
+		c.C(`A005 FETCH 1 (FLAGS)`).S(`* 1 FETCH (FLAGS (\Recent))`).OK(`A005`)
+
+		c.doAppend(`"All Mail"`, buildRFC5322TestLiteral(`To: 2@pm.me`)).expect("NO")
+
+		c.C(`A006 CLOSE`).OK(`A006`)
+	})
+}
+
+func TestPermissionsUpdatedOnExistingMailbox(t *testing.T) {
+	runOneToOneTestWithAuth(t, defaultServerOptions(t), func(c *testConnection, s *testSession) {
+		mboxID := s.mailboxCreated("user", []string{"Archive"})
+		s.messageCreated("user", mboxID, []byte("To: 1@pm.me"), time.Now())
+
+		c.C(`A001 SELECT Archive`).Sxe(`A001 OK \[READ-WRITE\]`)
+		c.C(`A002 CLOSE`).OK(`A002`)
+
+		s.mailboxPermissionsUpdated("user", mboxID, imap.PermRead)
+
+		c.C(`A003 SELECT Archive`).Sxe(`A003 OK \[READ-ONLY\]`)
+		c.C(`A004 STORE 1 +FLAGS (\Seen)`).NO(`A004`)
+		c.C(`A005 CLOSE`).OK(`A005`)
+
+		s.mailboxPermissionsUpdated("user", mboxID, imap.PermAll)
+
+		c.C(`A006 SELECT Archive`).Sxe(`A006 OK \[READ-WRITE\]`)
+		c.C(`A007 STORE 1 +FLAGS.SILENT (\Seen)`).OK(`A007`)
+	})
+}
+
+func TestPermissionsNoRead(t *testing.T) {
+	runOneToOneTestWithAuth(t, defaultServerOptions(t), func(c *testConnection, s *testSession) {
+		s.mailboxCreatedWithPermissions("user", []string{"Outbox"}, imap.PermInsert)
+
+		c.C(`A001 SELECT Outbox`).NO(`A001`)
+		c.C(`A002 EXAMINE Outbox`).NO(`A002`)
+
+		c.doAppend(`Outbox`, buildRFC5322TestLiteral(`To: 1@pm.me`)).expect("OK")
+	})
+}
+
+func TestPermissionsNoInsert(t *testing.T) {
+	runOneToOneTestWithAuth(t, defaultServerOptions(t), func(c *testConnection, s *testSession) {
+		s.mailboxCreatedWithPermissions("user", []string{"Sent"}, imap.PermRead|imap.PermWriteFlags|imap.PermExpunge)
+		s.messageCreated("user", imap.MailboxID("0"), []byte("To: 1@pm.me"), time.Now())
+
+		c.doAppend(`Sent`, buildRFC5322TestLiteral(`To: 2@pm.me`)).expect("NO")
+
+		c.C(`A001 SELECT INBOX`).OK(`A001`)
+		c.C(`A002 COPY 1 Sent`).NO(`A002`)
+		c.C(`A003 MOVE 1 Sent`).NO(`A003`)
+
+		c.C(`A004 STATUS Sent (MESSAGES)`).S(`* STATUS "Sent" (MESSAGES 0)`).OK(`A004`)
+
+		c.C(`A005 SELECT Sent`).Sxe(`A005 OK \[READ-WRITE\]`)
+	})
+}
+
+func TestPermissionsNoExpunge(t *testing.T) {
+	runOneToOneTestWithAuth(t, defaultServerOptions(t), func(c *testConnection, s *testSession) {
+		mboxID := s.mailboxCreatedWithPermissions("user", []string{"Archive"}, imap.PermRead|imap.PermWriteFlags|imap.PermInsert)
+		s.messageCreated("user", mboxID, []byte("To: 1@pm.me"), time.Now())
+
+		c.C(`A001 SELECT Archive`).Sxe(`A001 OK \[READ-WRITE\]`)
+		c.C(`A002 STORE 1 +FLAGS.SILENT (\Deleted)`).OK(`A002`)
+		c.C(`A003 EXPUNGE`).NO(`A003`)
+		c.C(`A004 MOVE 1 INBOX`).NO(`A004`)
+
+		// CLOSE silently skips the expunge.
+		c.C(`A005 CLOSE`).OK(`A005`)
+		c.C(`A006 STATUS Archive (MESSAGES)`).S(`* STATUS "Archive" (MESSAGES 1)`).OK(`A006`)
+	})
+}
+
+func TestPermissionsNoCreateChildren(t *testing.T) {
+	runOneToOneTestWithAuth(t, defaultServerOptions(t), func(c *testConnection, s *testSession) {
+		s.mailboxCreatedWithPermissions("user", []string{"Labels"}, imap.PermAll&^imap.PermCreateChildren)
+
+		c.C(`A001 CREATE Labels/Work`).NO(`A001`)
+		c.C(`A002 CREATE Labels/Work/Project`).NO(`A002`)
+		c.C(`A003 CREATE Folders/Work`).OK(`A003`)
+	})
+}
@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/ProtonMail/gluon/async"
+	"github.com/ProtonMail/gluon/events"
+	"github.com/ProtonMail/gluon/limits"
+	"github.com/ProtonMail/gluon/listener"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxyProtocolRemoteAddr(t *testing.T) {
+	runTest(t, defaultServerOptions(t), []int{}, func(_ map[int]*testConnection, s *testSession) {
+		eventCh := s.server.AddWatcher(events.SessionAdded{})
+
+		l := serveProxied(t, s)
+
+		c := dialProxied(t, l, "PROXY TCP4 192.0.2.1 198.51.100.1 56324 143\r\n")
+		defer func() { require.NoError(t, c.disconnect()) }()
+
+		added, ok := (<-eventCh).(events.SessionAdded)
+		require.True(t, ok)
+		require.Equal(t, "192.0.2.1:56324", added.RemoteAddr.String())
+
+		c.C("A001 login user pass").OK("A001")
+	})
+}
+
+func TestProxyProtocolConnectionLimitPerIP(t *testing.T) {
+	runTest(t, defaultServerOptions(t, withConnectionLimits(limits.Connections{MaxPerIP: 1})), []int{}, func(_ map[int]*testConnection, s *testSession) {
+		l := serveProxied(t, s)
+
+		// Clients relayed by the same proxy are counted by their own address.
+		c1 := dialProxied(t, l, "PROXY TCP4 192.0.2.1 198.51.100.1 56324 143\r\n")
+		defer func() { require.NoError(t, c1.disconnect()) }()
+
+		c2 := dialProxied(t, l, "PROXY TCP6 2001:db8::1 2001:db8::2 56324 143\r\n")
+		defer func() { require.NoError(t, c2.disconnect()) }()
+
+		conn, err := net.Dial(l.Addr().Network(), l.Addr().String())
+		require.NoError(t, err)
+
+		_, err = conn.Write([]byte("PROXY TCP4 192.0.2.1 198.51.100.1 56325 143\r\n"))
+		require.NoError(t, err)
+
+		newTestConnection(t, conn).S("* BYE [LIMIT] Too many connections, please try again later").expectClosed()
+	})
+}
+
+// serveProxied makes the server serve another listener behind a PROXY protocol proxy on this host until the test ends.
+func serveProxied(t *testing.T, s *testSession) net.Listener {
+	l, err := net.Listen("tcp", net.JoinHostPort("localhost", "0"))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	t.Cleanup(func() {
+		cancel()
+		l.Close()
+	})
+
+	proxy := listener.NewProxyListener(l, listener.ProxyConfig{
+		TrustedSources: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8"), netip.MustParsePrefix("::1/128")},
+	}, async.NoopPanicHandler{})
+
+	require.NoError(t, s.server.Serve(ctx, proxy))
+
+	return proxy
+}
+
+// dialProxied connects to the given listener as a proxy relaying a client with the given header.
+func dialProxied(t *testing.T, l net.Listener, header string) *testConnection {
+	conn, err := net.Dial(l.Addr().Network(), l.Addr().String())
+	require.NoError(t, err)
+
+	_, err = conn.Write([]byte(header))
+	require.NoError(t, err)
+
+	return newTestConnection(t, conn).Sx(`\* OK.*`)
+}
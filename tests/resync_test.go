@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResyncUser(t *testing.T) {
+	runOneToOneTestWithAuth(t, defaultServerOptions(t), func(c *testConnection, s *testSession) {
+		mboxID := s.mailboxCreated("user", []string{"mbox"})
+		messageID1 := s.messageCreated("user", mboxID, []byte("To: 1@pm.me"), time.Now())
+		messageID2 := s.messageCreated("user", mboxID, []byte("To: 2@pm.me"), time.Now())
+		messageID3 := s.messageCreated("user", mboxID, []byte("To: 3@pm.me"), time.Now())
+
+		c.C(`A001 STATUS mbox (UIDVALIDITY)`)
+		uidValidity := strings.TrimSpace(string(c.read()))
+		c.OK(`A001`)
+
+		c.C(`A002 SELECT mbox`).OK(`A002`)
+
+		// Change the remote without gluon being told about it.
+		s.withUpdatesLost("user", func() {
+			otherID := s.mailboxCreated("user", []string{"other"})
+
+			s.messageDeleted("user", messageID1)
+			s.messageSeen("user", messageID2, true)
+			s.messageAdded("user", messageID3, otherID)
+			s.messageCreated("user", mboxID, []byte("To: 4@pm.me"), time.Now())
+		})
+
+		c.C(`A003 STATUS other (MESSAGES)`).NO(`A003`)
+
+		// The session may receive the resulting updates after a command completes, so wait for them while idling.
+		c.C(`A004 IDLE`).S(`+ Ready`)
+
+		s.resyncUser("user")
+
+		c.Se(`* 1 EXPUNGE`)
+		c.C(`DONE`).OK(`A004`)
+		c.C(`A005 STATUS other (MESSAGES)`).S(`* STATUS "other" (MESSAGES 1)`).OK(`A005`)
+
+		s.withConnection("user", func(c *testConnection) {
+			// The mailbox keeps its UIDVALIDITY and the surviving messages keep their UIDs.
+			c.C(`B001 STATUS mbox (UIDVALIDITY)`).S(uidValidity).OK(`B001`)
+
+			c.C(`B002 SELECT mbox`).OK(`B002`)
+			c.C(`B003 FETCH 1:* (UID FLAGS)`)
+			c.S(
+				`* 1 FETCH (UID 2 FLAGS (\Seen))`,
+				`* 2 FETCH (UID 3 FLAGS ())`,
+				`* 3 FETCH (UID 4 FLAGS ())`,
+			)
+			c.OK(`B003`)
+		})
+	})
+}
+
+func TestResyncUserNoChanges(t *testing.T) {
+	runOneToOneTestWithAuth(t, defaultServerOptions(t), func(c *testConnection, s *testSession) {
+		mboxID := s.mailboxCreated("user", []string{"mbox"})
+		s.messageCreated("user", mboxID, []byte("To: 1@pm.me"), time.Now(), `\Seen`)
+		s.messageCreated("user", mboxID, []byte("To: 2@pm.me"), time.Now())
+
+		c.C(`A001 STATUS mbox (MESSAGES UIDNEXT UIDVALIDITY)`)
+		status := strings.TrimSpace(string(c.read()))
+		c.OK(`A001`)
+
+		s.resyncUser("user")
+
+		c.C(`A002 STATUS mbox (MESSAGES UIDNEXT UIDVALIDITY)`).S(status).OK(`A002`)
+
+		c.C(`A003 SELECT mbox`).OK(`A003`)
+		c.C(`A004 FETCH 1:* (UID FLAGS)`)
+		c.S(
+			`* 1 FETCH (UID 1 FLAGS (\Recent \Seen))`,
+			`* 2 FETCH (UID 2 FLAGS (\Recent))`,
+		)
+		c.OK(`A004`)
+	})
+}
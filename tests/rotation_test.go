@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/gluon/internal/db_impl"
+	"github.com/ProtonMail/gluon/internal/db_impl/sqlite3"
+	"github.com/ProtonMail/gluon/store"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotateUserPassphrase(t *testing.T) {
+	options := defaultServerOptions(t, withDatabase(db_impl.NewSQLiteDB(sqlite3.Encrypt())), withSearchIndex())
+
+	runOneToOneTestWithAuth(t, options, func(c *testConnection, s *testSession) {
+		ctx, userID := context.Background(), s.userIDs["user"]
+
+		c.doAppend(`INBOX`, buildRFC5322TestLiteral(`To: 1@pm.me`)).expect("OK")
+		c.doAppend(`INBOX`, buildRFC5322TestLiteral(`To: 2@pm.me`)).expect("OK")
+
+		require.ErrorIs(t, s.server.RotateUserPassphrase(ctx, userID, []byte("wrong"), []byte("new")), store.ErrWrongPassphrase)
+		require.NoError(t, s.server.RotateUserPassphrase(ctx, userID, []byte("pass"), []byte("new")))
+
+		// The user stays online throughout.
+		c.doAppend(`INBOX`, buildRFC5322TestLiteral(`To: 3@pm.me`)).expect("OK")
+
+		c.C(`A001 SELECT INBOX`).Se(`A001 OK [READ-WRITE] SELECT`)
+		c.C(`A002 SEARCH TEXT 2@pm.me`).S(`* SEARCH 2`).OK(`A002`)
+
+		report, err := s.server.CheckUser(ctx, userID, false)
+		require.NoError(t, err)
+		require.Empty(t, report.Problems)
+	})
+
+	options.credentials[0].password = "new"
+
+	runOneToOneTestWithAuth(t, options, func(c *testConnection, s *testSession) {
+		c.C(`A001 SELECT INBOX`).Se(`A001 OK [READ-WRITE] SELECT`)
+		c.C(`A002 SEARCH TEXT 3@pm.me`).S(`* SEARCH 3`).OK(`A002`)
+
+		report, err := s.server.CheckUser(context.Background(), s.userIDs["user"], false)
+		require.NoError(t, err)
+		require.Equal(t, 3, report.Messages)
+		require.Empty(t, report.Problems)
+	})
+}
+
+func TestRotateUserPassphraseResumes(t *testing.T) {
+	options := defaultServerOptions(t, withDatabase(db_impl.NewSQLiteDB(sqlite3.Encrypt())))
+
+	var userID string
+
+	runOneToOneTestWithAuth(t, options, func(c *testConnection, s *testSession) {
+		userID = s.userIDs["user"]
+
+		c.doAppend(`INBOX`, buildRFC5322TestLiteral(`To: 1@pm.me`)).expect("OK")
+		c.doAppend(`INBOX`, buildRFC5322TestLiteral(`To: 2@pm.me`)).expect("OK")
+	})
+
+	// Interrupt a rotation right after it started: neither the database nor any literal uses the new passphrase yet.
+	{
+		st, err := store.NewOnDiskStore(filepath.Join(options.dataDir, userID), []byte("pass"))
+		require.NoError(t, err)
+		require.NoError(t, st.(store.Rotator).StartRotation([]byte("pass"), []byte("new")))
+		require.NoError(t, st.Close())
+	}
+
+	options.credentials[0].password = "new"
+
+	runOneToOneTestWithAuth(t, options, func(c *testConnection, s *testSession) {
+		c.C(`A001 SELECT INBOX`).Se(`A001 OK [READ-WRITE] SELECT`)
+
+		require.Eventually(t, func() bool {
+			_, err := os.Stat(filepath.Join(options.dataDir, userID, ".rotation"))
+			return os.IsNotExist(err)
+		}, 5*time.Second, 10*time.Millisecond)
+
+		report, err := s.server.CheckUser(context.Background(), userID, false)
+		require.NoError(t, err)
+		require.Equal(t, 2, report.Messages)
+		require.Empty(t, report.Problems)
+	})
+}
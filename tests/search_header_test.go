@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/ProtonMail/gluon/store"
+	"github.com/stretchr/testify/require"
+)
+
+// countingStoreBuilder builds stores which count how many messages were read from them.
+type countingStoreBuilder struct {
+	store.OnDiskStoreBuilder
+
+	gets atomic.Int32
+}
+
+func (b *countingStoreBuilder) New(dir, userID string, passphrase []byte) (store.Store, error) {
+	st, err := b.OnDiskStoreBuilder.New(dir, userID, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	return &countingStore{Store: st, gets: &b.gets}, nil
+}
+
+type countingStore struct {
+	store.Store
+
+	gets *atomic.Int32
+}
+
+func (s *countingStore) Get(messageID imap.InternalMessageID) ([]byte, error) {
+	s.gets.Add(1)
+
+	return s.Store.Get(messageID)
+}
+
+func TestSearchHeaderFieldsDoNotReadStore(t *testing.T) {
+	builder := &countingStoreBuilder{}
+
+	runOneToOneTestWithAuth(t, defaultServerOptions(t, withStoreBuilder(builder)), func(c *testConnection, s *testSession) {
+		c.doAppend(`INBOX`, buildRFC5322TestLiteral("From: alice@pm.me\r\nTo: bob@pm.me\r\nCc: carol@pm.me\r\nSubject: Quarterly report\r\nDate: Tue, 18 Feb 2003 00:29:37 +0200\r\nMessage-ID: <report@pm.me>\r\nX-Custom: needle\r\n\r\nbody")).expect("OK")
+		c.doAppend(`INBOX`, buildRFC5322TestLiteral("From: dave@pm.me\r\nTo: alice@pm.me\r\nSubject: Lunch\r\n\r\nbody")).expect("OK")
+
+		c.C(`A001 SELECT INBOX`).OK(`A001`)
+
+		builder.gets.Store(0)
+
+		c.C(`A002 SEARCH FROM alice`).S(`* SEARCH 1`).OK(`A002`)
+		c.C(`A003 SEARCH TO alice`).S(`* SEARCH 2`).OK(`A003`)
+		c.C(`A004 SEARCH CC carol`).S(`* SEARCH 1`).OK(`A004`)
+		c.C(`A005 SEARCH BCC carol`).S(`* SEARCH`).OK(`A005`)
+		c.C(`A006 SEARCH SUBJECT "QUARTERLY"`).S(`* SEARCH 1`).OK(`A006`)
+		c.C(`A007 SEARCH HEADER Message-ID REPORT@pm.me`).S(`* SEARCH 1`).OK(`A007`)
+		c.C(`A008 SEARCH SENTON 18-Feb-2003`).S(`* SEARCH 1`).OK(`A008`)
+		c.C(`A009 SEARCH OR SUBJECT lunch SENTSINCE 1-Jan-2003`).S(`* SEARCH 1 2`).OK(`A009`)
+
+		require.Zero(t, builder.gets.Load())
+
+		// Other header fields aren't stored in the database.
+		c.C(`A010 SEARCH HEADER X-Custom needle`).S(`* SEARCH 1`).OK(`A010`)
+
+		require.NotZero(t, builder.gets.Load())
+	})
+}
@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchIndexBody(t *testing.T) {
+	runOneToOneTestWithData(t, defaultServerOptions(t, withSearchIndex()), func(c *testConnection, s *testSession, mbox string, mboxID imap.MailboxID) {
+		c.C(`A001 search body "Content-Length saves just the size of mail body"`)
+		c.S("* SEARCH 50")
+		c.OK("A001")
+
+		c.C(`A002 search body "Content-LenGTH sAvEs just the size of MaiL body"`)
+		c.S("* SEARCH 50")
+		c.OK("A002")
+
+		// Words are matched by substring, as with the unindexed search.
+		c.C(`A003 search body "ontent-Length saves just the size of mail bo"`)
+		c.S("* SEARCH 50")
+		c.OK("A003")
+	})
+}
+
+func TestSearchIndexText(t *testing.T) {
+	runOneToOneTestWithData(t, defaultServerOptions(t, withSearchIndex()), func(c *testConnection, s *testSession, mbox string, mboxID imap.MailboxID) {
+		c.C(`A001 search text "Message-ID: <006701c24183$c7f10d60$0200a8c0@eero>"`)
+		c.S("* SEARCH 20")
+		c.OK("A001")
+
+		c.C(`A002 search text "ContenT-LeNgTh saveS jUst the Size of mail body"`)
+		c.S("* SEARCH 50")
+		c.OK("A002")
+
+		// Keys without words can't be looked up in the index and are scanned for instead.
+		c.C(`A003 search text "<>"`)
+		c.Sx(`\* SEARCH`)
+		c.OK("A003")
+	})
+}
+
+func TestSearchIndexDecodesParts(t *testing.T) {
+	runOneToOneTestWithAuth(t, defaultServerOptions(t, withSearchIndex()), func(c *testConnection, s *testSession) {
+		c.C(`A001 select inbox`).OK(`A001`)
+
+		c.doAppend(`inbox`, buildRFC5322TestLiteral(base64Message("the xylophone player"))).expect("OK")
+		c.doAppend(`inbox`, buildRFC5322TestLiteral("To: 2@pm.me\r\nSubject: =?UTF-8?Q?caf=C3=A9?=\r\n\r\nnothing to see")).expect("OK")
+
+		// The base64 body is searched in its decoded form.
+		c.C(`A002 search body xylophone`).S(`* SEARCH 1`).OK(`A002`)
+		c.C(`A003 search body "xylophone player"`).S(`* SEARCH 1`).OK(`A003`)
+		c.C(`A004 search body "player xylophone"`).S(`* SEARCH`).OK(`A004`)
+
+		// Encoded headers are searched in their decoded form.
+		c.C(`A005 search charset utf-8 text café`).S(`* SEARCH 2`).OK(`A005`)
+
+		// BODY doesn't search the header.
+		c.C(`A006 search body café`).S(`* SEARCH`).OK(`A006`)
+	})
+}
+
+func TestSearchIndexIncompleteMessages(t *testing.T) {
+	runOneToOneTestWithAuth(t, defaultServerOptions(t, withSearchIndex()), func(c *testConnection, s *testSession) {
+		c.C(`A001 select inbox`).OK(`A001`)
+
+		c.doAppend(`inbox`, buildRFC5322TestLiteral(
+			"To: 1@pm.me\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n"+
+				"--b\r\nContent-Type: text/plain\r\n\r\nsee attached\r\n"+
+				"--b\r\nContent-Type: application/pdf; name=quarterly.pdf\r\n\r\nJVBERi0=\r\n"+
+				"--b--\r\n",
+		)).expect("OK")
+		c.doAppend(`inbox`, buildRFC5322TestLiteral("To: 2@pm.me\r\n\r\ntoken "+strings.Repeat("x", 100))).expect("OK")
+
+		// The headers of MIME parts, and so the names of attachments, are indexed.
+		c.C(`A002 search body quarterly`).S(`* SEARCH 1`).OK(`A002`)
+
+		// Tokens too long to be indexed are still found.
+		c.C(`A003 search body xxxxx`).S(`* SEARCH 2`).OK(`A003`)
+		c.C(`A004 search text "token xxxxx"`).S(`* SEARCH 2`).OK(`A004`)
+	})
+}
+
+func TestSearchIndexPersistedAndRebuilt(t *testing.T) {
+	dataDir := t.TempDir()
+
+	options := defaultServerOptions(t, withSearchIndex(), withDataDir(dataDir))
+
+	runOneToOneTestWithAuth(t, options, func(c *testConnection, s *testSession) {
+		c.doAppend(`inbox`, buildRFC5322TestLiteral(base64Message("the xylophone player"))).expect("OK")
+	})
+
+	runOneToOneTestWithAuth(t, options, func(c *testConnection, s *testSession) {
+		indexPath := filepath.Join(dataDir, "search", s.userIDs["user"])
+
+		// The index is stored encrypted.
+		b, err := os.ReadFile(indexPath)
+		require.NoError(t, err)
+		require.False(t, strings.Contains(string(b), "xylophone"))
+
+		c.C(`A001 select inbox`).OK(`A001`)
+		c.C(`A002 search body xylophone`).S(`* SEARCH 1`).OK(`A002`)
+
+		require.NoError(t, s.server.RebuildSearchIndex(context.Background(), s.userIDs["user"]))
+
+		c.C(`A003 search body xylophone`).S(`* SEARCH 1`).OK(`A003`)
+	})
+}
+
+func TestSearchIndexRebuildDisabled(t *testing.T) {
+	runOneToOneTestWithAuth(t, defaultServerOptions(t), func(c *testConnection, s *testSession) {
+		require.Error(t, s.server.RebuildSearchIndex(context.Background(), s.userIDs["user"]))
+	})
+}
+
+func base64Message(body string) string {
+	return "To: 1@pm.me\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+		base64.StdEncoding.EncodeToString([]byte(body))
+}
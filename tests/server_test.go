@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/ProtonMail/gluon"
+	"github.com/ProtonMail/gluon/auth"
 	"github.com/ProtonMail/gluon/connector"
 	"github.com/ProtonMail/gluon/db"
 	"github.com/ProtonMail/gluon/imap"
@@ -18,14 +19,17 @@ import (
 	"github.com/ProtonMail/gluon/internal/hash"
 	"github.com/ProtonMail/gluon/limits"
 	"github.com/ProtonMail/gluon/logging"
+	"github.com/ProtonMail/gluon/observability"
 	"github.com/ProtonMail/gluon/reporter"
 	"github.com/ProtonMail/gluon/store"
+	"github.com/ProtonMail/gluon/trace"
 	"github.com/ProtonMail/gluon/version"
 	"github.com/bradenaw/juniper/xslices"
 	"github.com/emersion/go-imap/client"
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
+	oteltrace "go.opentelemetry.io/otel/trace"
 	"golang.org/x/exp/slices"
 )
 
@@ -70,12 +74,24 @@ type serverOptions struct {
 	credentials          []credentials
 	delimiter            string
 	loginJailTime        time.Duration
+	loginThrottle        *limits.LoginThrottle
+	authenticator        auth.Authenticator
+	sessionTimeouts      *limits.SessionTimeouts
+	connLimits           limits.Connections
+	observabilitySender  observability.Sender
 	dataDir              string
 	databaseDir          string
 	idleBulkTime         time.Duration
 	storeBuilder         store.Builder
 	connectorBuilder     connectorBuilder
 	disableParallelism   bool
+	rejectUnavailable    bool
+	flagConflictPolicy   imap.FlagConflictPolicy
+	searchIndex          bool
+	storeBudget          int64
+	traceSink            trace.Sink
+	traceRedaction       trace.Redaction
+	tracerProvider       oteltrace.TracerProvider
 	imapLimits           limits.IMAP
 	reporter             reporter.Reporter
 	uidValidityGenerator imap.UIDValidityGenerator
@@ -162,6 +178,92 @@ func (disableParallelism) apply(options *serverOptions) {
 	options.disableParallelism = true
 }
 
+type rejectUnavailableLogins struct{}
+
+func (rejectUnavailableLogins) apply(options *serverOptions) {
+	options.rejectUnavailable = true
+}
+
+type flagConflictPolicy struct {
+	policy imap.FlagConflictPolicy
+}
+
+func (opt flagConflictPolicy) apply(options *serverOptions) {
+	options.flagConflictPolicy = opt.policy
+}
+
+type searchIndex struct{}
+
+func (searchIndex) apply(options *serverOptions) {
+	options.searchIndex = true
+}
+
+type loginThrottle struct {
+	throttle limits.LoginThrottle
+}
+
+func (opt loginThrottle) apply(options *serverOptions) {
+	options.loginThrottle = &opt.throttle
+}
+
+type sessionTimeouts struct {
+	timeouts limits.SessionTimeouts
+}
+
+func (opt sessionTimeouts) apply(options *serverOptions) {
+	options.sessionTimeouts = &opt.timeouts
+}
+
+type connLimits struct {
+	limits limits.Connections
+}
+
+func (opt connLimits) apply(options *serverOptions) {
+	options.connLimits = opt.limits
+}
+
+type observabilitySender struct {
+	sender observability.Sender
+}
+
+func (opt observabilitySender) apply(options *serverOptions) {
+	options.observabilitySender = opt.sender
+}
+
+type authenticatorOption struct {
+	authenticator auth.Authenticator
+}
+
+func (opt authenticatorOption) apply(options *serverOptions) {
+	options.authenticator = opt.authenticator
+}
+
+type storeBudget struct {
+	budget int64
+}
+
+func (opt storeBudget) apply(options *serverOptions) {
+	options.storeBudget = opt.budget
+}
+
+type traceOption struct {
+	sink      trace.Sink
+	redaction trace.Redaction
+}
+
+func (opt traceOption) apply(options *serverOptions) {
+	options.traceSink = opt.sink
+	options.traceRedaction = opt.redaction
+}
+
+type tracerProviderOption struct {
+	provider oteltrace.TracerProvider
+}
+
+func (opt tracerProviderOption) apply(options *serverOptions) {
+	options.tracerProvider = opt.provider
+}
+
 type imapLimits struct {
 	limits limits.IMAP
 }
@@ -222,6 +324,50 @@ func withDisableParallelism() serverOption {
 	return &disableParallelism{}
 }
 
+func withRejectUnavailableLogins() serverOption {
+	return &rejectUnavailableLogins{}
+}
+
+func withFlagConflictPolicy(policy imap.FlagConflictPolicy) serverOption {
+	return &flagConflictPolicy{policy: policy}
+}
+
+func withSearchIndex() serverOption {
+	return &searchIndex{}
+}
+
+func withLoginThrottle(throttle limits.LoginThrottle) serverOption {
+	return &loginThrottle{throttle: throttle}
+}
+
+func withSessionTimeouts(timeouts limits.SessionTimeouts) serverOption {
+	return &sessionTimeouts{timeouts: timeouts}
+}
+
+func withConnectionLimits(limits limits.Connections) serverOption {
+	return &connLimits{limits: limits}
+}
+
+func withObservabilitySender(sender observability.Sender) serverOption {
+	return &observabilitySender{sender: sender}
+}
+
+func withAuthenticator(authenticator auth.Authenticator) serverOption {
+	return &authenticatorOption{authenticator: authenticator}
+}
+
+func withStoreBudget(budget int64) serverOption {
+	return &storeBudget{budget: budget}
+}
+
+func withTrace(sink trace.Sink, redaction trace.Redaction) serverOption {
+	return &traceOption{sink: sink, redaction: redaction}
+}
+
+func withTracerProvider(provider oteltrace.TracerProvider) serverOption {
+	return &tracerProviderOption{provider: provider}
+}
+
 func withIMAPLimits(limits limits.IMAP) serverOption {
 	return &imapLimits{limits: limits}
 }
@@ -306,12 +452,53 @@ func runServer(tb testing.TB, options *serverOptions, tests func(session *testSe
 		gluon.WithReporter(reporter),
 		gluon.WithIMAPLimits(options.imapLimits),
 		gluon.WithDBClient(options.database),
+		gluon.WithFlagConflictPolicy(options.flagConflictPolicy),
 	}
 
 	if options.disableParallelism {
 		gluonOptions = append(gluonOptions, gluon.WithDisableParallelism())
 	}
 
+	if options.rejectUnavailable {
+		gluonOptions = append(gluonOptions, gluon.WithRejectUnavailableLogins())
+	}
+
+	if options.searchIndex {
+		gluonOptions = append(gluonOptions, gluon.WithSearchIndex())
+	}
+
+	if options.loginThrottle != nil {
+		gluonOptions = append(gluonOptions, gluon.WithLoginThrottle(*options.loginThrottle))
+	}
+
+	if options.sessionTimeouts != nil {
+		gluonOptions = append(gluonOptions, gluon.WithSessionTimeouts(*options.sessionTimeouts))
+	}
+
+	if options.connLimits != (limits.Connections{}) {
+		gluonOptions = append(gluonOptions, gluon.WithConnectionLimits(options.connLimits))
+	}
+
+	if options.observabilitySender != nil {
+		gluonOptions = append(gluonOptions, gluon.WithObservabilitySender(options.observabilitySender, 1, 2, 3))
+	}
+
+	if options.authenticator != nil {
+		gluonOptions = append(gluonOptions, gluon.WithAuthenticator(options.authenticator))
+	}
+
+	if options.storeBudget > 0 {
+		gluonOptions = append(gluonOptions, gluon.WithStoreBudget(options.storeBudget))
+	}
+
+	if options.traceSink != nil {
+		gluonOptions = append(gluonOptions, gluon.WithTrace(options.traceSink, options.traceRedaction))
+	}
+
+	if options.tracerProvider != nil {
+		gluonOptions = append(gluonOptions, gluon.WithTracerProvider(options.tracerProvider))
+	}
+
 	if options.reporter != nil {
 		gluonOptions = append(gluonOptions, gluon.WithReporter(options.reporter))
 	}
@@ -369,22 +556,34 @@ func runServer(tb testing.TB, options *serverOptions, tests func(session *testSe
 	require.NoError(tb, server.Serve(ctx, listener))
 
 	// Run the test against the server.
+	session := newTestSession(tb, listener, server, eventCh, reporter, userIDs, conns, dbPaths, options)
+
 	logging.DoAnnotated(ctx, func(context.Context) {
-		tests(newTestSession(tb, listener, server, eventCh, reporter, userIDs, conns, dbPaths, options))
+		tests(session)
 	}, logging.Labels{
 		"Action": "Running gluon tests",
 	})
 
-	// Flush and remove user before shutdown.
-	for userID, conn := range conns {
-		conn.Flush()
-		require.NoError(tb, server.RemoveUser(ctx, userID, false))
+	// A drained server is already closed.
+	if !session.drained {
+		// Flush and remove user before shutdown.
+		for userID, conn := range conns {
+			conn.Flush()
+			require.NoError(tb, server.RemoveUser(ctx, userID, false))
+		}
+
+		// Expect the server to shut down successfully when closed.
+		require.NoError(tb, server.Close(ctx))
 	}
 
-	// Expect the server to shut down successfully when closed.
-	require.NoError(tb, server.Close(ctx))
 	require.NoError(tb, <-server.GetErrorCh())
-	require.NoError(tb, listener.Close())
+
+	// Draining the server closed the listener already.
+	if session.drained {
+		require.ErrorIs(tb, listener.Close(), net.ErrClosed)
+	} else {
+		require.NoError(tb, listener.Close())
+	}
 }
 
 func withConnections(tb testing.TB, s *testSession, connIDs []int, tests func(map[int]*testConnection)) {
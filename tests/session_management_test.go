@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/gluon"
+	"github.com/ProtonMail/gluon/events"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListSessions(t *testing.T) {
+	runTest(t, defaultServerOptions(t), []int{1, 2}, func(c map[int]*testConnection, s *testSession) {
+		c[1].C("A001 login user pass").OK("A001")
+		c[1].C("A002 select INBOX").OK("A002")
+
+		c[2].C(`B001 ID ("name" "client")`).OK("B001")
+		c[2].C("B002 login user pass").OK("B002")
+		c[2].C("B003 select INBOX").OK("B003")
+		c[2].C("B004 unselect").OK("B004")
+		c[2].C("B005 IDLE").S("+ Ready")
+
+		sessions := s.server.ListSessions()
+		require.Len(t, sessions, 2)
+		require.Less(t, sessions[0].SessionID, sessions[1].SessionID)
+
+		for _, info := range sessions {
+			require.Equal(t, s.userIDs["user"], info.UserID)
+			require.NotNil(t, info.RemoteAddr)
+			require.False(t, info.ConnectedAt.IsZero())
+			require.Positive(t, info.BytesIn)
+			require.Positive(t, info.BytesOut)
+		}
+
+		require.Equal(t, "INBOX", sessions[0].Mailbox)
+		require.Empty(t, sessions[0].Command)
+
+		require.Empty(t, sessions[1].Mailbox)
+		require.Equal(t, "client", sessions[1].IMAPID.Name)
+		require.Contains(t, sessions[1].Command, "IDLE")
+
+		c[2].C("DONE").OK("B005")
+	})
+}
+
+func TestDisconnectSession(t *testing.T) {
+	runTest(t, defaultServerOptions(t), []int{1, 2}, func(c map[int]*testConnection, s *testSession) {
+		c[1].C("A001 login user pass").OK("A001")
+		c[2].C("B001 login user pass").OK("B001")
+		c[2].C("B002 select INBOX").OK("B002")
+		c[2].C("B003 IDLE").S("+ Ready")
+
+		sessions := s.server.ListSessions()
+		require.Len(t, sessions, 2)
+
+		require.ErrorIs(t, s.server.DisconnectSession(-1, "Maintenance"), gluon.ErrNoSuchSession)
+
+		eventCh := s.server.AddWatcher(events.SessionRemoved{})
+
+		// Sessions are disconnected in IDLE too.
+		for i, info := range sessions {
+			require.NoError(t, s.server.DisconnectSession(info.SessionID, "Maintenance"))
+
+			c[i+1].S("* BYE Maintenance")
+			c[i+1].expectClosed()
+
+			requireSessionRemoved(t, eventCh, events.SessionDisconnected)
+		}
+
+		require.Empty(t, s.server.ListSessions())
+	})
+}
+
+func TestDisconnectUser(t *testing.T) {
+	runTest(t, defaultServerOptions(t), []int{1, 2, 3}, func(c map[int]*testConnection, s *testSession) {
+		c[1].C("A001 login user pass").OK("A001")
+		c[2].C("B001 login user pass").OK("B001")
+
+		require.Equal(t, 2, s.server.DisconnectUser(s.userIDs["user"]))
+
+		for _, i := range []int{1, 2} {
+			c[i].S("* BYE Disconnected by the server")
+			c[i].expectClosed()
+		}
+
+		// Sessions of other users, or not logged in, stay connected.
+		c[3].C("C001 noop").OK("C001")
+		c[3].C("C002 login user pass").OK("C002")
+	})
+}
@@ -32,6 +32,7 @@ type Connector interface {
 	MailboxDeleted(imap.MailboxID) error
 	SetMailboxVisibility(imap.MailboxID, imap.MailboxVisibility)
 	RenameMailbox(id imap.MailboxID, newName []string) error
+	SetMailboxPermissions(id imap.MailboxID, perms imap.MailboxPermissions) error
 
 	SetAllowMessageCreateWithUnknownMailboxID(value bool)
 
@@ -46,6 +47,10 @@ type Connector interface {
 
 	UIDValidityBumped()
 
+	HealthChanged(imap.ConnectorHealth, string)
+
+	SetUsernames([]string)
+
 	GetLastRecordedIMAPID() imap.IMAPID
 
 	Sync(context.Context) error
@@ -53,6 +58,10 @@ type Connector interface {
 	Flush()
 
 	SetUpdatesAllowedToFail(bool)
+
+	WithUpdatesLost(func())
+
+	GetSnapshot() connector.Snapshot
 }
 
 type testSession struct {
@@ -66,6 +75,9 @@ type testSession struct {
 	conns       map[string]Connector
 	userDBPaths map[string]string
 	options     *serverOptions
+
+	// drained indicates whether the server was drained, which closed it.
+	drained bool
 }
 
 func newTestSession(
@@ -92,6 +104,13 @@ func newTestSession(
 	}
 }
 
+// drain drains the server, which closes it.
+func (s *testSession) drain(ctx context.Context) error {
+	s.drained = true
+
+	return s.server.Drain(ctx)
+}
+
 func (s *testSession) newConnection() *testConnection {
 	conn, err := net.Dial(s.listener.Addr().Network(), s.listener.Addr().String())
 	require.NoError(s.tb, err)
@@ -147,6 +166,12 @@ func (s *testSession) mailboxRenamed(user string, mboxID imap.MailboxID, newName
 	s.conns[s.userIDs[user]].Flush()
 }
 
+func (s *testSession) mailboxPermissionsUpdated(user string, mboxID imap.MailboxID, perms imap.MailboxPermissions) {
+	require.NoError(s.tb, s.conns[s.userIDs[user]].SetMailboxPermissions(mboxID, perms))
+
+	s.conns[s.userIDs[user]].Flush()
+}
+
 func (s *testSession) setAllowMessageCreateWithUnknownMailboxID(user string, value bool) {
 	s.conns[s.userIDs[user]].SetAllowMessageCreateWithUnknownMailboxID(value)
 }
@@ -213,6 +238,23 @@ func (s *testSession) mailboxCreatedCustom(user string, name []string, flags, pe
 	return mboxID
 }
 
+func (s *testSession) mailboxCreatedWithPermissions(user string, name []string, perms imap.MailboxPermissions) imap.MailboxID {
+	mboxID := imap.MailboxID(utils.NewRandomMailboxID())
+
+	require.NoError(s.tb, s.conns[s.userIDs[user]].MailboxCreated(imap.Mailbox{
+		ID:             mboxID,
+		Name:           name,
+		Flags:          defaultFlags,
+		PermanentFlags: defaultPermanentFlags,
+		Attributes:     defaultAttributes,
+		Permissions:    perms,
+	}))
+
+	s.conns[s.userIDs[user]].Flush()
+
+	return mboxID
+}
+
 func (s *testSession) messageCreatedWithMailboxes(user string, mailboxIDs []imap.MailboxID, literal []byte, internalDate time.Time, flags ...string) imap.MessageID {
 	messageID := imap.MessageID(utils.NewRandomMessageID())
 
@@ -365,6 +407,16 @@ func (s *testSession) uidValidityBumped(user string) {
 	s.conns[s.userIDs[user]].UIDValidityBumped()
 }
 
+func (s *testSession) healthChanged(user string, health imap.ConnectorHealth) {
+	s.conns[s.userIDs[user]].HealthChanged(health, "")
+	s.conns[s.userIDs[user]].Flush()
+}
+
+func (s *testSession) setUsernames(user string, usernames []string) {
+	s.conns[s.userIDs[user]].SetUsernames(usernames)
+	s.conns[s.userIDs[user]].Flush()
+}
+
 func (s *testSession) flush(user string) {
 	s.conns[s.userIDs[user]].Flush()
 }
@@ -373,6 +425,18 @@ func (s *testSession) setUpdatesAllowedToFail(user string, value bool) {
 	s.conns[s.userIDs[user]].SetUpdatesAllowedToFail(value)
 }
 
+func (s *testSession) withUpdatesLost(user string, fn func()) {
+	s.conns[s.userIDs[user]].WithUpdatesLost(fn)
+}
+
+func (s *testSession) resyncUser(user string) {
+	require.NoError(s.tb, s.server.ResyncUser(context.Background(), s.userIDs[user], s.conns[s.userIDs[user]].GetSnapshot()))
+}
+
+func (s *testSession) setSieveScript(user, script string) {
+	require.NoError(s.tb, s.server.SetUserSieveScript(context.Background(), s.userIDs[user], script))
+}
+
 func (s *testSession) removeAccount(t testing.TB, user string) string {
 	userID := s.userIDs[user]
 
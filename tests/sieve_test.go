@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/gluon/imap"
+	"github.com/stretchr/testify/require"
+)
+
+const sieveInboxID = imap.MailboxID("0")
+
+func TestSieveFileInto(t *testing.T) {
+	runOneToOneTestWithAuth(t, defaultServerOptions(t), func(c *testConnection, s *testSession) {
+		s.mailboxCreated("user", []string{"Work"})
+
+		s.setSieveScript("user", `
+			require ["fileinto", "imap4flags"];
+
+			if address :domain "from" "work.example.com" {
+				fileinto "Work";
+				addflag "\\Flagged";
+			}
+		`)
+
+		s.messageCreated("user", sieveInboxID, []byte("From: boss@work.example.com\r\n\r\nhello"), time.Now())
+		s.messageCreated("user", sieveInboxID, []byte("From: friend@example.com\r\n\r\nhello"), time.Now())
+		s.flush("user")
+
+		c.C(`A001 STATUS INBOX (MESSAGES)`).S(`* STATUS "INBOX" (MESSAGES 1)`).OK(`A001`)
+		c.C(`A002 STATUS Work (MESSAGES)`).S(`* STATUS "Work" (MESSAGES 1)`).OK(`A002`)
+
+		c.C(`A003 SELECT Work`).OK(`A003`)
+		c.C(`A004 FETCH 1 (FLAGS)`).S(`* 1 FETCH (FLAGS (\Flagged \Recent))`).OK(`A004`)
+	})
+}
+
+func TestSieveForwarded(t *testing.T) {
+	runOneToOneTestWithAuth(t, defaultServerOptions(t), func(c *testConnection, s *testSession) {
+		s.setSieveScript("user", `require "imap4flags"; addflag "$Forwarded";`)
+
+		s.messageCreated("user", sieveInboxID, []byte("Subject: hello\r\n\r\nhello"), time.Now())
+		s.flush("user")
+
+		c.C(`A001 SELECT INBOX`).OK(`A001`)
+		c.C(`A002 FETCH 1 (FLAGS)`).S(`* 1 FETCH (FLAGS ($Forwarded Forwarded \Recent))`).OK(`A002`)
+	})
+}
+
+func TestSieveDiscard(t *testing.T) {
+	runOneToOneTestWithAuth(t, defaultServerOptions(t), func(c *testConnection, s *testSession) {
+		s.setSieveScript("user", `if header :contains "subject" "spam" { discard; }`)
+
+		s.messageCreated("user", sieveInboxID, []byte("Subject: buy spam now\r\n\r\nhello"), time.Now())
+		s.messageCreated("user", sieveInboxID, []byte("Subject: lunch\r\n\r\nhello"), time.Now())
+		s.flush("user")
+
+		c.C(`A001 STATUS INBOX (MESSAGES)`).S(`* STATUS "INBOX" (MESSAGES 1)`).OK(`A001`)
+	})
+}
+
+func TestSieveUnknownMailboxKeeps(t *testing.T) {
+	runOneToOneTestWithAuth(t, defaultServerOptions(t), func(c *testConnection, s *testSession) {
+		s.setSieveScript("user", `require "fileinto"; fileinto "Missing";`)
+
+		s.messageCreated("user", sieveInboxID, []byte("Subject: hello\r\n\r\nhello"), time.Now())
+		s.flush("user")
+
+		c.C(`A001 STATUS INBOX (MESSAGES)`).S(`* STATUS "INBOX" (MESSAGES 1)`).OK(`A001`)
+	})
+}
+
+func TestSieveScript(t *testing.T) {
+	runOneToOneTestWithAuth(t, defaultServerOptions(t), func(c *testConnection, s *testSession) {
+		ctx := context.Background()
+		userID := s.userIDs["user"]
+
+		script, err := s.server.GetUserSieveScript(ctx, userID)
+		require.NoError(t, err)
+		require.Empty(t, script)
+
+		// Invalid scripts are rejected and leave the current script in place.
+		require.NoError(t, s.server.SetUserSieveScript(ctx, userID, `keep;`))
+		require.Error(t, s.server.SetUserSieveScript(ctx, userID, `redirect "a@b.c";`))
+
+		// Flags the connector can't store would be lost on the next resync.
+		require.Error(t, s.server.SetUserSieveScript(ctx, userID, `require "imap4flags"; addflag "$Work";`))
+		require.Error(t, s.server.SetUserSieveScript(ctx, userID, `require "imap4flags"; addflag "\Answered";`))
+
+		script, err = s.server.GetUserSieveScript(ctx, userID)
+		require.NoError(t, err)
+		require.Equal(t, `keep;`, script)
+
+		require.Error(t, s.server.SetUserSieveScript(ctx, "no-such-user", `keep;`))
+	})
+}
@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreBudget(t *testing.T) {
+	const budget = 16 * 1024
+
+	runOneToOneTestWithAuth(t, defaultServerOptions(t, withStoreBudget(budget)), func(c *testConnection, s *testSession) {
+		ctx, userID := context.Background(), s.userIDs["user"]
+
+		mboxID := s.mailboxCreated("user", []string{"mbox"})
+
+		bodies := make([]string, 20)
+
+		for i := range bodies {
+			b := make([]byte, 1024)
+			_, err := rand.Read(b)
+			require.NoError(t, err)
+
+			bodies[i] = hex.EncodeToString(b)
+
+			s.messageCreated("user", mboxID, []byte(buildRFC5322TestLiteral("To: 1@pm.me\r\n\r\n"+bodies[i])), time.Now())
+		}
+
+		s.flush("user")
+
+		size, err := s.server.GetUserStoreSize(ctx, userID)
+		require.NoError(t, err)
+		require.Greater(t, size, int64(budget))
+
+		require.NoError(t, s.server.EvictUserStore(ctx, userID))
+
+		size, err = s.server.GetUserStoreSize(ctx, userID)
+		require.NoError(t, err)
+		require.LessOrEqual(t, size, int64(budget))
+
+		// Evicted literals aren't reported as missing.
+		report, err := s.server.CheckUser(ctx, userID, false)
+		require.NoError(t, err)
+		require.Equal(t, len(bodies), report.Messages)
+		require.Empty(t, report.Problems)
+
+		// Evicted literals are fetched from the connector again.
+		c.C(`A001 SELECT mbox`).Se(`A001 OK [READ-WRITE] SELECT`)
+
+		for i, body := range bodies {
+			c.C(fmt.Sprintf(`A002 FETCH %v (BODY.PEEK[TEXT])`, i+1)).Sxe(body).OK(`A002`)
+		}
+
+		size, err = s.server.GetUserStoreSize(ctx, userID)
+		require.NoError(t, err)
+		require.Greater(t, size, int64(budget))
+	})
+}
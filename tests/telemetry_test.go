@@ -0,0 +1,132 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/gluon/telemetry"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slices"
+)
+
+func TestTelemetryFetch(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	defer func() { require.NoError(t, provider.Shutdown(context.Background())) }()
+
+	runOneToOneTest(t, defaultServerOptions(t, withTracerProvider(provider)), func(c *testConnection, s *testSession) {
+		literal := "Date: Mon, 02 Jan 2006 15:04:05 +0000\r\nFrom: sender@pm.me\r\nSubject: Hello\r\n\r\nHello"
+
+		c.C("A001 login user pass").OK("A001")
+		c.Cf("A002 append inbox {%v}", len(literal)).S("+ Ready")
+		c.C(literal).OK("A002")
+		c.C("A003 select inbox").OK("A003")
+		c.C("A004 fetch 1 (body.peek[])").Sxe("A004 OK")
+
+		fetch := waitForSpan(t, recorder, "imap.FETCH")
+		require.Contains(t, fetch.Attributes(), telemetry.CommandTagKey.String("A004"))
+		require.Contains(t, fetch.Attributes(), telemetry.UserIDKey.String(s.userIDs["user"]))
+		require.Contains(t, fetch.Attributes(), telemetry.MailboxMessagesKey.Int(1))
+		require.Contains(t, fetch.Attributes(), telemetry.MessageCountKey.Int(1))
+
+		// The time spent fetching is broken down into database transactions and store accesses.
+		require.NotEmpty(t, findDescendants(recorder, fetch, "db.read"))
+
+		get := findDescendants(recorder, fetch, "store.get")
+		require.Len(t, get, 1)
+
+		// The stored literal also holds the internal ID header.
+		attrs := attribute.NewSet(get[0].Attributes()...)
+
+		size, ok := attrs.Value(telemetry.MessageSizeKey)
+		require.True(t, ok)
+		require.Greater(t, size.AsInt64(), int64(len(literal)))
+	})
+}
+
+func TestTelemetryConnector(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	defer func() { require.NoError(t, provider.Shutdown(context.Background())) }()
+
+	runOneToOneTest(t, defaultServerOptions(t, withTracerProvider(provider)), func(c *testConnection, s *testSession) {
+		c.C("A001 login user pass").OK("A001")
+		c.C("A002 create mbox").OK("A002")
+		c.C("A003 select mbox").OK("A003")
+		c.C("A004 uid fetch 1:* (flags)").OK("A004")
+		c.C("A005 select nosuchbox").NO("A005")
+
+		create := waitForSpan(t, recorder, "imap.CREATE")
+		require.NotEmpty(t, findDescendants(recorder, create, "db.write"))
+		require.Len(t, findDescendants(recorder, create, "connector.CreateMailbox"), 1)
+
+		fetch := waitForSpan(t, recorder, "imap.UID FETCH")
+		require.Contains(t, fetch.Attributes(), telemetry.MailboxMessagesKey.Int(0))
+
+		// Failed commands are marked as such.
+		require.Equal(t, codes.Error, waitForSpanWithTag(t, recorder, "imap.SELECT", "A005").Status().Code)
+	})
+}
+
+// waitForSpan waits for a span with the given name to end; command spans end just after the command completes.
+func waitForSpan(t *testing.T, recorder *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	return waitForSpanWithTag(t, recorder, name, "")
+}
+
+// waitForSpanWithTag waits for the span of the command with the given tag, or of any command if the tag is empty.
+func waitForSpanWithTag(t *testing.T, recorder *tracetest.SpanRecorder, name, tag string) sdktrace.ReadOnlySpan {
+	var span sdktrace.ReadOnlySpan
+
+	require.Eventually(t, func() bool {
+		for _, ended := range recorder.Ended() {
+			if ended.Name() != name {
+				continue
+			}
+
+			if tag == "" || slices.Contains(ended.Attributes(), telemetry.CommandTagKey.String(tag)) {
+				span = ended
+				return true
+			}
+		}
+
+		return false
+	}, time.Second, 10*time.Millisecond)
+
+	return span
+}
+
+// findDescendants returns the ended spans with the given name which descend from the given span.
+func findDescendants(recorder *tracetest.SpanRecorder, ancestor sdktrace.ReadOnlySpan, name string) []sdktrace.ReadOnlySpan {
+	ended := recorder.Ended()
+
+	parents := make(map[oteltrace.SpanID]oteltrace.SpanID)
+
+	for _, span := range ended {
+		parents[span.SpanContext().SpanID()] = span.Parent().SpanID()
+	}
+
+	var res []sdktrace.ReadOnlySpan
+
+	for _, span := range ended {
+		if span.Name() != name {
+			continue
+		}
+
+		for id, ok := span.Parent().SpanID(), true; ok; id, ok = parents[id] {
+			if id == ancestor.SpanContext().SpanID() {
+				res = append(res, span)
+				break
+			}
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/gluon/events"
+	"github.com/ProtonMail/gluon/limits"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreAuthTimeout(t *testing.T) {
+	timeouts := limits.SessionTimeouts{PreAuth: time.Second}
+
+	runOneToOneTest(t, defaultServerOptions(t, withSessionTimeouts(timeouts)), func(c *testConnection, s *testSession) {
+		eventCh := s.server.AddWatcher(events.SessionRemoved{})
+
+		// Commands before logging in restart the timeout.
+		time.Sleep(timeouts.PreAuth / 2)
+		c.C("A001 NOOP").OK("A001")
+		time.Sleep(timeouts.PreAuth / 2)
+		c.C("A002 NOOP").OK("A002")
+
+		c.S(`* BYE Autologout; idle for too long.`)
+		c.expectClosed()
+
+		requireSessionRemoved(t, eventCh, events.SessionPreAuthTimeout)
+	})
+}
+
+func TestAutoLogout(t *testing.T) {
+	timeouts := limits.SessionTimeouts{PreAuth: time.Hour, AutoLogout: time.Second}
+
+	runOneToOneTestWithAuth(t, defaultServerOptions(t, withSessionTimeouts(timeouts)), func(c *testConnection, s *testSession) {
+		eventCh := s.server.AddWatcher(events.SessionRemoved{})
+
+		c.C("A001 SELECT INBOX").OK("A001")
+
+		c.S(`* BYE Autologout; idle for too long.`)
+		c.expectClosed()
+
+		requireSessionRemoved(t, eventCh, events.SessionAutoLogout)
+	})
+}
+
+func TestAutoLogoutWaitsForLiteral(t *testing.T) {
+	timeouts := limits.SessionTimeouts{PreAuth: time.Hour, AutoLogout: time.Second}
+
+	runOneToOneTestWithAuth(t, defaultServerOptions(t, withSessionTimeouts(timeouts)), func(c *testConnection, s *testSession) {
+		eventCh := s.server.AddWatcher(events.SessionRemoved{})
+
+		literal := []byte("Date: Mon, 02 Jan 2006 15:04:05 +0000\r\nFrom: sender@pm.me\r\nTo: user@pm.me\r\n\r\nHello")
+
+		// The literal is sent in parts, over longer than the timeout.
+		c.Cf("A001 APPEND INBOX {%v}", len(literal)).S("+ Ready")
+
+		for _, part := range [][]byte{literal[:20], literal[20:40]} {
+			_, err := c.conn.Write(part)
+			require.NoError(t, err)
+
+			time.Sleep(timeouts.AutoLogout * 2 / 3)
+		}
+
+		c.Cb(literal[40:]).OK("A001")
+
+		// The timeout restarts once the command completes.
+		c.S(`* BYE Autologout; idle for too long.`)
+		c.expectClosed()
+
+		requireSessionRemoved(t, eventCh, events.SessionAutoLogout)
+	})
+}
+
+func TestIdleTimeout(t *testing.T) {
+	timeouts := limits.SessionTimeouts{AutoLogout: time.Hour, Idle: 3 * time.Second, IdleKeepalive: time.Second}
+
+	runOneToOneTestWithAuth(t, defaultServerOptions(t, withSessionTimeouts(timeouts)), func(c *testConnection, s *testSession) {
+		eventCh := s.server.AddWatcher(events.SessionRemoved{})
+
+		c.C("A001 SELECT INBOX").OK("A001")
+
+		// Sessions in IDLE are kept alive until they stay too long.
+		c.C("A002 IDLE").S("+ Ready")
+		c.S(`* OK Still here`)
+		c.S(`* OK Still here`)
+		c.S(`* BYE Autologout; idle for too long.`)
+		c.expectClosed()
+
+		requireSessionRemoved(t, eventCh, events.SessionIdleTimeout)
+	})
+}
+
+func TestLogoutRemovedReason(t *testing.T) {
+	runOneToOneTestWithAuth(t, defaultServerOptions(t), func(c *testConnection, s *testSession) {
+		eventCh := s.server.AddWatcher(events.SessionRemoved{})
+
+		c.C("A001 LOGOUT")
+		c.S(`* BYE`)
+		c.OK("A001")
+
+		requireSessionRemoved(t, eventCh, events.SessionClosed)
+	})
+}
+
+func requireSessionRemoved(t *testing.T, eventCh <-chan events.Event, reason events.SessionRemovedReason) {
+	select {
+	case event := <-eventCh:
+		removed, ok := event.(events.SessionRemoved)
+		require.True(t, ok)
+		require.Equal(t, reason, removed.Reason)
+
+	case <-time.After(5 * time.Second):
+		t.Fatal("Session wasn't removed")
+	}
+}
@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ProtonMail/gluon/trace"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceRedacted(t *testing.T) {
+	sink := &testTraceSink{}
+
+	runOneToOneTest(t, defaultServerOptions(t, withTrace(sink, trace.RedactAll)), func(c *testConnection, s *testSession) {
+		literal := "Date: Mon, 02 Jan 2006 15:04:05 +0000\r\nFrom: sender@pm.me\r\nSubject: Secret plans\r\n\r\nHello"
+
+		c.C("A001 login user pass").OK("A001")
+		c.C("A002 select inbox").OK("A002")
+		c.Cf("A003 append inbox {%v}", len(literal)).S("+ Ready")
+		c.C(literal).OK("A003")
+		c.C("A004 fetch 1 (envelope body.peek[])").Sxe("A004 OK")
+		c.C(`A005 search from sender@pm.me subject "Secret plans"`).Sxe("A005 OK")
+
+		records := sink.getRecords()
+
+		// Nothing sensitive is traced.
+		for _, record := range records {
+			for _, secret := range []string{"pass", "sender@pm.me", "Secret", "Hello"} {
+				require.NotContains(t, record.Line, secret)
+			}
+		}
+
+		login := sink.find(trace.Outgoing, "A001")
+		require.Equal(t, "LOGIN", login.Command)
+		require.Equal(t, "OK", login.Status)
+		require.Positive(t, login.Duration)
+
+		// Records are attributed to the user once logged in.
+		require.Equal(t, s.userIDs["user"], sink.find(trace.Incoming, "A002").UserID)
+
+		fetch := sink.find(trace.Incoming, "A004")
+		require.Equal(t, "FETCH", fetch.Command)
+		require.Equal(t, "A004 fetch 1 (envelope body.peek[])", fetch.Line)
+	})
+}
+
+func TestTraceUnredacted(t *testing.T) {
+	sink := &testTraceSink{}
+
+	runOneToOneTest(t, defaultServerOptions(t, withTrace(sink, 0)), func(c *testConnection, s *testSession) {
+		c.C("A001 login user pass").OK("A001")
+		c.C("A002 bad").BAD("A002")
+
+		require.Equal(t, "A001 login user pass", sink.find(trace.Incoming, "A001").Line)
+		require.Equal(t, "BAD", sink.find(trace.Outgoing, "A002").Status)
+	})
+}
+
+// testTraceSink collects trace records.
+type testTraceSink struct {
+	records []trace.Record
+	lock    sync.Mutex
+}
+
+func (s *testTraceSink) Trace(record trace.Record) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.records = append(s.records, record)
+}
+
+func (s *testTraceSink) getRecords() []trace.Record {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]trace.Record{}, s.records...)
+}
+
+// find returns the first record with the given direction and tag.
+func (s *testTraceSink) find(direction trace.Direction, tag string) trace.Record {
+	for _, record := range s.getRecords() {
+		if record.Direction == direction && strings.EqualFold(record.Tag, tag) {
+			return record
+		}
+	}
+
+	panic("no such trace record")
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ProtonMail/gluon"
+	"github.com/ProtonMail/gluon/connector"
+	"github.com/ProtonMail/gluon/imap"
+)
+
+var (
+	dataDir    = flag.String("data-dir", "", "Gluon data directory")
+	dbDir      = flag.String("db-dir", "", "Gluon database directory (defaults to the data directory)")
+	userID     = flag.String("user-id", "", "ID of the user to check")
+	passphrase = flag.String("passphrase", "", "Passphrase of the user's message store (or set GLUON_PASSPHRASE)")
+	encrypted  = flag.Bool("encrypted-db", false, "The database is encrypted with the passphrase")
+	repair     = flag.Bool("repair", false, "Repair the problems which can be fixed locally")
+	jsonOutput = flag.Bool("json", false, "Print the report as JSON")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Printf("Usage %v [options]\n", os.Args[0])
+		fmt.Printf("\nChecks a user's database and message store for inconsistencies.")
+		fmt.Printf("\nThe user must not be in use by a running server.\n")
+		fmt.Printf("\nOptions:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *dataDir == "" || *userID == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *dbDir == "" {
+		*dbDir = *dataDir
+	}
+
+	if *passphrase == "" {
+		*passphrase = os.Getenv("GLUON_PASSPHRASE")
+	}
+
+	ctx := context.Background()
+
+	options := []gluon.Option{gluon.WithDataDir(*dataDir), gluon.WithDatabaseDir(*dbDir)}
+
+	if *encrypted {
+		options = append(options, gluon.WithEncryptedDB())
+	}
+
+	server, err := gluon.New(options...)
+	if err != nil {
+		panic(fmt.Errorf("failed to create server: %w", err))
+	}
+
+	// The user is only loaded to check it; the connector never has anything to sync.
+	conn := connector.NewDummy(nil, nil, time.Hour, imap.NewFlagSet(), imap.NewFlagSet(), imap.NewFlagSet())
+
+	isNew, err := server.LoadUser(ctx, conn, *userID, []byte(*passphrase))
+	if err != nil {
+		panic(fmt.Errorf("failed to load user: %w", err))
+	}
+
+	if isNew {
+		if err := server.RemoveUser(ctx, *userID, true); err != nil {
+			panic(fmt.Errorf("failed to remove user: %w", err))
+		}
+
+		panic(fmt.Errorf("no database found for user %v", *userID))
+	}
+
+	report, err := server.CheckUser(ctx, *userID, *repair)
+	if err != nil {
+		panic(fmt.Errorf("failed to check user: %w", err))
+	}
+
+	if err := server.Close(ctx); err != nil {
+		panic(fmt.Errorf("failed to close server: %w", err))
+	}
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+
+		if err := enc.Encode(report); err != nil {
+			panic(fmt.Errorf("failed to encode report: %w", err))
+		}
+	} else {
+		fmt.Printf("Checked %v mailboxes and %v messages of user %v\n", report.Mailboxes, report.Messages, report.UserID)
+
+		for _, problem := range report.Problems {
+			fmt.Println(problem)
+		}
+
+		fmt.Printf("%v problems found\n", len(report.Problems))
+	}
+
+	if !report.OK() {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ProtonMail/gluon/store"
+)
+
+var (
+	dataDir    = flag.String("data-dir", "", "Gluon data directory")
+	userID     = flag.String("user-id", "", "ID of the user whose store to migrate")
+	passphrase = flag.String("passphrase", "", "Passphrase of the user's message store (or set GLUON_PASSPHRASE)")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Printf("Usage %v [options]\n", os.Args[0])
+		fmt.Printf("\nMigrates a user's message store from a file per message to pack files.")
+		fmt.Printf("\nThe user must not be in use by a running server. An interrupted migration is finished by running it again.\n")
+		fmt.Printf("\nOptions:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *dataDir == "" || *userID == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *passphrase == "" {
+		*passphrase = os.Getenv("GLUON_PASSPHRASE")
+	}
+
+	if err := store.MigrateToPackStore(*dataDir, *userID, []byte(*passphrase)); err != nil {
+		panic(fmt.Errorf("failed to migrate store: %w", err))
+	}
+
+	st, err := new(store.PackStoreBuilder).New(*dataDir, *userID, []byte(*passphrase))
+	if err != nil {
+		panic(fmt.Errorf("failed to open packed store: %w", err))
+	}
+
+	ids, err := st.List()
+	if err != nil {
+		panic(fmt.Errorf("failed to list packed store: %w", err))
+	}
+
+	if err := st.Close(); err != nil {
+		panic(fmt.Errorf("failed to close packed store: %w", err))
+	}
+
+	fmt.Printf("Store of user %v holds %v literals in pack files\n", *userID, len(ids))
+}
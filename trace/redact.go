@@ -0,0 +1,256 @@
+package trace
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Redaction selects what is redacted from traced lines.
+type Redaction int
+
+const (
+	// RedactCredentials hides the arguments of LOGIN and AUTHENTICATE.
+	RedactCredentials Redaction = 1 << iota
+
+	// RedactLiterals hides the content of literals, such as message bodies and headers.
+	RedactLiterals
+
+	// RedactAddresses hides email addresses, including those of envelopes.
+	RedactAddresses
+
+	// RedactSubjects hides subjects, in envelopes, Subject headers and SUBJECT search keys.
+	RedactSubjects
+
+	// RedactAll hides everything which can be redacted.
+	RedactAll = RedactCredentials | RedactLiterals | RedactAddresses | RedactSubjects
+)
+
+// Placeholders replacing what is redacted.
+const (
+	redactedCredentials = "<CREDENTIALS>"
+	redactedAddresses   = "<ADDRESSES>"
+	redactedAddress     = "<ADDRESS>"
+	redactedSubject     = "<SUBJECT>"
+)
+
+var (
+	// addressRegexp matches email addresses.
+	addressRegexp = regexp.MustCompile(`[^\s"'<>()\[\],;:@]+@[^\s"'<>()\[\],;:@]+`)
+
+	// subjectHeaderRegexp matches Subject header fields, including folded lines.
+	subjectHeaderRegexp = regexp.MustCompile(`(?i)(^|\n)(subject:)[^\r\n]*(\r?\n[ \t][^\r\n]*)*`)
+
+	// subjectKeyRegexp matches the SUBJECT search key and the start of its argument.
+	subjectKeyRegexp = regexp.MustCompile(`(?i)\bSUBJECT `)
+
+	// envelopeRegexp matches the start of an envelope.
+	envelopeRegexp = regexp.MustCompile(`ENVELOPE \(`)
+
+	// literalRegexp matches the start of a literal.
+	literalRegexp = regexp.MustCompile(`~?\{(\d+)\+?\}\r\n`)
+)
+
+// Incoming redacts a line sent by a client with the given command, which may be empty if it couldn't be parsed.
+func (r Redaction) Incoming(tag, command, line string) string {
+	if r&RedactCredentials != 0 && (strings.EqualFold(command, "login") || strings.EqualFold(command, "authenticate")) {
+		return strings.TrimSpace(fmt.Sprintf("%v %v %v", tag, strings.ToUpper(command), redactedCredentials))
+	}
+
+	return r.redact(line)
+}
+
+// Outgoing redacts a line sent by the server.
+func (r Redaction) Outgoing(line string) string {
+	return r.redact(line)
+}
+
+func (r Redaction) redact(line string) string {
+	// Envelopes are redacted first as they may contain literals.
+	if r&(RedactAddresses|RedactSubjects) != 0 {
+		line = r.redactEnvelopes(line)
+	}
+
+	if r&RedactLiterals != 0 {
+		line = redactLiterals(line)
+	}
+
+	if r&RedactSubjects != 0 {
+		line = subjectHeaderRegexp.ReplaceAllString(line, "${1}${2} "+redactedSubject)
+		line = redactSubjectKeys(line)
+	}
+
+	if r&RedactAddresses != 0 {
+		line = addressRegexp.ReplaceAllString(line, redactedAddress)
+	}
+
+	return line
+}
+
+// redactEnvelopes hides the subject and address fields of the envelopes in the given line.
+func (r Redaction) redactEnvelopes(line string) string {
+	var b strings.Builder
+
+	for {
+		loc := envelopeRegexp.FindStringIndex(line)
+		if loc == nil {
+			break
+		}
+
+		b.WriteString(line[:loc[1]])
+		line = line[loc[1]:]
+
+		// The fields are the date, subject, from, sender, reply-to, to, cc, bcc, in-reply-to and message-id.
+		for field := 0; field < 10; field++ {
+			if field > 0 {
+				if !strings.HasPrefix(line, " ") {
+					break
+				}
+
+				b.WriteByte(' ')
+				line = line[1:]
+			}
+
+			end := scanToken(line)
+			if end < 0 {
+				break
+			}
+
+			switch {
+			case field == 1 && r&RedactSubjects != 0:
+				b.WriteString(redactedSubject)
+
+			case field >= 2 && field <= 7 && r&RedactAddresses != 0 && line[:end] != "NIL":
+				b.WriteString(redactedAddresses)
+
+			default:
+				b.WriteString(line[:end])
+			}
+
+			line = line[end:]
+		}
+	}
+
+	b.WriteString(line)
+
+	return b.String()
+}
+
+// redactLiterals replaces the content of literals with their size.
+func redactLiterals(line string) string {
+	var b strings.Builder
+
+	for {
+		loc := literalRegexp.FindStringSubmatchIndex(line)
+		if loc == nil {
+			break
+		}
+
+		size, err := strconv.Atoi(line[loc[2]:loc[3]])
+		if err != nil || loc[1]+size > len(line) {
+			break
+		}
+
+		b.WriteString(line[:loc[1]])
+		b.WriteString(fmt.Sprintf("<%v bytes>", size))
+		line = line[loc[1]+size:]
+	}
+
+	b.WriteString(line)
+
+	return b.String()
+}
+
+// redactSubjectKeys hides the arguments of SUBJECT search keys.
+func redactSubjectKeys(line string) string {
+	var b strings.Builder
+
+	for {
+		loc := subjectKeyRegexp.FindStringIndex(line)
+		if loc == nil {
+			break
+		}
+
+		b.WriteString(line[:loc[1]])
+		line = line[loc[1]:]
+
+		if end := scanToken(line); end > 0 {
+			b.WriteString(redactedSubject)
+			line = line[end:]
+		}
+	}
+
+	b.WriteString(line)
+
+	return b.String()
+}
+
+// scanToken returns the length of the string, literal, NIL, atom or parenthesized list at the start of the given
+// line, or -1 if there is none.
+func scanToken(line string) int {
+	if line == "" {
+		return -1
+	}
+
+	switch line[0] {
+	case '"':
+		for i := 1; i < len(line); i++ {
+			switch line[i] {
+			case '\\':
+				i++
+
+			case '"':
+				return i + 1
+			}
+		}
+
+		return -1
+
+	case '~', '{':
+		loc := literalRegexp.FindStringSubmatchIndex(line)
+		if loc == nil || loc[0] != 0 {
+			return -1
+		}
+
+		size, err := strconv.Atoi(line[loc[2]:loc[3]])
+		if err != nil || loc[1]+size > len(line) {
+			return -1
+		}
+
+		return loc[1] + size
+
+	case '(':
+		for i := 1; i < len(line); {
+			if line[i] == ')' {
+				return i + 1
+			}
+
+			if line[i] == ' ' {
+				i++
+				continue
+			}
+
+			n := scanToken(line[i:])
+			if n < 0 {
+				return -1
+			}
+
+			i += n
+		}
+
+		return -1
+
+	default:
+		end := strings.IndexAny(line, " ()\r\n")
+		if end < 0 {
+			return len(line)
+		}
+
+		if end == 0 {
+			return -1
+		}
+
+		return end
+	}
+}
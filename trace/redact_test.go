@@ -0,0 +1,115 @@
+package trace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactIncoming(t *testing.T) {
+	tests := []struct {
+		name      string
+		redaction Redaction
+		command   string
+		line      string
+		want      string
+	}{
+		{
+			name:      "login",
+			redaction: RedactCredentials,
+			command:   "login",
+			line:      "A001 LOGIN user pass",
+			want:      "A001 LOGIN <CREDENTIALS>",
+		},
+		{
+			name:      "login literal",
+			redaction: RedactCredentials,
+			command:   "login",
+			line:      "A001 LOGIN user {4}\r\npass",
+			want:      "A001 LOGIN <CREDENTIALS>",
+		},
+		{
+			name:      "login kept",
+			redaction: RedactLiterals,
+			command:   "login",
+			line:      "A001 LOGIN user pass",
+			want:      "A001 LOGIN user pass",
+		},
+		{
+			name:      "append",
+			redaction: RedactLiterals,
+			command:   "append",
+			line:      "A001 APPEND INBOX {11}\r\nhello world",
+			want:      "A001 APPEND INBOX {11}\r\n<11 bytes>",
+		},
+		{
+			name:      "search",
+			redaction: RedactAddresses | RedactSubjects,
+			command:   "search",
+			line:      `A001 SEARCH FROM user@example.com SUBJECT "hello \"world\"" UNSEEN`,
+			want:      `A001 SEARCH FROM <ADDRESS> SUBJECT <SUBJECT> UNSEEN`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, tc.redaction.Incoming("A001", tc.command, tc.line))
+		})
+	}
+}
+
+func TestRedactOutgoing(t *testing.T) {
+	envelope := `* 1 FETCH (UID 1 ENVELOPE ("Mon, 02 Jan 2006 15:04:05 +0000" "Secret plans" (("Alice" NIL "alice" "example.com")) ` +
+		`(("Alice" NIL "alice" "example.com")) NIL (("Bob" NIL "bob" "example.com")) NIL NIL NIL "<id@example.com>"))`
+
+	tests := []struct {
+		name      string
+		redaction Redaction
+		line      string
+		want      string
+	}{
+		{
+			name:      "envelope",
+			redaction: RedactAll,
+			line:      envelope,
+			want:      `* 1 FETCH (UID 1 ENVELOPE ("Mon, 02 Jan 2006 15:04:05 +0000" <SUBJECT> <ADDRESSES> <ADDRESSES> NIL <ADDRESSES> NIL NIL NIL "<<ADDRESS>>"))`,
+		},
+		{
+			name:      "envelope subject only",
+			redaction: RedactSubjects,
+			line:      envelope,
+			want: `* 1 FETCH (UID 1 ENVELOPE ("Mon, 02 Jan 2006 15:04:05 +0000" <SUBJECT> (("Alice" NIL "alice" "example.com")) ` +
+				`(("Alice" NIL "alice" "example.com")) NIL (("Bob" NIL "bob" "example.com")) NIL NIL NIL "<id@example.com>"))`,
+		},
+		{
+			name:      "envelope literal subject",
+			redaction: RedactSubjects,
+			line:      `* 1 FETCH (ENVELOPE (NIL {5}` + "\r\n" + `hello NIL NIL NIL NIL NIL NIL NIL NIL))`,
+			want:      `* 1 FETCH (ENVELOPE (NIL <SUBJECT> NIL NIL NIL NIL NIL NIL NIL NIL))`,
+		},
+		{
+			name:      "body literal",
+			redaction: RedactLiterals,
+			line:      "* 1 FETCH (BODY[] {29}\r\nSubject: hi\r\nTo: a@b.c\r\n\r\nhey)",
+			want:      "* 1 FETCH (BODY[] {29}\r\n<29 bytes>)",
+		},
+		{
+			name:      "body headers",
+			redaction: RedactAddresses | RedactSubjects,
+			line:      "* 1 FETCH (BODY[] {29}\r\nSubject: hi\r\nTo: a@b.c\r\n\r\nhey)",
+			want:      "* 1 FETCH (BODY[] {29}\r\nSubject: <SUBJECT>\r\nTo: <ADDRESS>\r\n\r\nhey)",
+		},
+		{
+			name:      "nothing",
+			redaction: 0,
+			line:      envelope,
+			want:      envelope,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, tc.redaction.Outgoing(tc.line))
+		})
+	}
+}
@@ -0,0 +1,117 @@
+// Package trace records the IMAP traffic of sessions as structured records, with sensitive data redacted, so that
+// traces can be shared for support.
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Direction tells who sent a traced line.
+type Direction string
+
+const (
+	// Incoming lines are sent by clients.
+	Incoming Direction = "in"
+
+	// Outgoing lines are sent by the server.
+	Outgoing Direction = "out"
+)
+
+// Record describes a line exchanged with a client.
+type Record struct {
+	Time      time.Time
+	SessionID int
+
+	// UserID is the ID of the user the session is logged in to, if any.
+	UserID string
+
+	Direction Direction
+
+	// Tag is the tag of the command the line belongs to, if any.
+	Tag string
+
+	// Command is the name of the command the line belongs to, if known.
+	Command string
+
+	// Line is what was sent, redacted.
+	Line string
+
+	// Status is the status of responses, such as OK, NO, BAD or BYE.
+	Status string
+
+	// Duration is how long the command took, for the response completing it.
+	Duration time.Duration
+}
+
+// Sink receives the records of all sessions. It may be called concurrently.
+type Sink interface {
+	Trace(Record)
+}
+
+// NewJSONSink returns a sink writing records to the given writer as JSON lines.
+func NewJSONSink(w io.Writer) Sink {
+	return &jsonSink{w: w}
+}
+
+type jsonSink struct {
+	w    io.Writer
+	lock sync.Mutex
+}
+
+type jsonRecord struct {
+	Time       time.Time `json:"time"`
+	SessionID  int       `json:"session_id"`
+	UserID     string    `json:"user_id,omitempty"`
+	Direction  Direction `json:"direction"`
+	Tag        string    `json:"tag,omitempty"`
+	Command    string    `json:"command,omitempty"`
+	Line       string    `json:"line"`
+	Status     string    `json:"status,omitempty"`
+	DurationMS *float64  `json:"duration_ms,omitempty"`
+}
+
+func (s *jsonSink) Trace(record Record) {
+	var buf bytes.Buffer
+
+	// Redaction placeholders such as <SUBJECT> are kept readable.
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+
+	if err := enc.Encode(toJSONRecord(record)); err != nil {
+		logrus.WithError(err).Warn("Failed to encode trace record")
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, err := s.w.Write(buf.Bytes()); err != nil {
+		logrus.WithError(err).Warn("Failed to write trace record")
+	}
+}
+
+func toJSONRecord(record Record) jsonRecord {
+	res := jsonRecord{
+		Time:      record.Time,
+		SessionID: record.SessionID,
+		UserID:    record.UserID,
+		Direction: record.Direction,
+		Tag:       record.Tag,
+		Command:   record.Command,
+		Line:      record.Line,
+		Status:    record.Status,
+	}
+
+	if record.Duration > 0 {
+		ms := float64(record.Duration) / float64(time.Millisecond)
+		res.DurationMS = &ms
+	}
+
+	return res
+}
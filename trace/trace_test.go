@@ -0,0 +1,26 @@
+package trace
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONSink(t *testing.T) {
+	var buf bytes.Buffer
+
+	sink := NewJSONSink(&buf)
+
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	sink.Trace(Record{Time: now, SessionID: 1, Direction: Incoming, Tag: "A001", Command: "LOGIN", Line: "A001 LOGIN <CREDENTIALS>"})
+	sink.Trace(Record{Time: now, SessionID: 1, UserID: "user", Direction: Outgoing, Tag: "A001", Command: "LOGIN", Line: "A001 OK", Status: "OK", Duration: 1500 * time.Microsecond})
+
+	require.Equal(t,
+		`{"time":"2023-01-02T03:04:05Z","session_id":1,"direction":"in","tag":"A001","command":"LOGIN","line":"A001 LOGIN <CREDENTIALS>"}`+"\n"+
+			`{"time":"2023-01-02T03:04:05Z","session_id":1,"user_id":"user","direction":"out","tag":"A001","command":"LOGIN","line":"A001 OK","status":"OK","duration_ms":1.5}`+"\n",
+		buf.String(),
+	)
+}